@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// DefaultAdminAddr 是管理接口默认的监听地址，只监听本地
+const DefaultAdminAddr = "127.0.0.1:9003"
+
+// runCircuits 打印正在运行的 relay 上所有的 circuit，-stats 打印累计的统计
+func runCircuits(args []string) error {
+	fs := flag.NewFlagSet("circuits", flag.ExitOnError)
+	admin := fs.String("admin", DefaultAdminAddr, "admin address of the running relay")
+	stats := fs.Bool("stats", false, "print the accumulated stats instead")
+	fs.Parse(args)
+
+	path := "/circuits"
+	if *stats {
+		path = "/stats"
+	}
+	resp, err := http.Get("http://" + *admin + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return adminError(resp)
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// runKill 关闭正在运行的 relay 上的一个 circuit
+func runKill(args []string) error {
+	fs := flag.NewFlagSet("kill", flag.ExitOnError)
+	admin := fs.String("admin", DefaultAdminAddr, "admin address of the running relay")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: relay kill [-admin addr] <circuit id>")
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid circuit id %q", fs.Arg(0))
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/circuits/%d", *admin, id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return adminError(resp)
+	}
+	fmt.Printf("killed circuit %d \n", id)
+	return nil
+}
+
+func adminError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("%s: %s", resp.Status, body)
+}
@@ -5,26 +5,26 @@ import (
 	"flag"
 	"fmt"
 	"log"
-
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	identity "github.com/czh0526/libp2p/p2p/identity"
+	relay "github.com/czh0526/libp2p/p2p/relay"
+	noise "github.com/czh0526/libp2p/security/noise"
+	libp2ptls "github.com/czh0526/libp2p/security/tls"
 	ipfslog "github.com/ipfs/go-log"
-	security "github.com/libp2p/go-conn-security"
-	csms "github.com/libp2p/go-conn-security-multistream"
-	insecure "github.com/libp2p/go-conn-security/insecure"
+	libp2p "github.com/libp2p/go-libp2p"
 	circuit "github.com/libp2p/go-libp2p-circuit"
-	crypto "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
-	pstoremem "github.com/libp2p/go-libp2p-peerstore/pstoremem"
-	swrm "github.com/libp2p/go-libp2p-swarm"
-	transport "github.com/libp2p/go-libp2p-transport"
-	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
-	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
-	mux "github.com/libp2p/go-stream-muxer"
+	secio "github.com/libp2p/go-libp2p-secio"
 	tcp "github.com/libp2p/go-tcp-transport"
 	ws "github.com/libp2p/go-ws-transport"
-	ma "github.com/multiformats/go-multiaddr"
 	logging "github.com/whyrusleeping/go-logging"
 	mplex "github.com/whyrusleeping/go-smux-multiplex"
-	msmux "github.com/whyrusleeping/go-smux-multistream"
 	yamux "github.com/whyrusleeping/go-smux-yamux"
 )
 
@@ -33,74 +33,113 @@ func init() {
 	ipfslog.SetLogLevel("net/identify", "DEBUG")
 }
 
-func main() {
-	port := flag.Int("l", 9001, "Relay TCP listen port")
-	wsport := flag.Int("ws", 9002, "Relay WS listen port")
-	flag.Parse()
+// peerList 是可以重复出现、也可以用逗号分隔的 peer ID 参数
+type peerList []peer.ID
 
-	ip4addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port))
-	if err != nil {
-		log.Fatal(err)
+func (pl *peerList) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		id, err := peer.IDB58Decode(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid peer id %q: %s", s, err)
+		}
+		*pl = append(*pl, id)
 	}
+	return nil
+}
 
-	ip6addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip6/::/tcp/%d", *port))
-	if err != nil {
-		log.Fatal(err)
+func (pl *peerList) String() string {
+	strs := make([]string, len(*pl))
+	for i, id := range *pl {
+		strs[i] = id.Pretty()
 	}
+	return strings.Join(strs, ",")
+}
 
-	wsaddr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", *wsport))
-	if err != nil {
-		log.Fatal(err)
+// securityOptions 把逗号分隔的加密协议名转换成 libp2p 的 Option，排在前面的优先
+func securityOptions(names string) ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "secio":
+			opts = append(opts, libp2p.Security(secio.ID, secio.New))
+		case "noise":
+			opts = append(opts, libp2p.Security(noise.ID, noise.New))
+		case "tls":
+			opts = append(opts, libp2p.Security(libp2ptls.ID, libp2ptls.New))
+		default:
+			return nil, fmt.Errorf("unknown security %q, use secio, noise or tls", name)
+		}
 	}
+	return opts, nil
+}
 
-	privKey, pubKey, err := crypto.GenerateKeyPair(crypto.ECDSA, 2048)
-	if err != nil {
-		log.Fatal(err)
+func main() {
+	// 管理正在运行的 relay 的子命令
+	commands := map[string]func([]string) error{
+		"circuits": runCircuits,
+		"kill":     runKill,
 	}
-
-	id, err := peer.IDFromPrivateKey(privKey)
-	if err != nil {
-		log.Fatal(err)
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	peerstore := pstoremem.NewPeerstore()
-	peerstore.AddPrivKey(id, privKey)
-	peerstore.AddPubKey(id, pubKey)
-
-	ctx := context.Background()
-	swarm := swrm.NewSwarm(ctx, id, peerstore, nil)
-	host, err := bhost.NewHost(ctx, swarm, &bhost.HostOpts{})
-	if err != nil {
-		swarm.Close()
-		log.Fatal(err)
-	}
+	port := flag.Int("l", 9001, "Relay TCP listen port")
+	wsport := flag.Int("ws", 9002, "Relay WS listen port")
+	keyFile := flag.String("key", "relay.key", "identity file, created if missing")
+	security := flag.String("security", "secio,noise,tls", "comma separated security transports, in order of preference")
+	active := flag.Bool("active", false, "dial destination peers that are not connected to the relay")
+
+	var cfg relay.Config
+	flag.IntVar(&cfg.Limits.MaxCircuits, "max-circuits", 128, "max concurrent circuits, 0 for no limit")
+	flag.IntVar(&cfg.Limits.MaxCircuitsPerPeer, "max-circuits-per-peer", 8, "max concurrent circuits per source or destination peer, 0 for no limit")
+	flag.DurationVar(&cfg.Limits.MaxDuration, "max-duration", 10*time.Minute, "max lifetime of a circuit, 0 for no limit")
+	flag.Int64Var(&cfg.Limits.MaxBytes, "max-bytes", 0, "max bytes relayed in each direction of a circuit, 0 for no limit")
+	flag.Int64Var(&cfg.Limits.MaxRate, "max-rate", 0, "max bytes per second in each direction of a circuit, 0 for no limit")
+	flag.Var((*peerList)(&cfg.ACL.AllowSrc), "allow-src", "only relay from these peers (repeatable, comma separated)")
+	flag.Var((*peerList)(&cfg.ACL.DenySrc), "deny-src", "never relay from these peers (repeatable, comma separated)")
+	flag.Var((*peerList)(&cfg.ACL.AllowDst), "allow-dst", "only relay to these peers (repeatable, comma separated)")
+	flag.Var((*peerList)(&cfg.ACL.DenyDst), "deny-dst", "never relay to these peers (repeatable, comma separated)")
+	admin := flag.String("admin", DefaultAdminAddr, "listen address of the admin HTTP/Prometheus endpoint, empty to disable")
+	grace := flag.Duration("grace", 30*time.Second, "on SIGINT/SIGTERM, how long to wait for circuits to finish")
+	flag.Parse()
+	cfg.Active = *active
 
-	upgrader := new(tptu.Upgrader)
-	upgrader.Secure = makeInsecureTransport(id)
-	upgrader.Muxer, err = makeMuxer()
+	// relay 的 peer ID 在重启之后保持不变，客户端里配置的 relay 地址才不会失效
+	privKey, err := identity.Load(*keyFile)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("-key %s: %s", *keyFile, err)
 	}
-	tpts, err := makeTransports(upgrader)
+	secOpts, err := securityOptions(*security)
 	if err != nil {
-		swarm.Close()
 		log.Fatal(err)
 	}
-	for _, t := range tpts {
-		err = swarm.AddTransport(t)
-		if err != nil {
-			swarm.Close()
-			log.Fatal(err)
-		}
+
+	opts := []libp2p.Option{
+		libp2p.Identity(privKey),
+		libp2p.ListenAddrStrings(
+			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port),
+			fmt.Sprintf("/ip6/::/tcp/%d", *port),
+			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", *wsport),
+		),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Transport(ws.New),
+		libp2p.Muxer("/yamux/1.0.0", yamux.DefaultTransport),
+		libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
+		// 中继由 relay.Service 处理，不使用 go-libp2p-circuit 自带的 hop
+		libp2p.DisableRelay(),
 	}
-	swarm.AddListenAddr(ip4addr)
-	swarm.AddListenAddr(ip6addr)
-	swarm.AddListenAddr(wsaddr)
+	opts = append(opts, secOpts...)
 
-	err = circuit.AddRelayTransport(ctx, host, upgrader, circuit.OptHop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	host, err := libp2p.New(ctx, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	svc := relay.New(host, cfg)
 
 	fmt.Printf("Relay addresses: \n")
 	for _, addr := range host.Addrs() {
@@ -108,28 +147,34 @@ func main() {
 		if err == nil {
 			continue
 		}
-		fmt.Printf("%s/ipfs/%s\n", addr.String(), id.Pretty())
+		fmt.Printf("%s/ipfs/%s\n", addr.String(), host.ID().Pretty())
 	}
 
-	select {}
-}
-
-func makeInsecureTransport(id peer.ID) security.Transport {
-	secMuxer := new(csms.SSMuxer)
-	secMuxer.AddTransport(insecure.ID, insecure.New(id))
-	return secMuxer
-}
+	// 管理接口: JSON、Prometheus 指标和关闭 circuit
+	var adminSrv *http.Server
+	if *admin != "" {
+		adminSrv = &http.Server{Addr: *admin, Handler: svc.Handler()}
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		fmt.Printf("Admin endpoint: http://%s/circuits, /stats, /metrics \n", *admin)
+	}
 
-func makeMuxer() (mux.Transport, error) {
-	muxMuxer := msmux.NewBlankTransport()
-	muxMuxer.AddTransport("/yamux/1.0.0", yamux.DefaultTransport)
-	muxMuxer.AddTransport("/mplex/6.7.0", mplex.DefaultTransport)
-	return muxMuxer, nil
-}
+	// 收到 SIGINT/SIGTERM 后不再接受新的 circuit，最多等待 grace 让已有的 circuit 结束
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	fmt.Printf("received %s, waiting up to %s for %d circuits \n", sig, *grace, svc.NumCircuits())
 
-func makeTransports(upgrader *tptu.Upgrader) ([]transport.Transport, error) {
-	transports := make([]transport.Transport, 2)
-	transports[0] = tcp.NewTCPTransport(upgrader)
-	transports[1] = ws.New(upgrader)
-	return transports, nil
+	sctx, scancel := context.WithTimeout(ctx, *grace)
+	defer scancel()
+	if err := svc.Shutdown(sctx); err != nil {
+		fmt.Printf("closed remaining circuits: %s \n", err)
+	}
+	if adminSrv != nil {
+		adminSrv.Close()
+	}
+	host.Close()
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	host "github.com/libp2p/go-libp2p-host"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+/*
+ * 退出码按位组合，0 表示所有检查都通过:
+ *   1: 目标节点不能直连（没有给出直连地址时不检查）
+ *   2: 不能经过 relay 连接目标节点
+ *   4: 不能连接 relay
+ *  64: 参数错误
+ *  70: 检查本身没能进行（例如创建本地节点失败），和上面的检查结果区分开
+ */
+const (
+	exitOK               = 0
+	exitDirectFailed     = 1
+	exitRelayedFailed    = 2
+	exitRelayUnreachable = 4
+	exitUsage            = 64
+	exitError            = 70
+)
+
+type checkConfig struct {
+	relay, target pstore.PeerInfo
+	direct        bool
+	count         int   // 往返的次数
+	size          int   // 每次往返的字节数
+	bytes         int64 // 测吞吐量发送的字节数，0 表示不测
+	timeout       time.Duration
+}
+
+// pathReport 是一条路径（直连或经过 relay）的检查结果
+type pathReport struct {
+	Checked    bool    `json:"checked"`
+	OK         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+	RTTMin     float64 `json:"rtt_min_ms,omitempty"`
+	RTTAvg     float64 `json:"rtt_avg_ms,omitempty"`
+	RTTMax     float64 `json:"rtt_max_ms,omitempty"`
+	Throughput float64 `json:"throughput_bytes_per_sec,omitempty"`
+}
+
+type report struct {
+	Relay      string     `json:"relay"`
+	Target     string     `json:"target"`
+	RelayOK    bool       `json:"relay_ok"`
+	RelayError string     `json:"relay_error,omitempty"`
+	Direct     pathReport `json:"direct"`
+	Relayed    pathReport `json:"relayed"`
+	// 经过 relay 与直连之比，两条路径都检查通过时才有
+	RTTRatio        float64 `json:"rtt_ratio,omitempty"`
+	ThroughputRatio float64 `json:"throughput_ratio,omitempty"`
+	ExitCode        int     `json:"exit_code"`
+}
+
+// runCheck 检查目标节点的直连和经过 relay 的可达性，返回退出码
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	relayAddr := fs.String("relay", "", "multiaddr of the relay, with /ipfs/<id>")
+	target := fs.String("target", "", "multiaddr of the target, /ipfs/<id> alone skips the direct check")
+	direct := fs.Bool("direct", true, "also check direct reachability")
+	count := fs.Int("count", 5, "number of round trips")
+	size := fs.Int("size", 64, "bytes per round trip")
+	bytes := fs.Int64("bytes", 1<<20, "bytes to send for the throughput test, 0 to skip")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each connection and test")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Parse(args)
+
+	cfg := checkConfig{
+		direct:  *direct,
+		count:   *count,
+		size:    *size,
+		bytes:   *bytes,
+		timeout: *timeout,
+	}
+	rinfo, err := parsePeer(*relayAddr)
+	if err != nil {
+		fmt.Printf("-relay: %s \n", err)
+		return exitUsage
+	}
+	tinfo, err := parsePeer(*target)
+	if err != nil {
+		fmt.Printf("-target: %s \n", err)
+		return exitUsage
+	}
+	if cfg.count < 1 || cfg.size < 1 {
+		fmt.Printf("-count and -size must be positive \n")
+		return exitUsage
+	}
+	cfg.relay, cfg.target = *rinfo, *tinfo
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := libp2p.New(ctx, libp2p.NoListenAddrs, libp2p.DisableRelay())
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	defer h.Close()
+
+	rep, err := check(ctx, h, cfg)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	rep.Relay, rep.Target = *relayAddr, *target
+	if *asJSON {
+		out, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		rep.print()
+	}
+	return rep.ExitCode
+}
+
+// check 依次检查 relay、直连和经过 relay 的路径。h 上不能有其他的 circuit relay
+func check(ctx context.Context, h host.Host, cfg checkConfig) (*report, error) {
+	r, err := circuit.NewRelay(ctx, h, nil)
+	if err != nil {
+		return nil, err
+	}
+	rep := &report{}
+
+	cctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	err = h.Connect(cctx, cfg.relay)
+	cancel()
+	if err != nil {
+		rep.RelayError = err.Error()
+	} else {
+		rep.RelayOK = true
+	}
+
+	if cfg.direct && len(cfg.target.Addrs) > 0 {
+		h.Peerstore().AddAddrs(cfg.target.ID, cfg.target.Addrs, pstore.TempAddrTTL)
+		rep.Direct = checkPath(ctx, cfg, func(ctx context.Context) (conn, error) {
+			s, err := h.NewStream(ctx, cfg.target.ID, Proto)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		})
+	}
+	if rep.RelayOK {
+		rep.Relayed = checkPath(ctx, cfg, func(ctx context.Context) (conn, error) {
+			c, err := r.DialPeer(ctx, cfg.relay, pstore.PeerInfo{ID: cfg.target.ID})
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		})
+	} else {
+		rep.Relayed = pathReport{Checked: true, Error: "relay unreachable"}
+	}
+
+	if rep.Direct.OK && rep.Relayed.OK {
+		rep.RTTRatio = rep.Relayed.RTTAvg / rep.Direct.RTTAvg
+		if rep.Direct.Throughput > 0 {
+			rep.ThroughputRatio = rep.Relayed.Throughput / rep.Direct.Throughput
+		}
+	}
+
+	if !rep.RelayOK {
+		rep.ExitCode |= exitRelayUnreachable
+	}
+	if rep.Direct.Checked && !rep.Direct.OK {
+		rep.ExitCode |= exitDirectFailed
+	}
+	if !rep.Relayed.OK {
+		rep.ExitCode |= exitRelayedFailed
+	}
+	return rep, nil
+}
+
+// checkPath 在 dial 打开的连接上测量 RTT，在另一个连接上测量吞吐量
+func checkPath(ctx context.Context, cfg checkConfig, dial func(context.Context) (conn, error)) pathReport {
+	pr := pathReport{Checked: true}
+	open := func() (conn, error) {
+		dctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+		return dial(dctx)
+	}
+	fail := func(c io.Closer, err error) pathReport {
+		if c != nil {
+			c.Close()
+		}
+		pr.Error = err.Error()
+		return pr
+	}
+
+	c, err := open()
+	if err != nil {
+		return fail(nil, err)
+	}
+	rtts, err := measureRTT(c, cfg.count, cfg.size, cfg.timeout)
+	if err != nil {
+		return fail(c, err)
+	}
+	st := summarize(rtts)
+	pr.RTTMin, pr.RTTAvg, pr.RTTMax = millis(st.min), millis(st.avg), millis(st.max)
+
+	if cfg.bytes > 0 {
+		if c, err = open(); err != nil {
+			return fail(nil, err)
+		}
+		if pr.Throughput, err = measureThroughput(c, cfg.bytes, cfg.timeout); err != nil {
+			return fail(c, err)
+		}
+	}
+	pr.OK = true
+	return pr
+}
+
+func (rep *report) print() {
+	if rep.RelayOK {
+		fmt.Printf("relay    %s: ok \n", rep.Relay)
+	} else {
+		fmt.Printf("relay    %s: %s \n", rep.Relay, rep.RelayError)
+	}
+	rep.Direct.print("direct")
+	rep.Relayed.print("relayed")
+	if rep.RTTRatio > 0 {
+		fmt.Printf("relayed/direct: rtt x%.2f", rep.RTTRatio)
+		if rep.ThroughputRatio > 0 {
+			fmt.Printf(", throughput x%.2f", rep.ThroughputRatio)
+		}
+		fmt.Printf(" \n")
+	}
+}
+
+func (pr *pathReport) print(name string) {
+	switch {
+	case !pr.Checked:
+		fmt.Printf("%-8s skipped \n", name)
+	case !pr.OK:
+		fmt.Printf("%-8s FAILED: %s \n", name, pr.Error)
+	default:
+		fmt.Printf("%-8s ok, rtt min/avg/max = %.3f/%.3f/%.3f ms", name, pr.RTTMin, pr.RTTAvg, pr.RTTMax)
+		if pr.Throughput > 0 {
+			fmt.Printf(", %.2f MiB/s", pr.Throughput/(1<<20))
+		}
+		fmt.Printf(" \n")
+	}
+}
@@ -0,0 +1,57 @@
+// relaycheck 检查一个节点能否直连、能否经过 relay 连接，并比较两条路径的 RTT 和吞吐量。
+//
+//	relaycheck serve -relay <relay-addr>                       运行被检查的目标节点
+//	relaycheck check -relay <relay-addr> -target <target-addr> 检查目标节点，结果见退出码
+package main
+
+import (
+	"fmt"
+	"os"
+
+	ipfslog "github.com/ipfs/go-log"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	logging "github.com/whyrusleeping/go-logging"
+)
+
+func init() {
+	ipfslog.SetAllLoggers(logging.WARNING)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s serve|check [flags] \n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s serve -relay <relay-addr> \n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s check -relay <relay-addr> -target <target-addr> [-json] \n", os.Args[0])
+}
+
+// parsePeer 分析带 /ipfs/<id> 的 multiaddr
+func parsePeer(s string) (*pstore.PeerInfo, error) {
+	if s == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil, err
+	}
+	return pstore.InfoFromP2pAddr(addr)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	switch os.Args[1] {
+	case "serve":
+		if err := runServe(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "check":
+		os.Exit(runCheck(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(exitUsage)
+	}
+}
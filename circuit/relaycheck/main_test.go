@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	relay "github.com/czh0526/libp2p/p2p/relay"
+	tu "github.com/czh0526/libp2p/testutil"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+func info(h host.Host) pstore.PeerInfo {
+	return pstore.PeerInfo{ID: h.ID(), Addrs: h.Addrs()}
+}
+
+func runCheckOrFatal(t *testing.T, ctx context.Context, cfg checkConfig) *report {
+	h := tu.GenHost(t, ctx)
+	defer h.Close()
+	rep, err := check(ctx, h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+func TestCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rh := tu.GenHost(t, ctx)
+	defer rh.Close()
+	svc := relay.New(rh, relay.Config{})
+	// svc 下面会被替换，关闭最后的那个
+	defer func() {
+		svc.Close()
+	}()
+
+	target := tu.GenHost(t, ctx)
+	defer target.Close()
+	if err := startServer(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Connect(ctx, info(rh)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := checkConfig{
+		relay:   info(rh),
+		target:  info(target),
+		direct:  true,
+		count:   3,
+		size:    64,
+		bytes:   256 << 10,
+		timeout: 5 * time.Second,
+	}
+	rep := runCheckOrFatal(t, ctx, cfg)
+	if rep.ExitCode != exitOK || !rep.Direct.OK || !rep.Relayed.OK {
+		t.Fatalf("expected all checks to pass, got %+v", rep)
+	}
+	if rep.Relayed.RTTAvg <= 0 || rep.Relayed.Throughput <= 0 || rep.RTTRatio <= 0 {
+		t.Fatalf("expected measurements for the relayed path, got %+v", rep.Relayed)
+	}
+
+	// 只给出 peer ID 时不检查直连
+	cfg.target = pstore.PeerInfo{ID: target.ID()}
+	rep = runCheckOrFatal(t, ctx, cfg)
+	if rep.ExitCode != exitOK || rep.Direct.Checked {
+		t.Fatalf("expected the direct check to be skipped, got %+v", rep)
+	}
+
+	// relay 拒绝到目标节点的 circuit
+	svc.Close()
+	svc = relay.New(rh, relay.Config{ACL: relay.ACL{DenyDst: []peer.ID{target.ID()}}})
+	cfg.target = info(target)
+	rep = runCheckOrFatal(t, ctx, cfg)
+	if rep.ExitCode != exitRelayedFailed || !rep.Direct.OK {
+		t.Fatalf("expected only the relayed check to fail, got %+v", rep)
+	}
+
+	// relay 不可达，目标节点也不能直连
+	rh.Close()
+	target.Close()
+	cfg.timeout = time.Second
+	rep = runCheckOrFatal(t, ctx, cfg)
+	if rep.ExitCode != exitRelayUnreachable|exitRelayedFailed|exitDirectFailed {
+		t.Fatalf("expected everything to fail, got %+v", rep)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	identity "github.com/czh0526/libp2p/p2p/identity"
+	libp2p "github.com/libp2p/go-libp2p"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+// 检查与 relay 的连接的间隔，断开之后重新连接
+const relayKeepAlive = 10 * time.Second
+
+// runServe 运行被检查的目标节点: 同时接受直连的 stream 和经过 relay 的 circuit
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	relayAddr := fs.String("relay", "", "multiaddr of the relay to stay connected to, with /ipfs/<id>")
+	port := fs.Int("l", 0, "TCP listen port, 0 for a random port")
+	keyFile := fs.String("key", "", "identity file, created if missing; random identity if empty")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for connecting to the relay")
+	fs.Parse(args)
+
+	rinfo, err := parsePeer(*relayAddr)
+	if err != nil {
+		return fmt.Errorf("-relay: %s", err)
+	}
+
+	opts := []libp2p.Option{
+		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port)),
+		// circuit 由 startServer 处理
+		libp2p.DisableRelay(),
+	}
+	// 指定 -key 时目标节点的 peer ID 在重启之后保持不变，check 的 -target 不需要修改
+	if *keyFile != "" {
+		priv, err := identity.Load(*keyFile)
+		if err != nil {
+			return fmt.Errorf("-key %s: %s", *keyFile, err)
+		}
+		opts = append(opts, libp2p.Identity(priv))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := libp2p.New(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	if err := startServer(ctx, h); err != nil {
+		return err
+	}
+	go keepConnected(ctx, h, *rinfo, *timeout)
+
+	fmt.Printf("Direct addresses: \n")
+	for _, addr := range h.Addrs() {
+		fmt.Printf("%s/ipfs/%s \n", addr, h.ID().Pretty())
+	}
+	fmt.Printf("Now run \"relaycheck check -relay %s -target <direct address>\" \n", *relayAddr)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	return nil
+}
+
+// startServer 在 h 上处理直连的 stream 和 circuit 连接
+func startServer(ctx context.Context, h host.Host) error {
+	h.SetStreamHandler(Proto, func(s inet.Stream) {
+		if err := serveConn(s); err != nil {
+			fmt.Printf("direct %s: %s \n", s.Conn().RemotePeer().Pretty(), err)
+			s.Reset()
+		}
+	})
+
+	r, err := circuit.NewRelay(ctx, h, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		l := r.Listener()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if err := serveConn(c); err != nil {
+					fmt.Printf("relayed %s: %s \n", c.RemoteAddr(), err)
+					c.Close()
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+// keepConnected 保持与 relay 的连接，只有连着 relay 才能被经过它的 circuit 访问
+func keepConnected(ctx context.Context, h host.Host, relay pstore.PeerInfo, timeout time.Duration) {
+	ticker := time.NewTicker(relayKeepAlive)
+	defer ticker.Stop()
+	for {
+		if h.Network().Connectedness(relay.ID) != inet.Connected {
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			err := h.Connect(cctx, relay)
+			cancel()
+			if err != nil {
+				fmt.Printf("connect to relay %s: %s \n", relay.ID.Pretty(), err)
+			} else {
+				fmt.Printf("connected to relay %s \n", relay.ID.Pretty())
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
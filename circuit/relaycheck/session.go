@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+)
+
+/*
+ * 直连的 stream 和 circuit 连接上使用同一个协议，circuit 连接上没有 multistream，
+ * 由第一个字节选择操作:
+ *   'e': 原样返回收到的数据，直到对方关闭
+ *   'b': 丢弃收到的数据，对方关闭写之后返回字节数（8 字节大端）
+ */
+const Proto = "/relaycheck/1.0.0"
+
+const (
+	opEcho = 'e'
+	opBulk = 'b'
+)
+
+const bulkChunkSize = 64 << 10
+
+// conn 是直连的 inet.Stream 或者 circuit 连接
+type conn interface {
+	io.ReadWriteCloser
+	SetDeadline(time.Time) error
+}
+
+// serveConn 处理一个连接上的操作，出错时返回错误，由调用方重置连接
+func serveConn(c conn) error {
+	var op [1]byte
+	if _, err := io.ReadFull(c, op[:]); err != nil {
+		return err
+	}
+
+	switch op[0] {
+	case opEcho:
+		if _, err := io.Copy(c, c); err != nil {
+			return err
+		}
+	case opBulk:
+		n, err := io.Copy(ioutil.Discard, c)
+		if err != nil {
+			return err
+		}
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(n))
+		if _, err := c.Write(buf[:]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown op %q", op[0])
+	}
+	return c.Close()
+}
+
+// measureRTT 在连接上进行 count 次 size 字节的往返，任何一次出错都返回错误
+func measureRTT(c conn, count, size int, timeout time.Duration) ([]time.Duration, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	if _, err := c.Write([]byte{opEcho}); err != nil {
+		return nil, err
+	}
+
+	rtts := make([]time.Duration, 0, count)
+	payload := bytes.Repeat([]byte{'.'}, size)
+	reply := make([]byte, size)
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		if _, err := c.Write(payload); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(c, reply); err != nil {
+			return nil, err
+		}
+		rtts = append(rtts, time.Since(start))
+		if !bytes.Equal(reply, payload) {
+			return nil, fmt.Errorf("reply does not match request")
+		}
+	}
+	return rtts, c.Close()
+}
+
+// measureThroughput 发送 n 字节，以对方确认的字节数和用时计算吞吐量（字节/秒）
+func measureThroughput(c conn, n int64, timeout time.Duration) (float64, error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	if _, err := c.Write([]byte{opBulk}); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, bulkChunkSize)
+	start := time.Now()
+	for sent := int64(0); sent < n; {
+		chunk := buf
+		if n-sent < int64(len(chunk)) {
+			chunk = chunk[:n-sent]
+		}
+		k, err := c.Write(chunk)
+		if err != nil {
+			return 0, err
+		}
+		sent += int64(k)
+	}
+	if err := c.Close(); err != nil {
+		return 0, err
+	}
+
+	var ack [8]byte
+	if _, err := io.ReadFull(c, ack[:]); err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if got := int64(binary.BigEndian.Uint64(ack[:])); got != n {
+		return 0, fmt.Errorf("peer received %d of %d bytes", got, n)
+	}
+	return float64(n) / elapsed.Seconds(), nil
+}
+
+type rttStats struct {
+	min, avg, max time.Duration
+}
+
+func summarize(rtts []time.Duration) rttStats {
+	if len(rtts) == 0 {
+		return rttStats{}
+	}
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	return rttStats{
+		min: sorted[0],
+		avg: sum / time.Duration(len(sorted)),
+		max: sorted[len(sorted)-1],
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
@@ -0,0 +1,182 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	disc "github.com/libp2p/go-libp2p-discovery"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	relay "github.com/libp2p/go-libp2p/p2p/host/relay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+/*
+ * 代替 libp2p.EnableAutoRelay:
+ *   - 可达性只由 Chat 的 reachability.Tracker 判断，节点上只运行一个 AutoNAT 探测
+ *   - 不可达时连接 AddRelays 配置的 relay 和 DHT 中宣布的 relay，宣布经过它们的 /p2p-circuit 地址
+ *   - 可达或者未知时不宣布 relay 地址
+ */
+
+// 检查可达性和 relay 连接的间隔
+var AutoRelayInterval = 30 * time.Second
+
+// 不可达时使用的 relay 数
+var DesiredRelays = 3
+
+// AutoRelay 保存本节点宣布的 relay 地址。AddrsFactory 在构建 host 时使用，
+// Chat.StartAutoRelay 之后根据可达性更新
+type AutoRelay struct {
+	mu     sync.Mutex
+	relays []peer.ID
+	addrs  []ma.Multiaddr
+}
+
+func NewAutoRelay() *AutoRelay {
+	return &AutoRelay{}
+}
+
+// AddrsFactory 在 next 返回的地址之后加上 relay 地址，next 为 nil 时使用 host 的原始地址。
+// 例如 libp2p.AddrsFactory(ar.AddrsFactory(nil))
+func (ar *AutoRelay) AddrsFactory(next basichost.AddrsFactory) basichost.AddrsFactory {
+	if next == nil {
+		next = basichost.DefaultAddrsFactory
+	}
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		return append(next(addrs), ar.Addrs()...)
+	}
+}
+
+// Addrs 返回经过 relay 的地址，本节点可达时为空
+func (ar *AutoRelay) Addrs() []ma.Multiaddr {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return append([]ma.Multiaddr{}, ar.addrs...)
+}
+
+// Relays 返回正在使用的 relay
+func (ar *AutoRelay) Relays() []peer.ID {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return append([]peer.ID{}, ar.relays...)
+}
+
+// set 更新 relay 和地址，返回地址是否变化
+func (ar *AutoRelay) set(relays []peer.ID, addrs []ma.Multiaddr) bool {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	changed := len(addrs) != len(ar.addrs)
+	for i := 0; !changed && i < len(addrs); i++ {
+		changed = !addrs[i].Equal(ar.addrs[i])
+	}
+	ar.relays, ar.addrs = relays, addrs
+	return changed
+}
+
+// StartAutoRelay 在后台根据 Tracker 的结果更新 ar，直到 Chat 的 ctx 结束
+func (chat *Chat) StartAutoRelay(ar *AutoRelay) {
+	go func() {
+		ticker := time.NewTicker(AutoRelayInterval)
+		defer ticker.Stop()
+		for {
+			chat.updateRelays(chat.ctx, ar)
+			select {
+			case <-ticker.C:
+			case <-chat.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// updateRelays 不可达时保持与 DesiredRelays 个 relay 的连接并宣布经过它们的地址，其它状态时不使用 relay
+func (chat *Chat) updateRelays(ctx context.Context, ar *AutoRelay) {
+	var relays []peer.ID
+	if chat.reach.Status() == autonat.NATStatusPrivate {
+		// 保留仍然连接着的 relay
+		for _, p := range ar.Relays() {
+			if chat.host.Network().Connectedness(p) == inet.Connected {
+				relays = append(relays, p)
+			}
+		}
+		// relay 已经足够时不再查找，relayCandidates 会查询 DHT
+		var candidates []pstore.PeerInfo
+		if len(relays) < DesiredRelays {
+			candidates = chat.relayCandidates(ctx)
+		}
+		for _, pi := range candidates {
+			if len(relays) >= DesiredRelays {
+				break
+			}
+			if pi.ID == chat.host.ID() || containsPeer(relays, pi.ID) {
+				continue
+			}
+			cctx, cancel := context.WithTimeout(ctx, DirectDialTimeout)
+			err := chat.host.Connect(cctx, pi)
+			cancel()
+			if err != nil {
+				fmt.Printf("连接 relay <%s> 失败: %s \n", pi.ID.Pretty(), err)
+				continue
+			}
+			chat.host.ConnManager().TagPeer(pi.ID, "relay", 42)
+			relays = append(relays, pi.ID)
+		}
+	}
+
+	var addrs []ma.Multiaddr
+	for _, p := range relays {
+		circuit, err := ma.NewMultiaddr(fmt.Sprintf("/ipfs/%s/p2p-circuit", p.Pretty()))
+		if err != nil {
+			continue
+		}
+		direct, _ := splitAddrs(chat.host.Peerstore().Addrs(p))
+		for _, a := range direct {
+			addrs = append(addrs, a.Encapsulate(circuit))
+		}
+	}
+	if ar.set(relays, addrs) {
+		fmt.Printf("宣布 %d 个 relay 地址 \n", len(addrs))
+		// BasicHost 每分钟也会检查一次地址的变化
+		if ph, ok := chat.host.(interface{ PushIdentify() }); ok {
+			ph.PushIdentify()
+		}
+	}
+}
+
+// relayCandidates 返回可以使用的 relay: AddRelays 配置的在前，之后是 DHT 中宣布的
+func (chat *Chat) relayCandidates(ctx context.Context) []pstore.PeerInfo {
+	chat.mu.Lock()
+	configured := append([]peer.ID{}, chat.relays...)
+	chat.mu.Unlock()
+
+	var pis []pstore.PeerInfo
+	for _, p := range configured {
+		pis = append(pis, chat.host.Peerstore().PeerInfo(p))
+	}
+	if chat.dht == nil {
+		return pis
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	found, err := disc.FindPeers(ctx, chat.discovery, relay.RelayRendezvous, 100)
+	if err != nil {
+		fmt.Printf("查找 relay 失败: %s \n", err)
+		return pis
+	}
+	return append(pis, found...)
+}
+
+func containsPeer(peers []peer.ID, p peer.ID) bool {
+	for _, q := range peers {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
@@ -2,68 +2,139 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync"
 
 	chat_pb "github.com/czh0526/libp2p/client/chat/pb"
+	p2pdisc "github.com/czh0526/libp2p/p2p/discovery"
+	reachability "github.com/czh0526/libp2p/p2p/reachability"
 	"github.com/gogo/protobuf/proto"
 	discovery "github.com/libp2p/go-libp2p-discovery"
 	host "github.com/libp2p/go-libp2p-host"
-	kad_dht "github.com/libp2p/go-libp2p-kad-dht"
 	inet "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	protocol "github.com/libp2p/go-libp2p-protocol"
+	routing "github.com/libp2p/go-libp2p-routing"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 var PROTO_CHAT = "/chat/1.0.0"
 
+// 只在局域网中运行时没有 DHT，不能使用 group
+var ErrNoDHT = errors.New("chat: groups need the DHT, not available in LAN-only mode")
+
+// Routing 是 Chat 使用的路由，通常是 DHT，测试时可以使用 mockrouting
+type Routing interface {
+	routing.ContentRouting
+	routing.PeerRouting
+}
+
 type Chat struct {
-	groups           []string
-	friends          map[peer.ID]inet.Stream
-	host             host.Host
-	dht              *kad_dht.IpfsDHT
-	routingDiscovery *discovery.RoutingDiscovery
-	groupPeerChan    <-chan pstore.PeerInfo
+	ctx           context.Context
+	groups        []string
+	friends       map[peer.ID]inet.Stream
+	host          host.Host
+	dht           Routing
+	discovery     *p2pdisc.Discoverer // 发现 group 中的节点
+	groupPeerChan <-chan pstore.PeerInfo
+	reach         *reachability.Tracker
+	autonatSvc    *reachability.Service // 为其它节点提供的 AutoNAT 服务，没有启动时为 nil
+
+	mu        sync.Mutex
+	peers     map[peer.ID]*knownPeer // DHT 和 mDNS 发现的节点
+	relays    []peer.ID
+	upgrading map[peer.ID]chan struct{} // 经过 relay 的会话，正在尝试切换到直连
 }
 
+// New 构建 Chat，dht 为 nil 时只在局域网中通过 mDNS 发现节点
 func New(ctx context.Context,
 	groups []string,
 	host host.Host,
-	dht *kad_dht.IpfsDHT) *Chat {
-
-	// 构建 Discovery
-	routingDiscovery := discovery.NewRoutingDiscovery(dht)
-	for _, group := range groups {
-		// 并行宣布本节点的存在
-		discovery.Advertise(ctx, routingDiscovery, group)
+	dht Routing) *Chat {
+
+	// 构建 Discovery，mDNS 不区分 group，不作为它的后端
+	d := p2pdisc.New()
+	if dht != nil {
+		d.AddSource(p2pdisc.Source{
+			Name:       SourceDHT,
+			Discoverer: discovery.NewRoutingDiscovery(dht),
+		})
+		for _, group := range groups {
+			// 并行宣布本节点的存在
+			discovery.Advertise(ctx, d, group)
+		}
 	}
 
 	chat := &Chat{
-		groups:           groups,
-		friends:          make(map[peer.ID]inet.Stream),
-		host:             host,
-		dht:              dht,
-		routingDiscovery: routingDiscovery,
+		ctx:       ctx,
+		groups:    groups,
+		friends:   make(map[peer.ID]inet.Stream),
+		host:      host,
+		dht:       dht,
+		discovery: d,
+		peers:     make(map[peer.ID]*knownPeer),
+		upgrading: make(map[peer.ID]chan struct{}),
 	}
+	// 探测本节点是否可达，只使用直连地址
+	chat.reach = reachability.NewTracker(ctx, host, func() []ma.Multiaddr {
+		direct, _ := splitAddrs(host.Addrs())
+		return direct
+	}, reachability.Config{})
 
 	host.SetStreamHandler(protocol.ID(PROTO_CHAT), chat.handleChatStream)
+	host.Network().Notify((*netNotifiee)(chat))
 
 	return chat
 }
 
+// ChatWithPeer 连接 pid，先尝试直连，失败之后经过 relay 连接
 func (chat *Chat) ChatWithPeer(ctx context.Context, pid peer.ID) error {
+	if chat.host.Network().Connectedness(pid) == inet.Connected {
+		if chat.isRelayed(pid) {
+			chat.startUpgrade(pid)
+		}
+		return nil
+	}
+
 	fmt.Printf("获取 <%s> 的 Address \n", pid.Pretty())
-	pi, err := chat.dht.FindPeer(ctx, pid)
+	var pi pstore.PeerInfo
+	err := fmt.Errorf("no known address for <%s>", pid.Pretty())
+	if chat.dht != nil {
+		pi, err = chat.dht.FindPeer(ctx, pid)
+	}
 	if err != nil {
-		return err
+		// DHT 中找不到时，使用 peerstore 中 mDNS 发现的地址和 relay
+		pi = chat.host.Peerstore().PeerInfo(pid)
+		if len(pi.Addrs) == 0 && len(chat.relayAddrsFor(pid)) == 0 {
+			return err
+		}
 	}
 
-	fmt.Printf("根据 Address 建立连接 \n")
-	if err := chat.host.Connect(ctx, pi); err != nil {
-		return err
+	direct, relayed := splitAddrs(pi.Addrs)
+	derr := errNoDirectAddrs
+	if len(direct) > 0 {
+		fmt.Printf("根据 Address 建立连接 \n")
+		dctx, cancel := context.WithTimeout(ctx, DirectDialTimeout)
+		derr = chat.connect(dctx, pid, direct)
+		cancel()
+		if derr == nil {
+			return nil
+		}
+		fmt.Printf("直连失败: %s \n", derr)
 	}
 
+	relayed = append(relayed, chat.relayAddrsFor(pid)...)
+	if len(relayed) == 0 {
+		return derr
+	}
+	fmt.Printf("经过 relay 建立连接 \n")
+	if err := chat.connect(ctx, pid, relayed); err != nil {
+		return err
+	}
+	chat.startUpgrade(pid)
 	return nil
 }
 
@@ -107,13 +178,19 @@ func (chat *Chat) readMessage(stream inet.Stream) (string, error) {
 	}
 }
 
-func (chat *Chat) JoinGroup(ctx context.Context, groupName string) {
+// JoinGroup 在 DHT 中宣布本节点属于 groupName，并把 group 中的其它节点加入节点列表
+func (chat *Chat) JoinGroup(ctx context.Context, groupName string) error {
+	if chat.dht == nil {
+		return ErrNoDHT
+	}
+	chat.mu.Lock()
+	chat.groups = append(chat.groups, groupName)
+	chat.mu.Unlock()
+	discovery.Advertise(chat.ctx, chat.discovery, groupName)
+
 	// 查找 group 中的其它节点
 	fmt.Printf("Searching <%s>'s other peers ... \n", groupName)
-	_, err := chat.routingDiscovery.FindPeers(ctx, groupName)
-	if err != nil {
-		panic(err)
-	}
+	return chat.findGroupPeers(ctx, groupName)
 }
 
 func (chat *Chat) handleChatStream(stream inet.Stream) {
@@ -123,5 +200,9 @@ func (chat *Chat) handleChatStream(stream inet.Stream) {
 		return
 	}
 
+	if isRelayAddr(stream.Conn().RemoteMultiaddr()) {
+		fmt.Printf("\t %s <== %s (relayed) \n", msg, stream.Conn().RemotePeer())
+		return
+	}
 	fmt.Printf("\t %s <== %s \n", msg, stream.Conn().RemotePeer())
 }
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	p2pdisc "github.com/czh0526/libp2p/p2p/discovery"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// 发现节点的来源
+const (
+	SourceDHT  = "dht"
+	SourceMDNS = "mdns"
+)
+
+// mDNS 的服务名，只发现运行 chat 的节点
+const MDNSServiceTag = "_libp2p-chat._udp"
+
+// 发现的地址在 peerstore 中保存的时间，mDNS 每个 interval 会重新发现一次
+var DiscoveredAddrTTL = pstore.TempAddrTTL
+
+// PeerEntry 是合并 DHT 和 mDNS 的结果之后的一个节点
+type PeerEntry struct {
+	ID       peer.ID
+	Addrs    []ma.Multiaddr
+	Sources  []string // 发现这个节点的来源，按名字排序
+	Groups   []string // 通过 DHT 在这些 group 中发现
+	LastSeen time.Time
+}
+
+type knownPeer struct {
+	sources  map[string]bool
+	groups   map[string]bool
+	lastSeen time.Time
+}
+
+// Peers 返回所有发现的节点，按 ID 排序，地址取自 peerstore
+func (chat *Chat) Peers() []PeerEntry {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+
+	out := make([]PeerEntry, 0, len(chat.peers))
+	for id, kp := range chat.peers {
+		e := PeerEntry{
+			ID:       id,
+			Addrs:    chat.host.Peerstore().Addrs(id),
+			LastSeen: kp.lastSeen,
+		}
+		for s := range kp.sources {
+			e.Sources = append(e.Sources, s)
+		}
+		for g := range kp.groups {
+			e.Groups = append(e.Groups, g)
+		}
+		sort.Strings(e.Sources)
+		sort.Strings(e.Groups)
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// addPeer 记录 source 发现的节点，地址加入 peerstore 供 ChatWithPeer 使用
+func (chat *Chat) addPeer(pi pstore.PeerInfo, source, group string) {
+	if pi.ID == chat.host.ID() {
+		return
+	}
+	chat.host.Peerstore().AddAddrs(pi.ID, pi.Addrs, DiscoveredAddrTTL)
+
+	chat.mu.Lock()
+	kp, ok := chat.peers[pi.ID]
+	if !ok {
+		kp = &knownPeer{
+			sources: make(map[string]bool),
+			groups:  make(map[string]bool),
+		}
+		chat.peers[pi.ID] = kp
+	}
+	isNew := !kp.sources[source]
+	kp.sources[source] = true
+	if group != "" {
+		kp.groups[group] = true
+	}
+	kp.lastSeen = time.Now()
+	chat.mu.Unlock()
+
+	if isNew {
+		fmt.Printf("发现 <%s> (%s) \n", pi.ID.Pretty(), source)
+	}
+}
+
+// StartMDNS 在局域网中宣布本节点并发现其他的 chat 节点，不需要 DHT 和 bootstrap 节点
+func (chat *Chat) StartMDNS(interval time.Duration) error {
+	m, err := p2pdisc.NewMDNS(chat.ctx, chat.host, interval, MDNSServiceTag)
+	if err != nil {
+		return err
+	}
+	m.Notify((*mdnsNotifee)(chat).HandlePeerFound)
+	return nil
+}
+
+type mdnsNotifee Chat
+
+func (n *mdnsNotifee) HandlePeerFound(pi pstore.PeerInfo) {
+	(*Chat)(n).addPeer(pi, SourceMDNS, "")
+}
+
+// findGroupPeers 把 group 的节点加入节点列表，直到 ctx 结束或者查找完成
+func (chat *Chat) findGroupPeers(ctx context.Context, group string) error {
+	peers, err := chat.discovery.FindPeers(ctx, group)
+	if err != nil {
+		return err
+	}
+	go func() {
+		// 每个节点只输出一次，其它后端后来发现的地址在查找结束之后从缓存中读取
+		var found []peer.ID
+		for pi := range peers {
+			found = append(found, pi.ID)
+			chat.addLookup(group, pi.ID)
+		}
+		for _, p := range found {
+			chat.addLookup(group, p)
+		}
+	}()
+	return nil
+}
+
+// addLookup 把 discovery 缓存中 p 合并之后的结果加入节点列表
+func (chat *Chat) addLookup(group string, p peer.ID) {
+	r, ok := chat.discovery.Lookup(group, p)
+	if !ok {
+		return
+	}
+	pi := pstore.PeerInfo{ID: r.ID, Addrs: r.Addrs}
+	for _, source := range r.Sources {
+		chat.addPeer(pi, source, group)
+	}
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mockrouting "github.com/czh0526/libp2p/p2p/routing/mock"
+	tu "github.com/czh0526/libp2p/testutil"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+// makeLANChat 构建没有 DHT 的 Chat，和 --lan-only 一样
+func makeLANChat(t *testing.T, ctx context.Context) *Chat {
+	return New(ctx, nil, tu.GenHost(t, ctx), nil)
+}
+
+func TestPeersMerge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := makeLANChat(t, ctx), makeLANChat(t, ctx)
+	defer a.host.Close()
+	defer b.host.Close()
+
+	bi := pstore.PeerInfo{ID: b.host.ID(), Addrs: b.host.Addrs()}
+	(*mdnsNotifee)(a).HandlePeerFound(bi)
+	a.addPeer(bi, SourceDHT, "g1")
+	a.addPeer(pstore.PeerInfo{ID: a.host.ID(), Addrs: a.host.Addrs()}, SourceMDNS, "")
+
+	peers := a.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(peers))
+	}
+	p := peers[0]
+	if p.ID != b.host.ID() || len(p.Sources) != 2 || p.Sources[0] != SourceDHT || p.Sources[1] != SourceMDNS {
+		t.Fatalf("unexpected peer %+v", p)
+	}
+	if len(p.Groups) != 1 || p.Groups[0] != "g1" || len(p.Addrs) == 0 {
+		t.Fatalf("unexpected peer %+v", p)
+	}
+}
+
+func TestLANOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := makeLANChat(t, ctx), makeLANChat(t, ctx)
+	defer a.host.Close()
+	defer b.host.Close()
+
+	if err := a.JoinGroup(ctx, "g1"); err != ErrNoDHT {
+		t.Fatalf("expected %v, got %v", ErrNoDHT, err)
+	}
+	if err := a.ChatWithPeer(ctx, b.host.ID()); err == nil {
+		t.Fatal("expected an error for an undiscovered peer")
+	}
+
+	// mDNS 发现的地址足够聊天
+	(*mdnsNotifee)(a).HandlePeerFound(pstore.PeerInfo{ID: b.host.ID(), Addrs: b.host.Addrs()})
+	if err := a.ChatWithPeer(ctx, b.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendMessage(b.host.ID(), "offline"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJoinGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mr := mockrouting.NewServer()
+	ha, hb := tu.GenHost(t, ctx), tu.GenHost(t, ctx)
+	defer ha.Close()
+	defer hb.Close()
+	a, b := New(ctx, nil, ha, mr.Client(ha)), New(ctx, nil, hb, mr.Client(hb))
+
+	// 等 a 宣布之后 b 再查找
+	if err := a.JoinGroup(ctx, "g1"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mr.Queries(mockrouting.OpProvide) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("group not advertised")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := b.JoinGroup(ctx, "g1"); err != nil {
+		t.Fatal(err)
+	}
+	for len(b.Peers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("group peer not found")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	p := b.Peers()[0]
+	if p.ID != ha.ID() || len(p.Sources) != 1 || p.Sources[0] != SourceDHT || len(p.Groups) != 1 || p.Groups[0] != "g1" {
+		t.Fatalf("unexpected peer %+v", p)
+	}
+
+	// 不在节点列表中的节点通过路由查找地址
+	if err := a.ChatWithPeer(ctx, hb.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Queries(mockrouting.OpFindPeer) != 1 {
+		t.Fatalf("expected 1 FindPeer, got %d", mr.Queries(mockrouting.OpFindPeer))
+	}
+}
@@ -0,0 +1,300 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	reachability "github.com/czh0526/libp2p/p2p/reachability"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+/*
+ * 处于 NAT 之后的节点:
+ *   - Tracker 发现自己不可达之后，AutoRelay 通过 relay 宣布 /p2p-circuit 地址，见 autorelay.go
+ *   - ChatWithPeer 先尝试直连，失败之后经过 relay 连接
+ *   - 经过 relay 聊天时，定期尝试直连，成功之后关闭 relay 连接，之后的消息走直连
+ */
+
+// 直连的超时时间，超时之后经过 relay 连接
+var DirectDialTimeout = 10 * time.Second
+
+// 经过 relay 聊天时，尝试切换到直连的间隔
+var UpgradeInterval = 30 * time.Second
+
+var errNoDirectAddrs = errors.New("no direct address")
+
+func isRelayAddr(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(circuit.P_CIRCUIT)
+	return err == nil
+}
+
+// splitAddrs 把地址分为直连地址和 /p2p-circuit 地址
+func splitAddrs(addrs []ma.Multiaddr) (direct, relayed []ma.Multiaddr) {
+	for _, a := range addrs {
+		if isRelayAddr(a) {
+			relayed = append(relayed, a)
+		} else {
+			direct = append(direct, a)
+		}
+	}
+	return direct, relayed
+}
+
+// Reachability 返回 AutoNAT 探测到的本节点的可达性
+func (chat *Chat) Reachability() autonat.NATStatus {
+	return chat.reach.Status()
+}
+
+// ConfirmedAddrs 返回其它节点 dial-back 成功的公网地址，最近确认的在前
+func (chat *Chat) ConfirmedAddrs() []reachability.ConfirmedAddr {
+	return chat.reach.Confirmed()
+}
+
+// StartAutoNATService 为其它节点回答 AutoNAT 的 dial-back 请求，按 cfg 限制频率
+func (chat *Chat) StartAutoNATService(cfg reachability.ServiceConfig) error {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if chat.autonatSvc != nil {
+		return nil
+	}
+	svc, err := reachability.NewService(chat.ctx, chat.host, cfg)
+	if err != nil {
+		return err
+	}
+	chat.autonatSvc = svc
+	return nil
+}
+
+// AutoNATServiceStats 返回 AutoNAT 服务的统计，服务没有启动时 ok 为 false
+func (chat *Chat) AutoNATServiceStats() (stats reachability.ServiceStats, ok bool) {
+	chat.mu.Lock()
+	svc := chat.autonatSvc
+	chat.mu.Unlock()
+	if svc == nil {
+		return stats, false
+	}
+	return svc.Stats(), true
+}
+
+// Addrs 返回本节点宣布的地址，不可达时包括经过 relay 的地址
+func (chat *Chat) Addrs() []ma.Multiaddr {
+	return chat.host.Addrs()
+}
+
+// AddRelays 增加经过 relay 连接时使用的 relay
+func (chat *Chat) AddRelays(relays ...pstore.PeerInfo) {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	for _, pi := range relays {
+		chat.host.Peerstore().AddAddrs(pi.ID, pi.Addrs, pstore.PermanentAddrTTL)
+		chat.relays = append(chat.relays, pi.ID)
+	}
+}
+
+// relayAddrsFor 返回经过 relay 连接 pid 的地址，使用配置的 relay 和本节点自己正在使用的 relay
+func (chat *Chat) relayAddrsFor(pid peer.ID) []ma.Multiaddr {
+	chat.mu.Lock()
+	relays := append([]peer.ID{}, chat.relays...)
+	chat.mu.Unlock()
+
+	for _, a := range chat.host.Addrs() {
+		if !isRelayAddr(a) {
+			continue
+		}
+		// relay 地址形如 /ip4/.../tcp/.../ipfs/<relay>/p2p-circuit
+		if s, err := a.ValueForProtocol(ma.P_IPFS); err == nil {
+			if id, err := peer.IDB58Decode(s); err == nil {
+				relays = append(relays, id)
+			}
+		}
+	}
+
+	seen := make(map[peer.ID]bool)
+	var addrs []ma.Multiaddr
+	for _, id := range relays {
+		if seen[id] || id == pid {
+			continue
+		}
+		seen[id] = true
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ipfs/%s/p2p-circuit", id.Pretty()))
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// connect 用给定的地址连接 pid，之前失败的拨号不影响这一次
+func (chat *Chat) connect(ctx context.Context, pid peer.ID, addrs []ma.Multiaddr) error {
+	if sw, ok := chat.host.Network().(*swarm.Swarm); ok {
+		sw.Backoff().Clear(pid)
+	}
+	return chat.host.Connect(ctx, pstore.PeerInfo{ID: pid, Addrs: addrs})
+}
+
+// isRelayed 判断与 pid 的连接是否都经过 relay
+func (chat *Chat) isRelayed(pid peer.ID) bool {
+	conns := chat.host.Network().ConnsToPeer(pid)
+	for _, c := range conns {
+		if !isRelayAddr(c.RemoteMultiaddr()) {
+			return false
+		}
+	}
+	return len(conns) > 0
+}
+
+// startUpgrade 开始在后台尝试把与 pid 的会话切换到直连
+func (chat *Chat) startUpgrade(pid peer.ID) {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if _, ok := chat.upgrading[pid]; ok {
+		return
+	}
+	done := make(chan struct{})
+	chat.upgrading[pid] = done
+	go chat.upgradeLoop(pid, done)
+}
+
+// stopUpgrade 停止尝试切换，返回之前是否在尝试
+func (chat *Chat) stopUpgrade(pid peer.ID) bool {
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	done, ok := chat.upgrading[pid]
+	if ok {
+		close(done)
+		delete(chat.upgrading, pid)
+	}
+	return ok
+}
+
+func (chat *Chat) upgradeLoop(pid peer.ID, done chan struct{}) {
+	ticker := time.NewTicker(UpgradeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		case <-chat.ctx.Done():
+			chat.stopUpgrade(pid)
+			return
+		}
+
+		switch {
+		case chat.host.Network().Connectedness(pid) != inet.Connected:
+			// 会话已经结束，下一次 ChatWithPeer 时重新开始
+			chat.stopUpgrade(pid)
+			return
+		case !chat.isRelayed(pid):
+			// 对方直连了本节点
+			chat.migrate(pid)
+			return
+		}
+		if err := chat.tryDirect(pid); err != nil && err != errNoDirectAddrs {
+			fmt.Printf("直连 <%s> 失败: %s \n", pid.Pretty(), err)
+		}
+	}
+}
+
+// tryDirect 探测 pid 的直连地址，成功之后只断开 relay 连接，用探测成功的地址连接。
+// 已经有连接时 swarm 总是复用已有的连接，不能在保留 relay 连接的同时拨号直连，
+// 所以先探测地址可达，再关闭 relay 连接，直连失败时回到 relay
+func (chat *Chat) tryDirect(pid peer.ID) error {
+	direct, relayed := splitAddrs(chat.host.Peerstore().Addrs(pid))
+	if len(direct) == 0 {
+		return errNoDirectAddrs
+	}
+
+	addr, err := probe(chat.ctx, direct)
+	if err != nil {
+		return err
+	}
+
+	// 去掉 /p2p-circuit 地址，重新连接时只拨直连地址
+	ps := chat.host.Peerstore()
+	for _, a := range relayed {
+		ps.SetAddr(pid, a, 0)
+	}
+	closeRelayed(chat.host.Network(), pid)
+
+	ctx, cancel := context.WithTimeout(chat.ctx, DirectDialTimeout)
+	defer cancel()
+	if err := chat.connect(ctx, pid, []ma.Multiaddr{addr}); err != nil {
+		// 回到 relay
+		ps.AddAddrs(pid, relayed, pstore.TempAddrTTL)
+		if rerr := chat.connect(chat.ctx, pid, append(relayed, chat.relayAddrsFor(pid)...)); rerr != nil {
+			fmt.Printf("重新经过 relay 连接 <%s> 失败: %s \n", pid.Pretty(), rerr)
+		}
+		return err
+	}
+	chat.migrate(pid)
+	return nil
+}
+
+// probe 依次建立到 addrs 的 TCP 连接，返回第一个可以连通的地址。
+// 只检查地址是否可达，加密握手留给之后的 connect，不重复进行
+func probe(ctx context.Context, addrs []ma.Multiaddr) (ma.Multiaddr, error) {
+	err := errNoDirectAddrs
+	var d manet.Dialer
+	for _, a := range addrs {
+		dctx, cancel := context.WithTimeout(ctx, DirectDialTimeout)
+		c, derr := d.DialContext(dctx, a)
+		cancel()
+		if derr != nil {
+			err = derr
+			continue
+		}
+		c.Close()
+		return a, nil
+	}
+	return nil, err
+}
+
+// closeRelayed 关闭与 pid 之间经过 relay 的连接，保留直连
+func closeRelayed(n inet.Network, pid peer.ID) {
+	for _, c := range n.ConnsToPeer(pid) {
+		if isRelayAddr(c.RemoteMultiaddr()) {
+			c.Close()
+		}
+	}
+}
+
+// migrate 在有了直连之后关闭与 pid 的 relay 连接
+func (chat *Chat) migrate(pid peer.ID) {
+	if !chat.stopUpgrade(pid) {
+		return
+	}
+	closeRelayed(chat.host.Network(), pid)
+	fmt.Printf("与 <%s> 的会话已切换到直连 \n", pid.Pretty())
+}
+
+// netNotifiee 在对方直连本节点时切换会话
+type netNotifiee Chat
+
+func (nn *netNotifiee) chat() *Chat {
+	return (*Chat)(nn)
+}
+
+func (nn *netNotifiee) Connected(n inet.Network, c inet.Conn) {
+	if isRelayAddr(c.RemoteMultiaddr()) {
+		return
+	}
+	// 不能在通知中阻塞
+	go nn.chat().migrate(c.RemotePeer())
+}
+
+func (nn *netNotifiee) Disconnected(inet.Network, inet.Conn)   {}
+func (nn *netNotifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (nn *netNotifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (nn *netNotifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (nn *netNotifiee) ClosedStream(inet.Network, inet.Stream) {}
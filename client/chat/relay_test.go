@@ -0,0 +1,233 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	reachability "github.com/czh0526/libp2p/p2p/reachability"
+	tu "github.com/czh0526/libp2p/testutil"
+	libp2p "github.com/libp2p/go-libp2p"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	host "github.com/libp2p/go-libp2p-host"
+	kad_dht "github.com/libp2p/go-libp2p-kad-dht"
+	inet "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func makeChat(t *testing.T, ctx context.Context) *Chat {
+	h := tu.GenHost(t, ctx, libp2p.EnableRelay())
+	dht, err := kad_dht.New(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(ctx, nil, h, dht)
+}
+
+func waitDirect(t *testing.T, a, b *Chat) {
+	deadline := time.Now().Add(5 * time.Second)
+	for a.isRelayed(b.host.ID()) || len(a.host.Network().ConnsToPeer(b.host.ID())) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a single direct connection, got %v", a.host.Network().ConnsToPeer(b.host.ID()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// a 只知道 b 的一个连不上的地址，经过 relay 连接 b
+func makeRelayedChats(t *testing.T, ctx context.Context) (a, b *Chat, relay host.Host) {
+	relay = tu.GenHost(t, ctx, libp2p.EnableRelay(circuit.OptHop))
+	a, b = makeChat(t, ctx), makeChat(t, ctx)
+	if err := b.host.Connect(ctx, pstore.PeerInfo{ID: relay.ID(), Addrs: relay.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	a.AddRelays(pstore.PeerInfo{ID: relay.ID(), Addrs: relay.Addrs()})
+	a.host.Peerstore().AddAddrs(b.host.ID(), []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/1")}, pstore.TempAddrTTL)
+
+	if err := a.ChatWithPeer(ctx, b.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if !a.isRelayed(b.host.ID()) {
+		t.Fatal("expected a relayed connection")
+	}
+	if err := a.SendMessage(b.host.ID(), "over the relay"); err != nil {
+		t.Fatal(err)
+	}
+	return a, b, relay
+}
+
+func TestRelayedFallbackAndUpgrade(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b, relay := makeRelayedChats(t, ctx)
+	defer relay.Close()
+	defer a.host.Close()
+	defer b.host.Close()
+
+	upgradeOrFatal(t, a, b)
+	waitDirect(t, a, b)
+	if err := a.SendMessage(b.host.ID(), "direct"); err != nil {
+		t.Fatal(err)
+	}
+	if upgrading(a) != 0 {
+		t.Fatal("expected the upgrade loop to stop after migrating")
+	}
+}
+
+func upgradeOrFatal(t *testing.T, a, b *Chat) {
+	// identify 之后 a 才知道 b 的监听地址
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := a.tryDirect(b.host.ID())
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func upgrading(c *Chat) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.upgrading)
+}
+
+func TestMigrateOnIncomingDirect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b, relay := makeRelayedChats(t, ctx)
+	defer relay.Close()
+	defer a.host.Close()
+	defer b.host.Close()
+
+	// b 先切换到了直连，a 收到直连之后停止自己的尝试
+	upgradeOrFatal(t, b, a)
+	waitDirect(t, a, b)
+	deadline := time.Now().Add(5 * time.Second)
+	for upgrading(a) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the upgrade loop to stop after the peer dialed directly")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := a.SendMessage(b.host.ID(), "direct"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutoNATService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := makeLANChat(t, ctx), makeLANChat(t, ctx)
+	defer a.host.Close()
+	defer b.host.Close()
+
+	// 只有一个 AutoNAT 节点，一个确认就足够
+	b.reach = reachability.NewTracker(ctx, b.host, nil, reachability.Config{BootDelay: time.Hour, Confirmations: 1})
+
+	if _, ok := a.AutoNATServiceStats(); ok {
+		t.Fatal("expected the service to be stopped")
+	}
+	if err := a.StartAutoNATService(reachability.ServiceConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.host.Connect(ctx, pstore.PeerInfo{ID: a.host.ID(), Addrs: a.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// identify 完成之后 b 才知道 a 提供 AutoNAT 服务
+	deadline := time.Now().Add(5 * time.Second)
+	for b.reach.Probe(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no AutoNAT peer found")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.Reachability() != autonat.NATStatusPublic {
+		t.Fatalf("expected public, got %d", b.Reachability())
+	}
+	if confirmed := b.ConfirmedAddrs(); len(confirmed) != 1 || confirmed[0].By != a.host.ID() {
+		t.Fatalf("unexpected confirmed addresses %+v", confirmed)
+	}
+	if st, ok := a.AutoNATServiceStats(); !ok || st.Succeeded != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestAutoRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay := tu.GenHost(t, ctx, libp2p.EnableRelay(circuit.OptHop))
+	defer relay.Close()
+	ar := NewAutoRelay()
+	b := New(ctx, nil, tu.GenHost(t, ctx, libp2p.EnableRelay(), libp2p.AddrsFactory(ar.AddrsFactory(nil))), nil)
+	defer b.host.Close()
+	b.AddRelays(pstore.PeerInfo{ID: relay.ID(), Addrs: relay.Addrs()})
+
+	// 可达性未知时不使用 relay
+	b.updateRelays(ctx, ar)
+	if len(ar.Relays()) != 0 || len(ar.Addrs()) != 0 {
+		t.Fatalf("unexpected relays %v", ar.Relays())
+	}
+
+	// 声明一个没有监听的地址，dial-back 失败，b 不可达
+	closed, release := tu.LocalAddressOrFatal(t, "tcp")
+	defer release()
+	b.reach = reachability.NewTracker(ctx, b.host, func() []ma.Multiaddr { return []ma.Multiaddr{closed} }, reachability.Config{BootDelay: time.Hour})
+	s := makeLANChat(t, ctx)
+	defer s.host.Close()
+	if err := s.StartAutoNATService(reachability.ServiceConfig{DialTimeout: 2 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.host.Connect(ctx, pstore.PeerInfo{ID: s.host.ID(), Addrs: s.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for b.reach.Probe(ctx) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no AutoNAT peer found")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.Reachability() != autonat.NATStatusPrivate {
+		t.Fatalf("expected private, got %d", b.Reachability())
+	}
+
+	b.updateRelays(ctx, ar)
+	if relays := ar.Relays(); len(relays) != 1 || relays[0] != relay.ID() {
+		t.Fatalf("unexpected relays %v", relays)
+	}
+	_, relayed := splitAddrs(b.Addrs())
+	if len(relayed) == 0 {
+		t.Fatalf("expected relay addresses, got %v", b.Addrs())
+	}
+
+	// 只用宣布的 relay 地址连接 b
+	a := tu.GenHost(t, ctx, libp2p.EnableRelay())
+	defer a.Close()
+	if err := a.Connect(ctx, pstore.PeerInfo{ID: b.host.ID(), Addrs: relayed}); err != nil {
+		t.Fatal(err)
+	}
+	if conns := a.Network().ConnsToPeer(b.host.ID()); len(conns) != 1 || !isRelayAddr(conns[0].RemoteMultiaddr()) {
+		t.Fatalf("expected a relayed connection, got %v", conns)
+	}
+
+	// relay 不可用之后不再宣布它的地址
+	relay.Close()
+	deadline = time.Now().Add(5 * time.Second)
+	for b.host.Network().Connectedness(relay.ID()) == inet.Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("relay still connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.updateRelays(ctx, ar)
+	if _, relayed := splitAddrs(b.Addrs()); len(ar.Relays()) != 0 || len(relayed) != 0 {
+		t.Fatalf("unexpected relay addresses %v", relayed)
+	}
+}
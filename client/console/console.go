@@ -7,8 +7,10 @@ import (
 	"io"
 	"regexp"
 	"strings"
+	"time"
 
 	chat "github.com/czh0526/libp2p/client/chat"
+	autonat "github.com/libp2p/go-libp2p-autonat"
 	peer "github.com/libp2p/go-libp2p-peer"
 	colorable "github.com/mattn/go-colorable"
 
@@ -207,8 +209,53 @@ func (c *Console) Evaluate(statement string) error {
 
 		return nil
 
+	} else if strings.HasPrefix(statement, "status") {
+		c.Printf("Reachability: %s \n", reachability(c.chat.Reachability()))
+		if confirmed := c.chat.ConfirmedAddrs(); len(confirmed) > 0 {
+			c.Printf("Confirmed public addresses: \n")
+			for _, a := range confirmed {
+				c.Printf("\t%s (confirmed %s ago by %s) \n", a.Addr, time.Since(a.Confirmed).Round(time.Second), a.By.Pretty())
+			}
+		}
+		c.Printf("Addresses: \n")
+		for _, addr := range c.chat.Addrs() {
+			c.Printf("\t%s \n", addr)
+		}
+		if st, ok := c.chat.AutoNATServiceStats(); ok {
+			c.Printf("AutoNAT service: %d succeeded, %d failed, %d refused \n", st.Succeeded, st.Failed, st.Refused)
+		}
+		return nil
+
 	} else if strings.HasPrefix(statement, "join_group:") {
-		c.Printf("*) join_group: has not be implemented.\n")
+		group := strings.TrimSpace(strings.Replace(statement, "join_group:", "", -1))
+		if err := c.chat.JoinGroup(context.Background(), group); err != nil {
+			c.Printf("Error: %s\n", err)
+			return err
+		}
+		return nil
+
+	} else if strings.HasPrefix(statement, "peers") {
+		for _, p := range c.chat.Peers() {
+			c.Printf("%s [%s] %s \n", p.ID.Pretty(), strings.Join(p.Sources, ","), p.LastSeen.Format("15:04:05"))
+			if len(p.Groups) > 0 {
+				c.Printf("\tgroups: %s \n", strings.Join(p.Groups, ","))
+			}
+			for _, addr := range p.Addrs {
+				c.Printf("\t%s \n", addr)
+			}
+		}
+		return nil
 	}
 	return nil
 }
+
+func reachability(status autonat.NATStatus) string {
+	switch status {
+	case autonat.NATStatusPublic:
+		return "public"
+	case autonat.NATStatusPrivate:
+		return "private, reachable through relays"
+	default:
+		return "unknown"
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"strings"
 
+	reachability "github.com/czh0526/libp2p/p2p/reachability"
 	crypto "github.com/libp2p/go-libp2p-crypto"
 	maddr "github.com/multiformats/go-multiaddr"
 	multiaddr "github.com/multiformats/go-multiaddr"
@@ -80,6 +81,19 @@ type Config struct {
 	PrivKey        crypto.PrivKey
 	BootstrapPeers addrList
 	ListenAddrs    addrList
+	// peerstore 的保存目录，为空时只保存在内存中
+	PeerstoreDir string
+	// 不可达时连接 -relay 配置的和 DHT 中发现的 relay，并宣布 /p2p-circuit 地址
+	AutoRelay bool
+	// 直连失败时使用的 relay
+	Relays addrList
+	// 通过 mDNS 发现局域网中的节点
+	MDNS bool
+	// 只在局域网中运行，不使用 DHT 和 bootstrap 节点
+	LANOnly bool
+	// 为其它节点提供 AutoNAT 服务，每分钟最多回答 AutoNATLimit 次 dial-back
+	AutoNATService bool
+	AutoNATLimit   int
 }
 
 func ParseFlags() (Config, error) {
@@ -88,9 +102,21 @@ func ParseFlags() (Config, error) {
 	flag.StringVar(&skString, "sk", "", "host's private key.")
 	flag.Var(&cfg.BootstrapPeers, "bootstrap", "Adds a peer multiaddress to the bootstrap list")
 	flag.Var(&cfg.ListenAddrs, "listen", "Adds a multiaddress to the listen list")
+	flag.StringVar(&cfg.PeerstoreDir, "peerstore", "", "directory to persist the peerstore in, in-memory if empty")
+	flag.BoolVar(&cfg.AutoRelay, "autorelay", true, "advertise relay addresses when AutoNAT finds the host unreachable")
+	flag.Var(&cfg.Relays, "relay", "Adds a relay multiaddress used when a peer cannot be dialed directly")
+	flag.BoolVar(&cfg.MDNS, "mdns", true, "discover chat peers on the local network with mDNS")
+	flag.BoolVar(&cfg.LANOnly, "lan-only", false, "disable the DHT and bootstrap peers, discover peers with mDNS only")
+	flag.BoolVar(&cfg.AutoNATService, "autonat-service", false, "answer AutoNAT dial-back requests from other peers")
+	flag.IntVar(&cfg.AutoNATLimit, "autonat-limit", reachability.DefaultGlobalLimit, "max AutoNAT dial-backs served per minute")
 
 	flag.Parse()
-	if len(cfg.BootstrapPeers) == 0 {
+	if cfg.LANOnly {
+		// 局域网中没有 DHT 可以用来发现 relay
+		cfg.MDNS = true
+		cfg.AutoRelay = false
+	}
+	if len(cfg.BootstrapPeers) == 0 && !cfg.LANOnly {
 		cfg.BootstrapPeers = append(cfg.BootstrapPeers, defaultBootstrapAddrs...)
 	}
 	if len(cfg.ListenAddrs) == 0 {
@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
-	"sync"
+	"time"
 
 	chat "github.com/czh0526/libp2p/client/chat"
 	console "github.com/czh0526/libp2p/client/console"
+	bootstrap "github.com/czh0526/libp2p/p2p/bootstrap"
+	pstorefs "github.com/czh0526/libp2p/p2p/pstorefs"
+	reachability "github.com/czh0526/libp2p/p2p/reachability"
 	libp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-host"
 	kad_dht "github.com/libp2p/go-libp2p-kad-dht"
-	pstore "github.com/libp2p/go-libp2p-peerstore"
+	routing "github.com/libp2p/go-libp2p-routing"
 )
 
 func init() {
@@ -27,7 +30,12 @@ func main() {
 
 	ctx := context.Background()
 
-	host, dht, err := makeHostAndDHT(ctx, cfg)
+	// 不可达时宣布 relay 地址，可达性由 client 的 AutoNAT 探测判断
+	var autoRelay *chat.AutoRelay
+	if cfg.AutoRelay {
+		autoRelay = chat.NewAutoRelay()
+	}
+	host, dht, err := makeHostAndDHT(ctx, cfg, autoRelay)
 	if err != nil {
 		panic(err)
 	}
@@ -35,6 +43,27 @@ func main() {
 
 	// 启动 Client
 	client := chat.New(ctx, []string{}, host, dht)
+	relays, err := bootstrap.ParsePeers(cfg.Relays)
+	if err != nil {
+		panic(err)
+	}
+	client.AddRelays(relays...)
+	if autoRelay != nil {
+		client.StartAutoRelay(autoRelay)
+	}
+	if cfg.MDNS {
+		if err := client.StartMDNS(mdnsInterval); err != nil {
+			fmt.Printf("mdns error: %s \n", err)
+		}
+	}
+	if cfg.LANOnly {
+		fmt.Printf("LAN-only mode, discovering peers with mDNS \n")
+	}
+	if cfg.AutoNATService {
+		if err := client.StartAutoNATService(reachability.ServiceConfig{GlobalLimit: cfg.AutoNATLimit}); err != nil {
+			fmt.Printf("autonat service error: %s \n", err)
+		}
+	}
 	fmt.Printf("Client <%s> started ... \n", host.ID())
 
 	// 启动 Console
@@ -49,40 +78,65 @@ func main() {
 	select {}
 }
 
-func makeHostAndDHT(ctx context.Context, cfg Config) (host.Host, *kad_dht.IpfsDHT, error) {
+// mDNS 查询的间隔
+const mdnsInterval = 10 * time.Second
+
+// makeHostAndDHT 构建 Host 和 DHT，LANOnly 时不使用 DHT，返回的 DHT 为 nil。
+// autoRelay 不为 nil 时，Host 的地址包括它宣布的 relay 地址
+func makeHostAndDHT(ctx context.Context, cfg Config, autoRelay *chat.AutoRelay) (host.Host, chat.Routing, error) {
+
+	// DHT 在构建 Host 时创建
+	var dht *kad_dht.IpfsDHT
+	opts := []libp2p.Option{
+		libp2p.Identity(cfg.PrivKey),
+		libp2p.ListenAddrs(cfg.ListenAddrs...),
+		libp2p.EnableRelay(),
+	}
+	if !cfg.LANOnly {
+		opts = append(opts, libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
+			var err error
+			dht, err = kad_dht.New(ctx, h)
+			return dht, err
+		}))
+	}
+	if autoRelay != nil {
+		opts = append(opts, libp2p.AddrsFactory(autoRelay.AddrsFactory(nil)))
+	}
+	// 使用保存在本地的 peerstore，重启后可以直接连接上一次运行时认识的节点
+	if cfg.PeerstoreDir != "" {
+		ps, err := pstorefs.NewPeerstore(ctx, cfg.PeerstoreDir, pstorefs.DefaultOptions())
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, libp2p.Peerstore(ps))
+	}
 
 	// 构建 Host
-	host, err := libp2p.New(ctx, libp2p.Identity(cfg.PrivKey), libp2p.ListenAddrs(cfg.ListenAddrs...))
+	host, err := libp2p.New(ctx, opts...)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// 构建&启动 DHT
-	dht, err := kad_dht.New(ctx, host)
-	if err != nil {
-		return nil, nil, err
+	if cfg.LANOnly {
+		return host, nil, nil
 	}
+
+	// 启动 DHT
 	if err := dht.Bootstrap(ctx); err != nil {
 		return nil, nil, err
 	}
 
-	// 将 Host 接入网络
-	var wg sync.WaitGroup
-	for _, paddr := range cfg.BootstrapPeers {
-		pi, err := pstore.InfoFromP2pAddr(paddr)
-		if err != nil {
-			continue
-		}
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := host.Connect(ctx, *pi); err != nil {
-				fmt.Printf("connect to %s error: %s \n", pi.String(), err)
-			}
-		}()
+	// 将 Host 接入网络，之后在后台保持连接
+	peers, err := bootstrap.ParsePeers(cfg.BootstrapPeers)
+	if err != nil {
+		return nil, nil, err
 	}
-	wg.Wait()
+	bm := bootstrap.New(host, bootstrap.Config{
+		Peers:        peers,
+		UsePeerstore: true,
+	})
+	// Start 立即执行第一轮，出错时打印之后继续在后台重试
+	bm.Start(ctx)
 
 	return host, dht, nil
 }
@@ -2,75 +2,14 @@ package test_discovery
 
 import (
 	"context"
-	"sync"
 	"testing"
 
+	mockrouting "github.com/czh0526/libp2p/p2p/routing/mock"
 	swarmt "github.com/czh0526/libp2p/swarm"
-	cid "github.com/ipfs/go-cid"
 	disc "github.com/libp2p/go-libp2p-discovery"
-	host "github.com/libp2p/go-libp2p-host"
-	peer "github.com/libp2p/go-libp2p-peer"
-	pstore "github.com/libp2p/go-libp2p-peerstore"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 )
 
-type mockRoutingTable struct {
-	mx        sync.Mutex
-	providers map[string]map[peer.ID]pstore.PeerInfo
-}
-
-func NewMockRoutingTable() *mockRoutingTable {
-	return &mockRoutingTable{
-		providers: make(map[string]map[peer.ID]pstore.PeerInfo),
-	}
-}
-
-type mockRouting struct {
-	h   host.Host
-	tab *mockRoutingTable
-}
-
-func NewMockRouting(h host.Host, tab *mockRoutingTable) *mockRouting {
-	return &mockRouting{h: h, tab: tab}
-}
-
-func (m *mockRouting) Provide(ctx context.Context, cid cid.Cid, bcast bool) error {
-	m.tab.mx.Lock()
-	defer m.tab.mx.Unlock()
-
-	pmap, ok := m.tab.providers[cid.String()]
-	if !ok {
-		pmap = make(map[peer.ID]pstore.PeerInfo)
-		m.tab.providers[cid.String()] = pmap
-	}
-	pmap[m.h.ID()] = pstore.PeerInfo{ID: m.h.ID(), Addrs: m.h.Addrs()}
-
-	return nil
-}
-
-func (m *mockRouting) FindProvidersAsync(ctx context.Context, cid cid.Cid, limit int) <-chan pstore.PeerInfo {
-	ch := make(chan pstore.PeerInfo)
-	go func() {
-		defer close(ch)
-		m.tab.mx.Lock()
-		defer m.tab.mx.Unlock()
-
-		pmap, ok := m.tab.providers[cid.String()]
-		if !ok {
-			return
-		}
-		for _, pi := range pmap {
-			select {
-			case ch <- pi:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	return ch
-}
-
 func TestRoutingDiscovery(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -84,12 +23,12 @@ func TestRoutingDiscovery(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// 构建 routingTable
-	mtab := NewMockRoutingTable()
+	// 构建共用的路由表
+	mr := mockrouting.NewServer()
 
 	// 构建 ContentRouting
-	mr1 := NewMockRouting(h1, mtab)
-	mr2 := NewMockRouting(h2, mtab)
+	mr1 := mr.Client(h1)
+	mr2 := mr.Client(h2)
 
 	// 构建 RoutingDiscovery
 	d1 := disc.NewRoutingDiscovery(mr1)
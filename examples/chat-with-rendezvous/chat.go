@@ -7,8 +7,10 @@ import (
 	"os"
 	"sync"
 
+	rendezvous "github.com/czh0526/libp2p/p2p/rendezvous"
 	libp2p "github.com/libp2p/go-libp2p"
 	discovery "github.com/libp2p/go-libp2p-discovery"
+	host "github.com/libp2p/go-libp2p-host"
 	libp2pdht "github.com/libp2p/go-libp2p-kad-dht"
 	inet "github.com/libp2p/go-libp2p-net"
 	peerstore "github.com/libp2p/go-libp2p-peerstore"
@@ -85,43 +87,25 @@ func main() {
 	// 设置 StreamHandler
 	host.SetStreamHandler(protocol.ID(config.ProtocolID), handleStream)
 
-	// 构建 DHT 对象
-	kademliaDHT, err := libp2pdht.New(ctx, host)
-	if err != nil {
-		panic(err)
+	// 指定了 rendezvous 服务器时不使用 DHT
+	var d discovery.Discovery
+	if config.Server != nil {
+		d, err = serverDiscovery(ctx, host, config.Server)
+	} else {
+		d, err = dhtDiscovery(ctx, host, config.BootstrapPeers)
 	}
-
-	// 启动 DHT 客户端
-	fmt.Println("Bootstrapping the DHT")
-	if err = kademliaDHT.Bootstrap(ctx); err != nil {
+	if err != nil {
 		panic(err)
 	}
 
-	// 连接 Bootstrap 节点
-	var wg sync.WaitGroup
-	for _, peerAddr := range config.BootstrapPeers {
-		peerinfo, _ := peerstore.InfoFromP2pAddr(peerAddr)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := host.Connect(ctx, *peerinfo); err != nil {
-				fmt.Printf("[error]: %s \n", err)
-			} else {
-				fmt.Printf("Connection established with bootstrap node: %s \n", *peerinfo)
-			}
-		}()
-	}
-	wg.Wait()
-
 	// 宣布自己上线了，并宣布自己作为 RendezvousString 的内容提供者
 	fmt.Println("Announcing ourselves...")
-	routingDiscovery := discovery.NewRoutingDiscovery(kademliaDHT)
-	discovery.Advertise(ctx, routingDiscovery, config.RendezvousString)
+	discovery.Advertise(ctx, d, config.RendezvousString)
 	fmt.Println("Successfully announced!")
 
 	// 查找 RendezvousString 的其它内容提供者
 	fmt.Println("Searching for other peers ...")
-	peerChan, err := routingDiscovery.FindPeers(ctx, config.RendezvousString)
+	peerChan, err := d.FindPeers(ctx, config.RendezvousString)
 	if err != nil {
 		panic(err)
 	}
@@ -134,6 +118,8 @@ func main() {
 
 		fmt.Printf("Found peer: %s \n", peer)
 		fmt.Printf("Connecting to: %s \n", peer)
+		// rendezvous 服务器返回的地址不会自动加入 peerstore
+		host.Peerstore().AddAddrs(peer.ID, peer.Addrs, peerstore.TempAddrTTL)
 		stream, err := host.NewStream(ctx, peer.ID, protocol.ID(config.ProtocolID))
 
 		if err != nil {
@@ -151,3 +137,49 @@ func main() {
 
 	select {}
 }
+
+// dhtDiscovery 连接 bootstrap 节点，通过 DHT 宣布和查找节点
+func dhtDiscovery(ctx context.Context, host host.Host, bootstrapPeers []multiaddr.Multiaddr) (discovery.Discovery, error) {
+	// 构建 DHT 对象
+	kademliaDHT, err := libp2pdht.New(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// 启动 DHT 客户端
+	fmt.Println("Bootstrapping the DHT")
+	if err = kademliaDHT.Bootstrap(ctx); err != nil {
+		return nil, err
+	}
+
+	// 连接 Bootstrap 节点
+	var wg sync.WaitGroup
+	for _, peerAddr := range bootstrapPeers {
+		peerinfo, _ := peerstore.InfoFromP2pAddr(peerAddr)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := host.Connect(ctx, *peerinfo); err != nil {
+				fmt.Printf("[error]: %s \n", err)
+			} else {
+				fmt.Printf("Connection established with bootstrap node: %s \n", *peerinfo)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return discovery.NewRoutingDiscovery(kademliaDHT), nil
+}
+
+// serverDiscovery 连接 rendezvous 服务器，通过它宣布和查找节点
+func serverDiscovery(ctx context.Context, host host.Host, server multiaddr.Multiaddr) (discovery.Discovery, error) {
+	pi, err := peerstore.InfoFromP2pAddr(server)
+	if err != nil {
+		return nil, err
+	}
+	if err := host.Connect(ctx, *pi); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Connected to rendezvous server: %s \n", pi.ID.Pretty())
+	return rendezvous.NewClient(host, pi.ID), nil
+}
@@ -43,6 +43,8 @@ type Config struct {
 	BootstrapPeers   addrList
 	ListenAddresses  addrList
 	ProtocolID       string
+	// rendezvous 服务器的地址，为空时使用 DHT
+	Server maddr.Multiaddr
 }
 
 func ParseFlags() (Config, error) {
@@ -51,8 +53,16 @@ func ParseFlags() (Config, error) {
 	flag.Var(&config.BootstrapPeers, "peer", "Adds a peer multiaddress to the bootstrap list")
 	flag.Var(&config.ListenAddresses, "listen", "Adds a multiaddress to the listen list")
 	flag.StringVar(&config.ProtocolID, "pid", "chat/1.1.0", "Sets a protocol id for stream headers")
+	server := flag.String("server", "", "Multiaddress of a rendezvous server, with /ipfs/<id>, used instead of the DHT")
 
 	flag.Parse()
+	if *server != "" {
+		addr, err := maddr.NewMultiaddr(*server)
+		if err != nil {
+			return config, err
+		}
+		config.Server = addr
+	}
 	if len(config.BootstrapPeers) == 0 {
 		config.BootstrapPeers = dht.DefaultBootstrapPeers
 	}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-host"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+/*
+ * bulk 模式:
+ *   client ==> server: 持续发送数据，到时间后关闭写
+ *   server ==> client: 收到的字节数（8 字节大端）
+ * 以服务端确认的字节数计算吞吐量
+ */
+const bulkProtocol = "/echo/bulk/1.0.0"
+
+const bulkChunkSize = 64 << 10
+
+// 服务端: 丢弃收到的数据，最后返回字节数
+func handleBulk(s net.Stream) {
+	n, err := io.Copy(ioutil.Discard, s)
+	if err != nil {
+		fmt.Println(err)
+		s.Reset()
+		return
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	if _, err := s.Write(buf[:]); err != nil {
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+type bulkResult struct {
+	bytes   uint64
+	elapsed time.Duration
+	err     error
+}
+
+// runBulk 在 streams 个并行的 stream 上发送 duration 时长的数据，打印每个 stream 和总的吞吐量
+func runBulk(h host.Host, p peer.ID, streams int, duration time.Duration) {
+	// 先建立连接，所有 stream 共用一个连接
+	if err := h.Connect(context.Background(), h.Peerstore().PeerInfo(p)); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("sending to %s on %d streams for %s \n", p.Pretty(), streams, duration)
+	results := make([]bulkResult, streams)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = sendBulk(h, p, duration)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var total uint64
+	for i, r := range results {
+		if r.err != nil {
+			fmt.Printf("stream %d error: %s \n", i, r.err)
+			continue
+		}
+		total += r.bytes
+		fmt.Printf("stream %d: %d bytes in %s, %s \n", i, r.bytes, r.elapsed, throughput(r.bytes, r.elapsed))
+	}
+	fmt.Printf("total: %d bytes in %s, %s \n", total, elapsed, throughput(total, elapsed))
+}
+
+func sendBulk(h host.Host, p peer.ID, duration time.Duration) bulkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), roundTripTimeout)
+	defer cancel()
+	s, err := h.NewStream(ctx, p, bulkProtocol)
+	if err != nil {
+		return bulkResult{err: err}
+	}
+
+	buf := make([]byte, bulkChunkSize)
+	start := time.Now()
+	deadline := start.Add(duration)
+	for time.Now().Before(deadline) {
+		s.SetWriteDeadline(deadline.Add(roundTripTimeout))
+		if _, err := s.Write(buf); err != nil {
+			s.Reset()
+			return bulkResult{err: err}
+		}
+	}
+	s.Close()
+
+	// 等待服务端确认收到的字节数
+	var ack [8]byte
+	s.SetReadDeadline(time.Now().Add(roundTripTimeout))
+	if _, err := io.ReadFull(s, ack[:]); err != nil {
+		s.Reset()
+		return bulkResult{err: err}
+	}
+	return bulkResult{
+		bytes:   binary.BigEndian.Uint64(ack[:]),
+		elapsed: time.Since(start),
+	}
+}
+
+func throughput(n uint64, d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f MiB/s", float64(n)/d.Seconds()/(1<<20))
+}
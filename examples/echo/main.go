@@ -1,52 +1,42 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"crypto/rand"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
+	"time"
 
 	libp2p "github.com/libp2p/go-libp2p"
 
-	mrand "math/rand"
-
-	crypto "github.com/libp2p/go-libp2p-crypto"
 	host "github.com/libp2p/go-libp2p-host"
-	net "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-func makeBasicHost(listenPort int, insecure bool, randseed int64) (host.Host, error) {
-	// 构建 random reader
-	var r io.Reader
-	if randseed == 0 {
-		r = rand.Reader
-	} else {
-		r = mrand.New(mrand.NewSource(randseed))
+func makeBasicHost(listenPort int, stack Stack, keyFile string, randseed int64) (host.Host, error) {
+	// 构建私钥
+	priv, err := loadKey(keyFile, randseed)
+	if err != nil {
+		return nil, err
 	}
 
-	// 构建私钥
-	priv, _, err := crypto.GenerateKeyPairWithReader(
-		crypto.ECDSA, 2048, r)
+	listen, err := stack.ListenAddr(listenPort)
+	if err != nil {
+		return nil, err
+	}
+	stackOpts, err := stack.Options()
 	if err != nil {
 		return nil, err
 	}
 
 	// 构建必要的处理 Config 对象的 Option 函数集合
 	opts := []libp2p.Option{
-		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", listenPort)),
+		libp2p.ListenAddrStrings(listen),
 		libp2p.Identity(priv),
 		libp2p.DisableRelay(),
 	}
-	if insecure {
-		opts = append(opts, libp2p.NoSecurity)
-	}
+	opts = append(opts, stackOpts...)
 
 	// 构建 Host 对象
 	basicHost, err := libp2p.New(context.Background(), opts...)
@@ -59,12 +49,8 @@ func makeBasicHost(listenPort int, insecure bool, randseed int64) (host.Host, er
 	fmt.Printf("hostAddr = %s \n", hostAddr)
 	addr := basicHost.Addrs()[0]
 	fullAddr := addr.Encapsulate(hostAddr)
-	fmt.Printf("I am %s \n", fullAddr)
-	if insecure {
-		fmt.Printf("Now run \",/echo -l %d -d %s\" on a different terminal\n", listenPort+1, fullAddr)
-	} else {
-		fmt.Printf("Now run \"./echo -l %d -d %s\" on a different terminal\n", listenPort+1, fullAddr)
-	}
+	fmt.Printf("I am %s (%s) \n", fullAddr, stack)
+	fmt.Printf("Now run \"./echo -l %d -d %s %s\" on a different terminal\n", listenPort+1, fullAddr, stack.Flags())
 
 	return basicHost, nil
 }
@@ -73,92 +59,91 @@ func main() {
 	// 解析命令行参数
 	listenF := flag.Int("l", 0, "wait for incoming connections")
 	target := flag.String("d", "", "target peer to dial")
-	insecure := flag.Bool("insecure", false, "use an unencrypted connection")
+	insecure := flag.Bool("insecure", false, "use an unencrypted connection, same as -security insecure")
 	seed := flag.Int64("seed", 0, "set random seed for id generation")
+	keyFile := flag.String("key", "", "private key file, created if missing (keeps the peer ID stable)")
+
+	transport := flag.String("transport", "tcp", "transport: tcp or ws")
+	security := flag.String("security", "secio", "security: secio, noise, tls or insecure")
+	muxer := flag.String("muxer", "yamux", "stream muxer: yamux or mplex")
+
+	mode := flag.String("mode", "echo", "echo: repeated round trips with RTT stats; bulk: throughput over parallel streams")
+	count := flag.Int("n", 1, "echo: number of round trips")
+	interval := flag.Duration("i", time.Second, "echo: interval between round trips")
+	size := flag.Int("size", 64, "echo: payload size in bytes")
+	streams := flag.Int("streams", 4, "bulk: number of parallel streams")
+	duration := flag.Duration("t", 10*time.Second, "bulk: how long to send")
 	flag.Parse()
 
 	if *listenF == 0 {
 		panic("Please provide a port to bind on with -l")
 	}
+	if *count < 1 {
+		panic("Please provide at least one round trip with -n")
+	}
+
+	stack := Stack{Transport: *transport, Security: *security, Muxer: *muxer}
+	if *insecure {
+		stack.Security = "insecure"
+	}
 
 	// 构建 BasicHost
-	ha, err := makeBasicHost(*listenF, *insecure, *seed)
+	ha, err := makeBasicHost(*listenF, stack, *keyFile, *seed)
 	if err != nil {
 		panic(err)
 	}
 
 	// 设置协议流处理器，被动等待连接进来
-	ha.SetStreamHandler("/echo/1.0.0", func(s net.Stream) {
-		fmt.Println("Got a new stream!")
-		if err := doEcho(s); err != nil {
-			log.Println(err)
-			s.Reset()
-		} else {
-			s.Close()
-		}
-	})
+	ha.SetStreamHandler(echoProtocol, handleEcho)
+	ha.SetStreamHandler(streamEchoProtocol, handleStreamEcho)
+	ha.SetStreamHandler(bulkProtocol, handleBulk)
 
 	if *target == "" {
 		fmt.Println("listening for connections.")
 		select {}
 	}
 
-	// string ==> multiaddr
-	ipfsaddr, err := ma.NewMultiaddr(*target)
+	peerid, err := addAddrToPeerstore(ha, *target)
 	if err != nil {
 		panic(err)
 	}
 
+	switch *mode {
+	case "echo":
+		runEcho(ha, peerid, *count, *interval, *size)
+	case "bulk":
+		runBulk(ha, peerid, *streams, *duration)
+	default:
+		panic(fmt.Sprintf("unknown mode %q", *mode))
+	}
+}
+
+/*
+ * /ip4/<x.x.x.x>/tcp/<port>/ipfs/<peerid> ---- <peerid>
+ *                                          \__ /ip4/<x.x.x.x>/tcp/<port>
+ */
+func addAddrToPeerstore(h host.Host, addr string) (peer.ID, error) {
+	// string ==> multiaddr
+	ipfsaddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return "", err
+	}
+
 	// 提取 ipfs 的 pid
 	pid, err := ipfsaddr.ValueForProtocol(ma.P_IPFS)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// Base58 解码 pid
 	peerid, err := peer.IDB58Decode(pid)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// 将 pid => targetAddr 加入本地节点库
-	targetPeerAddr, _ := ma.NewMultiaddr(
-		fmt.Sprintf("/ipfs/%s", peer.IDB58Encode(peerid)))
+	targetPeerAddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ipfs/%s", pid))
 	targetAddr := ipfsaddr.Decapsulate(targetPeerAddr)
-	ha.Peerstore().AddAddr(peerid, targetAddr, pstore.PermanentAddrTTL)
-
-	// 主动连接 Target
-	fmt.Println("opening stream")
-	s, err := ha.NewStream(context.Background(), peerid, "/echo/1.0.0")
-	if err != nil {
-		panic(err)
-	}
-
-	// 发送字符串
-	_, err = s.Write([]byte("Hello, world!\n"))
-	if err != nil {
-		fmt.Println(err)
-	}
-	fmt.Println("send data ==> Hello, world!\n")
-
-	// 读取字符串
-	out, err := ioutil.ReadAll(s)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	fmt.Printf("reply data ==> %q\n", out)
-}
-
-func doEcho(s net.Stream) error {
-	buf := bufio.NewReader(s)
-	str, err := buf.ReadString('\n')
-	if err != nil {
-		return err
-	}
-	fmt.Printf("read data <== %s \n", str)
-
-	_, err = s.Write([]byte(str))
-	fmt.Printf("reply data <== %s \n", str)
-	return err
+	h.Peerstore().AddAddr(peerid, targetAddr, pstore.PermanentAddrTTL)
+	return peerid, nil
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-host"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// echoProtocol 每个 stream 只返回一行，与之前版本的客户端兼容
+const echoProtocol = "/echo/1.0.0"
+
+// streamEchoProtocol 在同一个 stream 上重复往返，-mode echo 使用
+const streamEchoProtocol = "/echo/stream/1.0.0"
+
+// 单次往返的超时时间
+const roundTripTimeout = 5 * time.Second
+
+// 服务端: 读取一行，原样返回后关闭
+func handleEcho(s net.Stream) {
+	fmt.Printf("Got a new stream from %s \n", s.Conn().RemotePeer())
+	str, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		fmt.Println(err)
+		s.Reset()
+		return
+	}
+	if _, err := s.Write([]byte(str)); err != nil {
+		fmt.Println(err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+// 服务端: 原样返回收到的数据，直到对方关闭
+func handleStreamEcho(s net.Stream) {
+	fmt.Printf("Got a new echo stream from %s \n", s.Conn().RemotePeer())
+	if _, err := io.Copy(s, s); err != nil {
+		fmt.Println(err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+/*
+ * echoClient 在一个 stream 上重复往返，
+ * 出错时丢弃当前 stream，下一次往返时重新连接并打开新的 stream
+ */
+type echoClient struct {
+	h    host.Host
+	peer peer.ID
+	s    net.Stream
+}
+
+func (c *echoClient) roundTrip(payload []byte) (time.Duration, error) {
+	if c.s == nil {
+		if err := c.reconnect(); err != nil {
+			return 0, err
+		}
+	}
+
+	c.s.SetDeadline(time.Now().Add(roundTripTimeout))
+	start := time.Now()
+	if _, err := c.s.Write(payload); err != nil {
+		c.reset()
+		return 0, err
+	}
+	reply := make([]byte, len(payload))
+	if _, err := io.ReadFull(c.s, reply); err != nil {
+		c.reset()
+		return 0, err
+	}
+	rtt := time.Since(start)
+
+	if !bytes.Equal(reply, payload) {
+		c.reset()
+		return 0, fmt.Errorf("reply does not match request")
+	}
+	return rtt, nil
+}
+
+func (c *echoClient) reconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), roundTripTimeout)
+	defer cancel()
+
+	// 连接断开时 NewStream 会重新拨号
+	s, err := c.h.NewStream(ctx, c.peer, streamEchoProtocol)
+	if err != nil {
+		return err
+	}
+	c.s = s
+	return nil
+}
+
+func (c *echoClient) reset() {
+	if c.s != nil {
+		c.s.Reset()
+		c.s = nil
+	}
+}
+
+func (c *echoClient) close() {
+	if c.s != nil {
+		c.s.Close()
+		c.s = nil
+	}
+}
+
+// runEcho 进行 count 次往返，每次间隔 interval，结束后打印 RTT 统计
+func runEcho(h host.Host, p peer.ID, count int, interval time.Duration, size int) {
+	c := &echoClient{h: h, peer: p}
+	defer c.close()
+
+	var rtts []time.Duration
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			time.Sleep(interval)
+		}
+
+		payload := makePayload(seq, size)
+		rtt, err := c.roundTrip(payload)
+		if err != nil {
+			fmt.Printf("seq=%d error: %s \n", seq, err)
+			continue
+		}
+		rtts = append(rtts, rtt)
+		fmt.Printf("seq=%d bytes=%d rtt=%s \n", seq, len(payload), rtt)
+	}
+
+	st := summarize(rtts)
+	fmt.Printf("--- %s echo statistics --- \n", p.Pretty())
+	fmt.Printf("%d sent, %d received, %.1f%% lost \n", count, st.n, 100*float64(count-st.n)/float64(count))
+	if st.n > 0 {
+		fmt.Printf("rtt min/avg/p99/max = %s/%s/%s/%s \n", st.min, st.avg, st.p99, st.max)
+	}
+}
+
+// makePayload 生成以换行结尾、长度为 size 的数据，开头是序号
+func makePayload(seq, size int) []byte {
+	head := fmt.Sprintf("Hello, world! %d ", seq)
+	if size < len(head)+1 {
+		size = len(head) + 1
+	}
+	buf := bytes.Repeat([]byte{'.'}, size)
+	copy(buf, head)
+	buf[size-1] = '\n'
+	return buf
+}
+
+type rttStats struct {
+	n                  int
+	min, avg, p99, max time.Duration
+}
+
+func summarize(rtts []time.Duration) rttStats {
+	st := rttStats{n: len(rtts)}
+	if st.n == 0 {
+		return st
+	}
+
+	sorted := make([]time.Duration, len(rtts))
+	copy(sorted, rtts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	st.min = sorted[0]
+	st.max = sorted[st.n-1]
+	st.avg = sum / time.Duration(st.n)
+	st.p99 = sorted[int(math.Ceil(0.99*float64(st.n)))-1]
+	return st
+}
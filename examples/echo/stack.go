@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	mrand "math/rand"
+
+	identity "github.com/czh0526/libp2p/p2p/identity"
+	noise "github.com/czh0526/libp2p/security/noise"
+	libp2ptls "github.com/czh0526/libp2p/security/tls"
+	libp2p "github.com/libp2p/go-libp2p"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	secio "github.com/libp2p/go-libp2p-secio"
+	tcp "github.com/libp2p/go-tcp-transport"
+	ws "github.com/libp2p/go-ws-transport"
+	mplex "github.com/whyrusleeping/go-smux-multiplex"
+	yamux "github.com/whyrusleeping/go-smux-yamux"
+)
+
+// Stack 描述一个 host 使用的传输层、安全层和多路复用
+type Stack struct {
+	Transport string
+	Security  string
+	Muxer     string
+}
+
+func (st Stack) String() string {
+	return fmt.Sprintf("%s/%s/%s", st.Transport, st.Security, st.Muxer)
+}
+
+// Flags 返回对端使用同样的协议栈时需要的命令行参数
+func (st Stack) Flags() string {
+	return fmt.Sprintf("-transport %s -security %s -muxer %s", st.Transport, st.Security, st.Muxer)
+}
+
+// ListenAddr 返回监听 port 的 multiaddr
+func (st Stack) ListenAddr(port int) (string, error) {
+	switch st.Transport {
+	case "tcp":
+		return fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port), nil
+	case "ws":
+		return fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", port), nil
+	default:
+		return "", fmt.Errorf("unknown transport %q, use tcp or ws", st.Transport)
+	}
+}
+
+// Options 把协议栈转换成 libp2p 的 Option，只启用选中的一种，方便比较不同的组合
+func (st Stack) Options() ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+
+	switch st.Transport {
+	case "tcp":
+		opts = append(opts, libp2p.Transport(tcp.NewTCPTransport))
+	case "ws":
+		opts = append(opts, libp2p.Transport(ws.New))
+	default:
+		return nil, fmt.Errorf("unknown transport %q, use tcp or ws", st.Transport)
+	}
+
+	switch st.Security {
+	case "secio":
+		opts = append(opts, libp2p.Security(secio.ID, secio.New))
+	case "noise":
+		opts = append(opts, libp2p.Security(noise.ID, noise.New))
+	case "tls":
+		opts = append(opts, libp2p.Security(libp2ptls.ID, libp2ptls.New))
+	case "insecure":
+		opts = append(opts, libp2p.NoSecurity)
+	default:
+		return nil, fmt.Errorf("unknown security %q, use secio, noise, tls or insecure", st.Security)
+	}
+
+	switch st.Muxer {
+	case "yamux":
+		opts = append(opts, libp2p.Muxer("/yamux/1.0.0", yamux.DefaultTransport))
+	case "mplex":
+		opts = append(opts, libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport))
+	default:
+		return nil, fmt.Errorf("unknown muxer %q, use yamux or mplex", st.Muxer)
+	}
+
+	return opts, nil
+}
+
+/*
+ * 私钥的来源:
+ *   1. keyFile 不为空时由 identity.Load 读取，不存在时生成并保存，peer ID 在多次运行之间保持不变
+ *   2. 没有 keyFile 时，seed 不为 0 则由 seed 生成，否则随机生成
+ */
+func loadKey(keyFile string, seed int64) (crypto.PrivKey, error) {
+	if keyFile != "" {
+		return identity.Load(keyFile)
+	}
+
+	var r io.Reader = rand.Reader
+	if seed != 0 {
+		r = mrand.New(mrand.NewSource(seed))
+	}
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, r)
+	return priv, err
+}
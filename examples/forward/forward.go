@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	streamutil "github.com/czh0526/libp2p/p2p/streamutil"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+// Forwarder 把本地地址上的连接通过 libp2p stream 转发到 dest 节点，由 dest 连接 target
+type Forwarder struct {
+	host   host.Host
+	dest   peer.ID
+	target ma.Multiaddr
+}
+
+func NewForwarder(h host.Host, dest peer.ID, target ma.Multiaddr) *Forwarder {
+	return &Forwarder{
+		host:   h,
+		dest:   dest,
+		target: target,
+	}
+}
+
+// openStream 打开一个 stream 并完成握手
+func (f *Forwarder) openStream(ctx context.Context) (inet.Stream, *bufio.Reader, error) {
+	stream, err := f.host.NewStream(ctx, f.dest, Protocol)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeHeader(stream, f.target); err != nil {
+		stream.Reset()
+		return nil, nil, err
+	}
+
+	buf := bufio.NewReader(stream)
+	if err := readStatus(buf); err != nil {
+		stream.Reset()
+		return nil, nil, err
+	}
+	return stream, buf, nil
+}
+
+// ServeTCP 接受本地 TCP 连接，每个连接对应一个 stream
+func (f *Forwarder) ServeTCP(local ma.Multiaddr) error {
+	// 用 net 而不是 manet 监听，这样拿到的是 *net.TCPConn，可以半关闭
+	network, addr, err := manet.DialArgs(local)
+	if err != nil {
+		return err
+	}
+	list, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer list.Close()
+	fmt.Printf("forwarding %s => %s via %s \n", list.Addr(), f.target, f.dest.Pretty())
+
+	for {
+		conn, err := list.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+			stream, buf, err := f.openStream(ctx)
+			cancel()
+			if err != nil {
+				fmt.Printf("forward %s failed: %s \n", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			streamutil.Splice(conn, conn, stream, buf)
+		}()
+	}
+}
+
+// ServeUDP 接收本地 UDP 数据报，每个来源地址对应一个 stream
+func (f *Forwarder) ServeUDP(local ma.Multiaddr) error {
+	network, addr, err := manet.DialArgs(local)
+	if err != nil {
+		return err
+	}
+	laddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	fmt.Printf("forwarding %s => %s via %s \n", conn.LocalAddr(), f.target, f.dest.Pretty())
+
+	sessions := &udpSessions{
+		f:    f,
+		conn: conn,
+		m:    make(map[string]*udpSession),
+	}
+	pkt := make([]byte, maxDatagramLen)
+	for {
+		n, src, err := conn.ReadFromUDP(pkt)
+		if err != nil {
+			return err
+		}
+		sessions.deliver(src, pkt[:n])
+	}
+}
+
+// udpSessions 是 ServeUDP 按来源地址维护的会话。
+// 数据报在 mu 下放入会话的队列，会话也在 mu 下决定结束并从表中删除，
+// 所以结束的会话不会再收到数据报，之后到达的数据报开始新的会话。
+// mu 只保护 m，stream 在每个会话自己的 goroutine 中打开，不阻塞读循环
+type udpSessions struct {
+	f    *Forwarder
+	conn *net.UDPConn
+
+	mu sync.Mutex
+	m  map[string]*udpSession
+}
+
+// deliver 把数据报交给 src 的会话，没有会话时新建一个
+func (ss *udpSessions) deliver(src *net.UDPAddr, data []byte) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	key := src.String()
+	s, ok := ss.m[key]
+	if !ok {
+		s = newUDPSession(src)
+		ss.m[key] = s
+		go ss.run(s)
+	}
+	s.enqueue(data)
+}
+
+// remove 把 s 从表中删除。idleOnly 为 true 时只删除空闲超时的会话，返回是否删除
+func (ss *udpSessions) remove(s *udpSession, idleOnly bool) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if idleOnly && !s.idle() {
+		return false
+	}
+	if key := s.src.String(); ss.m[key] == s {
+		delete(ss.m, key)
+	}
+	return true
+}
+
+// run 打开 stream，之后发送队列中的数据报并把回复发回来源地址，直到 stream 出错或者会话空闲超时
+func (ss *udpSessions) run(s *udpSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	stream, buf, err := ss.f.openStream(ctx)
+	cancel()
+	if err != nil {
+		ss.remove(s, false)
+		fmt.Printf("forward %s failed: %s \n", s.src, err)
+		return
+	}
+	s.stream = stream
+
+	done := make(chan struct{})
+	defer close(done)
+	go ss.sendLoop(s, done)
+	go ss.expireLoop(s, done)
+	ss.relayBack(s, buf)
+}
+
+// udpQueueLen 是每个会话缓存的数据报数量: stream 建立之前收到的数据报在队列中等待，队列满时丢弃
+const udpQueueLen = 64
+
+type udpSession struct {
+	src    *net.UDPAddr
+	stream inet.Stream
+	queue  chan []byte
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newUDPSession(src *net.UDPAddr) *udpSession {
+	return &udpSession{
+		src:   src,
+		queue: make(chan []byte, udpQueueLen),
+		last:  time.Now(),
+	}
+}
+
+// enqueue 复制数据报放入队列，不阻塞读循环
+func (s *udpSession) enqueue(data []byte) {
+	s.touch()
+
+	select {
+	case s.queue <- append([]byte(nil), data...):
+	default:
+	}
+}
+
+func (s *udpSession) touch() {
+	s.mu.Lock()
+	s.last = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *udpSession) idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.last) > udpIdleTimeout
+}
+
+// sendLoop 把队列中的数据报写到 stream，直到 done 关闭
+func (ss *udpSessions) sendLoop(s *udpSession, done <-chan struct{}) {
+	for {
+		select {
+		case pkt := <-s.queue:
+			if err := writeDatagram(s.stream, pkt); err != nil {
+				// 先删除会话，之后的数据报交给新的会话；relayBack 随之返回
+				ss.remove(s, false)
+				s.stream.Reset()
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// expireLoop 在会话空闲超时后删除会话并关闭 stream
+func (ss *udpSessions) expireLoop(s *udpSession, done <-chan struct{}) {
+	t := time.NewTicker(udpIdleTimeout / 4)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if ss.remove(s, true) {
+				s.stream.Reset()
+				return
+			}
+		}
+	}
+}
+
+// relayBack 把 stream 上收到的数据报发回来源地址，直到 stream 出错
+func (ss *udpSessions) relayBack(s *udpSession, buf *bufio.Reader) {
+	defer s.stream.Reset()
+	defer ss.remove(s, false)
+
+	var pkt []byte
+	var err error
+	for {
+		pkt, err = readDatagram(buf, pkt)
+		if err != nil {
+			return
+		}
+		s.touch()
+		if _, err := ss.conn.WriteToUDP(pkt, s.src); err != nil {
+			return
+		}
+	}
+}
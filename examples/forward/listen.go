@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	streamutil "github.com/czh0526/libp2p/p2p/streamutil"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr-net"
+)
+
+const dialTimeout = 10 * time.Second
+
+// UDP 会话空闲这么久之后关闭
+const udpIdleTimeout = 2 * time.Minute
+
+// Allowlist 是出口一侧的访问控制: 哪些 peer 可以使用，可以连到哪些目标
+type Allowlist struct {
+	anyPeer bool
+	peers   map[peer.ID]bool
+	targets map[string]bool
+}
+
+// ParseAllowlist 解析逗号分隔的 peer ID 和目标 multiaddr 列表，peer 列表为 "*" 时允许所有 peer
+func ParseAllowlist(peers, targets string) (*Allowlist, error) {
+	al := &Allowlist{
+		peers:   make(map[peer.ID]bool),
+		targets: make(map[string]bool),
+	}
+
+	for _, s := range splitList(peers) {
+		if s == "*" {
+			al.anyPeer = true
+			continue
+		}
+		id, err := peer.IDB58Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad peer id %q: %s", s, err)
+		}
+		al.peers[id] = true
+	}
+
+	for _, s := range splitList(targets) {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad target %q: %s", s, err)
+		}
+		al.targets[addr.String()] = true
+	}
+	if len(al.targets) == 0 {
+		return nil, errors.New("at least one allowed target is required")
+	}
+	return al, nil
+}
+
+func (al *Allowlist) AllowPeer(p peer.ID) bool {
+	return al.anyPeer || al.peers[p]
+}
+
+func (al *Allowlist) AllowTarget(addr ma.Multiaddr) bool {
+	return al.targets[addr.String()]
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// listen 模式: 接收 forward 端的 stream，检查 allowlist 后连接目标
+func newStreamHandler(al *Allowlist) inet.StreamHandler {
+	return func(stream inet.Stream) {
+		remote := stream.Conn().RemotePeer()
+		if !al.AllowPeer(remote) {
+			fmt.Printf("denied peer %s \n", remote.Pretty())
+			writeStatus(stream, errors.New("peer not allowed"))
+			stream.Close()
+			return
+		}
+
+		buf := bufio.NewReader(stream)
+		target, err := readHeader(buf)
+		if err != nil {
+			fmt.Printf("bad header from %s: %s \n", remote.Pretty(), err)
+			stream.Reset()
+			return
+		}
+		if !al.AllowTarget(target) {
+			fmt.Printf("denied %s => %s \n", remote.Pretty(), target)
+			writeStatus(stream, errors.New("target not allowed"))
+			stream.Close()
+			return
+		}
+
+		fmt.Printf("%s => %s \n", remote.Pretty(), target)
+		if isUDP(target) {
+			exitUDP(stream, buf, target)
+		} else {
+			exitTCP(stream, buf, target)
+		}
+	}
+}
+
+func exitTCP(stream inet.Stream, buf *bufio.Reader, target ma.Multiaddr) {
+	network, addr, err := manet.DialArgs(target)
+	if err != nil {
+		writeStatus(stream, err)
+		stream.Close()
+		return
+	}
+	conn, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		fmt.Println(err)
+		writeStatus(stream, err)
+		stream.Close()
+		return
+	}
+	if err := writeStatus(stream, nil); err != nil {
+		stream.Reset()
+		conn.Close()
+		return
+	}
+
+	streamutil.Splice(conn, conn, stream, buf)
+}
+
+func exitUDP(stream inet.Stream, buf *bufio.Reader, target ma.Multiaddr) {
+	network, addr, err := manet.DialArgs(target)
+	if err != nil {
+		writeStatus(stream, err)
+		stream.Close()
+		return
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		fmt.Println(err)
+		writeStatus(stream, err)
+		stream.Close()
+		return
+	}
+	defer conn.Close()
+	if err := writeStatus(stream, nil); err != nil {
+		stream.Reset()
+		return
+	}
+
+	done := make(chan struct{})
+
+	// 目标 ==> stream
+	go func() {
+		defer close(done)
+		pkt := make([]byte, maxDatagramLen)
+		for {
+			conn.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+			n, err := conn.Read(pkt)
+			if err != nil {
+				stream.Close()
+				return
+			}
+			if err := writeDatagram(stream, pkt[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	// stream ==> 目标
+	var pkt []byte
+	for {
+		pkt, err = readDatagram(buf, pkt)
+		if err != nil {
+			if err != io.EOF {
+				stream.Reset()
+			}
+			break
+		}
+		if _, err := conn.Write(pkt); err != nil {
+			stream.Reset()
+			break
+		}
+	}
+	conn.Close()
+	<-done
+}
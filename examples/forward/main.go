@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+
+	identity "github.com/czh0526/libp2p/p2p/identity"
+	libp2p "github.com/libp2p/go-libp2p"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const help = `
+This example forwards arbitrary TCP or UDP ports over libp2p streams, so that a
+service on a NATed box (SSH, Postgres, ...) can be reached by peer ID.
+
+Exit side, which connects to the real service:
+  ./forward listen -l 4001 -key exit.key \
+      -allow-peers <peer-id>[,<peer-id>...] -allow-targets /ip4/127.0.0.1/tcp/22
+
+Entry side, which accepts local connections:
+  ./forward forward -from /ip4/127.0.0.1/tcp/2222 \
+      -peer /ip4/<exit-ip>/tcp/4001/ipfs/<exit-peer-id> -to /ip4/127.0.0.1/tcp/22
+
+Then: ssh -p 2222 localhost
+Use /udp/ in -from and -to to forward UDP datagrams.
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Print(help)
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "listen":
+		err = runListen(flag.Args()[1:])
+	case "forward":
+		err = runForward(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func runListen(args []string) error {
+	fs := flag.NewFlagSet("listen", flag.ExitOnError)
+	port := fs.Int("l", 4001, "libp2p listen port")
+	keyFile := fs.String("key", "", "private key file, created if missing (keeps the peer ID stable)")
+	peers := fs.String("allow-peers", "", "comma separated peer IDs allowed to forward, * for any")
+	targets := fs.String("allow-targets", "", "comma separated target multiaddrs that may be reached")
+	fs.Parse(args)
+
+	al, err := ParseAllowlist(*peers, *targets)
+	if err != nil {
+		return err
+	}
+
+	h, err := makeHost(*port, *keyFile)
+	if err != nil {
+		return err
+	}
+	h.SetStreamHandler(Protocol, newStreamHandler(al))
+
+	for _, a := range h.Addrs() {
+		fmt.Printf("%s/ipfs/%s\n", a, h.ID().Pretty())
+	}
+	<-make(chan struct{})
+	return nil
+}
+
+func runForward(args []string) error {
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	port := fs.Int("l", 0, "libp2p listen port")
+	keyFile := fs.String("key", "", "private key file, created if missing")
+	from := fs.String("from", "", "local multiaddr to accept connections on")
+	dest := fs.String("peer", "", "exit peer multiaddr, /ip4/<ip>/tcp/<port>/ipfs/<peer-id>")
+	to := fs.String("to", "", "target multiaddr, as seen from the exit peer")
+	fs.Parse(args)
+
+	if *from == "" || *dest == "" || *to == "" {
+		return fmt.Errorf("-from, -peer and -to are required")
+	}
+	local, err := ma.NewMultiaddr(*from)
+	if err != nil {
+		return err
+	}
+	target, err := ma.NewMultiaddr(*to)
+	if err != nil {
+		return err
+	}
+	if isUDP(local) != isUDP(target) {
+		return fmt.Errorf("-from and -to must both be tcp or both be udp")
+	}
+
+	h, err := makeHost(*port, *keyFile)
+	if err != nil {
+		return err
+	}
+	destID, err := addAddrToPeerstore(h, *dest)
+	if err != nil {
+		return err
+	}
+
+	f := NewForwarder(h, destID, target)
+	if isUDP(local) {
+		return f.ServeUDP(local)
+	}
+	return f.ServeTCP(local)
+}
+
+// 构建主机，指定 keyFile 时从文件中读取私钥（不存在则生成并保存）
+func makeHost(port int, keyFile string) (host.Host, error) {
+	priv, err := loadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return libp2p.New(
+		context.Background(),
+		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)),
+		libp2p.Identity(priv),
+	)
+}
+
+// loadKey 在指定 keyFile 时由 identity.Load 读取（不存在则生成并保存），否则随机生成
+func loadKey(keyFile string) (crypto.PrivKey, error) {
+	if keyFile != "" {
+		return identity.Load(keyFile)
+	}
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, rand.Reader)
+	return priv, err
+}
+
+/*
+ * /ip4/<x.x.x.x>/tcp/<port>/ipfs/<peerid> ---- <peerid>
+ *                                          \__ /ip4/<x.x.x.x>/tcp/<port>
+ */
+func addAddrToPeerstore(h host.Host, addr string) (peer.ID, error) {
+	ipfsaddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return "", err
+	}
+	pid, err := ipfsaddr.ValueForProtocol(ma.P_IPFS)
+	if err != nil {
+		return "", err
+	}
+	peerid, err := peer.IDB58Decode(pid)
+	if err != nil {
+		return "", err
+	}
+
+	targetPeerAddr, _ := ma.NewMultiaddr(fmt.Sprintf("/ipfs/%s", pid))
+	targetAddr := ipfsaddr.Decapsulate(targetPeerAddr)
+	h.Peerstore().AddAddr(peerid, targetAddr, pstore.PermanentAddrTTL)
+	return peerid, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const Protocol = "/forward/0.0.1"
+
+// 目标地址的最大长度
+const maxHeaderLen = 1024
+
+// UDP 数据报在 stream 上用 2 字节大端长度分帧
+const maxDatagramLen = 65535
+
+/*
+ * 协议:
+ *   forward ==> listen:  uvarint(len) | target multiaddr (bytes)
+ *   listen  ==> forward: "OK\n" 或 "ERR <原因>\n"
+ * 之后 TCP 目标直接传输字节流，UDP 目标按数据报分帧传输
+ */
+
+func writeHeader(w io.Writer, target ma.Multiaddr) error {
+	b := target.Bytes()
+	buf := make([]byte, binary.MaxVarintLen64+len(b))
+	n := binary.PutUvarint(buf, uint64(len(b)))
+	n += copy(buf[n:], b)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+func readHeader(r *bufio.Reader) (ma.Multiaddr, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxHeaderLen {
+		return nil, errors.New("target address too long")
+	}
+
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return ma.NewMultiaddrBytes(b)
+}
+
+func writeStatus(w io.Writer, err error) error {
+	if err == nil {
+		_, werr := io.WriteString(w, "OK\n")
+		return werr
+	}
+	_, werr := fmt.Fprintf(w, "ERR %s\n", strings.Replace(err.Error(), "\n", " ", -1))
+	return werr
+}
+
+func readStatus(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if line == "OK" {
+		return nil
+	}
+	return fmt.Errorf("remote refused: %s", strings.TrimPrefix(line, "ERR "))
+}
+
+func writeDatagram(w io.Writer, data []byte) error {
+	if len(data) > maxDatagramLen {
+		return errors.New("datagram too large")
+	}
+	buf := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(buf, uint16(len(data)))
+	copy(buf[2:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readDatagram(r io.Reader, buf []byte) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// isUDP 判断目标地址是否是 UDP
+func isUDP(addr ma.Multiaddr) bool {
+	for _, p := range addr.Protocols() {
+		if p.Code == ma.P_UDP {
+			return true
+		}
+	}
+	return false
+}
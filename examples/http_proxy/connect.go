@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	streamutil "github.com/czh0526/libp2p/p2p/streamutil"
+	inet "github.com/libp2p/go-libp2p-net"
+)
+
+const dialTimeout = 10 * time.Second
+
+// local peer 使用: 处理 CONNECT，把客户端的 TCP 连接和一个 libp2p stream 拼接起来
+func (p *ProxyService) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, err := p.host.NewStream(context.Background(), p.dest, Protocol)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// ==> CONNECT host:port
+	if _, err := fmt.Fprintf(stream, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", r.Host, r.Host); err != nil {
+		stream.Reset()
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// <== 远端拨号的结果
+	sbuf := bufio.NewReader(stream)
+	resp, err := http.ReadResponse(sbuf, r)
+	if err != nil {
+		stream.Reset()
+		fmt.Println(err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		// 把远端的说明（例如出口策略的 403）原样交给客户端
+		defer stream.Close()
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	conn, cbuf, err := hj.Hijack()
+	if err != nil {
+		stream.Reset()
+		fmt.Println(err)
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		stream.Reset()
+		conn.Close()
+		return
+	}
+
+	// 两侧的 bufio 中可能已经缓存了数据，从 buffer 读取
+	streamutil.Splice(conn, cbuf.Reader, stream, sbuf)
+}
+
+// remote peer 使用: 拨号 CONNECT 的目标，成功后拼接 stream 和 TCP 连接
+func (p *ProxyService) handleConnect(stream inet.Stream, sbuf *bufio.Reader, req *http.Request) {
+	fmt.Printf("Tunneling to %s \n", req.Host)
+	// 拨号与策略检查相同的端口
+	addr := req.Host
+	if host, port := splitHostPort(addr); port == "" {
+		addr = net.JoinHostPort(host, defaultPort(req))
+	}
+	conn, err := p.policy.Dialer().Dial("tcp", addr)
+	if err != nil {
+		if perr, ok := asPolicyError(err); ok {
+			perr.Peer = stream.Conn().RemotePeer().Pretty()
+			writeDenied(stream, perr)
+			stream.Close()
+			return
+		}
+		fmt.Println(err)
+		fmt.Fprintf(stream, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+		stream.Close()
+		return
+	}
+
+	if _, err := fmt.Fprintf(stream, "HTTP/1.1 200 OK\r\n\r\n"); err != nil {
+		stream.Reset()
+		conn.Close()
+		return
+	}
+
+	streamutil.Splice(conn, conn, stream, sbuf)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// 拒绝原因，放在 403 响应的 reason 字段中
+const (
+	ReasonPeerNotAllowed = "peer_not_allowed"
+	ReasonHostNotAllowed = "host_not_allowed"
+	ReasonPrivateAddress = "private_address"
+	ReasonRateLimited    = "rate_limited"
+)
+
+// PolicyError 表示请求被出口策略拒绝
+type PolicyError struct {
+	Reason string `json:"reason"`
+	Peer   string `json:"peer"`
+	Host   string `json:"host"`
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s => %s", e.Reason, e.Peer, e.Host)
+}
+
+// ExitPolicy 是 remote peer 的出口策略: 允许哪些 peer、访问哪些目标、每个 peer 的请求频率
+type ExitPolicy struct {
+	// 为空时允许所有 peer
+	AllowedPeers map[peer.ID]bool
+	// 为空时允许所有目标，格式见 HostPattern
+	AllowedHosts []HostPattern
+	// 是否允许访问 localhost、RFC1918 等内网地址
+	AllowPrivate bool
+	// 每个 peer 每秒允许的请求数，0 表示不限制
+	Rate  float64
+	Burst int
+
+	mu       sync.Mutex
+	limiters map[peer.ID]*tokenBucket
+}
+
+// DefaultExitPolicy 允许所有 peer 和公网目标，禁止访问内网地址
+func DefaultExitPolicy() *ExitPolicy {
+	return &ExitPolicy{}
+}
+
+// Check 在发起请求之前检查 peer 和目标 host:port，内网地址在拨号时由 Dialer 检查。
+// hostport 没有端口时使用 defaultPort，见 defaultPort 函数
+func (ep *ExitPolicy) Check(p peer.ID, hostport, defaultPort string) *PolicyError {
+	deny := func(reason string) *PolicyError {
+		return &PolicyError{Reason: reason, Peer: p.Pretty(), Host: hostport}
+	}
+
+	if len(ep.AllowedPeers) > 0 && !ep.AllowedPeers[p] {
+		return deny(ReasonPeerNotAllowed)
+	}
+
+	host, port := splitHostPort(hostport)
+	if port == "" {
+		port = defaultPort
+	}
+	if len(ep.AllowedHosts) > 0 {
+		allowed := false
+		for _, hp := range ep.AllowedHosts {
+			if hp.Match(host, port) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return deny(ReasonHostNotAllowed)
+		}
+	}
+
+	// 明显的内网地址不必等到拨号
+	if !ep.AllowPrivate {
+		if ip := net.ParseIP(host); (ip != nil && isPrivateIP(ip)) || strings.EqualFold(host, "localhost") {
+			return deny(ReasonPrivateAddress)
+		}
+	}
+
+	if ep.Rate > 0 && !ep.limiter(p).allow() {
+		return deny(ReasonRateLimited)
+	}
+	return nil
+}
+
+func (ep *ExitPolicy) limiter(p peer.ID) *tokenBucket {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	if ep.limiters == nil {
+		ep.limiters = make(map[peer.ID]*tokenBucket)
+	}
+	tb, ok := ep.limiters[p]
+	if !ok {
+		burst := ep.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		tb = newTokenBucket(ep.Rate, burst)
+		ep.limiters[p] = tb
+	}
+	return tb
+}
+
+// Dialer 返回一个在连接建立前检查实际 IP 的 Dialer，域名解析到内网地址时同样会被拒绝
+func (ep *ExitPolicy) Dialer() *net.Dialer {
+	d := &net.Dialer{Timeout: dialTimeout}
+	if ep.AllowPrivate {
+		return d
+	}
+	d.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+			return &PolicyError{Reason: ReasonPrivateAddress, Host: address}
+		}
+		return nil
+	}
+	return d
+}
+
+// Transport 返回使用 Dialer 的 http.Transport
+func (ep *ExitPolicy) Transport() *http.Transport {
+	d := ep.Dialer()
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, network, addr)
+		},
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// HostPattern 匹配目标的 host 和 port，例如 "ipfs.io:443"、"*.ipfs.io"、"*:80"
+type HostPattern struct {
+	Host string
+	Port string
+}
+
+func ParseHostPatterns(s string) []HostPattern {
+	var out []HostPattern
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		host, port := splitHostPort(f)
+		if port == "" {
+			port = "*"
+		}
+		out = append(out, HostPattern{Host: strings.ToLower(host), Port: port})
+	}
+	return out
+}
+
+func (hp HostPattern) Match(host, port string) bool {
+	if hp.Port != "*" && hp.Port != port {
+		return false
+	}
+
+	host = strings.ToLower(host)
+	switch {
+	case hp.Host == "*":
+		return true
+	case strings.HasPrefix(hp.Host, "*."):
+		return strings.HasSuffix(host, hp.Host[1:])
+	default:
+		return host == hp.Host
+	}
+}
+
+// defaultPort 返回请求的 Host 没有端口时的默认端口: CONNECT 和 https 为 443，其它为 80
+func defaultPort(req *http.Request) string {
+	if req.Method == http.MethodConnect || (req.URL != nil && req.URL.Scheme == "https") {
+		return "443"
+	}
+	return "80"
+}
+
+// splitHostPort 拆分 host:port，没有端口时 port 为空
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.Trim(hostport, "[]"), ""
+	}
+	return host, port
+}
+
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range []string{
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10",
+		"169.254.0.0/16",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDenied 记录日志，并向 stream 写一个带 JSON 说明的 403 响应
+func writeDenied(w io.Writer, perr *PolicyError) error {
+	fmt.Printf("denied: %s \n", perr)
+
+	body, err := json.Marshal(perr)
+	if err != nil {
+		return err
+	}
+	resp := &http.Response{
+		StatusCode:    http.StatusForbidden,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	return resp.Write(w)
+}
+
+// asPolicyError 取出拨号错误中的 PolicyError
+func asPolicyError(err error) (*PolicyError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *PolicyError:
+			return e, true
+		case *net.OpError:
+			err = e.Err
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// tokenBucket 是一个简单的令牌桶
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (tb *tokenBucket) allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
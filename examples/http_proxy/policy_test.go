@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestCheck(t *testing.T) {
+	alice, bob := peer.ID("alice"), peer.ID("bob")
+	allowAlice := map[peer.ID]bool{alice: true}
+
+	cases := []struct {
+		name        string
+		peers       map[peer.ID]bool
+		hosts       string
+		private     bool
+		p           peer.ID
+		hostport    string
+		defaultPort string
+		reason      string
+	}{
+		{name: "default allows public", p: alice, hostport: "example.com", defaultPort: "80"},
+		{name: "default denies localhost", p: alice, hostport: "localhost:8080", defaultPort: "80", reason: ReasonPrivateAddress},
+		{name: "default denies private ip", p: alice, hostport: "10.1.2.3", defaultPort: "80", reason: ReasonPrivateAddress},
+		{name: "default denies loopback ipv6", p: alice, hostport: "[::1]:80", defaultPort: "80", reason: ReasonPrivateAddress},
+		{name: "allow private", private: true, p: alice, hostport: "192.168.1.1:80", defaultPort: "80"},
+
+		// 没有端口时使用默认端口
+		{name: "implicit http port", hosts: "example.com:80", p: alice, hostport: "example.com", defaultPort: "80"},
+		{name: "implicit http port wildcard", hosts: "*:80", p: alice, hostport: "example.com", defaultPort: "80"},
+		{name: "implicit https port", hosts: "example.com:443", p: alice, hostport: "example.com", defaultPort: "443"},
+		{name: "implicit port mismatch", hosts: "example.com:443", p: alice, hostport: "example.com", defaultPort: "80", reason: ReasonHostNotAllowed},
+		{name: "explicit port wins", hosts: "example.com:80", p: alice, hostport: "example.com:8080", defaultPort: "80", reason: ReasonHostNotAllowed},
+		{name: "implicit port ipv6", hosts: "*:80", private: true, p: alice, hostport: "[::1]", defaultPort: "80"},
+
+		// 通配符
+		{name: "any port", hosts: "example.com", p: alice, hostport: "example.com:8080", defaultPort: "80"},
+		{name: "suffix wildcard", hosts: "*.ipfs.io:443", p: alice, hostport: "gateway.ipfs.io", defaultPort: "443"},
+		{name: "suffix wildcard case", hosts: "*.ipfs.io", p: alice, hostport: "Gateway.IPFS.io:443", defaultPort: "443"},
+		{name: "suffix wildcard excludes apex", hosts: "*.ipfs.io", p: alice, hostport: "ipfs.io", defaultPort: "443", reason: ReasonHostNotAllowed},
+		{name: "suffix wildcard excludes lookalike", hosts: "*.ipfs.io", p: alice, hostport: "evilipfs.io", defaultPort: "443", reason: ReasonHostNotAllowed},
+		{name: "host not in list", hosts: "ipfs.io,*.libp2p.io:443", p: alice, hostport: "example.com", defaultPort: "443", reason: ReasonHostNotAllowed},
+
+		// 拒绝的先后顺序: peer、host、内网地址
+		{name: "peer allowed", peers: allowAlice, p: alice, hostport: "example.com", defaultPort: "80"},
+		{name: "peer denied first", peers: allowAlice, hosts: "example.com:443", p: bob, hostport: "localhost", defaultPort: "80", reason: ReasonPeerNotAllowed},
+		{name: "host denied before private", hosts: "example.com", p: alice, hostport: "localhost", defaultPort: "80", reason: ReasonHostNotAllowed},
+		{name: "private denied even if host allowed", hosts: "*:80", p: alice, hostport: "127.0.0.1", defaultPort: "80", reason: ReasonPrivateAddress},
+	}
+
+	for _, c := range cases {
+		ep := DefaultExitPolicy()
+		ep.AllowedPeers = c.peers
+		ep.AllowedHosts = ParseHostPatterns(c.hosts)
+		ep.AllowPrivate = c.private
+
+		perr := ep.Check(c.p, c.hostport, c.defaultPort)
+		switch {
+		case c.reason == "" && perr != nil:
+			t.Errorf("%s: expected allowed, got %s", c.name, perr)
+		case c.reason != "" && perr == nil:
+			t.Errorf("%s: expected %s, got allowed", c.name, c.reason)
+		case c.reason != "" && perr.Reason != c.reason:
+			t.Errorf("%s: expected %s, got %s", c.name, c.reason, perr.Reason)
+		}
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	ep := DefaultExitPolicy()
+	ep.Rate = 0.001
+	ep.Burst = 2
+	alice, bob := peer.ID("alice"), peer.ID("bob")
+
+	for i := 0; i < 2; i++ {
+		if perr := ep.Check(alice, "example.com", "80"); perr != nil {
+			t.Fatal(perr)
+		}
+	}
+	if perr := ep.Check(alice, "example.com", "80"); perr == nil || perr.Reason != ReasonRateLimited {
+		t.Fatalf("expected %s, got %v", ReasonRateLimited, perr)
+	}
+	// 每个 peer 单独限制
+	if perr := ep.Check(bob, "example.com", "80"); perr != nil {
+		t.Fatal(perr)
+	}
+	// 被拒绝的请求不消耗令牌
+	ep.AllowedHosts = ParseHostPatterns("ipfs.io")
+	if perr := ep.Check(bob, "example.com", "80"); perr == nil || perr.Reason != ReasonHostNotAllowed {
+		t.Fatalf("expected %s, got %v", ReasonHostNotAllowed, perr)
+	}
+	if perr := ep.Check(bob, "ipfs.io", "80"); perr != nil {
+		t.Fatal(perr)
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	cases := []struct {
+		method string
+		url    string
+		port   string
+	}{
+		{http.MethodGet, "http://example.com/", "80"},
+		{http.MethodPost, "http://example.com:8080/", "80"},
+		{http.MethodGet, "https://example.com/", "443"},
+		{http.MethodConnect, "", "443"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if port := defaultPort(&http.Request{Method: c.method, URL: u}); port != c.port {
+			t.Errorf("%s %s: expected %s, got %s", c.method, c.url, c.port, port)
+		}
+	}
+}
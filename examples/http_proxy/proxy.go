@@ -26,6 +26,7 @@ send the sends the response back.
 Usage: Start remote peer first with:   ./proxy
        Then start the local peer with: ./proxy -d <remote-peer-multiaddress>
 Then you can do something like: curl -x "localhost:9900" "http://ipfs.io".
+HTTPS works too, through CONNECT: curl -x "localhost:9900" "https://ipfs.io".
 This proxies sends the request through the local peer, which proxies it to
 the remote peer, which makes it and sends the response back.
 `
@@ -47,11 +48,25 @@ type ProxyService struct {
 	host      host.Host
 	dest      peer.ID
 	proxyAddr ma.Multiaddr
+
+	// remote peer 使用的出口策略
+	policy    *ExitPolicy
+	transport *http.Transport
 }
 
-// 构建代理服务器
-func NewProxyService(h host.Host, proxyAddr ma.Multiaddr, dest peer.ID) *ProxyService {
-	h.SetStreamHandler(Protocol, streamHandler)
+// 构建代理服务器，policy 为 nil 时使用 DefaultExitPolicy
+func NewProxyService(h host.Host, proxyAddr ma.Multiaddr, dest peer.ID, policy *ExitPolicy) *ProxyService {
+	if policy == nil {
+		policy = DefaultExitPolicy()
+	}
+	p := &ProxyService{
+		host:      h,
+		dest:      dest,
+		proxyAddr: proxyAddr,
+		policy:    policy,
+		transport: policy.Transport(),
+	}
+	h.SetStreamHandler(Protocol, p.streamHandler)
 
 	fmt.Println("Proxy server is ready.")
 	fmt.Println("libp2p-peer addresses: ")
@@ -59,17 +74,11 @@ func NewProxyService(h host.Host, proxyAddr ma.Multiaddr, dest peer.ID) *ProxySe
 		fmt.Printf("%s/ipfs/%s\n", a, peer.IDB58Encode(h.ID()))
 	}
 
-	return &ProxyService{
-		host:      h,
-		dest:      dest,
-		proxyAddr: proxyAddr,
-	}
+	return p
 }
 
 // remote host 使用
-func streamHandler(stream inet.Stream) {
-	defer stream.Close()
-
+func (p *ProxyService) streamHandler(stream inet.Stream) {
 	// 从 stream 中读 http request
 	buf := bufio.NewReader(stream)
 	req, err := http.ReadRequest(buf)
@@ -78,29 +87,60 @@ func streamHandler(stream inet.Stream) {
 		fmt.Println(err)
 		return
 	}
+
+	// 出口策略检查
+	if perr := p.policy.Check(stream.Conn().RemotePeer(), req.Host, defaultPort(req)); perr != nil {
+		writeDenied(stream, perr)
+		stream.Close()
+		return
+	}
+
+	// https 等通过 CONNECT 建立隧道
+	if req.Method == http.MethodConnect {
+		p.handleConnect(stream, buf, req)
+		return
+	}
+	defer stream.Close()
 	defer req.Body.Close()
 
 	req.URL.Scheme = "http"
-	hp := strings.Split(req.Host, ":")
-	if len(hp) > 1 && hp[1] == "443" {
-		req.URL.Scheme = "https"
-	} else {
-		req.URL.Scheme = "http"
-	}
 	req.URL.Host = req.Host
 
 	outreq := new(http.Request)
 	*outreq = *req
+	outreq.RequestURI = ""
+	outreq.Header = cloneHeader(req.Header)
+	removeHopHeaders(outreq.Header)
 
 	fmt.Printf("Making request to %s \n", req.URL)
-	resp, err := http.DefaultTransport.RoundTrip(outreq)
+	// 请求体直接从 stream 中读取，不做缓存
+	resp, err := p.transport.RoundTrip(outreq)
 	if err != nil {
+		if perr, ok := asPolicyError(err); ok {
+			perr.Peer = stream.Conn().RemotePeer().Pretty()
+			writeDenied(stream, perr)
+			return
+		}
 		stream.Reset()
 		fmt.Println(err)
 		return
 	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	// 响应体边读边写到 stream 中
+	if err := resp.Write(stream); err != nil {
+		stream.Reset()
+		fmt.Println(err)
+	}
+}
 
-	resp.Write(stream)
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		h2[k] = append([]string(nil), v...)
+	}
+	return h2
 }
 
 func (p *ProxyService) Serve() {
@@ -148,6 +188,11 @@ func addAddrToPeerstore(h host.Host, addr string) peer.ID {
 // local peer 使用
 func (p *ProxyService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("proxying request for %s to peer %s \n", r.URL, p.dest.Pretty())
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+
 	// Stream: host ==> dest
 	stream, err := p.host.NewStream(context.Background(), p.dest, Protocol)
 	if err != nil {
@@ -157,14 +202,17 @@ func (p *ProxyService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer stream.Close()
 
-	// ==> request
-	err = r.Write(stream)
-	if err != nil {
-		stream.Reset()
-		fmt.Println(err)
-		http.Error(w, err.Error(), http.StatusServiceUnavailable)
-		return
-	}
+	outreq := r.WithContext(context.Background())
+	outreq.Header = cloneHeader(r.Header)
+	removeHopHeaders(outreq.Header)
+
+	// ==> request，请求体在单独的 goroutine 中边读边写，同时可以开始读取响应
+	go func() {
+		if err := outreq.Write(stream); err != nil {
+			fmt.Println(err)
+			stream.Reset()
+		}
+	}()
 
 	buf := bufio.NewReader(stream)
 	resp, err := http.ReadResponse(buf, r)
@@ -172,8 +220,11 @@ func (p *ProxyService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		stream.Reset()
 		fmt.Println(err)
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
+	defer resp.Body.Close()
 
+	removeHopHeaders(resp.Header)
 	for k, v := range resp.Header {
 		for _, s := range v {
 			w.Header().Add(k, s)
@@ -181,19 +232,78 @@ func (p *ProxyService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
-	resp.Body.Close()
+	if _, err := copyFlush(w, resp.Body); err != nil {
+		stream.Reset()
+		fmt.Println(err)
+	}
+}
+
+// copyFlush 把响应体写给客户端，每次写入后 flush，不在 ResponseWriter 中积攒数据
+func copyFlush(w http.ResponseWriter, r io.Reader) (int64, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return io.Copy(w, r)
+	}
+
+	var written int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			flusher.Flush()
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func parsePolicyFlags(peers, hosts string, allowPrivate bool, rate float64, burst int) (*ExitPolicy, error) {
+	policy := DefaultExitPolicy()
+	policy.AllowPrivate = allowPrivate
+	policy.Rate = rate
+	policy.Burst = burst
+	policy.AllowedHosts = ParseHostPatterns(hosts)
+
+	for _, s := range strings.Split(peers, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := peer.IDB58Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad peer id %q: %s", s, err)
+		}
+		if policy.AllowedPeers == nil {
+			policy.AllowedPeers = make(map[peer.ID]bool)
+		}
+		policy.AllowedPeers[id] = true
+	}
+	return policy, nil
 }
 
 func main() {
 	flag.Usage = func() {
-		fmt.Println(help)
+		fmt.Print(help)
 		flag.PrintDefaults()
 	}
 
 	destPeer := flag.String("d", "", "destination peer address")
 	port := flag.Int("p", 9900, "proxy port")
 	p2pport := flag.Int("l", 12000, "libp2p listen port")
+	// remote peer 的出口策略
+	allowPeers := flag.String("allow-peers", "", "comma separated peer IDs allowed to use this exit, empty for any")
+	allowHosts := flag.String("allow-hosts", "", "comma separated host[:port] patterns, e.g. *.ipfs.io:443, empty for any")
+	allowPrivate := flag.Bool("allow-private", false, "allow requests to localhost and private networks")
+	rate := flag.Float64("rate", 0, "requests per second allowed per peer, 0 for unlimited")
+	burst := flag.Int("burst", 10, "request burst allowed per peer")
 	flag.Parse()
 
 	if *destPeer != "" {
@@ -207,14 +317,18 @@ func main() {
 		}
 
 		// 启动本地代理服务
-		proxy := NewProxyService(host, proxyAddr, destPeerID)
+		proxy := NewProxyService(host, proxyAddr, destPeerID, nil)
 		proxy.Serve()
 
 	} else {
 		// 构建主机对象
 		host := makeRandomHost(*p2pport)
 		// 启动远程代理服务
-		_ = NewProxyService(host, nil, "")
+		policy, err := parsePolicyFlags(*allowPeers, *allowHosts, *allowPrivate, *rate, *burst)
+		if err != nil {
+			panic(err)
+		}
+		_ = NewProxyService(host, nil, "", policy)
 		<-make(chan struct{})
 	}
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	pb "github.com/czh0526/libp2p/multipro/pb"
+	signed "github.com/czh0526/libp2p/security/signed"
+	ggio "github.com/gogo/protobuf/io"
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/google/uuid"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+const gossipProtocol = "/gossip/0.0.1"
+
+const (
+	// 新消息的默认 ttl
+	DefaultGossipTTL = 8
+	// 收到的 ttl 超过这个值时按这个值处理，ttl 不在签名范围内，防止被随意放大
+	MaxGossipTTL = 16
+	// 单次转发的超时时间
+	gossipSendTimeout = 5 * time.Second
+)
+
+// GossipConfig 控制 gossip 的转发
+type GossipConfig struct {
+	// 每次转发给多少个 peer，0 表示所有相连的 peer
+	Fanout int
+	// 自己发起的消息的 ttl
+	TTL uint32
+}
+
+func DefaultGossipConfig() GossipConfig {
+	return GossipConfig{TTL: DefaultGossipTTL}
+}
+
+/*
+ * gossip 消息由发起者签名，之后的节点验证签名后原样转发:
+ *   1. MessageData.Gossip 为 false 的消息只在本地处理，不转发
+ *   2. 同一个消息 ID 只处理、转发一次，重复的消息直接丢弃
+ *   3. 每转发一次 ttl 减一，减到 0 不再转发
+ *   4. 每次随机选择 Fanout 个 peer，不包括消息的来源和发起者
+ */
+type GossipProtocol struct {
+	node *Node
+
+	mu       sync.Mutex
+	cfg      GossipConfig
+	handlers []func(msg *pb.GossipMessage)
+	rng      *rand.Rand
+}
+
+func NewGossipProtocol(node *Node, cfg GossipConfig) *GossipProtocol {
+	g := &GossipProtocol{
+		node: node,
+		cfg:  cfg,
+		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	node.SetStreamHandler(gossipProtocol, g.onGossip)
+	return g
+}
+
+// SetGossipConfig 修改转发的配置
+func (g *GossipProtocol) SetGossipConfig(cfg GossipConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cfg = cfg
+}
+
+// OnGossip 注册收到新 gossip 消息时的回调，每个消息只回调一次
+func (g *GossipProtocol) OnGossip(h func(msg *pb.GossipMessage)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.handlers = append(g.handlers, h)
+}
+
+// Publish 签名并发出一个 gossip 消息，返回消息 ID
+func (g *GossipProtocol) Publish(topic string, data []byte) (string, error) {
+	g.mu.Lock()
+	ttl := g.cfg.TTL
+	g.mu.Unlock()
+
+	id := uuid.New().String()
+	msg := &pb.GossipMessage{
+		MessageData: g.node.NewMessageData(id, true),
+		Topic:       topic,
+		Data:        data,
+	}
+	if err := g.node.signMessage(gossipProtocol, msg); err != nil {
+		return "", err
+	}
+	msg.Ttl = ttl
+
+	fmt.Printf("%s: Publishing gossip %s on %s \n", g.node.ID(), id, topic)
+	g.forward(msg, "")
+	return id, nil
+}
+
+func (g *GossipProtocol) onGossip(s inet.Stream) {
+	from := s.Conn().RemotePeer()
+
+	msg := new(pb.GossipMessage)
+	reader := ggio.NewDelimitedReader(s, maxRPCMessageSize)
+	err := reader.ReadMsg(msg)
+	s.Close()
+	if err != nil {
+		fmt.Printf("%s: read gossip from %s failed: %s \n", g.node.ID(), from, err)
+		return
+	}
+
+	data := msg.GetMessageData()
+	if data == nil || data.NodeId == peer.IDB58Encode(g.node.ID()) {
+		return
+	}
+
+	// 重复的消息不必再验证签名
+	if g.node.policy.HasSeen(&signed.Envelope{Domain: gossipProtocol, PeerID: data.NodeId, ID: data.Id}) {
+		return
+	}
+
+	// ttl 不在签名范围内，验证时置 0
+	ttl := msg.Ttl
+	msg.Ttl = 0
+	err = g.node.authenticateMessage(gossipProtocol, msg)
+	msg.Ttl = ttl
+	if err != nil {
+		if !signed.IsCode(err, signed.ErrReplay) {
+			fmt.Printf("%s: failed to authenticate gossip from %s: %s \n", g.node.ID(), from, err)
+		}
+		return
+	}
+
+	g.deliver(msg)
+
+	if !data.Gossip {
+		return
+	}
+	if ttl > MaxGossipTTL {
+		ttl = MaxGossipTTL
+	}
+	if ttl <= 1 {
+		return
+	}
+	// 回调可能还持有 msg，转发使用拷贝
+	fwd := proto.Clone(msg).(*pb.GossipMessage)
+	fwd.Ttl = ttl - 1
+	g.forward(fwd, from)
+}
+
+func (g *GossipProtocol) deliver(msg *pb.GossipMessage) {
+	g.mu.Lock()
+	handlers := make([]func(*pb.GossipMessage), len(g.handlers))
+	copy(handlers, g.handlers)
+	g.mu.Unlock()
+
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+// forward 把消息发给随机选出的 peer，不包括来源和发起者
+func (g *GossipProtocol) forward(msg *pb.GossipMessage, from peer.ID) {
+	origin := msg.GetMessageData().NodeId
+
+	var peers []peer.ID
+	for _, p := range g.node.Network().Peers() {
+		if p == from || peer.IDB58Encode(p) == origin {
+			continue
+		}
+		peers = append(peers, p)
+	}
+
+	g.mu.Lock()
+	fanout := g.cfg.Fanout
+	g.rng.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	g.mu.Unlock()
+	if fanout > 0 && len(peers) > fanout {
+		peers = peers[:fanout]
+	}
+
+	// 每个 peer 使用一份拷贝，避免并发序列化同一个消息
+	for _, p := range peers {
+		go g.send(p, proto.Clone(msg).(*pb.GossipMessage))
+	}
+}
+
+func (g *GossipProtocol) send(p peer.ID, msg *pb.GossipMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), gossipSendTimeout)
+	defer cancel()
+
+	s, err := g.node.NewStream(ctx, p, gossipProtocol)
+	if err != nil {
+		fmt.Printf("%s: failed to open gossip stream to %s: %s \n", g.node.ID(), p, err)
+		return
+	}
+	writer := ggio.NewDelimitedWriter(s)
+	if err := writer.WriteMsg(msg); err != nil {
+		fmt.Printf("%s: failed to send gossip to %s: %s \n", g.node.ID(), p, err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
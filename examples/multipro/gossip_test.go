@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/czh0526/libp2p/multipro/pb"
+)
+
+func connectNodes(t *testing.T, ctx context.Context, a, b *Node) {
+	if _, err := a.Network().DialPeer(ctx, b.ID()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gossipCounter 记录每个节点收到某个消息的次数
+type gossipCounter struct {
+	mu     sync.Mutex
+	counts map[int]int
+	all    chan struct{}
+	want   int
+}
+
+func countGossip(nodes []*Node, want int) *gossipCounter {
+	gc := &gossipCounter{
+		counts: make(map[int]int),
+		all:    make(chan struct{}),
+		want:   want,
+	}
+	for i, n := range nodes {
+		i := i
+		n.OnGossip(func(msg *pb.GossipMessage) {
+			gc.mu.Lock()
+			defer gc.mu.Unlock()
+			gc.counts[i]++
+			if len(gc.counts) == gc.want && gc.counts[i] == 1 {
+				close(gc.all)
+			}
+		})
+	}
+	return gc
+}
+
+func (gc *gossipCounter) wait(t *testing.T, timeout time.Duration) {
+	select {
+	case <-gc.all:
+	case <-time.After(timeout):
+		gc.mu.Lock()
+		defer gc.mu.Unlock()
+		t.Fatalf("gossip reached %d of %d nodes", len(gc.counts), gc.want)
+	}
+}
+
+func (gc *gossipCounter) check(t *testing.T) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	for i, c := range gc.counts {
+		if c != 1 {
+			t.Errorf("node %d received the message %d times", i, c)
+		}
+	}
+}
+
+func TestGossipRingPropagation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 50)
+
+	// 每个节点连接环上后面的三个节点，直径大约为 9
+	for i := range nodes {
+		for j := 1; j <= 3; j++ {
+			connectNodes(t, ctx, nodes[i], nodes[(i+j)%len(nodes)])
+		}
+	}
+	for _, n := range nodes {
+		n.SetGossipConfig(GossipConfig{TTL: MaxGossipTTL})
+	}
+
+	gc := countGossip(nodes[1:], len(nodes)-1)
+	if _, err := nodes[0].Publish("ring", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	gc.wait(t, 10*time.Second)
+
+	// 等待剩余的转发结束，检查没有重复投递
+	time.Sleep(200 * time.Millisecond)
+	gc.check(t)
+}
+
+func TestGossipFanoutPropagation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 50)
+
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			connectNodes(t, ctx, nodes[i], nodes[j])
+		}
+	}
+	// 每个节点只转发给 12 个 peer，所有节点都收不到的概率可以忽略
+	for _, n := range nodes {
+		n.SetGossipConfig(GossipConfig{Fanout: 12, TTL: DefaultGossipTTL})
+	}
+
+	gc := countGossip(nodes[1:], len(nodes)-1)
+	if _, err := nodes[0].Publish("mesh", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	gc.wait(t, 10*time.Second)
+
+	time.Sleep(200 * time.Millisecond)
+	gc.check(t)
+}
+
+func TestGossipTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 5)
+
+	// 0 - 1 - 2 - 3 - 4
+	for i := 0; i < len(nodes)-1; i++ {
+		connectNodes(t, ctx, nodes[i], nodes[i+1])
+	}
+	nodes[0].SetGossipConfig(GossipConfig{TTL: 3})
+
+	gc := countGossip(nodes[1:4], 3)
+	var mu sync.Mutex
+	reached := false
+	nodes[4].OnGossip(func(msg *pb.GossipMessage) {
+		mu.Lock()
+		reached = true
+		mu.Unlock()
+	})
+
+	if _, err := nodes[0].Publish("line", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	gc.wait(t, 5*time.Second)
+
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if reached {
+		t.Fatal("gossip travelled beyond its ttl")
+	}
+}
@@ -4,14 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync"
 
+	pb "github.com/czh0526/libp2p/multipro/pb"
 	libp2p "github.com/libp2p/go-libp2p"
 	crypto "github.com/libp2p/go-libp2p-crypto"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-func makeRandomNode(port int, done chan bool) *Node {
+func makeRandomNode(port int) *Node {
 	priv, _, _ := crypto.GenerateKeyPair(crypto.Secp256k1, 256)
 	listen, _ := ma.NewMultiaddr(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port))
 	host, _ := libp2p.New(
@@ -19,7 +21,7 @@ func makeRandomNode(port int, done chan bool) *Node {
 		libp2p.ListenAddrs(listen),
 		libp2p.Identity(priv),
 	)
-	return NewNode(host, done)
+	return NewNode(host)
 }
 
 func main() {
@@ -27,21 +29,44 @@ func main() {
 	port1 := rand.Intn(100) + 10000
 	port2 := port1 + 1
 
-	done := make(chan bool, 1)
-
-	h1 := makeRandomNode(port1, done)
-	h2 := makeRandomNode(port2, done)
+	h1 := makeRandomNode(port1)
+	h2 := makeRandomNode(port2)
 	h1.Peerstore().AddAddrs(h2.ID(), h2.Addrs(), pstore.PermanentAddrTTL)
 	h2.Peerstore().AddAddrs(h1.ID(), h1.Addrs(), pstore.PermanentAddrTTL)
 
 	fmt.Printf("This is a conversation between %s and %s \n", h1.ID(), h2.ID())
 
-	h1.Ping(h2.Host)
-	h2.Ping(h1.Host)
-	h1.Echo(h2.Host)
-	h2.Echo(h1.Host)
+	// 先建立连接，避免双方同时拨号
+	ctx := context.Background()
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		panic(err)
+	}
+
+	// 四个调用并发进行
+	var wg sync.WaitGroup
+	call := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+	call(func() error { _, err := h1.Ping(ctx, h2.ID()); return err })
+	call(func() error { _, err := h2.Ping(ctx, h1.ID()); return err })
+	call(func() error { _, err := h1.Echo(ctx, h2.ID(), fmt.Sprintf("Echo from %s", h1.ID())); return err })
+	call(func() error { _, err := h2.Echo(ctx, h1.ID(), fmt.Sprintf("Echo from %s", h2.ID())); return err })
+	wg.Wait()
 
-	for i := 0; i < 4; i++ {
-		<-done
+	// h1 发起一个 gossip 消息，h2 收到后打印
+	received := make(chan struct{})
+	h2.OnGossip(func(msg *pb.GossipMessage) {
+		fmt.Printf("%s: Received gossip from %s on %s: %s \n", h2.ID(), msg.MessageData.NodeId, msg.Topic, msg.Data)
+		close(received)
+	})
+	if _, err := h1.Publish("greeting", []byte(fmt.Sprintf("Gossip from %s", h1.ID()))); err != nil {
+		panic(err)
 	}
+	<-received
 }
@@ -1,32 +1,37 @@
 package main
 
 import (
-	"context"
-	"fmt"
 	"time"
 
 	pb "github.com/czh0526/libp2p/multipro/pb"
-	ggio "github.com/gogo/protobuf/io"
+	signed "github.com/czh0526/libp2p/security/signed"
 	proto "github.com/gogo/protobuf/proto"
-	crypto "github.com/libp2p/go-libp2p-crypto"
 	host "github.com/libp2p/go-libp2p-host"
-	inet "github.com/libp2p/go-libp2p-net"
 	peer "github.com/libp2p/go-libp2p-peer"
-	protocol "github.com/libp2p/go-libp2p-protocol"
 )
 
 const clientVersion = "go-p2p-node/0.0.1"
 
 type Node struct {
 	host.Host
+	policy *signed.Policy
+	*RPC
 	*PingProtocol
 	*EchoProtocol
+	*GossipProtocol
 }
 
-func NewNode(host host.Host, done chan bool) *Node {
-	node := &Node{Host: host}
-	node.PingProtocol = NewPingProtocol(node, done)
-	node.EchoProtocol = NewEchoProtocol(node, done)
+func NewNode(host host.Host) *Node {
+	return NewNodeWithPolicy(host, signed.DefaultPolicy())
+}
+
+// NewNodeWithPolicy 使用指定的验证策略构造 Node
+func NewNodeWithPolicy(host host.Host, policy *signed.Policy) *Node {
+	node := &Node{Host: host, policy: policy}
+	node.RPC = NewRPC(node)
+	node.PingProtocol = NewPingProtocol(node)
+	node.EchoProtocol = NewEchoProtocol(node)
+	node.GossipProtocol = NewGossipProtocol(node, DefaultGossipConfig())
 	return node
 }
 
@@ -46,92 +51,50 @@ func (n *Node) NewMessageData(messageId string, gossip bool) *pb.MessageData {
 	}
 }
 
-func (n *Node) sendProtoMessage(id peer.ID, p protocol.ID, data proto.Message) bool {
-	// 与相连的 peer 建立消息流信道
-	s, err := n.NewStream(context.Background(), id, p)
-	if err != nil {
-		fmt.Println(err)
-		return false
-	}
-
-	// 向信道里面写消息
-	writer := ggio.NewFullWriter(s)
-	err = writer.WriteMsg(data)
-	if err != nil {
-		fmt.Println(err)
-		s.Reset()
-		return false
-	}
-
-	// 关闭信道
-	err = inet.FullClose(s)
-	if err != nil {
-		fmt.Println(err)
-		s.Reset()
-		return false
-	}
-	return true
-}
-
-func (n *Node) signProtoMessage(message proto.Message) ([]byte, error) {
+func (n *Node) signProtoMessage(domain string, message proto.Message) ([]byte, error) {
 	data, err := proto.Marshal(message)
 	if err != nil {
 		return nil, err
 	}
-	return n.signData(data)
+	return signed.Sign(n.Peerstore().PrivKey(n.ID()), domain, data)
 }
 
-func (n *Node) signData(data []byte) ([]byte, error) {
-	key := n.Peerstore().PrivKey(n.ID())
-	res, err := key.Sign(data)
-	return res, err
-}
-
-func (n *Node) authenticateMessage(message proto.Message, data *pb.MessageData) bool {
-	sign := data.Sign
+// signMessage 对消息签名，并把签名写入 MessageData.Sign。
+// domain 是协议标识，为一个协议签名的消息在其它协议中无法通过验证
+func (n *Node) signMessage(domain string, message SignedMessage) error {
+	data := message.GetMessageData()
 	data.Sign = nil
-
-	bin, err := proto.Marshal(message)
+	sign, err := n.signProtoMessage(domain, message)
 	if err != nil {
-		fmt.Println(err, "Failed to marshal pb message")
-		return false
+		return err
 	}
-
 	data.Sign = sign
-
-	peerId, err := peer.IDB58Decode(data.NodeId)
-	if err != nil {
-		fmt.Println(err, "Failed to decode node id from base58")
-		return false
-	}
-
-	return n.verifyData(bin, []byte(sign), peerId, data.NodePubKey)
+	return nil
 }
 
-func (n *Node) verifyData(data []byte, signature []byte, peerId peer.ID, pubKeyData []byte) bool {
-	key, err := crypto.UnmarshalPublicKey(pubKeyData)
-	if err != nil {
-		fmt.Println(err, "Failed to extract key from message key data.")
-		return false
-	}
-
-	// 验证 public key <==> peer id
-	idFromKey, err := peer.IDFromPublicKey(key)
-	if err != nil {
-		fmt.Println(err, "Failed to extract peer id from public key")
-		return false
-	}
-
-	if idFromKey != peerId {
-		fmt.Println(err, "Node id and provided public key mismatch.")
-		return false
+// authenticateMessage 按 node 的验证策略检查签名、时间戳和重放，失败时返回 *signed.VerifyError
+func (n *Node) authenticateMessage(domain string, message SignedMessage) error {
+	data := message.GetMessageData()
+	if data == nil {
+		return &signed.VerifyError{Code: signed.ErrMissingID, Domain: domain}
 	}
 
-	// data <==> sugnature
-	res, err := key.Verify(data, signature)
+	sign := data.Sign
+	data.Sign = nil
+	bin, err := proto.Marshal(message)
+	data.Sign = sign
 	if err != nil {
-		fmt.Println(err, "Error authenticating data")
+		return err
 	}
 
-	return res
+	_, err = n.policy.Verify(&signed.Envelope{
+		Domain:    domain,
+		ID:        data.Id,
+		Timestamp: time.Unix(data.Timestamp, 0),
+		PeerID:    data.NodeId,
+		PubKey:    data.NodePubKey,
+		Data:      bin,
+		Signature: sign,
+	})
+	return err
 }
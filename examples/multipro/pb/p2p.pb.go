@@ -290,33 +290,98 @@ func (m *EchoResponse) GetMessage() string {
 	return ""
 }
 
+type GossipMessage struct {
+	MessageData          *MessageData `protobuf:"bytes,1,opt,name=messageData,proto3" json:"messageData,omitempty"`
+	Topic                string       `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Data                 []byte       `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Ttl                  uint32       `protobuf:"varint,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *GossipMessage) Reset()         { *m = GossipMessage{} }
+func (m *GossipMessage) String() string { return proto.CompactTextString(m) }
+func (*GossipMessage) ProtoMessage()    {}
+func (*GossipMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e7fdddb109e6467a, []int{5}
+}
+func (m *GossipMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GossipMessage.Unmarshal(m, b)
+}
+func (m *GossipMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GossipMessage.Marshal(b, m, deterministic)
+}
+func (m *GossipMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GossipMessage.Merge(m, src)
+}
+func (m *GossipMessage) XXX_Size() int {
+	return xxx_messageInfo_GossipMessage.Size(m)
+}
+func (m *GossipMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_GossipMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GossipMessage proto.InternalMessageInfo
+
+func (m *GossipMessage) GetMessageData() *MessageData {
+	if m != nil {
+		return m.MessageData
+	}
+	return nil
+}
+
+func (m *GossipMessage) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *GossipMessage) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *GossipMessage) GetTtl() uint32 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*MessageData)(nil), "protocols.p2p.MessageData")
 	proto.RegisterType((*PingRequest)(nil), "protocols.p2p.PingRequest")
 	proto.RegisterType((*PingResponse)(nil), "protocols.p2p.PingResponse")
 	proto.RegisterType((*EchoRequest)(nil), "protocols.p2p.EchoRequest")
 	proto.RegisterType((*EchoResponse)(nil), "protocols.p2p.EchoResponse")
+	proto.RegisterType((*GossipMessage)(nil), "protocols.p2p.GossipMessage")
 }
 
 func init() { proto.RegisterFile("p2p.proto", fileDescriptor_e7fdddb109e6467a) }
 
 var fileDescriptor_e7fdddb109e6467a = []byte{
-	// 261 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x8f, 0xb1, 0x4e, 0xc3, 0x30,
-	0x10, 0x86, 0xe5, 0xb6, 0xa4, 0xe4, 0xdc, 0x32, 0xdc, 0x80, 0x2c, 0x84, 0x50, 0x14, 0x31, 0x64,
-	0xca, 0x10, 0x56, 0x46, 0x18, 0x10, 0x42, 0xaa, 0x3c, 0xb0, 0xa7, 0xc9, 0x11, 0x2c, 0x35, 0xb6,
-	0xe9, 0xb9, 0x03, 0x0f, 0xc8, 0x7b, 0xa1, 0xba, 0x41, 0x4d, 0x1f, 0xa0, 0x4c, 0xbe, 0xff, 0xf3,
-	0xd9, 0xbf, 0x3e, 0x48, 0x7d, 0xe5, 0x4b, 0xbf, 0x75, 0xc1, 0xe1, 0x32, 0x1e, 0x8d, 0xdb, 0x70,
-	0xe9, 0x2b, 0x9f, 0xff, 0x08, 0x90, 0x6f, 0xc4, 0x5c, 0x77, 0xf4, 0x54, 0x87, 0x1a, 0xef, 0x61,
-	0xd9, 0x6c, 0x0c, 0xd9, 0xf0, 0x4e, 0x5b, 0x36, 0xce, 0x2a, 0x91, 0x89, 0x22, 0xd5, 0xa7, 0x10,
-	0x6f, 0x21, 0x0d, 0xa6, 0x27, 0x0e, 0x75, 0xef, 0xd5, 0x24, 0x13, 0xc5, 0x54, 0x1f, 0x01, 0x5e,
-	0xc1, 0xc4, 0xb4, 0x6a, 0x1a, 0x1f, 0x4e, 0x4c, 0x8b, 0xd7, 0x90, 0x74, 0x8e, 0xd9, 0x78, 0x35,
-	0xcb, 0x44, 0x71, 0xa9, 0x87, 0xb4, 0xe7, 0xd6, 0xb5, 0xf4, 0xd2, 0xaa, 0x8b, 0xb8, 0x3b, 0x24,
-	0xbc, 0x03, 0xd8, 0x4f, 0xab, 0xdd, 0xfa, 0x95, 0xbe, 0x55, 0x92, 0x89, 0x62, 0xa1, 0x47, 0x04,
-	0x11, 0x66, 0x6c, 0x3a, 0xab, 0xe6, 0xf1, 0x26, 0xce, 0x39, 0x81, 0x5c, 0x19, 0xdb, 0x69, 0xfa,
-	0xda, 0x11, 0x07, 0x7c, 0x04, 0xd9, 0x1f, 0xad, 0xa2, 0x84, 0xac, 0x6e, 0xca, 0x13, 0xf7, 0x72,
-	0xe4, 0xad, 0xc7, 0xeb, 0xa8, 0x60, 0x3e, 0xc4, 0x28, 0x97, 0xea, 0xbf, 0x98, 0x7f, 0xc0, 0xe2,
-	0x50, 0xc3, 0xde, 0x59, 0xa6, 0xb3, 0xf5, 0x10, 0xc8, 0xe7, 0xe6, 0xd3, 0xfd, 0x83, 0xce, 0xa1,
-	0xe6, 0xbc, 0x3a, 0xeb, 0x24, 0xfe, 0xf0, 0xf0, 0x1b, 0x00, 0x00, 0xff, 0xff, 0xf4, 0x47, 0x02,
-	0x5e, 0x88, 0x02, 0x00, 0x00,
+	// 301 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x92, 0x41, 0x4b, 0xc3, 0x40,
+	0x10, 0x85, 0xd9, 0xa6, 0x4d, 0xcd, 0xa4, 0x11, 0x59, 0x44, 0x16, 0x11, 0x09, 0xc1, 0x43, 0x4e,
+	0x39, 0xc4, 0xab, 0x47, 0x45, 0x44, 0x84, 0xb2, 0x07, 0xef, 0x69, 0x32, 0xc6, 0x85, 0x64, 0x77,
+	0xed, 0x6e, 0x0f, 0xfe, 0x04, 0x7f, 0x98, 0xff, 0x4b, 0x76, 0x13, 0x69, 0x7a, 0x96, 0x7a, 0xca,
+	0x7b, 0x2f, 0x33, 0x79, 0x7c, 0x64, 0x20, 0xd2, 0xa5, 0x2e, 0xf4, 0x56, 0x59, 0x45, 0x13, 0xff,
+	0xa8, 0x55, 0x67, 0x0a, 0x5d, 0xea, 0xec, 0x9b, 0x40, 0xfc, 0x82, 0xc6, 0x54, 0x2d, 0xde, 0x57,
+	0xb6, 0xa2, 0x37, 0x90, 0xd4, 0x9d, 0x40, 0x69, 0x5f, 0x71, 0x6b, 0x84, 0x92, 0x8c, 0xa4, 0x24,
+	0x8f, 0xf8, 0x61, 0x48, 0xaf, 0x20, 0xb2, 0xa2, 0x47, 0x63, 0xab, 0x5e, 0xb3, 0x59, 0x4a, 0xf2,
+	0x80, 0xef, 0x03, 0x7a, 0x0a, 0x33, 0xd1, 0xb0, 0xc0, 0x2f, 0xce, 0x44, 0x43, 0x2f, 0x20, 0x6c,
+	0x95, 0x31, 0x42, 0xb3, 0x79, 0x4a, 0xf2, 0x13, 0x3e, 0x3a, 0x97, 0x4b, 0xd5, 0xe0, 0x53, 0xc3,
+	0x16, 0x7e, 0x76, 0x74, 0xf4, 0x1a, 0xc0, 0xa9, 0xf5, 0x6e, 0xf3, 0x8c, 0x9f, 0x2c, 0x4c, 0x49,
+	0xbe, 0xe2, 0x93, 0x84, 0x52, 0x98, 0x1b, 0xd1, 0x4a, 0xb6, 0xf4, 0x6f, 0xbc, 0xce, 0x10, 0xe2,
+	0xb5, 0x90, 0x2d, 0xc7, 0x8f, 0x1d, 0x1a, 0x4b, 0xef, 0x20, 0xee, 0xf7, 0x54, 0x1e, 0x22, 0x2e,
+	0x2f, 0x8b, 0x03, 0xf6, 0x62, 0xc2, 0xcd, 0xa7, 0xe3, 0x94, 0xc1, 0x72, 0xb4, 0x1e, 0x2e, 0xe2,
+	0xbf, 0x36, 0x7b, 0x83, 0xd5, 0x50, 0x63, 0xb4, 0x92, 0x06, 0x8f, 0xd6, 0x83, 0x10, 0x3f, 0xd4,
+	0xef, 0xea, 0x1f, 0x70, 0x86, 0x9a, 0x23, 0xe3, 0x7c, 0x11, 0x48, 0x1e, 0xfd, 0x4f, 0x1f, 0x97,
+	0xff, 0xd8, 0x74, 0x0e, 0x0b, 0xab, 0xb4, 0xa8, 0xc7, 0x9e, 0xc1, 0xb8, 0xbb, 0x68, 0xdc, 0xc7,
+	0x82, 0xe1, 0x2e, 0x9c, 0xa6, 0x67, 0x10, 0x58, 0xdb, 0xf9, 0xc3, 0x4b, 0xb8, 0x93, 0x9b, 0xd0,
+	0x77, 0xdc, 0xfe, 0x0c, 0x00, 0x0d, 0xf4, 0x25, 0x3f, 0x14, 0x03, 0x00, 0x00,
 }
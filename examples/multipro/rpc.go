@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/czh0526/libp2p/multipro/pb"
+	ggio "github.com/gogo/protobuf/io"
+	proto "github.com/gogo/protobuf/proto"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+)
+
+// 单条消息的最大长度
+const maxRPCMessageSize = 1 << 20
+
+// 没有设置 deadline 的 Call 使用的超时时间
+const DefaultRPCTimeout = 10 * time.Second
+
+var ErrIDMismatch = errors.New("rpc: response id does not match request id")
+
+// SignedMessage 是带有 MessageData 信封的 protobuf 消息
+type SignedMessage interface {
+	proto.Message
+	GetMessageData() *pb.MessageData
+}
+
+// Handler 处理一个已经通过验证的请求，返回的响应由 RPC 负责签名
+type Handler func(ctx context.Context, from peer.ID, req SignedMessage) (SignedMessage, error)
+
+/*
+ * 每次调用使用一个 stream:
+ *   caller ==> handler: 带长度前缀的请求，然后关闭写
+ *   handler ==> caller: 带长度前缀的响应，然后关闭写
+ * 请求和响应的 MessageData 都要签名，响应的 Id 与请求相同。
+ * 请求以协议 ID 作为签名的 domain，响应使用 responseDomain，
+ * 所以请求和响应、不同协议之间的签名不能互相替换
+ */
+type RPC struct {
+	node *Node
+
+	mu      sync.Mutex
+	pending map[string]*pendingCall
+}
+
+type pendingCall struct {
+	peer   peer.ID
+	proto  protocol.ID
+	start  time.Time
+	cancel context.CancelFunc
+}
+
+func NewRPC(node *Node) *RPC {
+	return &RPC{
+		node:    node,
+		pending: make(map[string]*pendingCall),
+	}
+}
+
+// Handle 注册协议 p 的处理函数，newReq 用于构造请求消息
+func (r *RPC) Handle(p protocol.ID, newReq func() SignedMessage, h Handler) {
+	r.node.SetStreamHandler(p, func(s inet.Stream) {
+		r.serve(s, newReq, h)
+	})
+}
+
+func (r *RPC) serve(s inet.Stream, newReq func() SignedMessage, h Handler) {
+	from := s.Conn().RemotePeer()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRPCTimeout)
+	defer cancel()
+
+	// 读取请求
+	req := newReq()
+	reader := ggio.NewDelimitedReader(s, maxRPCMessageSize)
+	if err := reader.ReadMsg(req); err != nil {
+		fmt.Printf("%s: read request from %s failed: %s \n", s.Protocol(), from, err)
+		s.Reset()
+		return
+	}
+	if err := r.node.authenticateMessage(string(s.Protocol()), req); err != nil {
+		fmt.Printf("%s: failed to authenticate request from %s: %s \n", s.Protocol(), from, err)
+		s.Reset()
+		return
+	}
+
+	resp, err := h(ctx, from, req)
+	if err != nil {
+		fmt.Printf("%s: handler failed: %s \n", s.Protocol(), err)
+		s.Reset()
+		return
+	}
+
+	// 响应沿用请求的 Id，没有 MessageData 的响应无法签名
+	if resp == nil || resp.GetMessageData() == nil {
+		fmt.Printf("%s: handler returned a response without MessageData \n", s.Protocol())
+		s.Reset()
+		return
+	}
+	resp.GetMessageData().Id = req.GetMessageData().Id
+	if err := r.node.signMessage(responseDomain(s.Protocol()), resp); err != nil {
+		fmt.Printf("%s: failed to sign response: %s \n", s.Protocol(), err)
+		s.Reset()
+		return
+	}
+
+	writer := ggio.NewDelimitedWriter(s)
+	if err := writer.WriteMsg(resp); err != nil {
+		fmt.Printf("%s: write response to %s failed: %s \n", s.Protocol(), from, err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+// Call 向 p 发起一次调用，req 的 MessageData 由调用者填写（签名由 Call 完成），
+// 响应写入 resp。ctx 取消或超时时 stream 被 reset
+func (r *RPC) Call(ctx context.Context, to peer.ID, p protocol.ID, req, resp SignedMessage) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRPCTimeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	id := req.GetMessageData().Id
+	if err := r.addPending(id, to, p, cancel); err != nil {
+		return err
+	}
+	defer r.removePending(id)
+
+	if err := r.node.signMessage(string(p), req); err != nil {
+		return err
+	}
+
+	s, err := r.node.NewStream(ctx, to, p)
+	if err != nil {
+		return err
+	}
+
+	// ctx 结束时 reset stream，让阻塞中的读写返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-done:
+		}
+	}()
+
+	writer := ggio.NewDelimitedWriter(s)
+	if err := writer.WriteMsg(req); err != nil {
+		s.Reset()
+		return ctxErr(ctx, err)
+	}
+	s.Close()
+
+	reader := ggio.NewDelimitedReader(s, maxRPCMessageSize)
+	if err := reader.ReadMsg(resp); err != nil {
+		s.Reset()
+		return ctxErr(ctx, err)
+	}
+
+	if err := r.node.authenticateMessage(responseDomain(p), resp); err != nil {
+		return err
+	}
+	if resp.GetMessageData().Id != id {
+		return ErrIDMismatch
+	}
+	return nil
+}
+
+// Pending 返回正在进行中的调用数量
+func (r *RPC) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// CancelAll 取消所有正在进行中的调用
+func (r *RPC) CancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.pending {
+		c.cancel()
+	}
+}
+
+func (r *RPC) addPending(id string, to peer.ID, p protocol.ID, cancel context.CancelFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[id]; ok {
+		return fmt.Errorf("rpc: duplicate request id %s", id)
+	}
+	r.pending[id] = &pendingCall{
+		peer:   to,
+		proto:  p,
+		start:  time.Now(),
+		cancel: cancel,
+	}
+	return nil
+}
+
+func (r *RPC) removePending(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+}
+
+func responseDomain(p protocol.ID) string {
+	return string(p) + "/response"
+}
+
+// 操作失败是因为 ctx 结束时，返回 ctx 的错误
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/czh0526/libp2p/multipro/pb"
+	mocknet "github.com/czh0526/libp2p/p2p/net/mock"
+	signed "github.com/czh0526/libp2p/security/signed"
+	tu "github.com/czh0526/libp2p/testutil"
+	ggio "github.com/gogo/protobuf/io"
+	"github.com/google/uuid"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func makeMockNodes(t *testing.T, ctx context.Context, n int) []*Node {
+	mn := mocknet.New(ctx)
+	nodes := make([]*Node, n)
+	for i := range nodes {
+		// GenPeer 使用的是不能签名的假密钥，这里用真实的密钥
+		sk, _, err := tu.RandTestKeyPair(512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 10000+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = NewNode(h)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+func TestRPCPingEcho(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 2)
+	a, b := nodes[0], nodes[1]
+
+	// 并发调用，检查 pending 的记录不会串
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := a.Ping(ctx, b.ID()); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := b.Echo(ctx, a.ID(), fmt.Sprintf("echo %d", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if a.Pending() != 0 || b.Pending() != 0 {
+		t.Fatalf("pending calls left: %d, %d", a.Pending(), b.Pending())
+	}
+}
+
+func TestRPCTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 2)
+	a, b := nodes[0], nodes[1]
+
+	// 处理函数一直阻塞
+	block := make(chan struct{})
+	defer close(block)
+	b.Handle("/slow/0.0.1",
+		func() SignedMessage { return new(pb.PingRequest) },
+		func(ctx context.Context, from peer.ID, req SignedMessage) (SignedMessage, error) {
+			<-block
+			return nil, fmt.Errorf("unreachable")
+		})
+
+	req := &pb.PingRequest{MessageData: a.NewMessageData(uuid.New().String(), false)}
+	cctx, ccancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer ccancel()
+
+	start := time.Now()
+	err := a.Call(cctx, b.ID(), "/slow/0.0.1", req, new(pb.PingResponse))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("call did not return on timeout")
+	}
+	if a.Pending() != 0 {
+		t.Fatal("timed out call still pending")
+	}
+}
+
+func TestRPCRejectsForgedResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 3)
+	a, b, c := nodes[0], nodes[1], nodes[2]
+
+	// b 的响应声称来自 c，但使用 b 的签名
+	b.Handle("/forged/0.0.1",
+		func() SignedMessage { return new(pb.PingRequest) },
+		func(ctx context.Context, from peer.ID, req SignedMessage) (SignedMessage, error) {
+			resp := &pb.PingResponse{MessageData: b.NewMessageData("", false)}
+			resp.MessageData.NodeId = peer.IDB58Encode(c.ID())
+			return resp, nil
+		})
+
+	req := &pb.PingRequest{MessageData: a.NewMessageData(uuid.New().String(), false)}
+	err := a.Call(ctx, b.ID(), "/forged/0.0.1", req, new(pb.PingResponse))
+	if !signed.IsCode(err, signed.ErrPeerMismatch) {
+		t.Fatalf("expected peer mismatch, got %v", err)
+	}
+}
+
+func TestRPCResponseWithoutMessageData(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 2)
+	a, b := nodes[0], nodes[1]
+
+	// 处理函数忘记填写 MessageData，b 不能 panic
+	b.Handle("/nodata/0.0.1",
+		func() SignedMessage { return new(pb.PingRequest) },
+		func(ctx context.Context, from peer.ID, req SignedMessage) (SignedMessage, error) {
+			return new(pb.PingResponse), nil
+		})
+
+	req := &pb.PingRequest{MessageData: a.NewMessageData(uuid.New().String(), false)}
+	if err := a.Call(ctx, b.ID(), "/nodata/0.0.1", req, new(pb.PingResponse)); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+	// b 仍然可以处理其它请求
+	if _, err := a.Ping(ctx, b.ID()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRPCRejectsReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodes := makeMockNodes(t, ctx, 2)
+	a, b := nodes[0], nodes[1]
+
+	var mu sync.Mutex
+	calls := 0
+	b.Handle("/count/0.0.1",
+		func() SignedMessage { return new(pb.PingRequest) },
+		func(ctx context.Context, from peer.ID, req SignedMessage) (SignedMessage, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return &pb.PingResponse{MessageData: b.NewMessageData("", false)}, nil
+		})
+
+	req := &pb.PingRequest{MessageData: a.NewMessageData(uuid.New().String(), false)}
+	if err := a.Call(ctx, b.ID(), "/count/0.0.1", req, new(pb.PingResponse)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 原样重发已经签过名的请求
+	s, err := a.NewStream(ctx, b.ID(), "/count/0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(req); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := ggio.NewDelimitedReader(s, maxRPCMessageSize).ReadMsg(new(pb.PingResponse)); err == nil {
+		t.Fatal("replayed request was answered")
+	}
+
+	// 为 /count 签名的请求发给 ping 也不能通过
+	req = &pb.PingRequest{MessageData: a.NewMessageData(uuid.New().String(), false)}
+	if err := a.signMessage("/count/0.0.1", req); err != nil {
+		t.Fatal(err)
+	}
+	s, err = a.NewStream(ctx, b.ID(), pingProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(req); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := ggio.NewDelimitedReader(s, maxRPCMessageSize).ReadMsg(new(pb.PingResponse)); err == nil {
+		t.Fatal("request signed for another protocol was answered")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	identity "github.com/czh0526/libp2p/p2p/identity"
+	rendezvous "github.com/czh0526/libp2p/p2p/rendezvous"
+	libp2p "github.com/libp2p/go-libp2p"
+)
+
+func main() {
+	port := flag.Int("l", 9005, "TCP listen port")
+	keyFile := flag.String("key", "rendezvous.key", "identity file, created if missing")
+	statsInterval := flag.Duration("stats", time.Minute, "how often to print registration counts, 0 to disable")
+
+	var cfg rendezvous.Config
+	flag.DurationVar(&cfg.MaxTTL, "max-ttl", rendezvous.DefaultMaxTTL, "longest registration accepted")
+	flag.IntVar(&cfg.MaxRegistrations, "max-registrations", rendezvous.DefaultMaxRegistrations, "max namespaces a peer can register in")
+	flag.IntVar(&cfg.MaxTotalRegistrations, "max-total-registrations", rendezvous.DefaultMaxTotalRegistrations, "max registrations across all peers and namespaces")
+	flag.IntVar(&cfg.MaxRegistrationsPerIP, "max-registrations-per-ip", rendezvous.DefaultMaxRegistrationsPerIP, "max registrations from peers behind one IP address")
+	flag.DurationVar(&cfg.PressureTTL, "pressure-ttl", rendezvous.DefaultPressureTTL, "max TTL granted while more than half of max-total-registrations are in use")
+	flag.IntVar(&cfg.MaxDiscoverLimit, "max-discover", rendezvous.DefaultDiscoverLimit, "max registrations returned by one DISCOVER")
+	flag.Parse()
+
+	privKey, err := identity.Load(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	host, err := libp2p.New(ctx,
+		libp2p.Identity(privKey),
+		libp2p.ListenAddrStrings(
+			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port),
+			fmt.Sprintf("/ip6/::/tcp/%d", *port),
+		),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer host.Close()
+	svc := rendezvous.New(host, cfg)
+	defer svc.Close()
+
+	fmt.Printf("Rendezvous addresses: \n")
+	for _, addr := range host.Addrs() {
+		fmt.Printf("%s/ipfs/%s \n", addr, host.ID().Pretty())
+	}
+
+	if *statsInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*statsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+				st := svc.Stats()
+				fmt.Printf("%d registrations from %d peers in %d namespaces \n", st.Registrations, st.Peers, st.Namespaces)
+			}
+		}()
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+}
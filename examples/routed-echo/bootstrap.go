@@ -2,13 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"sync"
+	"os"
+	"strings"
+	"unicode"
 
+	bootstrap "github.com/czh0526/libp2p/p2p/bootstrap"
 	host "github.com/libp2p/go-libp2p-host"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	ma "github.com/multiformats/go-multiaddr"
@@ -26,94 +27,109 @@ var (
 		"/ip6/2604:a880:800:10::4a:5001/tcp/4001/ipfs/QmSoLV4Bbm51jM9C4gDYZQ9Cy3U6aXMJDAbzgu2fzaDs64",
 		"/ip6/2a03:b0c0:0:1010::23:1001/tcp/4001/ipfs/QmSoLer265NRgSp2LA3dPaeykiS1J6DifTC88f5uVQKNAd",
 	})
-	LOCAL_PEER_ENDPOINT = "http://localhost:13002/api/v0/id"
 )
 
+// 环境变量中的 bootstrap 列表，多个 multiaddr 用逗号或空白分隔，优先于 bootstrap 文件
+const BootstrapEnv = "ROUTED_ECHO_BOOTSTRAP"
+
+// bootstrap 子命令写入、客户端默认读取的文件
+const DefaultBootstrapFile = "bootstrap.peers"
+
 func convertPeers(peers []string) []pstore.PeerInfo {
-	pinfos := make([]pstore.PeerInfo, len(peers))
-	for i, peer := range peers {
-		maddr := ma.StringCast(peer)
-		p, err := pstore.InfoFromP2pAddr(maddr)
-		if err != nil {
-			fmt.Println(err)
-		}
-		pinfos[i] = *p
+	addrs, err := parseAddrs(peers)
+	if err != nil {
+		panic(err)
+	}
+	pinfos, err := bootstrap.ParsePeers(addrs)
+	if err != nil {
+		panic(err)
 	}
 	return pinfos
 }
 
-type IdOutput struct {
-	ID              string
-	PublicKey       string
-	Addresses       []string
-	AgentVersion    string
-	ProtocolVersion string
+// parseAddrs 把字符串转换成 multiaddr，交给 bootstrap.ParsePeers 按 peer 合并
+func parseAddrs(addrs []string) ([]ma.Multiaddr, error) {
+	var out []ma.Multiaddr
+	for _, s := range addrs {
+		maddr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad bootstrap address %q: %s", s, err)
+		}
+		out = append(out, maddr)
+	}
+	return out, nil
 }
 
-func getLocalPeerInfo() []pstore.PeerInfo {
-	resp, err := http.Get(LOCAL_PEER_ENDPOINT)
-	if err != nil {
-		panic(err)
+/*
+ * loadBootstrapPeers 按顺序查找 bootstrap 列表:
+ *   1. 环境变量 ROUTED_ECHO_BOOTSTRAP
+ *   2. path 指定的文件，每行一个 multiaddr，# 开头的行是注释
+ */
+func loadBootstrapPeers(path string) ([]pstore.PeerInfo, error) {
+	if env := os.Getenv(BootstrapEnv); env != "" {
+		fmt.Printf("using bootstrap peers from $%s \n", BootstrapEnv)
+		addrs, err := parseAddrs(strings.FieldsFunc(env, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		return bootstrap.ParsePeers(addrs)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
+	fmt.Printf("using bootstrap peers from %s \n", path)
+	return bootstrap.LoadPeers(path)
+}
+
+// writeBootstrapFile 把 h 的地址写入 path，keep 为 true 时保留文件中已有的地址。
+// 先写临时文件再改名，客户端不会读到写了一半的文件
+func writeBootstrapFile(path string, h host.Host, keep bool) error {
+	var lines []string
+	if keep {
+		old, err := bootstrap.ReadPeersFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, addr := range old {
+			lines = append(lines, addr.String())
+		}
 	}
 
-	var js IdOutput
-	err = json.Unmarshal(body, &js)
+	hostAddr, err := ma.NewMultiaddr(fmt.Sprintf("/ipfs/%s", h.ID().Pretty()))
 	if err != nil {
-		panic(err)
+		return err
+	}
+	for _, addr := range h.Addrs() {
+		lines = append(lines, addr.Encapsulate(hostAddr).String())
 	}
 
-	for _, addr := range js.Addresses {
-		if addr[0:8] == "/ip4/127" {
-			return convertPeers([]string{addr})
-		}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
 	}
-	return make([]pstore.PeerInfo, 1)
+	return os.Rename(tmp, path)
 }
 
-// ph ==> peers
-func bootstrapConnect(ctx context.Context, ph host.Host, peers []pstore.PeerInfo) error {
+// startBootstrap 连接 bootstrap 节点，之后在后台保持至少 minPeers 个连接，断线后自动重连
+func startBootstrap(ctx context.Context, h host.Host, peers []pstore.PeerInfo, minPeers int) (*bootstrap.Manager, error) {
 	if len(peers) < 1 {
-		return errors.New("not enough bootstrap peers")
+		return nil, errors.New("not enough bootstrap peers")
 	}
 
-	// 逐个连接 peer
-	errs := make(chan error, len(peers))
-	var wg sync.WaitGroup
-	for _, p := range peers {
-		wg.Add(1)
-		go func(p pstore.PeerInfo) {
-			defer wg.Done()
-			defer fmt.Printf("bootstrapDial: %s, %s \n", ph.ID(), p.ID)
-
-			// ph ==> p
-			ph.Peerstore().AddAddrs(p.ID, p.Addrs, pstore.PermanentAddrTTL)
-			if err := ph.Connect(ctx, p); err != nil {
-				fmt.Printf("bootstrapDialFailed: %s \n", p.ID)
-				fmt.Printf("failed to bootstrap with %v: %s", p.ID, err)
-				errs <- err
-				return
-			}
-			fmt.Printf("bootstrapDialSuccess: %s \n", p.ID)
-			fmt.Printf("bootstrapped with %v", p.ID)
-		}(p)
+	m := bootstrap.New(h, bootstrap.Config{
+		Peers:        peers,
+		MinPeers:     minPeers,
+		UsePeerstore: true,
+		Ping:         true,
+	})
+	if err := m.Bootstrap(ctx); err != nil {
+		return nil, fmt.Errorf("failed to bootstrap: %s", err)
 	}
-	wg.Wait()
-
-	close(errs)
-	count := 0
-	var err error
-	for err = range errs {
-		if err != nil {
-			count++
+	for p, st := range m.Stats() {
+		if st.Successes > 0 {
+			fmt.Printf("bootstrapped with %s \n", p)
 		}
 	}
-	if count == len(peers) {
-		return fmt.Errorf("failed to bootstrap. %s \n", err)
-	}
-	return nil
+	m.Start(ctx)
+	return m, nil
 }
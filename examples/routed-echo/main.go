@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"time"
 
 	mrand "math/rand"
 
+	bootstrap "github.com/czh0526/libp2p/p2p/bootstrap"
+	pstorefs "github.com/czh0526/libp2p/p2p/pstorefs"
 	ds "github.com/ipfs/go-datastore"
 	dsync "github.com/ipfs/go-datastore/sync"
 	libp2p "github.com/libp2p/go-libp2p"
@@ -24,7 +28,7 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-func makeRoutedHost(listenPort int, randseed int64, bootstrapPeers []pstore.PeerInfo, globalFlag string) (host.Host, error) {
+func makeKey(randseed int64) (crypto.PrivKey, error) {
 	// 构建随机数流
 	var r io.Reader
 	if randseed == 0 {
@@ -34,38 +38,65 @@ func makeRoutedHost(listenPort int, randseed int64, bootstrapPeers []pstore.Peer
 	}
 
 	// 构建密钥对
-	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.ECDSA, 2048, r)
+	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, 0, r)
+	return priv, err
+}
+
+// makeDHTHost 构建 BasicHost 和运行在其上的 DHT，peerstoreDir 不为空时 peerstore 保存在该目录中
+func makeDHTHost(ctx context.Context, listenPort int, randseed int64, peerstoreDir string) (host.Host, *dht.IpfsDHT, error) {
+	priv, err := makeKey(randseed)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
 	// 构建配置参数
 	opts := []libp2p.Option{
-		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/00.0.0.0/tcp/%d", listenPort)),
+		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", listenPort)),
 		libp2p.Identity(priv),
 		libp2p.DefaultTransports,
 		libp2p.DefaultMuxers,
 		libp2p.DefaultSecurity,
 		libp2p.NATPortMap(),
 	}
+	if peerstoreDir != "" {
+		ps, err := pstorefs.NewPeerstore(ctx, peerstoreDir, pstorefs.DefaultOptions())
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, libp2p.Peerstore(ps))
+	}
 
 	fmt.Println("构建 BasicHost")
-	ctx := context.Background()
 	basicHost, err := libp2p.New(ctx, opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	fmt.Println("构建 IpfsDHT( 实现 IpfsRouting 接口 )")
 	dstore := dsync.MutexWrap(ds.NewMapDatastore())
-	dht := dht.NewDHT(ctx, basicHost, dstore)
+	return basicHost, dht.NewDHT(ctx, basicHost, dstore), nil
+}
+
+func makeRoutedHost(listenPort int, randseed int64, bootstrapPeers []pstore.PeerInfo, peerstoreDir string) (host.Host, error) {
+	ctx := context.Background()
+	basicHost, kad, err := makeDHTHost(ctx, listenPort, randseed, peerstoreDir)
+	if err != nil {
+		return nil, err
+	}
 
 	fmt.Println("BasicHost + IpfsRouting => RoutedHost")
-	routedHost := rhost.Wrap(basicHost, dht)
+	routedHost := rhost.Wrap(basicHost, kad)
 
-	// 让 routedHost 连接 bootstrapPeers 节点
-	err = bootstrapConnect(ctx, routedHost, bootstrapPeers)
-	if err != nil {
+	// 让 routedHost 连接 bootstrapPeers 节点，然后开始填充路由表
+	if _, err := startBootstrap(ctx, routedHost, bootstrapPeers, len(bootstrapPeers)); err != nil {
+		return nil, err
+	}
+	if err := kad.Bootstrap(ctx); err != nil {
+		return nil, err
+	}
+
+	// DHT 在连接建立后异步检查对方是否支持 DHT 协议，等到路由表中有节点再开始查找
+	if err := waitRoutingTable(ctx, kad, 10*time.Second); err != nil {
 		return nil, err
 	}
 
@@ -80,12 +111,79 @@ func makeRoutedHost(listenPort int, randseed int64, bootstrapPeers []pstore.Peer
 	return routedHost, nil
 }
 
+func waitRoutingTable(ctx context.Context, kad *dht.IpfsDHT, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for kad.RoutingTable().Size() == 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("no DHT peers in routing table after %s", timeout)
+		}
+	}
+	return nil
+}
+
+// runBootstrap 运行一个 DHT server 节点，并把它的地址写入文件供客户端读取
+func runBootstrap(args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	listenF := fs.Int("l", 4001, "port to listen on")
+	seed := fs.Int64("seed", 0, "set random seed for id generation")
+	out := fs.String("o", DefaultBootstrapFile, "file to write the bootstrap multiaddrs to")
+	keep := fs.Bool("append", false, "keep the peers already in the file and connect to them")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	h, kad, err := makeDHTHost(ctx, *listenF, *seed, "")
+	if err != nil {
+		return err
+	}
+
+	// 与文件中已有的 bootstrap 节点互相连接，组成一个 bootstrap 网络
+	if *keep {
+		peers, err := bootstrap.LoadPeers(*out)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(peers) > 0 {
+			if _, err := startBootstrap(ctx, h, peers, len(peers)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+	if err := kad.Bootstrap(ctx); err != nil {
+		return err
+	}
+
+	if err := writeBootstrapFile(*out, h, *keep); err != nil {
+		return err
+	}
+	fmt.Printf("bootstrap node %s written to %s \n", h.ID().Pretty(), *out)
+	for _, addr := range h.Addrs() {
+		fmt.Printf("%s/ipfs/%s \n", addr, h.ID().Pretty())
+	}
+	fmt.Printf("Now run \"./routed-echo -l 10000 -bootstrap %s\" on a different terminal\n", *out)
+	select {}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		if err := runBootstrap(os.Args[2:]); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	// 解析命令行参数
 	listenF := flag.Int("l", 0, "wait for incoming connections")
 	target := flag.String("d", "", "target peer to dial")
 	seed := flag.Int64("seed", 0, "set random seed for id generation")
 	global := flag.Bool("global", false, "use global ipfs peers for bootstrapping")
+	bootstrapFile := flag.String("bootstrap", DefaultBootstrapFile, "file with bootstrap multiaddrs, overridden by $"+BootstrapEnv)
+	peerstoreDir := flag.String("peerstore", "", "directory to persist the peerstore in, in-memory if empty")
 	flag.Parse()
 
 	if *listenF == 0 {
@@ -94,19 +192,22 @@ func main() {
 
 	// 设置 bootstrap 节点集合
 	var bootstrapPeers []pstore.PeerInfo
-	var globalFlag string
 	if *global {
 		fmt.Println("using global bootstrap")
 		bootstrapPeers = IPFS_PEERS
-		globalFlag = " -global"
 	} else {
 		fmt.Println("using local bootstrap")
-		bootstrapPeers = getLocalPeerInfo()
-		globalFlag = ""
+		peers, err := loadBootstrapPeers(*bootstrapFile)
+		if err != nil {
+			fmt.Printf("no bootstrap peers: %s \n", err)
+			fmt.Printf("run \"./routed-echo bootstrap -o %s\" first, or set $%s \n", *bootstrapFile, BootstrapEnv)
+			os.Exit(1)
+		}
+		bootstrapPeers = peers
 	}
 
 	// 构建 RoutedHost
-	ha, err := makeRoutedHost(*listenF, *seed, bootstrapPeers, globalFlag)
+	ha, err := makeRoutedHost(*listenF, *seed, bootstrapPeers, *peerstoreDir)
 	if err != nil {
 		panic(err)
 	}
@@ -115,7 +216,7 @@ func main() {
 	ha.SetStreamHandler("/echo/1.0.0", func(s net.Stream) {
 		fmt.Println("Got a new stram!")
 		if err := doEcho(s); err != nil {
-			panic(err)
+			fmt.Println(err)
 			s.Reset()
 		} else {
 			s.Close()
@@ -123,6 +224,7 @@ func main() {
 	})
 
 	if *target == "" {
+		fmt.Printf("Now run \"./routed-echo -l %d -d %s -bootstrap %s\" on a different terminal\n", *listenF+1, ha.ID().Pretty(), *bootstrapFile)
 		fmt.Println("listening for connections")
 		select {}
 	}
@@ -1,15 +1,66 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	p2pnat "github.com/czh0526/libp2p/p2p/nat"
 	nat "github.com/fd/go-nat"
+	libp2p "github.com/libp2p/go-libp2p"
 )
 
 func main() {
-	nat, err := nat.DiscoverGateway()
+	port := flag.Int("l", 4001, "TCP listen port")
+	lease := flag.Duration("lease", p2pnat.DefaultLease, "port mapping lease")
+	flag.Parse()
+
+	gw, err := nat.DiscoverGateway()
 	if err != nil {
 		log.Fatalf("error: %s", err)
 	}
-	log.Printf("nat type: %s", nat.Type())
+	log.Printf("nat type: %s", gw.Type())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mgr := p2pnat.New(gw, p2pnat.Config{Lease: *lease})
+	host, err := libp2p.New(ctx,
+		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", *port)),
+		libp2p.AddrsFactory(mgr.AddrsFactory(nil)),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer host.Close()
+
+	// 退出时删除网关上的映射
+	if err := mgr.Start(ctx, host.Network()); err != nil {
+		log.Fatal(err)
+	}
+	defer mgr.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	printed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-sigs:
+			return
+		}
+		// 外部地址的数量变化时打印 host 的地址
+		if n := len(mgr.ExternalAddrs()); n != printed {
+			printed = n
+			for _, addr := range host.Addrs() {
+				log.Printf("%s/ipfs/%s", addr, host.ID().Pretty())
+			}
+		}
+	}
 }
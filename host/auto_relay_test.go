@@ -3,7 +3,6 @@ package test_host
 import (
 	"context"
 	"fmt"
-	"sync"
 	"testing"
 	"time"
 
@@ -15,11 +14,10 @@ import (
 	autonatpb "github.com/libp2p/go-libp2p-autonat/pb"
 	inet "github.com/libp2p/go-libp2p-net"
 
-	cid "github.com/ipfs/go-cid"
+	mockrouting "github.com/czh0526/libp2p/p2p/routing/mock"
 	libp2p "github.com/libp2p/go-libp2p"
 	circuit "github.com/libp2p/go-libp2p-circuit"
 	host "github.com/libp2p/go-libp2p-host"
-	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	routing "github.com/libp2p/go-libp2p-routing"
 	ma "github.com/multiformats/go-multiaddr"
@@ -36,67 +34,6 @@ func init() {
 	relay.AdvertiseBootDelay = 100 * time.Millisecond
 }
 
-type mockRoutingTable struct {
-	mx        sync.Mutex
-	providers map[string]map[peer.ID]pstore.PeerInfo
-}
-
-func newMockRoutingTable() *mockRoutingTable {
-	return &mockRoutingTable{
-		providers: make(map[string]map[peer.ID]pstore.PeerInfo),
-	}
-}
-
-type mockRouting struct {
-	h   host.Host
-	tab *mockRoutingTable
-}
-
-func newMockRouting(h host.Host, tab *mockRoutingTable) *mockRouting {
-	return &mockRouting{h: h, tab: tab}
-}
-
-func (m *mockRouting) FindPeer(ctx context.Context, p peer.ID) (pstore.PeerInfo, error) {
-	return pstore.PeerInfo{}, routing.ErrNotFound
-}
-
-func (m *mockRouting) Provide(ctx context.Context, cid cid.Cid, bcast bool) error {
-	m.tab.mx.Lock()
-	defer m.tab.mx.Unlock()
-
-	pmap, ok := m.tab.providers[cid.String()]
-	if !ok {
-		pmap = make(map[peer.ID]pstore.PeerInfo)
-		m.tab.providers[cid.String()] = pmap
-	}
-
-	pmap[m.h.ID()] = pstore.PeerInfo{ID: m.h.ID(), Addrs: m.h.Addrs()}
-	return nil
-}
-
-func (m *mockRouting) FindProvidersAsync(ctx context.Context, cid cid.Cid, limit int) <-chan pstore.PeerInfo {
-	ch := make(chan pstore.PeerInfo)
-	go func() {
-		defer close(ch)
-		m.tab.mx.Lock()
-		defer m.tab.mx.Unlock()
-
-		pmap, ok := m.tab.providers[cid.String()]
-		if !ok {
-			return
-		}
-		for _, pi := range pmap {
-			select {
-			case ch <- pi:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	return ch
-}
-
 func makeAutoNATServicePrivate(ctx context.Context, t *testing.T) host.Host {
 	h, err := libp2p.New(ctx)
 	if err != nil {
@@ -110,10 +47,9 @@ func TestAutoRelay(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	mtab := newMockRoutingTable()
+	mr := mockrouting.NewServer()
 	makeRouting := func(h host.Host) (routing.PeerRouting, error) {
-		mr := newMockRouting(h, mtab)
-		return mr, nil
+		return mr.Client(h), nil
 	}
 
 	h1 := makeAutoNATServicePrivate(ctx, t)
@@ -63,7 +63,7 @@ func bootstrap(t *testing.T, ctx context.Context, dhts []*dht.IpfsDHT) {
 	start := rand.Intn(len(dhts))
 	for i := range dhts {
 		dht := dhts[(start+i)%len(dhts)]
-		dht.RunBootstrap(ctx, cfg)
+		dht.BootstrapOnce(ctx, cfg)
 	}
 }
 
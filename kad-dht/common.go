@@ -22,14 +22,15 @@ func setupDHTS(t *testing.T, ctx context.Context, n int) []*dht.IpfsDHT {
 	dhts := make([]*dht.IpfsDHT, n)
 	for i := 0; i < n; i++ {
 		dhts[i] = setupDHT(ctx, t, false)
-		fmt.Printf("%d). %s \n", i, dhts[i].Self().ShortString())
+		fmt.Printf("%d). %s \n", i, dhts[i].Host().ID().ShortString())
 	}
 	return dhts
 }
 
-func setupDHT(ctx context.Context, t *testing.T, client bool) *dht.IpfsDHT {
+func setupDHT(ctx context.Context, t *testing.T, client bool, swarmOpts ...swarmt.Option) *dht.IpfsDHT {
+	swarmOpts = append([]swarmt.Option{swarmt.OptDisableReuseport}, swarmOpts...)
 	d, err := dht.New(ctx,
-		bhost.New(swarmt.GenSwarm(t, ctx, swarmt.OptDisableReuseport)),
+		bhost.New(swarmt.GenSwarm(t, ctx, swarmOpts...)),
 		opts.Client(client),
 		opts.NamespacedValidator("v", blankValidator{}),
 	)
@@ -42,14 +43,14 @@ func setupDHT(ctx context.Context, t *testing.T, client bool) *dht.IpfsDHT {
 
 // 等待 a 的节点数据库中包含了 b 节点的信息
 func wait(t *testing.T, ctx context.Context, a, b *dht.IpfsDHT) {
-	for a.RoutingTable().Find(b.Self()) == "" {
+	for a.RoutingTable().Find(b.Host().ID()) == "" {
 		select {
 		case <-ctx.Done():
 			t.Fatal(ctx.Err())
 		case <-time.After(time.Millisecond * 5):
 		}
 	}
-	fmt.Printf("%s has connected to %s \n", a.Self().ShortString(), b.Self().ShortString())
+	fmt.Printf("%s has connected to %s \n", a.Host().ID().ShortString(), b.Host().ID().ShortString())
 }
 
 func connect(t *testing.T, ctx context.Context, a, b *dht.IpfsDHT) {
@@ -60,16 +61,16 @@ func connect(t *testing.T, ctx context.Context, a, b *dht.IpfsDHT) {
 
 func connectNoSync(t *testing.T, ctx context.Context, a, b *dht.IpfsDHT) {
 	// 获取 b 的 peer ID
-	idB := b.Self()
+	idB := b.Host().ID()
 	// 获取 b 的地址
-	addrB := b.Peerstore().Addrs(idB)
+	addrB := b.Host().Peerstore().Addrs(idB)
 	if len(addrB) == 0 {
 		t.Fatal("peers setup incorrectly: no local address")
 	}
 	fmt.Printf("%s ==> %s \n", a.Host().Addrs(), b.Host().Network().ListenAddresses())
 
 	// 将 b 的地址加入到 a 的节点库中
-	a.Peerstore().AddAddrs(idB, addrB, pstore.PermanentAddrTTL)
+	a.Host().Peerstore().AddAddrs(idB, addrB, pstore.PermanentAddrTTL)
 	// a ==> b
 	pi := pstore.PeerInfo{ID: idB}
 	if err := a.Host().Connect(ctx, pi); err != nil {
@@ -3,7 +3,6 @@ package test_dht
 import (
 	"context"
 	"fmt"
-	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"math/rand"
 	"sort"
 	"testing"
@@ -14,6 +13,7 @@ import (
 	kb "github.com/libp2p/go-libp2p-kbucket"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestFindPeersConnectedToPeer(t *testing.T) {
@@ -39,12 +39,12 @@ func TestFindPeersConnectedToPeer(t *testing.T) {
 	defer cancel()
 
 	// 通过 0 查找与 2 连接的 peer
-	pchan, err := dhts[0].FindPeersConnectedToPeer(ctxT, dhts[2].Self())
+	pchan, err := dhts[0].FindPeersConnectedToPeer(ctxT, dhts[2].Host().ID())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	fmt.Printf("%s ==> \n", dhts[2].Self().ShortString())
+	fmt.Printf("%s ==> \n", dhts[2].Host().ID().ShortString())
 	var found []*pstore.PeerInfo
 	for nextp := range pchan {
 		found = append(found, nextp)
@@ -55,7 +55,7 @@ func TestFindPeersConnectedToPeer(t *testing.T) {
 }
 
 func TestClientModeFindPeer(t *testing.T) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
 	a := setupDHT(ctx, t, false)
@@ -71,7 +71,7 @@ func TestClientModeFindPeer(t *testing.T) {
 	wait(t, ctx, b, a)
 	wait(t, ctx, c, a)
 
-	pi, err := c.FindPeer(ctx, b.Self())
+	pi, err := c.FindPeer(ctx, b.Host().ID())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,8 +87,6 @@ func TestClientModeFindPeer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	<-time.After(time.Minute * 5)
 }
 
 func TestFindPeerQuery(t *testing.T) {
@@ -138,7 +136,7 @@ func testFindPeerQuery(t *testing.T,
 	for i, d := range dhts {
 		lp := len(d.Host().Network().Peers())
 		if i != 0 && lp > 0 {
-			reachableIds = append(reachableIds, d.Self())
+			reachableIds = append(reachableIds, d.Host().ID())
 		}
 	}
 	fmt.Println("guy routing table ==> ")
@@ -54,7 +54,7 @@ func TestValueGetSet(t *testing.T) {
 	var dhts [5]*dht.IpfsDHT
 	for i := range dhts {
 		dhts[i] = setupDHT(ctx, t, false)
-		fmt.Printf("%d). %s \n", i, dhts[i].Self().ShortString())
+		fmt.Printf("%d). %s \n", i, dhts[i].Host().ID().ShortString())
 		defer dhts[i].Close()
 		defer dhts[i].Host().Close()
 	}
@@ -62,7 +62,7 @@ func TestValueGetSet(t *testing.T) {
 	// 0 -> 1
 	connect(t, ctx, dhts[0], dhts[1])
 
-	fmt.Printf("PutValue('/v/hello', 'world') to %s \n", dhts[0].Self().ShortString())
+	fmt.Printf("PutValue('/v/hello', 'world') to %s \n", dhts[0].Host().ID().ShortString())
 	ctxT, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 	err := dhts[0].PutValue(ctxT, "/v/hello", []byte("world"))
@@ -70,7 +70,7 @@ func TestValueGetSet(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	fmt.Println("requesting value on dhts: ", dhts[1].Self())
+	fmt.Println("requesting value on dhts: ", dhts[1].Host().ID())
 	ctxT, cancel = context.WithTimeout(ctx, time.Second*2)
 	defer cancel()
 	val, err := dhts[1].GetValue(ctxT, "/v/hello")
@@ -88,7 +88,7 @@ func TestValueGetSet(t *testing.T) {
 	connect(t, ctx, dhts[2], dhts[0])
 	connect(t, ctx, dhts[2], dhts[1])
 
-	fmt.Println("requesting value (offline) on dhts: ", dhts[2].Self())
+	fmt.Println("requesting value (offline) on dhts: ", dhts[2].Host().ID())
 	vala, err := dhts[2].GetValue(ctxT, "/v/hello", dht.Quorum(0))
 	if vala != nil {
 		t.Fatalf("offline get should have failed, got %s", string(vala))
@@ -98,7 +98,7 @@ func TestValueGetSet(t *testing.T) {
 	}
 	fmt.Println("when the offline dht become online, it has no value.")
 
-	fmt.Println("requesting value (online) on dhts: ", dhts[2].Self())
+	fmt.Println("requesting value (online) on dhts: ", dhts[2].Host().ID())
 	vala, err = dhts[2].GetValue(ctxT, "/v/hello")
 	if err != nil {
 		t.Fatal(err)
@@ -116,7 +116,7 @@ func TestValueGetSet(t *testing.T) {
 	// 4 -> 3 -> 0,1,2
 	connect(t, ctx, dhts[4], dhts[3])
 
-	fmt.Println("requesting value(requires peer routing) on dhts: ", dhts[4].Self())
+	fmt.Println("requesting value(requires peer routing) on dhts: ", dhts[4].Host().ID())
 	val, err = dhts[4].GetValue(ctxT, "/v/hello")
 	if err != nil {
 		t.Fatal(err)
@@ -142,7 +142,7 @@ func TestValueGetInNetwork(t *testing.T) {
 	var dhts [5]*dht.IpfsDHT
 	for i := range dhts {
 		dhts[i] = setupDHT(ctx, t, false)
-		fmt.Printf("%d). %s \n", i, dhts[i].Self().ShortString())
+		fmt.Printf("%d). %s \n", i, dhts[i].Host().ID().ShortString())
 		defer dhts[i].Close()
 		defer dhts[i].Host().Close()
 	}
@@ -151,7 +151,7 @@ func TestValueGetInNetwork(t *testing.T) {
 	connect(t, ctx, dhts[0], dhts[1])
 
 	// set value in node 0
-	fmt.Printf("PutValue('/v/hello', 'world') to %s \n", dhts[0].Self().ShortString())
+	fmt.Printf("PutValue('/v/hello', 'world') to %s \n", dhts[0].Host().ID().ShortString())
 	ctxT, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 	err := dhts[0].PutValue(ctxT, "/v/hello", []byte("world"))
@@ -169,7 +169,7 @@ func TestValueGetInNetwork(t *testing.T) {
 	// 4 -> 3 -> 0,1,2
 	connect(t, ctx, dhts[4], dhts[3])
 
-	fmt.Println("requesting value(requires peer routing) on dhts: ", dhts[4].Self())
+	fmt.Println("requesting value(requires peer routing) on dhts: ", dhts[4].Host().ID())
 	val, err := dhts[4].GetValue(ctxT, "/v/hello")
 	if err != nil {
 		t.Fatal(err)
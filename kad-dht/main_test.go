@@ -0,0 +1,11 @@
+package test_dht
+
+import (
+	"testing"
+
+	tu "github.com/czh0526/libp2p/testutil"
+)
+
+func TestMain(m *testing.M) {
+	tu.RunMain(m)
+}
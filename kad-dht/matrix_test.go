@@ -0,0 +1,53 @@
+package test_dht
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	swarmt "github.com/czh0526/libp2p/swarm"
+)
+
+// 在每一种 加密 x 多路复用 组合上检查 DHT 的 Put/Get 以及 FindPeer
+func TestDHTMatrix(t *testing.T) {
+	swarmt.Matrix(t, func(t *testing.T, swarmOpts ...swarmt.Option) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dhtA := setupDHT(ctx, t, false, swarmOpts...)
+		dhtB := setupDHT(ctx, t, false, swarmOpts...)
+		dhtC := setupDHT(ctx, t, false, swarmOpts...)
+		defer dhtA.Close()
+		defer dhtB.Close()
+		defer dhtC.Close()
+		defer dhtA.Host().Close()
+		defer dhtB.Host().Close()
+		defer dhtC.Host().Close()
+
+		// A - B - C
+		connect(t, ctx, dhtA, dhtB)
+		connect(t, ctx, dhtB, dhtC)
+
+		ctxT, cancelT := context.WithTimeout(ctx, 5*time.Second)
+		defer cancelT()
+
+		if err := dhtA.PutValue(ctxT, "/v/matrix", []byte("world")); err != nil {
+			t.Fatal(err)
+		}
+		val, err := dhtC.GetValue(ctxT, "/v/matrix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != "world" {
+			t.Fatalf("expected 'world', got '%s'", val)
+		}
+
+		pi, err := dhtA.FindPeer(ctxT, dhtC.Host().ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pi.ID != dhtC.Host().ID() {
+			t.Fatalf("found wrong peer: %s", pi.ID)
+		}
+	})
+}
@@ -3,50 +3,45 @@ package test_dht
 import (
 	"context"
 	"testing"
+	"time"
 
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 )
 
-// 不知道在测试什么？？？
+// dht.New 在网络上注册了通知，连接建立后双方进入路由表，连接全部关闭后从路由表中删除
 func TestNotifieeMultipleConn(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	d1 := setupDHT(ctx, t, false)
 	d2 := setupDHT(ctx, t, false)
-
-	nn1 := dht.NewNetNotifiee(d1)
-	nn2 := dht.NewNetNotifiee(d2)
+	defer d1.Close()
+	defer d2.Close()
+	defer d1.Host().Close()
+	defer d2.Host().Close()
 
 	connect(t, ctx, d1, d2)
-	c12 := d1.Host().Network().ConnsToPeer(d2.Self())[0]
-	c21 := d2.Host().Network().ConnsToPeer(d1.Self())[0]
-
-	nn1.Connected(d1.Host().Network(), c12)
-	nn2.Connected(d1.Host().Network(), c21)
-
-	if !checkRoutingTable(d1, d2) {
-		t.Fatal("no routes")
-	}
-
-	nn1.Disconnected(d1.Host().Network(), c12)
-	nn2.Disconnected(d2.Host().Network(), c21)
 	if !checkRoutingTable(d1, d2) {
 		t.Fatal("no routes")
 	}
 
-	for _, conn := range d1.Host().Network().ConnsToPeer(d2.Self()) {
+	for _, conn := range d1.Host().Network().ConnsToPeer(d2.Host().ID()) {
 		conn.Close()
 	}
-	for _, conn := range d2.Host().Network().ConnsToPeer(d1.Self()) {
+	for _, conn := range d2.Host().Network().ConnsToPeer(d1.Host().ID()) {
 		conn.Close()
 	}
 
-	if checkRoutingTable(d1, d2) {
-		t.Fatal("should have no routes")
+	// 断开的通知是异步的
+	deadline := time.Now().Add(5 * time.Second)
+	for checkRoutingTable(d1, d2) {
+		if time.Now().After(deadline) {
+			t.Fatal("should have no routes")
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 }
 
 func checkRoutingTable(a, b *dht.IpfsDHT) bool {
-	return a.RoutingTable().Find(b.Self()) != "" && b.RoutingTable().Find(a.Self()) != ""
+	return a.RoutingTable().Find(b.Host().ID()) != "" && b.RoutingTable().Find(a.Host().ID()) != ""
 }
@@ -6,7 +6,13 @@ import (
 	"testing"
 	"time"
 
+	ggio "github.com/gogo/protobuf/io"
 	cid "github.com/ipfs/go-cid"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	opts "github.com/libp2p/go-libp2p-kad-dht/opts"
+	pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	inet "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
 	mhash "github.com/multiformats/go-multihash"
 )
 
@@ -64,7 +70,7 @@ func TestProvides(t *testing.T) {
 			if prov.ID == "" {
 				t.Fatal("Got back nil provider")
 			}
-			if prov.ID != dhts[3].Self() {
+			if prov.ID != dhts[3].Host().ID() {
 				t.Fatal("Got back wrong provider.")
 			}
 		case <-ctxT.Done():
@@ -101,10 +107,32 @@ func TestLocalProvides(t *testing.T) {
 	for _, c := range testCaseCids {
 		for i := 0; i < 3; i++ {
 			// 在 [0-2] 节点进行本地查找,验证 [3] 的数据是否扩散到其他节点
-			provs := dhts[i].Providers().GetProviders(ctx, c)
+			provs := localProviders(ctx, t, dhts[3], dhts[i], c)
 			if len(provs) > 0 {
 				t.Fatal("shouldn't know this")
 			}
 		}
 	}
 }
+
+// localProviders 由 from 向 to 发送一次 GET_PROVIDERS，返回 to 本地保存的 provider
+func localProviders(ctx context.Context, t *testing.T, from, to *dht.IpfsDHT, c cid.Cid) []*pb.Message_Peer {
+	pi := pstore.PeerInfo{ID: to.Host().ID(), Addrs: to.Host().Addrs()}
+	if err := from.Host().Connect(ctx, pi); err != nil {
+		t.Fatal(err)
+	}
+	s, err := from.Host().NewStream(ctx, pi.ID, opts.ProtocolDHT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inet.FullClose(s)
+
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(pb.NewMessage(pb.Message_GET_PROVIDERS, c.Bytes(), 0)); err != nil {
+		t.Fatal(err)
+	}
+	resp := new(pb.Message)
+	if err := ggio.NewDelimitedReader(s, inet.MessageSizeMax).ReadMsg(resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.ProviderPeers
+}
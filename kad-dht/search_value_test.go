@@ -31,7 +31,7 @@ func TestSearchValue(t *testing.T) {
 	defer cancel()
 
 	// put value into dhtA
-	fmt.Printf("===> put('/v/hello', 'valid') into %s \n", dhtA.Self().ShortString())
+	fmt.Printf("===> put('/v/hello', 'valid') into %s \n", dhtA.Host().ID().ShortString())
 	err := dhtA.PutValue(ctxT, "/v/hello", []byte("valid"))
 	if err != nil {
 		t.Error(err)
@@ -58,7 +58,7 @@ func TestSearchValue(t *testing.T) {
 	<-time.After(time.Microsecond * 100)
 
 	// 在查找过程中，修改 dhtB 中的数据
-	fmt.Printf("===> put('/v/hello', 'newer') into %s \n", dhtB.Self().ShortString())
+	fmt.Printf("===> put('/v/hello', 'newer') into %s \n", dhtB.Host().ID().ShortString())
 	err = dhtB.PutValue(ctxT, "/v/hello", []byte("newer"))
 	if err != nil {
 		t.Error(err)
@@ -24,7 +24,7 @@ func TestValueSet(t *testing.T) {
 
 	for i := range dhts {
 		dhts[i] = setupDHT(ctx, t, false)
-		fmt.Printf("%d). %s \n", i, dhts[i].Self())
+		fmt.Printf("%d). %s \n", i, dhts[i].Host().ID())
 		defer dhts[i].Close()
 		defer dhts[i].Host().Close()
 	}
@@ -40,7 +40,7 @@ func TestValueSet(t *testing.T) {
 	connect(t, ctx, dhts[3], dhts[2])
 	connect(t, ctx, dhts[4], dhts[3])
 
-	fmt.Printf("adding value on: %s \n", dhts[0].Self())
+	fmt.Printf("adding value on: %s \n", dhts[0].Host().ID())
 	ctxT, cancel := context.WithTimeout(ctx, 100*time.Second)
 	defer cancel()
 	err := dhts[0].PutValue(ctxT, "/v/hello", []byte("world"))
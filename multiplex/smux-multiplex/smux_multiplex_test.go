@@ -10,3 +10,7 @@ import (
 func TestMultiplexTransport(t *testing.T) {
 	test.SubtestAll(t, smux_mplex.DefaultTransport)
 }
+
+func BenchmarkMultiplexTransport(b *testing.B) {
+	test.SubBenchAll(b, smux_mplex.DefaultTransport)
+}
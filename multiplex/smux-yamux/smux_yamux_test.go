@@ -0,0 +1,16 @@
+package smux_yamux
+
+import (
+	"testing"
+
+	test "github.com/czh0526/libp2p/multiplex/stream-muxer"
+	yamux "github.com/whyrusleeping/go-smux-yamux"
+)
+
+func TestYamuxTransport(t *testing.T) {
+	test.SubtestAll(t, yamux.DefaultTransport)
+}
+
+func BenchmarkYamuxTransport(b *testing.B) {
+	test.SubBenchAll(b, yamux.DefaultTransport)
+}
@@ -22,3 +22,17 @@ func TestMultiplexTransport(t *testing.T) {
 	tpt.AddTransport("/smux_mplex/1.0.0", smux_mplex.DefaultTransport)
 	test.SubtestAll(t, tpt)
 }
+
+func BenchmarkMultiplexTransport(b *testing.B) {
+	tpt := smux_mstream.NewBlankTransport()
+	tpt.AddTransport("/yamux/1.0.0", yamux.DefaultTransport)
+	b.Run("yamux", func(b *testing.B) {
+		test.SubBenchAll(b, tpt)
+	})
+
+	tpt = smux_mstream.NewBlankTransport()
+	tpt.AddTransport("/smux_mplex/1.0.0", smux_mplex.DefaultTransport)
+	b.Run("mplex", func(b *testing.B) {
+		test.SubBenchAll(b, tpt)
+	})
+}
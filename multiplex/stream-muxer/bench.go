@@ -0,0 +1,77 @@
+package stream_muxer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	smux "github.com/libp2p/go-stream-muxer"
+)
+
+const benchChunk = 64 << 10
+
+// SubBenchThroughput 测量在 streams 个并发 Stream 上的单向吞吐量，每次迭代写入 64KiB
+func SubBenchThroughput(b *testing.B, tr smux.Transport, streams int) {
+	l := listenLocal(b)
+	done := serveWith(b, tr, l, func(s smux.Stream) {
+		io.Copy(ioutil.Discard, s)
+		// 回写一个字节，表示数据已经全部收到
+		s.Write([]byte{0})
+		s.Close()
+	})
+	defer done()
+
+	c := dialConn(b, tr, l)
+	defer c.Close()
+
+	ss := make([]smux.Stream, streams)
+	for i := range ss {
+		s, err := c.OpenStream()
+		if err != nil {
+			b.Fatal(err)
+		}
+		ss[i] = s
+	}
+
+	chunk := randBuf(benchChunk)
+	b.SetBytes(benchChunk)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var wg sync.WaitGroup
+	for i, s := range ss {
+		// 将 b.N 次写入平均分配到各个 Stream 上
+		n := b.N / streams
+		if i < b.N%streams {
+			n++
+		}
+
+		wg.Add(1)
+		go func(s smux.Stream, n int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				if _, err := s.Write(chunk); err != nil {
+					b.Error(err)
+					s.Reset()
+					return
+				}
+			}
+			s.Close()
+			if _, err := io.ReadFull(s, make([]byte, 1)); err != nil {
+				b.Error(err)
+			}
+		}(s, n)
+	}
+	wg.Wait()
+}
+
+// SubBenchAll 以 1/10/100 个并发 Stream 运行吞吐量测试
+func SubBenchAll(b *testing.B, tr smux.Transport) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("Throughput%dStreams", n), func(b *testing.B) {
+			SubBenchThroughput(b, tr, n)
+		})
+	}
+}
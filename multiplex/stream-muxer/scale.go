@@ -0,0 +1,84 @@
+package stream_muxer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// ScaleEnv 环境变量可以整体放大/缩小压力测试的规模，例如 STREAM_MUXER_SCALE=0.1
+const ScaleEnv = "STREAM_MUXER_SCALE"
+
+// Scale 描述压力测试的规模
+type Scale struct {
+	// SubtestStress: 同一个 Conn 上并发的 Stream 数量，以及每个 Stream 上的消息数量/最大长度
+	Streams int
+	Msgs    int
+	MsgMax  int
+
+	// SubtestLargeTransfer: 并发的大块传输数量，以及每次传输的字节数
+	Transfers    int
+	TransferSize int
+
+	// SubtestResetStorm: 被 Reset 的 Stream 数量
+	Resets int
+
+	// SubtestSlowReader: 慢速读取方阻塞时，其它 Stream 需要完成的回显次数
+	FastRounds int
+}
+
+var DefaultScale = Scale{
+	Streams:      1000,
+	Msgs:         10,
+	MsgMax:       4096,
+	Transfers:    4,
+	TransferSize: 8 << 20,
+	Resets:       500,
+	FastRounds:   50,
+}
+
+// Times 按比例调整规模，每一项至少保留 1
+func (s Scale) Times(f float64) Scale {
+	mul := func(n int) int {
+		n = int(float64(n) * f)
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+	msgMax := mul(s.MsgMax)
+	if msgMax >= len(randomness) {
+		msgMax = len(randomness) - 1
+	}
+	return Scale{
+		Streams:      mul(s.Streams),
+		Msgs:         mul(s.Msgs),
+		MsgMax:       msgMax,
+		Transfers:    mul(s.Transfers),
+		TransferSize: mul(s.TransferSize),
+		Resets:       mul(s.Resets),
+		FastRounds:   mul(s.FastRounds),
+	}
+}
+
+func (s Scale) String() string {
+	return fmt.Sprintf("streams=%d msgs=%d msgmax=%d transfers=%d size=%d resets=%d rounds=%d",
+		s.Streams, s.Msgs, s.MsgMax, s.Transfers, s.TransferSize, s.Resets, s.FastRounds)
+}
+
+// ScaleFromEnv 返回 DefaultScale 经过 STREAM_MUXER_SCALE 以及 -short 调整之后的结果
+func ScaleFromEnv(t testing.TB) Scale {
+	s := DefaultScale
+	if v := os.Getenv(ScaleEnv); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			t.Fatalf("invalid %s=%q", ScaleEnv, v)
+		}
+		s = s.Times(f)
+	}
+	if testing.Short() {
+		s = s.Times(0.1)
+	}
+	return s
+}
@@ -0,0 +1,475 @@
+package stream_muxer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	smux "github.com/libp2p/go-stream-muxer"
+)
+
+// 单个压力测试允许的最长时间，超时视为 muxer 挂死
+var StressTimeout = 2 * time.Minute
+
+const (
+	modeEcho byte = iota
+	modeServerReset
+	modeClientReset
+	modeSlow
+)
+
+// serveWith 与 GoServe 类似，但每个新的 Stream 都交给 handler 处理，
+// 并且在 done() 返回时所有的连接都已经关闭
+func serveWith(t testing.TB, tr smux.Transport, l net.Listener, handler func(smux.Stream)) (done func()) {
+	var (
+		mu    sync.Mutex
+		conns []smux.Conn
+		wg    sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			conn, err := tr.NewConn(nc, true)
+			if err != nil {
+				t.Error(err)
+				nc.Close()
+				continue
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			go func() {
+				for {
+					s, err := conn.AcceptStream()
+					if err != nil {
+						return
+					}
+					go handler(s)
+				}
+			}()
+		}
+	}()
+
+	return func() {
+		l.Close()
+		wg.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+}
+
+// dialConn 连接 l 并将 net.Conn 包装成 smux.Conn
+func dialConn(t testing.TB, tr smux.Transport, l net.Listener) smux.Conn {
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := tr.NewConn(nc, false)
+	if err != nil {
+		nc.Close()
+		t.Fatal(err)
+	}
+	go func() {
+		// 客户端不接受对方打开的 Stream
+		for {
+			s, err := c.AcceptStream()
+			if err != nil {
+				return
+			}
+			s.Reset()
+		}
+	}()
+	return c
+}
+
+func listenLocal(t testing.TB) net.Listener {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// quietEcho 回显 Stream 上的所有数据，不输出日志
+func quietEcho(s smux.Stream) {
+	defer s.Close()
+	io.Copy(s, s)
+}
+
+// modeHandler 根据 Stream 上的第一个字节决定处理方式
+func modeHandler(release <-chan struct{}) func(smux.Stream) {
+	return func(s smux.Stream) {
+		var mode [1]byte
+		if _, err := io.ReadFull(s, mode[:]); err != nil {
+			s.Reset()
+			return
+		}
+
+		switch mode[0] {
+		case modeEcho:
+			quietEcho(s)
+		case modeServerReset:
+			io.ReadFull(s, make([]byte, 16))
+			s.Reset()
+		case modeSlow:
+			// 在 release 关闭之前一个字节也不读
+			<-release
+			io.Copy(ioutil.Discard, s)
+			s.Close()
+		default:
+			io.Copy(ioutil.Discard, s)
+			s.Close()
+		}
+	}
+}
+
+// waitTimeout 等待 wg 完成，超时返回 false
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// reportErrors 输出最多 10 个错误，避免上千个 Stream 同时失败时刷屏
+func reportErrors(t testing.TB, errs <-chan error) {
+	n := 0
+	for err := range errs {
+		if n < 10 {
+			t.Error(err)
+		}
+		n++
+	}
+	if n > 10 {
+		t.Errorf("... and %d more errors", n-10)
+	}
+}
+
+// echoRound 在 s 上写一段随机数据，并检查回显的数据是否一致
+func echoRound(s smux.Stream, size int) error {
+	out := randBuf(size)
+	if _, err := s.Write(out); err != nil {
+		return err
+	}
+
+	in := make([]byte, len(out))
+	if _, err := io.ReadFull(s, in); err != nil {
+		return err
+	}
+	if !bytes.Equal(in, out) {
+		return fmt.Errorf("echoed data mismatch (%d bytes)", size)
+	}
+	return nil
+}
+
+func SubtestManyStreams(t *testing.T, tr smux.Transport) {
+	SubtestStress(t, tr, ScaleFromEnv(t))
+}
+
+// SubtestStress 在一个 Conn 上并发打开 s.Streams 个 Stream，每个 Stream 回显 s.Msgs 条随机长度的消息
+func SubtestStress(t *testing.T, tr smux.Transport, s Scale) {
+	fmt.Printf("stress: %s \n", s)
+
+	l := listenLocal(t)
+	done := serveWith(t, tr, l, quietEcho)
+	defer done()
+
+	c := dialConn(t, tr, l)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, s.Streams)
+	for i := 0; i < s.Streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			st, err := c.OpenStream()
+			if err != nil {
+				errs <- fmt.Errorf("stream %d: open: %s", i, err)
+				return
+			}
+			for m := 0; m < s.Msgs; m++ {
+				if err := echoRound(st, 1+mrand.Intn(s.MsgMax)); err != nil {
+					st.Reset()
+					errs <- fmt.Errorf("stream %d, msg %d: %s", i, m, err)
+					return
+				}
+			}
+
+			// 关闭写方向后，对方的 echo 也会关闭，这里应当读到 EOF
+			st.Close()
+			if rest, err := ioutil.ReadAll(st); err != nil || len(rest) != 0 {
+				errs <- fmt.Errorf("stream %d: expected clean EOF, got %d bytes, err %v", i, len(rest), err)
+			}
+		}(i)
+	}
+
+	if !waitTimeout(&wg, StressTimeout) {
+		t.Fatalf("stress test timed out after %s", StressTimeout)
+	}
+	close(errs)
+	reportErrors(t, errs)
+}
+
+func SubtestLargeTransfers(t *testing.T, tr smux.Transport) {
+	SubtestLargeTransfer(t, tr, ScaleFromEnv(t))
+}
+
+// SubtestLargeTransfer 并发地传输 s.Transfers 份 s.TransferSize 字节的数据，
+// 接收方计算 sha256 并回传，发送方比较校验和
+func SubtestLargeTransfer(t *testing.T, tr smux.Transport, s Scale) {
+	fmt.Printf("large transfer: %d x %d bytes \n", s.Transfers, s.TransferSize)
+
+	l := listenLocal(t)
+	done := serveWith(t, tr, l, func(st smux.Stream) {
+		h := sha256.New()
+		if _, err := io.Copy(h, st); err != nil {
+			st.Reset()
+			return
+		}
+		st.Write(h.Sum(nil))
+		st.Close()
+	})
+	defer done()
+
+	c := dialConn(t, tr, l)
+	defer c.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make(chan error, s.Transfers)
+	for i := 0; i < s.Transfers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			st, err := c.OpenStream()
+			if err != nil {
+				errs <- fmt.Errorf("transfer %d: open: %s", i, err)
+				return
+			}
+
+			h := sha256.New()
+			w := io.MultiWriter(st, h)
+			for left := s.TransferSize; left > 0; {
+				n := 64 << 10
+				if n > left {
+					n = left
+				}
+				if _, err := w.Write(randBuf(n)); err != nil {
+					st.Reset()
+					errs <- fmt.Errorf("transfer %d: write: %s", i, err)
+					return
+				}
+				left -= n
+			}
+			st.Close()
+
+			sum := make([]byte, sha256.Size)
+			if _, err := io.ReadFull(st, sum); err != nil {
+				errs <- fmt.Errorf("transfer %d: read checksum: %s", i, err)
+				return
+			}
+			if !bytes.Equal(sum, h.Sum(nil)) {
+				errs <- fmt.Errorf("transfer %d: checksum mismatch", i)
+			}
+		}(i)
+	}
+
+	if !waitTimeout(&wg, StressTimeout) {
+		t.Fatalf("large transfer timed out after %s", StressTimeout)
+	}
+	close(errs)
+	reportErrors(t, errs)
+
+	total := float64(s.Transfers*s.TransferSize) / (1 << 20)
+	fmt.Printf("transferred %.1f MiB in %s (%.1f MiB/s) \n", total, time.Since(start), total/time.Since(start).Seconds())
+}
+
+func SubtestResetStorms(t *testing.T, tr smux.Transport) {
+	SubtestResetStorm(t, tr, ScaleFromEnv(t))
+}
+
+// SubtestResetStorm 同时 Reset 大量 Stream（一半由本端发起，一半由对端发起），
+// 之后 Conn 仍然必须可用
+func SubtestResetStorm(t *testing.T, tr smux.Transport, s Scale) {
+	fmt.Printf("reset storm: %d streams \n", s.Resets)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	l := listenLocal(t)
+	done := serveWith(t, tr, l, modeHandler(release))
+	defer done()
+
+	c := dialConn(t, tr, l)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Resets; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			st, err := c.OpenStream()
+			if err != nil {
+				// 风暴中打开失败是允许的，只要 Conn 最后仍然可用
+				return
+			}
+
+			mode := modeClientReset
+			if i%2 == 0 {
+				mode = modeServerReset
+			}
+			st.Write([]byte{mode})
+			st.Write(randBuf(16))
+
+			if mode == modeClientReset {
+				st.Reset()
+				return
+			}
+			// 等待对端的 Reset，不能一直阻塞
+			ioutil.ReadAll(st)
+			st.Reset()
+		}(i)
+	}
+
+	if !waitTimeout(&wg, StressTimeout) {
+		t.Fatalf("reset storm did not settle after %s", StressTimeout)
+	}
+
+	if c.IsClosed() {
+		t.Fatal("connection closed by reset storm")
+	}
+
+	st, err := c.OpenStream()
+	if err != nil {
+		t.Fatalf("open stream after reset storm: %s", err)
+	}
+	defer st.Close()
+
+	if _, err := st.Write([]byte{modeEcho}); err != nil {
+		t.Fatal(err)
+	}
+	if err := echoRound(st, 4096); err != nil {
+		t.Fatalf("echo after reset storm: %s", err)
+	}
+}
+
+func SubtestSlowReaders(t *testing.T, tr smux.Transport) {
+	SubtestSlowReader(t, tr, ScaleFromEnv(t))
+}
+
+// SubtestSlowReader 对端完全不读取其中一个 Stream，
+// 同一个 Conn 上的其它 Stream 仍然必须能够正常回显
+func SubtestSlowReader(t *testing.T, tr smux.Transport, s Scale) {
+	fmt.Printf("slow reader: %d echo rounds \n", s.FastRounds)
+
+	release := make(chan struct{})
+	released := false
+	defer func() {
+		if !released {
+			close(release)
+		}
+	}()
+
+	l := listenLocal(t)
+	done := serveWith(t, tr, l, modeHandler(release))
+	defer done()
+
+	c := dialConn(t, tr, l)
+	defer c.Close()
+
+	// 慢速 Stream: 持续写入，直到被对方的窗口阻塞
+	slow, err := c.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowDone := make(chan error, 1)
+	go func() {
+		if _, err := slow.Write([]byte{modeSlow}); err != nil {
+			slowDone <- err
+			return
+		}
+		for i := 0; i < 256; i++ {
+			if _, err := slow.Write(randBuf(64 << 10)); err != nil {
+				slowDone <- err
+				return
+			}
+		}
+		slowDone <- slow.Close()
+	}()
+
+	// 给慢速 Stream 一点时间填满缓冲区
+	time.Sleep(100 * time.Millisecond)
+
+	fast, err := c.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	fastDone := make(chan error, 1)
+	go func() {
+		if _, err := fast.Write([]byte{modeEcho}); err != nil {
+			fastDone <- err
+			return
+		}
+		for i := 0; i < s.FastRounds; i++ {
+			if err := echoRound(fast, 1+mrand.Intn(s.MsgMax)); err != nil {
+				fastDone <- fmt.Errorf("round %d: %s", i, err)
+				return
+			}
+		}
+		fastDone <- nil
+	}()
+
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Fatalf("fast stream failed while a slow reader is blocked: %s", err)
+		}
+	case <-time.After(StressTimeout):
+		t.Fatalf("fast stream starved by slow reader for %s", StressTimeout)
+	}
+
+	// 放行慢速 Stream，它要么写完，要么已经被 muxer 重置（例如 mplex 的接收超时）
+	close(release)
+	released = true
+	select {
+	case err := <-slowDone:
+		if err != nil {
+			fmt.Printf("slow stream ended with: %s \n", err)
+		}
+	case <-time.After(StressTimeout):
+		t.Fatalf("slow stream never drained after release")
+	}
+}
@@ -145,6 +145,10 @@ type TransportTest func(t *testing.T, tr smux.Transport)
 var Subtests = []TransportTest{
 	//SubtestDummy,
 	SubtestSimpleWrite,
+	SubtestManyStreams,
+	SubtestLargeTransfers,
+	SubtestResetStorms,
+	SubtestSlowReaders,
 }
 
 func getFunctionName(i interface{}) string {
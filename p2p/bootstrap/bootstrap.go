@@ -0,0 +1,432 @@
+// bootstrap 维护节点与网络之间的连接:
+//
+//   - 连接数少于 MinPeers 时，拨号 bootstrap 列表中的节点
+//   - bootstrap 节点都不可用时，退而拨号 peerstore 中保存的节点（例如上一次运行时连接过的节点）
+//   - 拨号失败的节点按指数退避，成功后重置
+//   - 可选地 ping 已连接的 bootstrap 节点，ping 不通的连接被关闭，之后重新拨号
+//   - 记录每个节点的拨号统计
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var ErrNoPeers = errors.New("bootstrap: not connected to any peer")
+
+// Config 是 Manager 的配置，为 0 的字段使用默认值
+type Config struct {
+	// bootstrap 节点列表
+	Peers []pstore.PeerInfo
+	// 至少保持的连接数
+	MinPeers int
+	// 检查连接数的间隔
+	Period time.Duration
+	// 单次拨号的超时时间
+	ConnectTimeout time.Duration
+	// 拨号失败后的退避时间，每次失败翻倍，不超过 BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// 是否使用 peerstore 中的其它节点补足连接
+	UsePeerstore bool
+	// 是否 ping 已连接的 bootstrap 节点，需要对方支持 ping 协议
+	Ping bool
+}
+
+const (
+	DefaultMinPeers       = 4
+	DefaultPeriod         = 30 * time.Second
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultBackoffBase    = time.Second
+	DefaultBackoffMax     = 10 * time.Minute
+)
+
+func (cfg *Config) setDefaults() {
+	if cfg.MinPeers <= 0 {
+		cfg.MinPeers = DefaultMinPeers
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = DefaultPeriod
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = DefaultConnectTimeout
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = DefaultBackoffBase
+	}
+	if cfg.BackoffMax <= 0 {
+		cfg.BackoffMax = DefaultBackoffMax
+	}
+}
+
+// PeerStats 是一个节点的拨号统计
+type PeerStats struct {
+	Bootstrap   bool
+	Attempts    int
+	Successes   int
+	Failures    int
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string
+	// 最近一次 ping 的往返时间
+	LastRTT time.Duration
+	// ping 失败的次数和最近一次的错误，ping 失败不计入拨号失败，也不触发退避
+	PingFailures  int
+	LastPingError string
+	// 连续失败的次数和下一次允许拨号的时间
+	consecutive int
+	nextAttempt time.Time
+}
+
+// NextAttempt 返回下一次允许拨号的时间
+func (s PeerStats) NextAttempt() time.Time {
+	return s.nextAttempt
+}
+
+// Manager 维护连接数，在 Start 之后周期性运行，连接断开时提前运行
+type Manager struct {
+	host host.Host
+	cfg  Config
+
+	mu    sync.Mutex
+	stats map[peer.ID]*PeerStats
+
+	trigger chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func New(h host.Host, cfg Config) *Manager {
+	cfg.setDefaults()
+	m := &Manager{
+		host:    h,
+		cfg:     cfg,
+		stats:   make(map[peer.ID]*PeerStats),
+		trigger: make(chan struct{}, 1),
+	}
+	for _, pi := range cfg.Peers {
+		m.stats[pi.ID] = &PeerStats{Bootstrap: true}
+	}
+	return m
+}
+
+// ParsePeers 解析 /.../ipfs/<peer-id> 格式的地址，同一个 peer 的多个地址合并到一起
+func ParsePeers(addrs []ma.Multiaddr) ([]pstore.PeerInfo, error) {
+	var pinfos []pstore.PeerInfo
+	index := make(map[peer.ID]int)
+	for _, addr := range addrs {
+		pi, err := pstore.InfoFromP2pAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("bad bootstrap address %s: %s", addr, err)
+		}
+		if i, ok := index[pi.ID]; ok {
+			pinfos[i].Addrs = append(pinfos[i].Addrs, pi.Addrs...)
+			continue
+		}
+		index[pi.ID] = len(pinfos)
+		pinfos = append(pinfos, *pi)
+	}
+	return pinfos, nil
+}
+
+// ReadPeersFile 读取节点列表文件: 每行一个 /.../ipfs/<peer-id> 格式的地址，# 开头的行是注释
+func ReadPeersFile(path string) ([]ma.Multiaddr, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []ma.Multiaddr
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(line)
+		if err != nil {
+			return nil, fmt.Errorf("bad bootstrap address %q: %s", line, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// LoadPeers 读取节点列表文件，同一个 peer 的多个地址合并到一起
+func LoadPeers(path string) ([]pstore.PeerInfo, error) {
+	addrs, err := ReadPeersFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePeers(addrs)
+}
+
+// Start 在后台维护连接，直到 ctx 结束或调用 Close
+func (m *Manager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	m.host.Network().Notify(m.notifiee())
+	go m.loop(ctx)
+}
+
+func (m *Manager) Close() error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	<-m.done
+	m.host.Network().StopNotify(m.notifiee())
+	return nil
+}
+
+func (m *Manager) loop(ctx context.Context) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.cfg.Period)
+	defer ticker.Stop()
+	for {
+		if m.cfg.Ping {
+			m.healthCheck(ctx)
+		}
+		if err := m.Bootstrap(ctx); err != nil {
+			fmt.Printf("bootstrap: %s \n", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-m.trigger:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Bootstrap 执行一轮: 连接数不足时拨号，没有任何连接时返回 ErrNoPeers
+func (m *Manager) Bootstrap(ctx context.Context) error {
+	// 先拨号 bootstrap 节点，仍然不够时再拨号 peerstore 中的节点
+	m.dial(ctx, m.candidates(m.cfg.Peers))
+	if m.cfg.UsePeerstore {
+		m.dial(ctx, m.candidates(m.peerstorePeers()))
+	}
+
+	if len(m.host.Network().Peers()) == 0 {
+		return ErrNoPeers
+	}
+	return nil
+}
+
+// dial 每次并行拨号还缺少的数量，有失败时继续拨号剩下的 candidates，直到连接数达到 MinPeers
+func (m *Manager) dial(ctx context.Context, candidates []pstore.PeerInfo) {
+	for len(candidates) > 0 && ctx.Err() == nil {
+		need := m.cfg.MinPeers - len(m.host.Network().Peers())
+		if need <= 0 {
+			return
+		}
+		batch := candidates
+		if len(batch) > need {
+			batch = batch[:need]
+		}
+		candidates = candidates[len(batch):]
+
+		var wg sync.WaitGroup
+		for _, pi := range batch {
+			wg.Add(1)
+			go func(pi pstore.PeerInfo) {
+				defer wg.Done()
+				m.connect(ctx, pi)
+			}(pi)
+		}
+		wg.Wait()
+	}
+}
+
+// candidates 返回没有连接、并且不在退避期内的节点，随机排列
+func (m *Manager) candidates(peers []pstore.PeerInfo) []pstore.PeerInfo {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []pstore.PeerInfo
+	for _, pi := range peers {
+		if pi.ID == m.host.ID() || m.host.Network().Connectedness(pi.ID) == inet.Connected {
+			continue
+		}
+		if st, ok := m.stats[pi.ID]; ok && now.Before(st.nextAttempt) {
+			continue
+		}
+		out = append(out, pi)
+	}
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// peerstorePeers 返回 peerstore 中有地址的非 bootstrap 节点，成功过的排在前面
+func (m *Manager) peerstorePeers() []pstore.PeerInfo {
+	var good, rest []pstore.PeerInfo
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.host.Peerstore().PeersWithAddrs() {
+		st, ok := m.stats[p]
+		if ok && st.Bootstrap {
+			continue
+		}
+		pi := m.host.Peerstore().PeerInfo(p)
+		if ok && st.Successes > 0 {
+			good = append(good, pi)
+		} else {
+			rest = append(rest, pi)
+		}
+	}
+	return append(good, rest...)
+}
+
+func (m *Manager) connect(ctx context.Context, pi pstore.PeerInfo) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.ConnectTimeout)
+	defer cancel()
+
+	err := m.host.Connect(ctx, pi)
+	m.record(pi.ID, err)
+	if err != nil {
+		fmt.Printf("bootstrap: connect to %s failed: %s \n", pi.ID, err)
+		return
+	}
+	// 记住可用的地址，peerstore 持久化时下次运行可以用到
+	m.host.Peerstore().AddAddrs(pi.ID, pi.Addrs, pstore.PermanentAddrTTL)
+}
+
+// record 更新统计，失败时计算下一次允许拨号的时间
+func (m *Manager) record(p peer.ID, err error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.stats[p]
+	if !ok {
+		st = &PeerStats{}
+		m.stats[p] = st
+	}
+	st.Attempts++
+	st.LastAttempt = now
+	if err == nil {
+		st.Successes++
+		st.LastSuccess = now
+		st.LastError = ""
+		st.consecutive = 0
+		st.nextAttempt = time.Time{}
+		return
+	}
+
+	st.Failures++
+	st.LastError = err.Error()
+	st.consecutive++
+	st.nextAttempt = now.Add(m.backoff(st.consecutive))
+}
+
+// backoff 返回第 n 次连续失败后的退避时间，带 ±10% 的抖动
+func (m *Manager) backoff(n int) time.Duration {
+	d := m.cfg.BackoffBase
+	for i := 1; i < n && d < m.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > m.cfg.BackoffMax {
+		d = m.cfg.BackoffMax
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/5+1)) - d/10
+	return d + jitter
+}
+
+// healthCheck ping 已连接的 bootstrap 节点，ping 不通时关闭连接
+func (m *Manager) healthCheck(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, pi := range m.cfg.Peers {
+		if m.host.Network().Connectedness(pi.ID) != inet.Connected {
+			continue
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			rtt, err := m.ping(ctx, p)
+			m.mu.Lock()
+			st := m.stats[p]
+			if err != nil {
+				st.PingFailures++
+				st.LastPingError = err.Error()
+			} else {
+				st.LastRTT = rtt
+				st.LastPingError = ""
+			}
+			m.mu.Unlock()
+
+			// 关闭之后由下一轮重新拨号，慢的节点不会因此进入退避
+			if err != nil {
+				fmt.Printf("bootstrap: health check of %s failed: %s \n", p, err)
+				m.host.Network().ClosePeer(p)
+			}
+		}(pi.ID)
+	}
+	wg.Wait()
+}
+
+func (m *Manager) ping(ctx context.Context, p peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.ConnectTimeout)
+	defer cancel()
+
+	ch, err := ping.Ping(ctx, m.host, p)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case rtt, ok := <-ch:
+		if !ok {
+			return 0, fmt.Errorf("ping failed")
+		}
+		return rtt, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Stats 返回所有拨号过的节点和 bootstrap 节点的统计
+func (m *Manager) Stats() map[peer.ID]PeerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[peer.ID]PeerStats, len(m.stats))
+	for p, st := range m.stats {
+		out[p] = *st
+	}
+	return out
+}
+
+// 连接断开、连接数低于 MinPeers 时，提前运行一轮
+func (m *Manager) notifiee() inet.Notifiee {
+	return (*notifiee)(m)
+}
+
+type notifiee Manager
+
+func (n *notifiee) Disconnected(net inet.Network, c inet.Conn) {
+	if len(net.Peers()) < n.cfg.MinPeers {
+		select {
+		case n.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      {}
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) {}
+func (n *notifiee) Connected(inet.Network, inet.Conn)      {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
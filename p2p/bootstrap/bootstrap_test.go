@@ -0,0 +1,259 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mocknet "github.com/czh0526/libp2p/p2p/net/mock"
+	tu "github.com/czh0526/libp2p/testutil"
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// makeNet 构建 n 个 host，hosts[0] 是被测的节点，它与其它节点之间只建立 link，不建立连接
+func makeNet(t *testing.T, ctx context.Context, n int) (mocknet.Mocknet, []host.Host) {
+	mn := mocknet.New(ctx)
+	hosts := make([]host.Host, n)
+	for i := range hosts {
+		sk, _, err := tu.RandTestKeyPair(512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 20000+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ping.NewPingService(h)
+		hosts[i] = h
+	}
+	for _, h := range hosts[1:] {
+		if _, err := mn.LinkPeers(hosts[0].ID(), h.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mn, hosts
+}
+
+func peerInfos(hosts []host.Host) []pstore.PeerInfo {
+	out := make([]pstore.PeerInfo, len(hosts))
+	for i, h := range hosts {
+		out[i] = pstore.PeerInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+	return out
+}
+
+func waitPeers(t *testing.T, h host.Host, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.Network().Peers()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d peers, got %d", n, len(h.Network().Peers()))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMinPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, hosts := makeNet(t, ctx, 6)
+	h := hosts[0]
+
+	m := New(h, Config{Peers: peerInfos(hosts[1:]), MinPeers: 3})
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.Network().Peers()); n != 3 {
+		t.Fatalf("expected 3 peers, got %d", n)
+	}
+
+	// 连接数足够时不再拨号
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	attempts := 0
+	for _, st := range m.Stats() {
+		attempts += st.Attempts
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 dial attempts, got %d", attempts)
+	}
+}
+
+func TestDialPastFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, hosts := makeNet(t, ctx, 6)
+	h := hosts[0]
+	// 只有 hosts[5] 可以连接
+	for _, dead := range hosts[1:5] {
+		if err := mn.UnlinkPeers(h.ID(), dead.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := New(h, Config{Peers: peerInfos(hosts[1:]), MinPeers: 1})
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if h.Network().Connectedness(hosts[5].ID()) != inet.Connected {
+		t.Fatal("expected a connection to the reachable peer")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, hosts := makeNet(t, ctx, 3)
+	h := hosts[0]
+
+	m := New(h, Config{Peers: peerInfos(hosts[1:]), MinPeers: 2, Period: time.Hour, BackoffBase: time.Millisecond})
+	m.Start(ctx)
+	defer m.Close()
+	waitPeers(t, h, 2)
+
+	// 断开之后，不等周期到达就重新连接
+	for _, p := range h.Network().Peers() {
+		h.Network().ClosePeer(p)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, hp := range hosts[1:] {
+		for m.Stats()[hp.ID()].Successes < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to be dialed twice, got %+v", hp.ID(), m.Stats()[hp.ID()])
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitPeers(t, h, 2)
+}
+
+func TestBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, hosts := makeNet(t, ctx, 2)
+	h, dead := hosts[0], hosts[1]
+	if err := mn.UnlinkPeers(h.ID(), dead.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(h, Config{Peers: peerInfos(hosts[1:]), MinPeers: 1, BackoffBase: 100 * time.Millisecond, BackoffMax: 400 * time.Millisecond})
+	if err := m.Bootstrap(ctx); err != ErrNoPeers {
+		t.Fatalf("expected %v, got %v", ErrNoPeers, err)
+	}
+
+	// 退避期内不会再拨号
+	m.Bootstrap(ctx)
+	st := m.Stats()[dead.ID()]
+	if st.Attempts != 1 || st.Failures != 1 || st.LastError == "" {
+		t.Fatalf("unexpected stats after first failure: %+v", st)
+	}
+
+	// 每次失败，退避时间翻倍，不超过 BackoffMax
+	var waits []time.Duration
+	for i := 0; i < 4; i++ {
+		st := m.Stats()[dead.ID()]
+		time.Sleep(time.Until(st.NextAttempt()))
+		m.Bootstrap(ctx)
+		st = m.Stats()[dead.ID()]
+		waits = append(waits, st.NextAttempt().Sub(st.LastAttempt))
+	}
+	expected := []time.Duration{200, 400, 400, 400}
+	for i, w := range waits {
+		want := expected[i] * time.Millisecond
+		if w < want*8/10 || w > want*12/10 {
+			t.Fatalf("backoff %d: expected about %s, got %s", i, want, w)
+		}
+	}
+
+	// 恢复之后连接成功，退避被重置
+	if _, err := mn.LinkPeers(h.ID(), dead.ID()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(m.Stats()[dead.ID()].NextAttempt()))
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := m.Stats()[dead.ID()]; st.Successes != 1 || !st.NextAttempt().IsZero() {
+		t.Fatalf("unexpected stats after success: %+v", st)
+	}
+}
+
+func TestPeerstoreFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn, hosts := makeNet(t, ctx, 3)
+	h, boot, saved := hosts[0], hosts[1], hosts[2]
+	if err := mn.UnlinkPeers(h.ID(), boot.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// saved 是上一次运行时保存在 peerstore 中的节点
+	h.Peerstore().AddAddrs(saved.ID(), saved.Addrs(), pstore.PermanentAddrTTL)
+
+	m := New(h, Config{Peers: peerInfos([]host.Host{boot}), MinPeers: 1})
+	if err := m.Bootstrap(ctx); err != ErrNoPeers {
+		t.Fatalf("expected %v without fallback, got %v", ErrNoPeers, err)
+	}
+
+	m = New(h, Config{Peers: peerInfos([]host.Host{boot}), MinPeers: 1, UsePeerstore: true})
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if h.Network().Connectedness(saved.ID()) != inet.Connected {
+		t.Fatal("expected a connection to the saved peer")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// mocknet 的 stream 在 reset 时可能阻塞，这里使用真实的 host
+	hosts := make([]host.Host, 2)
+	for i := range hosts {
+		addr, release := tu.LocalAddressOrFatal(t, "tcp")
+		defer release()
+		h, err := libp2p.New(ctx, libp2p.ListenAddrs(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		hosts[i] = h
+	}
+	h, boot := hosts[0], hosts[1]
+
+	m := New(h, Config{Peers: peerInfos(hosts[1:]), MinPeers: 1, Ping: true})
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m.healthCheck(ctx)
+	if st := m.Stats()[boot.ID()]; st.LastRTT == 0 {
+		t.Fatalf("expected a ping rtt, got %+v", st)
+	}
+
+	// 对方不再响应 ping 时，连接被关闭
+	boot.RemoveStreamHandler(ping.ID)
+	m.healthCheck(ctx)
+	if h.Network().Connectedness(boot.ID()) == inet.Connected {
+		t.Fatal("expected the unhealthy connection to be closed")
+	}
+	st := m.Stats()[boot.ID()]
+	if st.PingFailures != 1 || st.LastPingError == "" {
+		t.Fatalf("expected a recorded ping failure, got %+v", st)
+	}
+	// ping 失败不是拨号失败，可以立即重新拨号
+	if st.Failures != 0 || !st.NextAttempt().IsZero() {
+		t.Fatalf("expected no dial backoff, got %+v", st)
+	}
+}
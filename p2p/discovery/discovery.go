@@ -0,0 +1,300 @@
+// discovery 把多个发现节点的后端合并成一个 Discovery:
+//
+//   - 后端可以是 DHT rendezvous、mDNS、静态列表或者 rendezvous 服务器，只需要实现 Discoverer
+//   - FindPeers 同时查询所有的后端，每个 peer ID 只输出一次，合并之后的地址由 Lookup 查询
+//   - 每个后端的结果在它的 TTL 内有效，过期之后不再参与合并
+//   - Advertise 在所有实现了 Advertiser 的后端上宣布
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	disc "github.com/libp2p/go-libp2p-discovery"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// 后端没有设置 TTL 时，结果的有效时间
+var DefaultTTL = time.Hour
+
+var (
+	ErrNoSources    = errors.New("discovery: no sources")
+	ErrNoAdvertiser = errors.New("discovery: no source can advertise")
+)
+
+// Source 是一个发现节点的后端
+type Source struct {
+	Name string
+	disc.Discoverer
+	// 这个后端发现的节点的有效时间，0 表示 DefaultTTL
+	TTL time.Duration
+}
+
+// Record 是合并所有后端的结果之后的一个节点
+type Record struct {
+	ID      peer.ID
+	Addrs   []ma.Multiaddr
+	Sources []string // 按名字排序
+	// 最晚过期的后端的过期时间
+	Expires time.Time
+}
+
+type sighting struct {
+	addrs   []ma.Multiaddr
+	expires time.Time
+}
+
+// Discoverer 合并多个后端，实现 disc.Discovery
+type Discoverer struct {
+	mu      sync.Mutex
+	sources []Source
+	// namespace -> peer -> 后端 -> 这个后端最近一次的结果
+	cache map[string]map[peer.ID]map[string]*sighting
+}
+
+var _ disc.Discovery = (*Discoverer)(nil)
+
+func New(sources ...Source) *Discoverer {
+	return &Discoverer{
+		sources: sources,
+		cache:   make(map[string]map[peer.ID]map[string]*sighting),
+	}
+}
+
+// AddSource 增加一个后端，之后的 FindPeers 和 Advertise 会使用它
+func (d *Discoverer) AddSource(s Source) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sources = append(d.sources, s)
+}
+
+func (d *Discoverer) snapshot() []Source {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Source{}, d.sources...)
+}
+
+// Advertise 在所有实现了 Advertiser 的后端上同时宣布，返回其中最短的 TTL。
+// 只有所有的后端都失败时才返回错误
+func (d *Discoverer) Advertise(ctx context.Context, ns string, opts ...disc.Option) (time.Duration, error) {
+	type result struct {
+		ttl time.Duration
+		err error
+	}
+
+	var results []chan result
+	for _, s := range d.snapshot() {
+		a, ok := s.Discoverer.(disc.Advertiser)
+		if !ok {
+			continue
+		}
+		ch := make(chan result, 1)
+		results = append(results, ch)
+		go func(name string, a disc.Advertiser) {
+			ttl, err := a.Advertise(ctx, ns, opts...)
+			if err != nil {
+				err = fmt.Errorf("%s: %s", name, err)
+			}
+			ch <- result{ttl, err}
+		}(s.Name, a)
+	}
+	if len(results) == 0 {
+		return 0, ErrNoAdvertiser
+	}
+
+	var (
+		ttl time.Duration
+		ok  bool
+		err error
+	)
+	for _, ch := range results {
+		r := <-ch
+		if r.err != nil {
+			err = r.err
+			continue
+		}
+		if !ok || r.ttl < ttl {
+			ttl = r.ttl
+		}
+		ok = true
+	}
+	if !ok {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// FindPeers 同时查询所有的后端。一个节点第一次出现时，把当时合并的结果写入返回的 channel，
+// 之后其它后端发现的地址只合并到缓存中，调用者通过 Lookup 或者 peerstore 读取。
+// 所有的后端都结束之后关闭 channel
+func (d *Discoverer) FindPeers(ctx context.Context, ns string, opts ...disc.Option) (<-chan pstore.PeerInfo, error) {
+	var options disc.Options
+	if err := options.Apply(opts...); err != nil {
+		return nil, err
+	}
+	sources := d.snapshot()
+	if len(sources) == 0 {
+		return nil, ErrNoSources
+	}
+
+	type found struct {
+		source string
+		pi     pstore.PeerInfo
+	}
+
+	// 部分后端失败时仍然使用其它的后端，都失败时返回最后一个错误
+	qctx, cancel := context.WithCancel(ctx)
+	chans := make(map[string]<-chan pstore.PeerInfo)
+	var err error
+	for _, s := range sources {
+		ch, serr := s.FindPeers(qctx, ns, opts...)
+		if serr != nil {
+			err = fmt.Errorf("%s: %s", s.Name, serr)
+			continue
+		}
+		chans[s.Name] = ch
+	}
+	if len(chans) == 0 {
+		cancel()
+		return nil, err
+	}
+
+	in := make(chan found)
+	var wg sync.WaitGroup
+	for name, ch := range chans {
+		wg.Add(1)
+		go func(name string, ch <-chan pstore.PeerInfo) {
+			defer wg.Done()
+			for pi := range ch {
+				select {
+				case in <- found{name, pi}:
+				case <-qctx.Done():
+					return
+				}
+			}
+		}(name, ch)
+	}
+	go func() {
+		wg.Wait()
+		close(in)
+	}()
+
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		// 已经输出的节点
+		emitted := make(map[peer.ID]bool)
+		for f := range in {
+			pi := d.update(ns, f.source, f.pi)
+			if emitted[pi.ID] {
+				continue
+			}
+			if options.Limit > 0 && len(emitted) >= options.Limit {
+				continue
+			}
+			emitted[pi.ID] = true
+
+			select {
+			case out <- pi:
+			case <-qctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// update 记录 source 发现的节点，返回合并之后的结果
+func (d *Discoverer) update(ns, source string, pi pstore.PeerInfo) pstore.PeerInfo {
+	ttl := DefaultTTL
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.sources {
+		if s.Name == source && s.TTL > 0 {
+			ttl = s.TTL
+		}
+	}
+
+	peers, ok := d.cache[ns]
+	if !ok {
+		peers = make(map[peer.ID]map[string]*sighting)
+		d.cache[ns] = peers
+	}
+	sightings, ok := peers[pi.ID]
+	if !ok {
+		sightings = make(map[string]*sighting)
+		peers[pi.ID] = sightings
+	}
+	sightings[source] = &sighting{
+		addrs:   pi.Addrs,
+		expires: time.Now().Add(ttl),
+	}
+
+	r := merge(pi.ID, sightings, time.Now())
+	return pstore.PeerInfo{ID: r.ID, Addrs: r.Addrs}
+}
+
+// merge 合并没有过期的结果，同时删除过期的结果
+func merge(id peer.ID, sightings map[string]*sighting, now time.Time) Record {
+	r := Record{ID: id}
+	seen := make(map[string]bool)
+	for source, s := range sightings {
+		if now.After(s.expires) {
+			delete(sightings, source)
+			continue
+		}
+		r.Sources = append(r.Sources, source)
+		if s.expires.After(r.Expires) {
+			r.Expires = s.expires
+		}
+		for _, a := range s.addrs {
+			if !seen[a.String()] {
+				seen[a.String()] = true
+				r.Addrs = append(r.Addrs, a)
+			}
+		}
+	}
+	sort.Strings(r.Sources)
+	return r
+}
+
+// Peers 返回 ns 中没有过期的节点，按 ID 排序
+func (d *Discoverer) Peers(ns string) []Record {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	var out []Record
+	for id, sightings := range d.cache[ns] {
+		r := merge(id, sightings, now)
+		if len(r.Sources) == 0 {
+			delete(d.cache[ns], id)
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Lookup 返回 ns 中 id 的合并结果
+func (d *Discoverer) Lookup(ns string, id peer.ID) (Record, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sightings, ok := d.cache[ns][id]
+	if !ok {
+		return Record{}, false
+	}
+	r := merge(id, sightings, time.Now())
+	return r, len(r.Sources) > 0
+}
@@ -0,0 +1,236 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	disc "github.com/libp2p/go-libp2p-discovery"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// fakeSource 按 namespace 返回固定的节点，记录宣布过的 namespace
+type fakeSource struct {
+	peers      map[string][]pstore.PeerInfo
+	ttl        time.Duration
+	err        error
+	advertised []string
+}
+
+func (f *fakeSource) Advertise(ctx context.Context, ns string, opts ...disc.Option) (time.Duration, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.advertised = append(f.advertised, ns)
+	return f.ttl, nil
+}
+
+func (f *fakeSource) FindPeers(ctx context.Context, ns string, opts ...disc.Option) (<-chan pstore.PeerInfo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return peerChan(f.peers[ns]), nil
+}
+
+func randPeer(t *testing.T, ports ...int) pstore.PeerInfo {
+	id := tu.RandIdentityOrFatal(t).ID()
+	pi := pstore.PeerInfo{ID: id}
+	for _, port := range ports {
+		pi.Addrs = append(pi.Addrs, ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)))
+	}
+	return pi
+}
+
+func collect(t *testing.T, d *Discoverer, ns string, opts ...disc.Option) map[peer.ID][]ma.Multiaddr {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch, err := d.FindPeers(ctx, ns, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个节点只出现一次
+	out := make(map[peer.ID][]ma.Multiaddr)
+	for pi := range ch {
+		if _, ok := out[pi.ID]; ok {
+			t.Fatalf("peer %s emitted twice", pi.ID)
+		}
+		out[pi.ID] = pi.Addrs
+	}
+	return out
+}
+
+func TestFindPeersMerge(t *testing.T) {
+	a, b, c := randPeer(t, 1001), randPeer(t, 2001), randPeer(t, 3001)
+	b2 := pstore.PeerInfo{ID: b.ID, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.2/tcp/2002")}}
+
+	d := New(
+		Source{Name: "dht", Discoverer: &fakeSource{peers: map[string][]pstore.PeerInfo{"ns": {a, b}}}},
+		Source{Name: "mdns", Discoverer: &fakeSource{peers: map[string][]pstore.PeerInfo{"ns": {b2}}}},
+	)
+	d.AddSource(Source{Name: "static", Discoverer: Static{c}})
+
+	found := collect(t, d, "ns")
+	if len(found) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(found))
+	}
+	// 合并之后的地址从缓存中读取
+	r, ok := d.Lookup("ns", b.ID)
+	if !ok || len(r.Addrs) != 2 {
+		t.Fatalf("expected merged addrs for b, got %+v", r)
+	}
+	if len(r.Sources) != 2 || r.Sources[0] != "dht" || r.Sources[1] != "mdns" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	if len(d.Peers("ns")) != 3 || len(d.Peers("other")) != 0 {
+		t.Fatal("unexpected cache")
+	}
+
+	// 其它 namespace 只有 static 的节点
+	found = collect(t, d, "other")
+	if len(found) != 1 || found[c.ID] == nil {
+		t.Fatalf("unexpected peers %v", found)
+	}
+}
+
+func TestFindPeersLimit(t *testing.T) {
+	var peers []pstore.PeerInfo
+	for i := 0; i < 5; i++ {
+		peers = append(peers, randPeer(t, 1000+i))
+	}
+	d := New(Source{Name: "static", Discoverer: Static(peers)})
+	if found := collect(t, d, "ns", disc.Limit(2)); len(found) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(found))
+	}
+}
+
+func TestTTL(t *testing.T) {
+	a := randPeer(t, 1001)
+	a2 := pstore.PeerInfo{ID: a.ID, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/1002")}}
+	d := New(
+		Source{Name: "short", Discoverer: Static{a}, TTL: 50 * time.Millisecond},
+		Source{Name: "long", Discoverer: Static{a2}},
+	)
+	collect(t, d, "ns")
+	if r, _ := d.Lookup("ns", a.ID); len(r.Addrs) != 2 {
+		t.Fatalf("expected 2 addrs, got %v", r.Addrs)
+	}
+
+	// short 的结果过期之后只剩下 long 的地址
+	time.Sleep(100 * time.Millisecond)
+	r, ok := d.Lookup("ns", a.ID)
+	if !ok || len(r.Sources) != 1 || r.Sources[0] != "long" || len(r.Addrs) != 1 || !r.Addrs[0].Equal(a2.Addrs[0]) {
+		t.Fatalf("unexpected record %+v", r)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	a := randPeer(t, 1001)
+	broken := &fakeSource{err: errors.New("broken")}
+
+	if _, err := New().FindPeers(context.Background(), "ns"); err != ErrNoSources {
+		t.Fatalf("expected %v, got %v", ErrNoSources, err)
+	}
+	if _, err := New(Source{Name: "broken", Discoverer: broken}).FindPeers(context.Background(), "ns"); err == nil {
+		t.Fatal("expected an error when every source fails")
+	}
+
+	// 一个后端失败不影响其它的后端
+	d := New(
+		Source{Name: "broken", Discoverer: broken},
+		Source{Name: "static", Discoverer: Static{a}},
+	)
+	if found := collect(t, d, "ns"); len(found) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(found))
+	}
+}
+
+func TestAdvertise(t *testing.T) {
+	ctx := context.Background()
+	dht := &fakeSource{ttl: time.Hour}
+	rdv := &fakeSource{ttl: time.Minute}
+	broken := &fakeSource{err: errors.New("broken")}
+
+	// Static 不能宣布
+	if _, err := New(Source{Name: "static", Discoverer: Static{}}).Advertise(ctx, "ns"); err != ErrNoAdvertiser {
+		t.Fatalf("expected %v, got %v", ErrNoAdvertiser, err)
+	}
+	if _, err := New(Source{Name: "broken", Discoverer: broken}).Advertise(ctx, "ns"); err == nil {
+		t.Fatal("expected an error when every source fails")
+	}
+
+	d := New(
+		Source{Name: "dht", Discoverer: dht},
+		Source{Name: "rendezvous", Discoverer: rdv},
+		Source{Name: "broken", Discoverer: broken},
+		Source{Name: "static", Discoverer: Static{}},
+	)
+	ttl, err := d.Advertise(ctx, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("expected the shortest ttl, got %s", ttl)
+	}
+	if len(dht.advertised) != 1 || len(rdv.advertised) != 1 {
+		t.Fatal("expected every advertiser to be used")
+	}
+}
+
+func TestMDNSCache(t *testing.T) {
+	m := &MDNS{ttl: 50 * time.Millisecond, peers: make(map[peer.ID]mdnsPeer)}
+	a := randPeer(t, 1001)
+	var notified []peer.ID
+	m.Notify(func(pi pstore.PeerInfo) { notified = append(notified, pi.ID) })
+
+	(*mdnsNotifee)(m).HandlePeerFound(a)
+	if len(notified) != 1 || notified[0] != a.ID {
+		t.Fatalf("unexpected notifications %v", notified)
+	}
+
+	d := New(Source{Name: "mdns", Discoverer: m, TTL: m.TTL()})
+	if found := collect(t, d, "ns"); len(found) != 1 {
+		t.Fatalf("expected 1 peer, got %d", len(found))
+	}
+	time.Sleep(100 * time.Millisecond)
+	if found := collect(t, d, "ns"); len(found) != 0 {
+		t.Fatalf("expected the peer to expire, got %d", len(found))
+	}
+}
+
+func TestLoadStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := tu.RandIdentityOrFatal(t).ID().Pretty()
+	data := fmt.Sprintf("# peers\n/ip4/127.0.0.1/tcp/4001/ipfs/%s\n\n/ip4/10.0.0.1/tcp/4001/ipfs/%s\n", id, id)
+	path := filepath.Join(dir, "static.peers")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadStatic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1 || len(s[0].Addrs) != 2 {
+		t.Fatalf("unexpected peers %v", s)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not an address\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStatic(path); err == nil {
+		t.Fatal("expected an error for a bad address")
+	}
+}
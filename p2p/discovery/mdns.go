@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	disc "github.com/libp2p/go-libp2p-discovery"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	mdns "github.com/libp2p/go-libp2p/p2p/discovery"
+)
+
+/*
+ * MDNS 把 mDNS 服务包装成 Discovery:
+ *   - mDNS 只有一个服务名，不区分 namespace
+ *   - 服务一直在宣布本节点，不需要 Advertise，Discoverer 宣布时跳过它
+ *   - FindPeers 返回最近 3 个 interval 内发现的节点，不等待新的节点
+ */
+type MDNS struct {
+	svc mdns.Service
+	ttl time.Duration
+
+	mu     sync.Mutex
+	peers  map[peer.ID]mdnsPeer
+	notify []func(pstore.PeerInfo)
+}
+
+type mdnsPeer struct {
+	pstore.PeerInfo
+	seen time.Time
+}
+
+var _ disc.Discoverer = (*MDNS)(nil)
+
+// NewMDNS 启动 mDNS 服务，每个 interval 查询一次局域网中名为 tag 的服务，ctx 结束时停止
+func NewMDNS(ctx context.Context, h host.Host, interval time.Duration, tag string) (*MDNS, error) {
+	svc, err := mdns.NewMdnsService(ctx, h, interval, tag)
+	if err != nil {
+		return nil, err
+	}
+	m := &MDNS{
+		svc:   svc,
+		ttl:   3 * interval,
+		peers: make(map[peer.ID]mdnsPeer),
+	}
+	svc.RegisterNotifee((*mdnsNotifee)(m))
+	go func() {
+		<-ctx.Done()
+		svc.Close()
+	}()
+	return m, nil
+}
+
+// TTL 返回发现的节点的有效时间，可以作为 Source.TTL
+func (m *MDNS) TTL() time.Duration {
+	return m.ttl
+}
+
+// Notify 注册回调，每次 mDNS 发现节点时调用，不能阻塞
+func (m *MDNS) Notify(f func(pstore.PeerInfo)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = append(m.notify, f)
+}
+
+func (m *MDNS) FindPeers(ctx context.Context, ns string, opts ...disc.Option) (<-chan pstore.PeerInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var peers []pstore.PeerInfo
+	for id, p := range m.peers {
+		if now.Sub(p.seen) > m.ttl {
+			delete(m.peers, id)
+			continue
+		}
+		peers = append(peers, p.PeerInfo)
+	}
+	return peerChan(peers), nil
+}
+
+func (m *MDNS) Close() error {
+	return m.svc.Close()
+}
+
+func (m *MDNS) found(pi pstore.PeerInfo) {
+	m.mu.Lock()
+	m.peers[pi.ID] = mdnsPeer{pi, time.Now()}
+	notify := append([]func(pstore.PeerInfo){}, m.notify...)
+	m.mu.Unlock()
+
+	for _, f := range notify {
+		f(pi)
+	}
+}
+
+type mdnsNotifee MDNS
+
+func (n *mdnsNotifee) HandlePeerFound(pi pstore.PeerInfo) {
+	(*MDNS)(n).found(pi)
+}
@@ -0,0 +1,37 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	bootstrap "github.com/czh0526/libp2p/p2p/bootstrap"
+	disc "github.com/libp2p/go-libp2p-discovery"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+// Static 是固定的节点列表，不区分 namespace，也不能宣布
+type Static []pstore.PeerInfo
+
+// 静态列表一直有效，可以作为 Source.TTL
+const StaticTTL = 100 * 365 * 24 * time.Hour
+
+var _ disc.Discoverer = Static(nil)
+
+// LoadStatic 读取节点列表文件，格式与 bootstrap 文件相同，见 bootstrap.ReadPeersFile
+func LoadStatic(path string) (Static, error) {
+	return bootstrap.LoadPeers(path)
+}
+
+func (s Static) FindPeers(ctx context.Context, ns string, opts ...disc.Option) (<-chan pstore.PeerInfo, error) {
+	return peerChan(s), nil
+}
+
+// peerChan 返回一个已经写入 peers 并关闭的 channel
+func peerChan(peers []pstore.PeerInfo) <-chan pstore.PeerInfo {
+	ch := make(chan pstore.PeerInfo, len(peers))
+	for _, pi := range peers {
+		ch <- pi
+	}
+	close(ch)
+	return ch
+}
@@ -0,0 +1,34 @@
+// identity 读取和保存节点的私钥，让 relay、rendezvous 服务器等长期运行的节点在重启之后保持同一个 peer ID
+package identity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	crypto "github.com/libp2p/go-libp2p-crypto"
+)
+
+// Load 从 keyFile 读取私钥，文件不存在时生成新的 Ed25519 私钥并保存到 keyFile
+func Load(keyFile string) (crypto.PrivKey, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		return crypto.UnmarshalPrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = crypto.MarshalPrivateKey(priv); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, data, 0600); err != nil {
+		return nil, err
+	}
+	fmt.Printf("saved new identity to %s \n", keyFile)
+	return priv, nil
+}
@@ -0,0 +1,52 @@
+package identity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "node.key")
+
+	// 第一次生成并保存，之后读到同一个私钥
+	priv, err := Load(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected key file mode %s", info.Mode())
+	}
+	again, err := Load(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, _ := peer.IDFromPrivateKey(priv)
+	id2, _ := peer.IDFromPrivateKey(again)
+	if id1 != id2 {
+		t.Fatalf("expected the same identity, got %s and %s", id1.Pretty(), id2.Pretty())
+	}
+
+	// 损坏的文件不会被覆盖
+	if err := ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(keyFile); err == nil {
+		t.Fatal("expected an error for a corrupted key file")
+	}
+	if data, _ := ioutil.ReadFile(keyFile); string(data) != "garbage" {
+		t.Fatal("corrupted key file was overwritten")
+	}
+}
@@ -0,0 +1,184 @@
+// mocknat 是测试用的 NAT 网关，实现 go-nat 的 NAT 接口，不需要真实的路由器:
+//
+//   - 映射保存在内存中，外部端口默认与内部端口相同
+//   - 映射按 AddPortMapping 的 timeout 过期，可以检查续期的次数
+//   - 可以注入错误，Reset 模拟路由器重启
+package test_mocknat
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	gonat "github.com/fd/go-nat"
+)
+
+// Mapping 是网关上的一个端口映射
+type Mapping struct {
+	Protocol     string
+	InternalPort int
+	ExternalPort int
+	Description  string
+	Expires      time.Time
+	// AddPortMapping 的次数，第一次添加之后都是续期
+	Adds int
+}
+
+// Gateway 是内存中的 NAT 网关
+type Gateway struct {
+	mu         sync.Mutex
+	externalIP net.IP
+	internalIP net.IP
+	err        error
+	// Reset 之后分配的外部端口加上 offset
+	offset   int
+	mappings map[int]*Mapping
+	deletes  int
+}
+
+var _ gonat.NAT = (*Gateway)(nil)
+
+func NewGateway(externalIP net.IP) *Gateway {
+	return &Gateway{
+		externalIP: externalIP,
+		internalIP: net.IPv4(192, 168, 1, 100),
+		mappings:   make(map[int]*Mapping),
+	}
+}
+
+// Fail 让之后的请求返回 err，err 为 nil 时恢复正常
+func (g *Gateway) Fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.err = err
+}
+
+// SetExternalAddress 修改网关的外部地址
+func (g *Gateway) SetExternalAddress(ip net.IP) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.externalIP = ip
+}
+
+// Reset 模拟路由器重启: 删除所有的映射，之后分配不同的外部端口
+func (g *Gateway) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mappings = make(map[int]*Mapping)
+	g.offset++
+}
+
+// Mappings 返回没有过期的映射
+func (g *Gateway) Mappings() []Mapping {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire(time.Now())
+
+	var mappings []Mapping
+	for _, m := range g.mappings {
+		mappings = append(mappings, *m)
+	}
+	return mappings
+}
+
+// Deletes 返回 DeletePortMapping 删除的映射数
+func (g *Gateway) Deletes() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.deletes
+}
+
+// expire 删除过期的映射，调用者持有 mu
+func (g *Gateway) expire(now time.Time) {
+	for port, m := range g.mappings {
+		if now.After(m.Expires) {
+			delete(g.mappings, port)
+		}
+	}
+}
+
+func (g *Gateway) Type() string {
+	return "mock"
+}
+
+func (g *Gateway) GetDeviceAddress() (net.IP, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	return net.IPv4(192, 168, 1, 1), nil
+}
+
+func (g *Gateway) GetExternalAddress() (net.IP, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	if g.externalIP == nil {
+		return nil, gonat.ErrNoExternalAddress
+	}
+	return g.externalIP, nil
+}
+
+func (g *Gateway) GetInternalAddress() (net.IP, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.internalIP, nil
+}
+
+// AddPortMapping 添加或者续期映射，已有的映射保持原来的外部端口
+func (g *Gateway) AddPortMapping(protocol string, internalPort int, description string, timeout time.Duration) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return 0, g.err
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		return 0, errors.New("unsupported protocol")
+	}
+	now := time.Now()
+	g.expire(now)
+
+	key := mappingKey(protocol, internalPort)
+	m, ok := g.mappings[key]
+	if !ok {
+		m = &Mapping{
+			Protocol:     protocol,
+			InternalPort: internalPort,
+			ExternalPort: internalPort + g.offset,
+		}
+		g.mappings[key] = m
+	}
+	m.Description = description
+	m.Expires = now.Add(timeout)
+	m.Adds++
+	return m.ExternalPort, nil
+}
+
+func (g *Gateway) DeletePortMapping(protocol string, internalPort int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+	key := mappingKey(protocol, internalPort)
+	if _, ok := g.mappings[key]; ok {
+		delete(g.mappings, key)
+		g.deletes++
+	}
+	return nil
+}
+
+// udp 的端口放在 tcp 之后，两种协议的同一个端口是不同的映射
+func mappingKey(protocol string, port int) int {
+	if protocol == "udp" {
+		return port + 1<<16
+	}
+	return port
+}
@@ -0,0 +1,374 @@
+// nat 在网关上为 swarm 的 TCP 监听地址建立端口映射，适合长时间运行的节点:
+//
+//   - 通过 go-nat（UPnP 或 NAT-PMP）映射每个 IPv4 TCP 监听端口，监听地址变化时同步
+//   - 租期过半时续期，失败的映射按 RetryInterval 重试
+//   - AddrsFactory 把映射得到的外部地址加入 host 的地址
+//   - Close 时删除所有的映射
+package nat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	gonat "github.com/fd/go-nat"
+	inet "github.com/libp2p/go-libp2p-net"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Config 是 Manager 的配置，为 0 的字段使用默认值
+type Config struct {
+	// 网关上显示的映射描述
+	Description string
+	// 映射的租期，租期过半时续期
+	Lease time.Duration
+	// 映射失败之后重试的间隔
+	RetryInterval time.Duration
+}
+
+const (
+	DefaultDescription   = "libp2p"
+	DefaultLease         = time.Hour
+	DefaultRetryInterval = time.Minute
+)
+
+func (cfg *Config) setDefaults() {
+	if cfg.Description == "" {
+		cfg.Description = DefaultDescription
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+}
+
+// Mapping 是一个监听端口在网关上的映射
+type Mapping struct {
+	InternalPort int
+	ExternalPort int
+	// 网关的外部 IP 加上 ExternalPort，网关没有返回外部 IP 时为 nil
+	ExternalAddr ma.Multiaddr
+	Expires      time.Time
+	// 最近一次添加或续期的错误
+	LastError string
+}
+
+type entry struct {
+	Mapping
+	// 下一次添加或续期的时间
+	next time.Time
+}
+
+// valid 表示映射已经建立并且没有过期
+func (e *entry) valid(now time.Time) bool {
+	return e.ExternalPort != 0 && now.Before(e.Expires)
+}
+
+// ErrStarted 表示 Manager 已经 Start 过
+var ErrStarted = errors.New("nat: manager already started")
+
+// Manager 维护一个网关上的端口映射，在 Start 之后运行
+type Manager struct {
+	gw  gonat.NAT
+	cfg Config
+
+	trigger chan struct{}
+
+	// mu 保护 entries 以及 Start/Close 设置的 net、cancel、done
+	mu      sync.Mutex
+	entries map[int]*entry
+	started bool
+	net     inet.Network
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New 创建使用网关 gw 的 Manager，gw 通常由 gonat.DiscoverGateway 得到
+func New(gw gonat.NAT, cfg Config) *Manager {
+	cfg.setDefaults()
+	return &Manager{
+		gw:      gw,
+		cfg:     cfg,
+		entries: make(map[int]*entry),
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// AddrsFactory 在 next 返回的地址之后加上外部地址，next 为 nil 时使用 host 的原始地址。
+// 在构建 host 之前就可以使用，例如 libp2p.AddrsFactory(m.AddrsFactory(nil))
+func (m *Manager) AddrsFactory(next basichost.AddrsFactory) basichost.AddrsFactory {
+	if next == nil {
+		next = basichost.DefaultAddrsFactory
+	}
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		addrs = next(addrs)
+		for _, ext := range m.ExternalAddrs() {
+			if !containsAddr(addrs, ext) {
+				addrs = append(addrs, ext)
+			}
+		}
+		return addrs
+	}
+}
+
+// Start 映射 n 的监听端口，并在后台续期，直到 ctx 结束或调用 Close。
+// 一个 Manager 只能 Start 一次，之后（包括 Close 之后）再调用返回 ErrStarted
+func (m *Manager) Start(ctx context.Context, n inet.Network) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return ErrStarted
+	}
+	m.started = true
+
+	m.net = n
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	n.Notify(m.notifiee())
+	go m.loop(ctx, n, m.done)
+	return nil
+}
+
+// Close 停止续期并删除网关上的映射，没有 Start 或者已经 Close 时什么也不做
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	n, cancel, done := m.net, m.cancel, m.done
+	m.cancel = nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	n.StopNotify(m.notifiee())
+
+	m.mu.Lock()
+	entries := m.entries
+	m.entries = make(map[int]*entry)
+	m.mu.Unlock()
+
+	var err error
+	for port, e := range entries {
+		if e.ExternalPort == 0 {
+			continue
+		}
+		if derr := m.gw.DeletePortMapping("tcp", port); derr != nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// Mappings 返回已经建立并且没有过期的映射，按内部端口排序
+func (m *Manager) Mappings() []Mapping {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+
+	var mappings []Mapping
+	for _, e := range m.entries {
+		if e.valid(now) {
+			mappings = append(mappings, e.Mapping)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].InternalPort < mappings[j].InternalPort })
+	return mappings
+}
+
+// ExternalAddrs 返回映射得到的外部地址
+func (m *Manager) ExternalAddrs() []ma.Multiaddr {
+	var addrs []ma.Multiaddr
+	for _, mapping := range m.Mappings() {
+		if mapping.ExternalAddr != nil {
+			addrs = append(addrs, mapping.ExternalAddr)
+		}
+	}
+	return addrs
+}
+
+func (m *Manager) loop(ctx context.Context, n inet.Network, done chan struct{}) {
+	defer close(done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-m.trigger:
+		case <-ctx.Done():
+			return
+		}
+
+		next := m.sync(n, time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// sync 执行一轮: 删除不再监听的端口的映射，添加新的映射，续期到期的映射。
+// 返回下一次需要运行的时间
+func (m *Manager) sync(n inet.Network, now time.Time) time.Time {
+	ports := listenPorts(n.ListenAddresses())
+
+	// 网关的请求可能很慢，不持有 mu
+	m.mu.Lock()
+	var stale, due []int
+	for port, e := range m.entries {
+		if !ports[port] {
+			delete(m.entries, port)
+			if e.ExternalPort != 0 {
+				stale = append(stale, port)
+			}
+		}
+	}
+	for port := range ports {
+		e, ok := m.entries[port]
+		if !ok {
+			e = &entry{Mapping: Mapping{InternalPort: port}}
+			m.entries[port] = e
+		}
+		if !now.Before(e.next) {
+			due = append(due, port)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, port := range stale {
+		if err := m.gw.DeletePortMapping("tcp", port); err != nil {
+			fmt.Printf("nat: delete mapping for port %d: %s \n", port, err)
+		}
+	}
+
+	var extIP net.IP
+	if len(due) > 0 {
+		var err error
+		if extIP, err = m.gw.GetExternalAddress(); err != nil {
+			fmt.Printf("nat: get external address: %s \n", err)
+		}
+	}
+	for _, port := range due {
+		extPort, err := m.gw.AddPortMapping("tcp", port, m.cfg.Description, m.cfg.Lease)
+		m.update(port, extIP, extPort, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := now.Add(m.cfg.Lease / 2)
+	for _, e := range m.entries {
+		if e.next.Before(next) {
+			next = e.next
+		}
+	}
+	return next
+}
+
+// update 记录一次添加或续期的结果。
+// 端口的记录在添加期间被删除时（不再监听或者 Close），删除网关上刚刚建立的映射
+func (m *Manager) update(port int, extIP net.IP, extPort int, err error) {
+	m.mu.Lock()
+	e, ok := m.entries[port]
+	if !ok {
+		m.mu.Unlock()
+		if err == nil {
+			if derr := m.gw.DeletePortMapping("tcp", port); derr != nil {
+				fmt.Printf("nat: delete mapping for port %d: %s \n", port, derr)
+			}
+		}
+		return
+	}
+	defer m.mu.Unlock()
+	now := time.Now()
+
+	if err != nil {
+		// 续期失败时，旧的映射在过期之前仍然有效
+		fmt.Printf("nat: map port %d: %s \n", port, err)
+		e.LastError = err.Error()
+		e.next = now.Add(m.cfg.RetryInterval)
+		if !e.valid(now) {
+			e.ExternalPort, e.ExternalAddr = 0, nil
+		}
+		return
+	}
+
+	if extPort != e.ExternalPort {
+		fmt.Printf("nat: mapped port %d to external port %d \n", port, extPort)
+	}
+	e.ExternalPort = extPort
+	e.ExternalAddr = nil
+	if extIP != nil {
+		e.ExternalAddr, _ = ma.NewMultiaddr(fmt.Sprintf("/ip4/%s/tcp/%d", extIP, extPort))
+	}
+	e.Expires = now.Add(m.cfg.Lease)
+	e.LastError = ""
+	e.next = now.Add(m.cfg.Lease / 2)
+}
+
+// listenPorts 返回需要映射的端口: /ip4/<ip>/tcp/<port> 格式并且不是回环地址
+func listenPorts(addrs []ma.Multiaddr) map[int]bool {
+	ports := make(map[int]bool)
+	for _, addr := range addrs {
+		parts := ma.Split(addr)
+		if len(parts) != 2 {
+			continue
+		}
+		ipStr, err := parts[0].ValueForProtocol(ma.P_IP4)
+		if err != nil {
+			continue
+		}
+		portStr, err := parts[1].ValueForProtocol(ma.P_TCP)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(ipStr); ip == nil || ip.IsLoopback() {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port == 0 {
+			continue
+		}
+		ports[port] = true
+	}
+	return ports
+}
+
+func containsAddr(addrs []ma.Multiaddr, addr ma.Multiaddr) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) notifiee() inet.Notifiee {
+	return (*notifiee)(m)
+}
+
+type notifiee Manager
+
+func (n *notifiee) sync() {
+	select {
+	case n.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (n *notifiee) Listen(inet.Network, ma.Multiaddr)      { n.sync() }
+func (n *notifiee) ListenClose(inet.Network, ma.Multiaddr) { n.sync() }
+func (n *notifiee) Connected(inet.Network, inet.Conn)      {}
+func (n *notifiee) Disconnected(inet.Network, inet.Conn)   {}
+func (n *notifiee) OpenedStream(inet.Network, inet.Stream) {}
+func (n *notifiee) ClosedStream(inet.Network, inet.Stream) {}
@@ -0,0 +1,163 @@
+package nat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	mocknat "github.com/czh0526/libp2p/p2p/nat/mock"
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-host"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func makeHost(t *testing.T, ctx context.Context, m *Manager) host.Host {
+	h, err := libp2p.New(ctx,
+		libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"),
+		libp2p.AddrsFactory(m.AddrsFactory(nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// waitFor 等待 cond 成立，最多等 5 秒
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMapping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gw := mocknat.NewGateway(net.IPv4(1, 2, 3, 4))
+	m := New(gw, Config{Lease: 300 * time.Millisecond})
+	h := makeHost(t, ctx, m)
+	defer h.Close()
+	if err := m.Start(ctx, h.Network()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "mapping", func() bool { return len(m.Mappings()) == 1 })
+	mapping := m.Mappings()[0]
+	ext := ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", mapping.InternalPort))
+	if mapping.ExternalPort != mapping.InternalPort || !mapping.ExternalAddr.Equal(ext) {
+		t.Fatalf("unexpected mapping %+v", mapping)
+	}
+	if !containsAddr(h.Addrs(), ext) {
+		t.Fatalf("external address %s not in %s", ext, h.Addrs())
+	}
+
+	// 租期过半时续期，映射一直有效
+	waitFor(t, "renewal", func() bool {
+		gm := gw.Mappings()
+		return len(gm) == 1 && gm[0].Adds >= 3
+	})
+	if gm := gw.Mappings()[0]; gm.Description != DefaultDescription || gm.InternalPort != mapping.InternalPort {
+		t.Fatalf("unexpected gateway mapping %+v", gm)
+	}
+
+	// 新的监听地址也被映射
+	if err := h.Network().Listen(ma.StringCast("/ip4/0.0.0.0/tcp/0")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "second mapping", func() bool { return len(m.Mappings()) == 2 })
+	if len(m.ExternalAddrs()) != 2 {
+		t.Fatalf("expected 2 external addresses, got %s", m.ExternalAddrs())
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(gw.Mappings()) != 0 || gw.Deletes() != 2 {
+		t.Fatalf("expected the mappings to be deleted, got %+v", gw.Mappings())
+	}
+	if len(m.ExternalAddrs()) != 0 || containsAddr(h.Addrs(), ext) {
+		t.Fatal("expected no external addresses after Close")
+	}
+
+	// Close 之后不能再 Start，重复 Close 什么也不做
+	if err := m.Start(ctx, h.Network()); err != ErrStarted {
+		t.Fatalf("expected ErrStarted, got %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrphanedMapping(t *testing.T) {
+	gw := mocknat.NewGateway(net.IPv4(1, 2, 3, 4))
+	m := New(gw, Config{})
+
+	// 添加映射期间端口不再监听，sync 已经删除了它的记录
+	extPort, err := gw.AddPortMapping("tcp", 4001, DefaultDescription, DefaultLease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.update(4001, net.IPv4(1, 2, 3, 4), extPort, nil)
+	if len(gw.Mappings()) != 0 || gw.Deletes() != 1 {
+		t.Fatalf("expected the orphaned mapping to be deleted, got %+v", gw.Mappings())
+	}
+	if len(m.Mappings()) != 0 {
+		t.Fatalf("expected no mappings, got %+v", m.Mappings())
+	}
+}
+
+func TestGatewayFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gw := mocknat.NewGateway(net.IPv4(1, 2, 3, 4))
+	gw.Fail(errors.New("gateway unavailable"))
+	m := New(gw, Config{Lease: 300 * time.Millisecond, RetryInterval: 50 * time.Millisecond})
+	h := makeHost(t, ctx, m)
+	defer h.Close()
+	if err := m.Start(ctx, h.Network()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if len(m.Mappings()) != 0 {
+		t.Fatalf("expected no mappings, got %+v", m.Mappings())
+	}
+	gw.Fail(nil)
+	waitFor(t, "retry", func() bool { return len(m.Mappings()) == 1 })
+	port := m.Mappings()[0].InternalPort
+
+	// 路由器重启之后，续期得到新的外部端口和外部 IP
+	gw.SetExternalAddress(net.IPv4(5, 6, 7, 8))
+	gw.Reset()
+	ext := ma.StringCast(fmt.Sprintf("/ip4/5.6.7.8/tcp/%d", port+1))
+	waitFor(t, "new external address", func() bool {
+		addrs := m.ExternalAddrs()
+		return len(addrs) == 1 && addrs[0].Equal(ext)
+	})
+}
+
+func TestListenPorts(t *testing.T) {
+	var addrs []ma.Multiaddr
+	for _, s := range []string{
+		"/ip4/0.0.0.0/tcp/4001",
+		"/ip4/192.168.1.10/tcp/4002",
+		"/ip4/192.168.1.10/tcp/4001",
+		"/ip4/127.0.0.1/tcp/4003",
+		"/ip6/::/tcp/4004",
+		"/ip4/0.0.0.0/udp/4005",
+		"/ip4/0.0.0.0/tcp/4006/ws",
+	} {
+		addrs = append(addrs, ma.StringCast(s))
+	}
+	ports := listenPorts(addrs)
+	if len(ports) != 2 || !ports[4001] || !ports[4002] {
+		t.Fatalf("unexpected ports %v", ports)
+	}
+}
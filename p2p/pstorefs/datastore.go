@@ -0,0 +1,209 @@
+package pstorefs
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// 文件名使用不区分大小写、不含 '/' 的 base32 编码
+var keyEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+const tmpSuffix = ".tmp"
+
+// lockName 是目录下的锁文件，打开期间对它加 flock 排它锁
+const lockName = "LOCK"
+
+// ErrLocked 表示目录已经被另一个 Datastore 打开
+var ErrLocked = errors.New("pstorefs: datastore is opened by another process")
+
+/*
+ * Datastore 是一个基于目录的 key-value 存储，实现 ds.Batching:
+ *   - 每个 key 对应目录下的一个文件，文件名是 key 的 base32 编码
+ *   - 写入先写临时文件再 rename，进程中途退出不会留下写了一半的值
+ *   - 打开时把所有的值读入内存，Get/Query 不访问磁盘，Put/Delete 直接写盘
+ *   - 打开期间持有目录下 LOCK 文件的排它锁，同一个目录只能被打开一次，进程退出时锁由内核释放
+ * 适合 peerstore 这种数据量不大、读多写少的场景
+ */
+type Datastore struct {
+	dir  string
+	lock *os.File
+
+	mu     sync.RWMutex
+	values map[ds.Key][]byte
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// OpenDatastore 打开 dir 下的存储，目录不存在时创建。目录已经被打开时返回 ErrLocked
+func OpenDatastore(dir string) (*Datastore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	d, err := loadDatastore(dir)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	d.lock = lock
+	return d, nil
+}
+
+// lockDir 对 dir 下的锁文件加非阻塞的排它锁
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func loadDatastore(dir string) (*Datastore, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Datastore{
+		dir:    dir,
+		values: make(map[ds.Key][]byte),
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || name == lockName {
+			continue
+		}
+		// 上一次运行时没有完成的写入
+		if strings.HasSuffix(name, tmpSuffix) {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		raw, err := keyEncoding.DecodeString(name)
+		if err != nil {
+			return nil, fmt.Errorf("pstorefs: unexpected file %s in %s", name, dir)
+		}
+		val, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		d.values[ds.RawKey(string(raw))] = val
+	}
+	return d, nil
+}
+
+func (d *Datastore) path(key ds.Key) string {
+	return filepath.Join(d.dir, keyEncoding.EncodeToString(key.Bytes()))
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	val := make([]byte, len(value))
+	copy(val, value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 先写临时文件，再原子地替换
+	p := d.path(key)
+	if err := ioutil.WriteFile(p+tmpSuffix, val, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(p+tmpSuffix, p); err != nil {
+		os.Remove(p + tmpSuffix)
+		return err
+	}
+	d.values[key] = val
+	return nil
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	val, ok := d.values[key]
+	if !ok {
+		return nil, ds.ErrNotFound
+	}
+	out := make([]byte, len(val))
+	copy(out, val)
+	return out, nil
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.values[key]
+	return ok, nil
+}
+
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	val, ok := d.values[key]
+	if !ok {
+		return -1, ds.ErrNotFound
+	}
+	return len(val), nil
+}
+
+func (d *Datastore) Delete(key ds.Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.values[key]; !ok {
+		return ds.ErrNotFound
+	}
+	if err := os.Remove(d.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(d.values, key)
+	return nil
+}
+
+// Query 在内存中的快照上执行查询
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	d.mu.RLock()
+	entries := make([]dsq.Entry, 0, len(d.values))
+	for k, v := range d.values {
+		e := dsq.Entry{Key: k.String()}
+		if !q.KeysOnly {
+			e.Value = make([]byte, len(v))
+			copy(e.Value, v)
+		}
+		entries = append(entries, e)
+	}
+	d.mu.RUnlock()
+
+	r := dsq.ResultsWithEntries(q, entries)
+	return dsq.NaiveQueryApply(q, r), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+// Close 释放目录的锁，写入都已经落盘。锁文件留在目录中，下一次打开时复用
+func (d *Datastore) Close() error {
+	return d.lock.Close()
+}
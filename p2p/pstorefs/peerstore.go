@@ -0,0 +1,72 @@
+// pstorefs 提供保存在本地目录中的 peerstore，重启之后仍然保留已知节点的地址、公钥和协议:
+//
+//   - 地址按 TTL 过期，读取时过滤掉已经过期的地址
+//   - 后台定期清理过期的地址，节点的地址全部过期后记录被删除
+//   - 数据保存在 Datastore 中，每个 key 一个文件
+package pstorefs
+
+import (
+	"context"
+	"time"
+
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	pstoreds "github.com/libp2p/go-libp2p-peerstore/pstoreds"
+)
+
+// Options 是 peerstore 的配置
+type Options struct {
+	// 内存中缓存的节点地址记录数，0 表示不缓存
+	CacheSize uint
+	// 清理过期地址的间隔，0 表示不清理
+	GCInterval time.Duration
+	// 打开之后第一次清理前的等待时间
+	GCInitialDelay time.Duration
+}
+
+const (
+	DefaultCacheSize      = 1024
+	DefaultGCInterval     = time.Hour
+	DefaultGCInitialDelay = time.Minute
+)
+
+func DefaultOptions() Options {
+	return Options{
+		CacheSize:      DefaultCacheSize,
+		GCInterval:     DefaultGCInterval,
+		GCInitialDelay: DefaultGCInitialDelay,
+	}
+}
+
+// peerstore 在关闭时一并关闭底层的 Datastore
+type peerstore struct {
+	pstore.Peerstore
+	ds *Datastore
+}
+
+func (ps *peerstore) Close() error {
+	err := ps.Peerstore.Close()
+	if cerr := ps.ds.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewPeerstore 打开 dir 下保存的 peerstore，目录不存在时创建。ctx 结束后停止清理过期地址
+func NewPeerstore(ctx context.Context, dir string, opts Options) (pstore.Peerstore, error) {
+	d, err := OpenDatastore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dsOpts := pstoreds.DefaultOpts()
+	dsOpts.CacheSize = opts.CacheSize
+	dsOpts.GCPurgeInterval = opts.GCInterval
+	dsOpts.GCInitialDelay = opts.GCInitialDelay
+
+	ps, err := pstoreds.NewPeerstore(ctx, d, dsOpts)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return &peerstore{Peerstore: ps, ds: d}, nil
+}
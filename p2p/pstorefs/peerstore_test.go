@@ -0,0 +1,199 @@
+package pstorefs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	ds "github.com/ipfs/go-datastore"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	pt "github.com/libp2p/go-libp2p-peerstore/test"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pstorefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func openOrFatal(t *testing.T, ctx context.Context, dir string, opts Options) pstore.Peerstore {
+	ps, err := NewPeerstore(ctx, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func randPeer(t *testing.T) (peer.ID, *tu.PeerNetParams) {
+	p, err := tu.RandPeerNetParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.ID, p
+}
+
+// 通用的 peerstore 测试集
+func TestSuite(t *testing.T) {
+	pt.TestPeerstore(t, func() (pstore.Peerstore, func()) {
+		dir := tempDir(t)
+		ps := openOrFatal(t, context.Background(), dir, DefaultOptions())
+		return ps, func() {
+			ps.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestPersistence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	id, p := randPeer(t)
+	short, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	long, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4002")
+
+	// short 的 TTL 留出足够的余量，下面检查它还没过期时不受机器快慢影响
+	const shortTTL = 5 * time.Second
+	ps := openOrFatal(t, ctx, dir, DefaultOptions())
+	added := time.Now()
+	ps.AddAddr(id, short, shortTTL)
+	ps.AddAddr(id, long, pstore.PermanentAddrTTL)
+	if err := ps.AddPubKey(id, p.PubKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddProtocols(id, "/echo/1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后，未过期的地址、公钥和协议都还在
+	ps = openOrFatal(t, ctx, dir, DefaultOptions())
+	addrs := ps.Addrs(id)
+	if time.Since(added) >= shortTTL {
+		t.Fatalf("reopening took longer than the %s TTL", shortTTL)
+	}
+	pt.AssertAddressesEqual(t, []ma.Multiaddr{short, long}, addrs)
+	if pk := ps.PubKey(id); pk == nil || !pk.Equals(p.PubKey) {
+		t.Fatal("expected the public key to be persisted")
+	}
+	protos, err := ps.GetProtocols(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protos) != 1 || protos[0] != "/echo/1.0.0" {
+		t.Fatalf("unexpected protocols: %v", protos)
+	}
+	ps.Close()
+
+	// 重启期间过期的地址不再返回
+	time.Sleep(time.Until(added.Add(shortTTL + 500*time.Millisecond)))
+	ps = openOrFatal(t, ctx, dir, DefaultOptions())
+	defer ps.Close()
+	pt.AssertAddressesEqual(t, []ma.Multiaddr{long}, ps.Addrs(id))
+}
+
+func TestGC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	expiring, _ := randPeer(t)
+	permanent, _ := randPeer(t)
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+
+	opts := Options{GCInterval: 100 * time.Millisecond}
+	ps := openOrFatal(t, ctx, dir, opts)
+	defer ps.Close()
+	ps.AddAddr(expiring, addr, time.Second)
+	ps.AddAddr(permanent, addr, pstore.PermanentAddrTTL)
+
+	// 不算锁文件
+	files := func() int {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(fis) - 1
+	}
+	if n := files(); n != 2 {
+		t.Fatalf("expected 2 records on disk, got %d", n)
+	}
+
+	// 地址全部过期的节点被后台清理，不需要再访问它
+	deadline := time.Now().Add(5 * time.Second)
+	for files() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the expired record to be collected, %d records on disk", files())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	peers := ps.PeersWithAddrs()
+	if len(peers) != 1 || peers[0] != permanent {
+		t.Fatalf("expected only %s to have addrs, got %v", permanent, peers)
+	}
+}
+
+func TestDatastoreLock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ps := openOrFatal(t, ctx, dir, DefaultOptions())
+	if _, err := NewPeerstore(ctx, dir, DefaultOptions()); err != ErrLocked {
+		t.Fatalf("expected ErrLocked while the directory is open, got %v", err)
+	}
+
+	// 关闭之后可以再次打开
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ps = openOrFatal(t, ctx, dir, DefaultOptions())
+	ps.Close()
+}
+
+func TestDatastoreIncompleteWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenDatastore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ds.NewKey("/peers/keys/a")
+	if err := d.Put(key, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟写入临时文件之后、rename 之前进程退出
+	if err := ioutil.WriteFile(d.path(key)+tmpSuffix, []byte("v2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = OpenDatastore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := d.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "v1" {
+		t.Fatalf("expected the last complete value, got %q", val)
+	}
+	if _, err := os.Stat(d.path(key) + tmpSuffix); !os.IsNotExist(err) {
+		t.Fatal("expected the temporary file to be removed")
+	}
+}
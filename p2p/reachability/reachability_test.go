@@ -0,0 +1,193 @@
+package reachability
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	host "github.com/libp2p/go-libp2p-host"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// makeService 构建提供 AutoNAT 服务的节点，并让 clients 连接它，等待 identify 完成
+func makeService(t *testing.T, ctx context.Context, cfg ServiceConfig, clients ...host.Host) (host.Host, *Service) {
+	h := tu.GenHost(t, ctx)
+	svc, err := NewService(ctx, h, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		if err := c.Connect(ctx, pstore.PeerInfo{ID: h.ID(), Addrs: h.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			protos, _ := c.Peerstore().SupportsProtocols(h.ID(), autonat.AutoNATProto)
+			if len(protos) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("identify did not finish")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return h, svc
+}
+
+// 不会自动探测，只通过 Probe 探测
+var manualProbe = Config{BootDelay: time.Hour}
+
+func TestPublic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tu.GenHost(t, ctx)
+	defer c.Close()
+	tr := NewTracker(ctx, c, nil, manualProbe)
+	if err := tr.Probe(ctx); err != ErrNoPeers {
+		t.Fatalf("expected %v, got %v", ErrNoPeers, err)
+	}
+
+	s, svc := makeService(t, ctx, ServiceConfig{}, c)
+	defer s.Close()
+	defer svc.Close()
+
+	// 只有一个节点确认时状态仍然未知
+	if err := tr.Probe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := tr.Status(); st != autonat.NATStatusUnknown {
+		t.Fatalf("expected unknown after one confirmation, got %d", st)
+	}
+
+	s2, svc2 := makeService(t, ctx, ServiceConfig{}, c)
+	defer s2.Close()
+	defer svc2.Close()
+	if err := tr.Probe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := tr.Status(); st != autonat.NATStatusPublic {
+		t.Fatalf("expected public, got %d", st)
+	}
+	confirmed := tr.Confirmed()
+	if len(confirmed) != 1 || (confirmed[0].By != s.ID() && confirmed[0].By != s2.ID()) || !confirmed[0].Addr.Equal(c.Addrs()[0]) {
+		t.Fatalf("unexpected confirmed addresses %+v", confirmed)
+	}
+	if time.Since(confirmed[0].Confirmed) > time.Minute || tr.LastProbe().IsZero() {
+		t.Fatalf("unexpected confirmation time %s", confirmed[0].Confirmed)
+	}
+	if addr, err := tr.PublicAddr(); err != nil || !addr.Equal(confirmed[0].Addr) {
+		t.Fatalf("unexpected public address %s, %v", addr, err)
+	}
+	if st := svc.Stats(); st.Succeeded != 2 || st.Failed != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestPrivate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tu.GenHost(t, ctx)
+	defer c.Close()
+	// 声明一个没有监听的地址，dial-back 失败
+	closed, release := tu.LocalAddressOrFatal(t, "tcp")
+	defer release()
+	tr := NewTracker(ctx, c, func() []ma.Multiaddr { return []ma.Multiaddr{closed} }, manualProbe)
+
+	s, svc := makeService(t, ctx, ServiceConfig{DialTimeout: 2 * time.Second}, c)
+	defer s.Close()
+	defer svc.Close()
+
+	if err := tr.Probe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := tr.Status(); st != autonat.NATStatusPrivate {
+		t.Fatalf("expected private, got %d", st)
+	}
+	if _, err := tr.PublicAddr(); err != ErrNotPublic {
+		t.Fatalf("expected %v, got %v", ErrNotPublic, err)
+	}
+	if st := svc.Stats(); st.Failed != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestAddrExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tu.GenHost(t, ctx)
+	defer c.Close()
+	cfg := manualProbe
+	cfg.AddrTTL = 100 * time.Millisecond
+	cfg.Confirmations = 1
+	tr := NewTracker(ctx, c, nil, cfg)
+	s, svc := makeService(t, ctx, ServiceConfig{}, c)
+	defer s.Close()
+	defer svc.Close()
+
+	if err := tr.Probe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := tr.Status(); st != autonat.NATStatusPublic {
+		t.Fatalf("expected public, got %d", st)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if st := tr.Status(); st != autonat.NATStatusUnknown || len(tr.Confirmed()) != 0 {
+		t.Fatalf("expected the addresses to expire, got %d, %+v", st, tr.Confirmed())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b := tu.GenHost(t, ctx), tu.GenHost(t, ctx)
+	defer a.Close()
+	defer b.Close()
+	s, svc := makeService(t, ctx, ServiceConfig{PeerLimit: 2, GlobalLimit: 3}, a, b)
+	defer s.Close()
+	defer svc.Close()
+
+	ca, cb := autonat.NewAutoNATClient(a, nil), autonat.NewAutoNATClient(b, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := ca.DialBack(ctx, s.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 超过每个节点的限制
+	if _, err := ca.DialBack(ctx, s.ID()); !autonat.IsDialRefused(err) {
+		t.Fatalf("expected the request to be refused, got %v", err)
+	}
+	// 超过总数的限制
+	if _, err := cb.DialBack(ctx, s.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.DialBack(ctx, s.ID()); !autonat.IsDialRefused(err) {
+		t.Fatalf("expected the request to be refused, got %v", err)
+	}
+	if st := svc.Stats(); st.Succeeded != 3 || st.Refused != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestDialableAddrs(t *testing.T) {
+	observed := ma.StringCast("/ip4/1.2.3.4/tcp/5000")
+	var addrs [][]byte
+	for _, s := range []string{
+		"/ip4/1.2.3.4/tcp/4001",
+		"/ip4/10.0.0.1/tcp/4001",
+		"/ip4/1.2.3.4/tcp/4002/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ/p2p-circuit",
+		"/ip6/::1/tcp/4001",
+	} {
+		addrs = append(addrs, ma.StringCast(s).Bytes())
+	}
+	dialable := dialableAddrs(observed, addrs)
+	if len(dialable) != 1 || dialable[0].String() != "/ip4/1.2.3.4/tcp/4001" {
+		t.Fatalf("unexpected addresses %s", dialable)
+	}
+	if len(dialableAddrs(ma.StringCast("/ip4/1.2.3.4/tcp/4002/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ/p2p-circuit"), addrs)) != 0 {
+		t.Fatal("expected no addresses for a relayed connection")
+	}
+}
@@ -0,0 +1,286 @@
+package reachability
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	ggio "github.com/gogo/protobuf/io"
+	libp2p "github.com/libp2p/go-libp2p"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	pb "github.com/libp2p/go-libp2p-autonat/pb"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ServiceConfig 是 Service 的配置，为 0 的字段使用默认值
+type ServiceConfig struct {
+	// 每个 Interval 中一个节点最多请求的 dial-back 次数
+	PeerLimit int
+	// 每个 Interval 中所有节点一共最多请求的 dial-back 次数
+	GlobalLimit int
+	Interval    time.Duration
+	// 一次 dial-back 的超时时间
+	DialTimeout time.Duration
+}
+
+const (
+	DefaultPeerLimit   = 3
+	DefaultGlobalLimit = 30
+	DefaultInterval    = time.Minute
+	DefaultDialTimeout = 15 * time.Second
+)
+
+func (cfg *ServiceConfig) setDefaults() {
+	if cfg.PeerLimit <= 0 {
+		cfg.PeerLimit = DefaultPeerLimit
+	}
+	if cfg.GlobalLimit <= 0 {
+		cfg.GlobalLimit = DefaultGlobalLimit
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+}
+
+// ServiceStats 是 Service 处理的请求的统计
+type ServiceStats struct {
+	// dial-back 成功和失败的次数
+	Succeeded int
+	Failed    int
+	// 超过频率限制或者请求不合法而拒绝的次数
+	Refused int
+}
+
+// Service 为其它节点回答 AutoNAT 的 dial-back 请求:
+// 用另一个不监听的 host 拨号请求者声明的地址，只拨号与请求者的连接 IP 相同的地址，
+// 并且按节点和总数限制频率，避免被用来攻击第三方
+type Service struct {
+	host   host.Host
+	dialer host.Host
+	cfg    ServiceConfig
+
+	mu     sync.Mutex
+	reqs   map[peer.ID]int
+	global int
+	stats  ServiceStats
+	// 同一个节点的 dial-back 依次进行：dialer 是共享的，
+	// 并发的 ClearAddrs/ClosePeer 会清掉另一个请求的地址或者连接
+	dialing map[peer.ID]*peerLock
+
+	cancel context.CancelFunc
+}
+
+// NewService 在 h 上处理 AutoNAT 协议，直到 ctx 结束或调用 Close
+func NewService(ctx context.Context, h host.Host, cfg ServiceConfig) (*Service, error) {
+	cfg.setDefaults()
+	// 使用新的连接 dial-back，不能复用请求者已有的连接
+	dialer, err := libp2p.New(ctx, libp2p.NoListenAddrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	svc := &Service{
+		host:    h,
+		dialer:  dialer,
+		cfg:     cfg,
+		reqs:    make(map[peer.ID]int),
+		dialing: make(map[peer.ID]*peerLock),
+		cancel:  cancel,
+	}
+	h.SetStreamHandler(autonat.AutoNATProto, svc.handleStream)
+	go svc.resetLoop(ctx)
+	return svc, nil
+}
+
+func (svc *Service) Close() error {
+	svc.host.RemoveStreamHandler(autonat.AutoNATProto)
+	svc.cancel()
+	return svc.dialer.Close()
+}
+
+// Stats 返回到目前为止的统计
+func (svc *Service) Stats() ServiceStats {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.stats
+}
+
+// resetLoop 每个 Interval 清零请求的计数
+func (svc *Service) resetLoop(ctx context.Context) {
+	ticker := time.NewTicker(svc.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		svc.mu.Lock()
+		svc.reqs = make(map[peer.ID]int)
+		svc.global = 0
+		svc.mu.Unlock()
+	}
+}
+
+func (svc *Service) handleStream(s inet.Stream) {
+	defer inet.FullClose(s)
+	s.SetDeadline(time.Now().Add(svc.cfg.DialTimeout + 5*time.Second))
+	r := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+	w := ggio.NewDelimitedWriter(s)
+
+	var req pb.Message
+	if err := r.ReadMsg(&req); err != nil {
+		s.Reset()
+		return
+	}
+	if req.GetType() != pb.Message_DIAL {
+		s.Reset()
+		return
+	}
+
+	resp := &pb.Message{
+		Type:         pb.Message_DIAL_RESPONSE.Enum(),
+		DialResponse: svc.dialBack(s.Conn(), req.GetDial()),
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		s.Reset()
+	}
+}
+
+func dialResponse(status pb.Message_ResponseStatus, text string) *pb.Message_DialResponse {
+	return &pb.Message_DialResponse{Status: status.Enum(), StatusText: &text}
+}
+
+func (svc *Service) dialBack(c inet.Conn, req *pb.Message_Dial) *pb.Message_DialResponse {
+	remote := c.RemotePeer()
+	if req.GetPeer() == nil || peer.ID(req.GetPeer().GetId()) != remote {
+		svc.count(&svc.stats.Refused)
+		return dialResponse(pb.Message_E_BAD_REQUEST, "peer id mismatch")
+	}
+	if !svc.allow(remote) {
+		svc.count(&svc.stats.Refused)
+		return dialResponse(pb.Message_E_DIAL_REFUSED, "too many dial-back requests")
+	}
+
+	addrs := dialableAddrs(c.RemoteMultiaddr(), req.GetPeer().GetAddrs())
+	if len(addrs) == 0 {
+		svc.count(&svc.stats.Failed)
+		return dialResponse(pb.Message_E_DIAL_ERROR, "no dialable addresses")
+	}
+
+	unlock := svc.lockPeer(remote)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), svc.cfg.DialTimeout)
+	defer cancel()
+	svc.dialer.Peerstore().ClearAddrs(remote)
+	err := svc.dialer.Connect(ctx, pstore.PeerInfo{ID: remote, Addrs: addrs})
+	if err != nil {
+		svc.count(&svc.stats.Failed)
+		return dialResponse(pb.Message_E_DIAL_ERROR, err.Error())
+	}
+	defer svc.dialer.Network().ClosePeer(remote)
+
+	conns := svc.dialer.Network().ConnsToPeer(remote)
+	if len(conns) == 0 {
+		svc.count(&svc.stats.Failed)
+		return dialResponse(pb.Message_E_INTERNAL_ERROR, "connection closed")
+	}
+	svc.count(&svc.stats.Succeeded)
+	return &pb.Message_DialResponse{
+		Status: pb.Message_OK.Enum(),
+		Addr:   conns[0].RemoteMultiaddr().Bytes(),
+	}
+}
+
+// allow 按节点和总数检查频率限制，允许时计数
+func (svc *Service) allow(p peer.ID) bool {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.reqs[p] >= svc.cfg.PeerLimit || svc.global >= svc.cfg.GlobalLimit {
+		return false
+	}
+	svc.reqs[p]++
+	svc.global++
+	return true
+}
+
+// peerLock 是一个节点的 dial-back 锁，refs 为 0 时从 dialing 中删除
+type peerLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockPeer 等待 p 的其它 dial-back 结束，返回释放锁的函数
+func (svc *Service) lockPeer(p peer.ID) func() {
+	svc.mu.Lock()
+	l, ok := svc.dialing[p]
+	if !ok {
+		l = &peerLock{}
+		svc.dialing[p] = l
+	}
+	l.refs++
+	svc.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		svc.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(svc.dialing, p)
+		}
+		svc.mu.Unlock()
+	}
+}
+
+func (svc *Service) count(n *int) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	*n++
+}
+
+// dialableAddrs 返回 IP 与 observed 相同的地址，observed 不是 IP 地址时（例如经过 relay）不拨号
+func dialableAddrs(observed ma.Multiaddr, addrs [][]byte) []ma.Multiaddr {
+	ip := addrIP(observed)
+	if ip == nil || isRelayed(observed) {
+		return nil
+	}
+	var dialable []ma.Multiaddr
+	for _, b := range addrs {
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			continue
+		}
+		if isRelayed(addr) || !ip.Equal(addrIP(addr)) {
+			continue
+		}
+		dialable = append(dialable, addr)
+	}
+	return dialable
+}
+
+// addrIP 返回地址中的 IP，没有 IP 时返回 nil
+func addrIP(addr ma.Multiaddr) net.IP {
+	for _, code := range []int{ma.P_IP4, ma.P_IP6} {
+		if v, err := addr.ValueForProtocol(code); err == nil {
+			return net.ParseIP(v)
+		}
+	}
+	return nil
+}
+
+func isRelayed(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(circuit.P_CIRCUIT)
+	return err == nil
+}
@@ -0,0 +1,285 @@
+// reachability 报告本节点是否可以从公网访问，并可以为其它节点提供 AutoNAT 服务:
+//
+//   - Tracker 定期请求已连接的、支持 AutoNAT 的节点 dial-back，得到 public/private/unknown 状态，
+//     至少 Confirmations 个不同的节点确认过本节点宣布的地址之后才是 public
+//   - Tracker 记录每个被确认的公网地址和确认的时间，超过 AddrTTL 没有再次确认的地址被丢弃
+//   - Service 回答其它节点的 dial-back 请求，按节点和总数限制频率
+package reachability
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var (
+	ErrNoPeers   = errors.New("reachability: no connected AutoNAT peers")
+	ErrNotPublic = errors.New("reachability: NAT status is not public")
+)
+
+// Config 是 Tracker 的配置，为 0 的字段使用默认值
+type Config struct {
+	// 启动之后等待建立连接的时间
+	BootDelay time.Duration
+	// 状态未知时重新探测的间隔
+	RetryInterval time.Duration
+	// 状态已知时重新探测的间隔
+	RefreshInterval time.Duration
+	// 一轮探测的超时时间
+	RequestTimeout time.Duration
+	// 一轮探测最多请求的节点数
+	Probes int
+	// 确认的地址在这段时间内没有再次确认时被丢弃
+	AddrTTL time.Duration
+	// 状态变为 public 需要的确认节点数，节点在 AddrTTL 内的确认都计入
+	Confirmations int
+}
+
+const (
+	DefaultBootDelay       = 15 * time.Second
+	DefaultRetryInterval   = 90 * time.Second
+	DefaultRefreshInterval = 15 * time.Minute
+	DefaultRequestTimeout  = 30 * time.Second
+	DefaultProbes          = 3
+	DefaultAddrTTL         = time.Hour
+	DefaultConfirmations   = 2
+)
+
+func (cfg *Config) setDefaults() {
+	if cfg.BootDelay <= 0 {
+		cfg.BootDelay = DefaultBootDelay
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultRefreshInterval
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = DefaultRequestTimeout
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = DefaultProbes
+	}
+	if cfg.AddrTTL <= 0 {
+		cfg.AddrTTL = DefaultAddrTTL
+	}
+	if cfg.Confirmations <= 0 {
+		cfg.Confirmations = DefaultConfirmations
+	}
+}
+
+// ConfirmedAddr 是其它节点 dial-back 成功的公网地址
+type ConfirmedAddr struct {
+	Addr ma.Multiaddr
+	// 最近一次确认的时间和确认的节点
+	Confirmed time.Time
+	By        peer.ID
+}
+
+// Tracker 探测本节点的可达性，实现 autonat.AutoNAT
+type Tracker struct {
+	host     host.Host
+	getAddrs autonat.GetAddrs
+	cfg      Config
+
+	mu        sync.Mutex
+	status    autonat.NATStatus
+	confirmed map[string]*ConfirmedAddr
+	// 确认过本节点地址的节点和最近一次确认的时间
+	confirmers map[peer.ID]time.Time
+	lastProbe  time.Time
+}
+
+var _ autonat.AutoNAT = (*Tracker)(nil)
+
+// NewTracker 创建 Tracker 并在后台探测，直到 ctx 结束。
+// getAddrs 返回请求 dial-back 的地址，为 nil 时使用 h.Addrs
+func NewTracker(ctx context.Context, h host.Host, getAddrs autonat.GetAddrs, cfg Config) *Tracker {
+	cfg.setDefaults()
+	if getAddrs == nil {
+		getAddrs = h.Addrs
+	}
+	t := &Tracker{
+		host:       h,
+		getAddrs:   getAddrs,
+		cfg:        cfg,
+		status:     autonat.NATStatusUnknown,
+		confirmed:  make(map[string]*ConfirmedAddr),
+		confirmers: make(map[peer.ID]time.Time),
+	}
+	go t.background(ctx)
+	return t
+}
+
+// Status 返回当前的状态，公网地址全部过期之后状态变为未知
+func (t *Tracker) Status() autonat.NATStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(time.Now())
+	return t.status
+}
+
+// PublicAddr 返回最近确认的公网地址
+func (t *Tracker) PublicAddr() (ma.Multiaddr, error) {
+	confirmed := t.Confirmed()
+	if len(confirmed) == 0 {
+		return nil, ErrNotPublic
+	}
+	return confirmed[0].Addr, nil
+}
+
+// Confirmed 返回没有过期的公网地址，最近确认的在前
+func (t *Tracker) Confirmed() []ConfirmedAddr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(time.Now())
+
+	var addrs []ConfirmedAddr
+	for _, a := range t.confirmed {
+		addrs = append(addrs, *a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Confirmed.After(addrs[j].Confirmed) })
+	return addrs
+}
+
+// LastProbe 返回最近一次探测的时间，还没有探测过时为零值
+func (t *Tracker) LastProbe() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastProbe
+}
+
+// expire 删除过期的地址，调用者持有 mu
+func (t *Tracker) expire(now time.Time) {
+	for key, a := range t.confirmed {
+		if now.Sub(a.Confirmed) > t.cfg.AddrTTL {
+			delete(t.confirmed, key)
+		}
+	}
+	for p, confirmed := range t.confirmers {
+		if now.Sub(confirmed) > t.cfg.AddrTTL {
+			delete(t.confirmers, p)
+		}
+	}
+	if t.status == autonat.NATStatusPublic && (len(t.confirmed) == 0 || len(t.confirmers) < t.cfg.Confirmations) {
+		t.status = autonat.NATStatusUnknown
+	}
+}
+
+func (t *Tracker) background(ctx context.Context) {
+	// 等待节点建立一些连接之后再探测
+	select {
+	case <-time.After(t.cfg.BootDelay):
+	case <-ctx.Done():
+		return
+	}
+
+	for {
+		t.Probe(ctx)
+
+		delay := t.cfg.RefreshInterval
+		if t.Status() == autonat.NATStatusUnknown {
+			delay = t.cfg.RetryInterval
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Probe 执行一轮探测: 请求最多 Probes 个节点 dial-back。
+// 拨号失败的回答多于成功的回答时状态为 private；成功的回答不少于失败的回答、
+// 并且 AddrTTL 内确认过的节点达到 Confirmations 时为 public；其它情况状态不变。
+// 返回的地址不是本节点宣布的地址时，这个回答被忽略
+func (t *Tracker) Probe(ctx context.Context) error {
+	peers := t.autonatPeers()
+	if len(peers) == 0 {
+		return ErrNoPeers
+	}
+	if len(peers) > t.cfg.Probes {
+		peers = peers[:t.cfg.Probes]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.RequestTimeout)
+	defer cancel()
+	// 请求和检查使用同一组地址，避免探测过程中地址变化
+	addrs := t.getAddrs()
+	advertised := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		advertised[a.String()] = true
+	}
+	cli := autonat.NewAutoNATClient(t.host, func() []ma.Multiaddr { return addrs })
+
+	var (
+		mu      sync.Mutex
+		private int
+		public  []ConfirmedAddr
+		wg      sync.WaitGroup
+	)
+	for _, p := range peers {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			addr, err := cli.DialBack(ctx, p)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil && advertised[addr.String()]:
+				public = append(public, ConfirmedAddr{Addr: addr, Confirmed: time.Now(), By: p})
+			case autonat.IsDialError(err):
+				private++
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastProbe = time.Now()
+	switch {
+	case private > len(public):
+		t.status = autonat.NATStatusPrivate
+		t.confirmed = make(map[string]*ConfirmedAddr)
+		t.confirmers = make(map[peer.ID]time.Time)
+	case len(public) > 0:
+		for i := range public {
+			a := public[i]
+			t.confirmed[a.Addr.String()] = &a
+			t.confirmers[a.By] = a.Confirmed
+		}
+		t.expire(t.lastProbe)
+		if len(t.confirmers) >= t.cfg.Confirmations {
+			t.status = autonat.NATStatusPublic
+		}
+	}
+	return nil
+}
+
+// autonatPeers 返回已连接的、支持 AutoNAT 协议的节点，顺序随机
+func (t *Tracker) autonatPeers() []peer.ID {
+	var peers []peer.ID
+	for _, p := range t.host.Network().Peers() {
+		if t.host.Network().Connectedness(p) != inet.Connected {
+			continue
+		}
+		protos, err := t.host.Peerstore().SupportsProtocols(p, autonat.AutoNATProto)
+		if err != nil || len(protos) == 0 {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	return peers
+}
@@ -0,0 +1,180 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// circuitJSON 是 /circuits 返回的一个 circuit，peer ID 使用 base58 字符串
+type circuitJSON struct {
+	ID          uint64  `json:"id"`
+	Src         string  `json:"src"`
+	Dst         string  `json:"dst"`
+	Reservation bool    `json:"reservation"`
+	Age         float64 `json:"age_seconds"`
+	SrcToDst    int64   `json:"bytes_src_to_dst"`
+	DstToSrc    int64   `json:"bytes_dst_to_src"`
+}
+
+type statsJSON struct {
+	Circuits     int               `json:"circuits"`
+	Reservations int               `json:"reservations"`
+	Accepted     uint64            `json:"accepted"`
+	Rejected     map[string]uint64 `json:"rejected"`
+	SrcToDst     int64             `json:"bytes_src_to_dst"`
+	DstToSrc     int64             `json:"bytes_dst_to_src"`
+}
+
+func toCircuitJSON(ci CircuitInfo) circuitJSON {
+	return circuitJSON{
+		ID:          ci.ID,
+		Src:         ci.Src.Pretty(),
+		Dst:         ci.Dst.Pretty(),
+		Reservation: ci.Reservation,
+		Age:         ci.Age.Seconds(),
+		SrcToDst:    ci.SrcToDst,
+		DstToSrc:    ci.DstToSrc,
+	}
+}
+
+// Handler 返回管理接口，只应该监听在本地地址上:
+//
+//	GET    /circuits       所有的 circuit 和预留
+//	DELETE /circuits/<id>  关闭一个 circuit
+//	GET    /stats          累计的统计
+//	GET    /metrics        Prometheus 文本格式的指标
+func (svc *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/circuits", svc.serveCircuits)
+	mux.HandleFunc("/circuits/", svc.serveCircuit)
+	mux.HandleFunc("/stats", svc.serveStats)
+	mux.HandleFunc("/metrics", svc.serveMetrics)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func (svc *Service) serveCircuits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	infos := svc.Circuits()
+	out := make([]circuitJSON, len(infos))
+	for i, ci := range infos {
+		out[i] = toCircuitJSON(ci)
+	}
+	writeJSON(w, out)
+}
+
+func (svc *Service) serveCircuit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/circuits/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid circuit id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, ci := range svc.Circuits() {
+			if ci.ID == id {
+				writeJSON(w, toCircuitJSON(ci))
+				return
+			}
+		}
+		http.Error(w, ErrNoCircuit.Error(), http.StatusNotFound)
+	case http.MethodDelete:
+		if err := svc.Kill(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Printf("relay: killed circuit %d \n", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (svc *Service) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := svc.Stats()
+	writeJSON(w, statsJSON{
+		Circuits:     st.Circuits,
+		Reservations: st.Reservations,
+		Accepted:     st.Accepted,
+		Rejected:     st.Rejected,
+		SrcToDst:     st.SrcToDst,
+		DstToSrc:     st.DstToSrc,
+	})
+}
+
+func (svc *Service) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	svc.WriteMetrics(w)
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出指标
+func (svc *Service) WriteMetrics(w io.Writer) {
+	st := svc.Stats()
+	infos := svc.Circuits()
+
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("relay_circuits", "gauge", "Number of active circuits.")
+	fmt.Fprintf(w, "relay_circuits %d\n", st.Circuits)
+	metric("relay_reservations", "gauge", "Number of circuits still in the handshake.")
+	fmt.Fprintf(w, "relay_reservations %d\n", st.Reservations)
+	metric("relay_circuits_accepted_total", "counter", "Circuits accepted since start.")
+	fmt.Fprintf(w, "relay_circuits_accepted_total %d\n", st.Accepted)
+
+	metric("relay_requests_rejected_total", "counter", "Rejected relay requests by reason.")
+	reasons := make([]string, 0, len(st.Rejected))
+	for reason := range st.Rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "relay_requests_rejected_total{reason=%q} %d\n", reason, st.Rejected[reason])
+	}
+
+	metric("relay_bytes_total", "counter", "Bytes relayed by direction.")
+	fmt.Fprintf(w, "relay_bytes_total{direction=\"src_to_dst\"} %d\n", st.SrcToDst)
+	fmt.Fprintf(w, "relay_bytes_total{direction=\"dst_to_src\"} %d\n", st.DstToSrc)
+
+	metric("relay_circuit_bytes", "gauge", "Bytes relayed by an active circuit.")
+	for _, ci := range infos {
+		if ci.Reservation {
+			continue
+		}
+		labels := fmt.Sprintf("id=\"%d\",src=%q,dst=%q", ci.ID, ci.Src.Pretty(), ci.Dst.Pretty())
+		fmt.Fprintf(w, "relay_circuit_bytes{%s,direction=\"src_to_dst\"} %d\n", labels, ci.SrcToDst)
+		fmt.Fprintf(w, "relay_circuit_bytes{%s,direction=\"dst_to_src\"} %d\n", labels, ci.DstToSrc)
+	}
+	metric("relay_circuit_age_seconds", "gauge", "Age of an active circuit.")
+	for _, ci := range infos {
+		if ci.Reservation {
+			continue
+		}
+		fmt.Fprintf(w, "relay_circuit_age_seconds{id=\"%d\",src=%q,dst=%q} %g\n",
+			ci.ID, ci.Src.Pretty(), ci.Dst.Pretty(), ci.Age.Seconds())
+	}
+}
@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	srv := httptest.NewServer(n.svc.Handler())
+	defer srv.Close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	if err := echo(c, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/circuits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var circuits []circuitJSON
+	err = json.NewDecoder(resp.Body).Decode(&circuits)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circuits) != 1 || circuits[0].Src != n.src.ID().Pretty() || circuits[0].SrcToDst != 100 {
+		t.Fatalf("unexpected circuits %+v", circuits)
+	}
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, line := range []string{
+		"relay_circuits 1\n",
+		"relay_circuits_accepted_total 1\n",
+		fmt.Sprintf("relay_circuit_bytes{id=\"%d\",src=%q,dst=%q,direction=\"src_to_dst\"} 100\n",
+			circuits[0].ID, n.src.ID().Pretty(), n.dst.ID().Pretty()),
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Fatalf("expected %q in metrics:\n%s", line, body)
+		}
+	}
+
+	// 关闭 circuit
+	url := fmt.Sprintf("%s/circuits/%d", srv.URL, circuits[0].ID)
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+	waitCircuits(t, n.svc, 0)
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected %d for an unknown circuit, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st statsJSON
+	err = json.NewDecoder(resp.Body).Decode(&st)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Accepted != 1 || st.Circuits != 0 || st.SrcToDst != 100 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
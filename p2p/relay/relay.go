@@ -0,0 +1,664 @@
+// relay 实现 circuit relay（/libp2p/circuit/relay/0.1.0）的中继端:
+//
+//   - 替换 go-libp2p-circuit 自带的 hop 处理，只做中继，不作为 circuit 的端点
+//   - 限制总的 circuit 数、每个节点的 circuit 数、每个 circuit 的时长、流量和速率
+//   - 按源节点和目标节点的允许列表/拒绝列表过滤请求
+//   - Shutdown 时不再接受新的请求，等待已有的 circuit 结束
+//   - 统计活动的 circuit、预留和被拒绝的请求，通过 Handler 提供 JSON 和 Prometheus 管理接口
+package relay
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ggio "github.com/gogo/protobuf/io"
+	proto "github.com/gogo/protobuf/proto"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	pb "github.com/libp2p/go-libp2p-circuit/pb"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var (
+	ErrClosed          = errors.New("relay: service closed")
+	ErrTooManyCircuits = errors.New("relay: too many circuits")
+	ErrTooManyForPeer  = errors.New("relay: too many circuits for peer")
+	ErrSrcDenied       = errors.New("relay: source peer not allowed")
+	ErrDstDenied       = errors.New("relay: destination peer not allowed")
+	ErrByteLimit       = errors.New("relay: circuit byte limit exceeded")
+	ErrDurationLimit   = errors.New("relay: circuit duration limit exceeded")
+	ErrKilled          = errors.New("relay: circuit killed")
+	ErrNoCircuit       = errors.New("relay: no such circuit")
+)
+
+// 被拒绝的请求按原因计数，协议错误使用状态码的小写名字，例如 hop_no_conn_to_dst
+var errReasons = map[error]string{
+	ErrClosed:          "closed",
+	ErrTooManyCircuits: "max_circuits",
+	ErrTooManyForPeer:  "max_circuits_per_peer",
+	ErrSrcDenied:       "src_denied",
+	ErrDstDenied:       "dst_denied",
+}
+
+func statusReason(code pb.CircuitRelay_Status) string {
+	return strings.ToLower(code.String())
+}
+
+const maxMessageSize = 4096
+
+// 读取 hop 请求的超时时间
+const handshakeTimeout = time.Minute
+
+// Limits 是中继的资源限制，为 0 的字段表示不限制
+type Limits struct {
+	// 同时存在的 circuit 数
+	MaxCircuits int
+	// 一个节点（作为源或目标）同时参与的 circuit 数
+	MaxCircuitsPerPeer int
+	// 一个 circuit 的最长时间，到时后被关闭
+	MaxDuration time.Duration
+	// 一个 circuit 每个方向最多转发的字节数，超过后被关闭
+	MaxBytes int64
+	// 一个 circuit 每个方向的速率（字节/秒）
+	MaxRate int64
+}
+
+// ACL 过滤源节点和目标节点。Allow 列表不为空时只允许列表中的节点，Deny 列表中的节点总是被拒绝
+type ACL struct {
+	AllowSrc []peer.ID
+	DenySrc  []peer.ID
+	AllowDst []peer.ID
+	DenyDst  []peer.ID
+}
+
+// Config 是 Service 的配置
+type Config struct {
+	Limits Limits
+	ACL    ACL
+	// 目标节点没有连接时是否主动拨号，否则只中继到已经连接的节点
+	Active bool
+	// 打开到目标节点的 stream 的超时时间
+	ConnectTimeout time.Duration
+}
+
+type peerSet map[peer.ID]struct{}
+
+func newPeerSet(ids []peer.ID) peerSet {
+	set := make(peerSet, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+func (set peerSet) has(id peer.ID) bool {
+	_, ok := set[id]
+	return ok
+}
+
+// hop 是一条正在中继的 circuit，握手完成之前是一个预留
+type hop struct {
+	// 两个方向转发的字节数，原子地访问，放在开头保证 64 位对齐
+	srcToDst, dstToSrc int64
+
+	id       uint64
+	src, dst peer.ID
+	start    time.Time // 预留的时间，握手完成后改为开始中继的时间
+	active   bool
+
+	s, bs inet.Stream
+
+	once  sync.Once
+	reset chan struct{}
+	err   error
+}
+
+// kill 重置两端的 stream，正在进行的转发随之结束。握手还没有完成时只做标记
+func (c *hop) kill(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.reset)
+		if c.s != nil {
+			c.s.Reset()
+			c.bs.Reset()
+		}
+	})
+}
+
+// finish 在两个方向的转发都结束之后调用，返回 circuit 被关闭的原因，正常结束时为 nil
+func (c *hop) finish() error {
+	c.once.Do(func() {
+		close(c.reset)
+	})
+	return c.err
+}
+
+func (c *hop) killed() bool {
+	select {
+	case <-c.reset:
+		return true
+	default:
+		return false
+	}
+}
+
+// Service 在 host 上处理 circuit relay 协议
+type Service struct {
+	host host.Host
+	cfg  Config
+
+	allowSrc, denySrc peerSet
+	allowDst, denyDst peerSet
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	closed   bool
+	nextID   uint64
+	circuits map[uint64]*hop
+	perPeer  map[peer.ID]int
+	done     chan struct{} // 最后一个 circuit 结束时关闭，只在 closed 之后使用
+
+	// 统计，由 mu 保护。字节数只包括已经结束的 circuit
+	accepted           uint64
+	rejected           map[string]uint64
+	srcToDst, dstToSrc int64
+}
+
+// CircuitInfo 是一个 circuit 的快照
+type CircuitInfo struct {
+	ID       uint64
+	Src, Dst peer.ID
+	// 握手还没有完成的预留
+	Reservation bool
+	Age         time.Duration
+	SrcToDst    int64
+	DstToSrc    int64
+}
+
+// Stats 是 Service 的累计统计
+type Stats struct {
+	Circuits     int
+	Reservations int
+	Accepted     uint64
+	// 按原因统计的被拒绝的请求
+	Rejected map[string]uint64
+	// 所有 circuit 每个方向转发的字节数
+	SrcToDst int64
+	DstToSrc int64
+}
+
+// New 创建 Service 并接管 host 上的 circuit relay 协议
+func New(h host.Host, cfg Config) *Service {
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = circuit.HopConnectTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := &Service{
+		host:     h,
+		cfg:      cfg,
+		allowSrc: newPeerSet(cfg.ACL.AllowSrc),
+		denySrc:  newPeerSet(cfg.ACL.DenySrc),
+		allowDst: newPeerSet(cfg.ACL.AllowDst),
+		denyDst:  newPeerSet(cfg.ACL.DenyDst),
+		ctx:      ctx,
+		cancel:   cancel,
+		circuits: make(map[uint64]*hop),
+		perPeer:  make(map[peer.ID]int),
+		done:     make(chan struct{}),
+		rejected: make(map[string]uint64),
+	}
+	h.SetStreamHandler(circuit.ProtoID, svc.handleStream)
+	return svc
+}
+
+// NumCircuits 返回正在中继的 circuit 数
+func (svc *Service) NumCircuits() int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return len(svc.circuits)
+}
+
+// Circuits 返回所有的 circuit（包括预留），按 ID 排序
+func (svc *Service) Circuits() []CircuitInfo {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	now := time.Now()
+	out := make([]CircuitInfo, 0, len(svc.circuits))
+	for _, c := range svc.circuits {
+		out = append(out, CircuitInfo{
+			ID:          c.id,
+			Src:         c.src,
+			Dst:         c.dst,
+			Reservation: !c.active,
+			Age:         now.Sub(c.start),
+			SrcToDst:    atomic.LoadInt64(&c.srcToDst),
+			DstToSrc:    atomic.LoadInt64(&c.dstToSrc),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Stats 返回累计的统计
+func (svc *Service) Stats() Stats {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	st := Stats{
+		Accepted: svc.accepted,
+		Rejected: make(map[string]uint64, len(svc.rejected)),
+		SrcToDst: svc.srcToDst,
+		DstToSrc: svc.dstToSrc,
+	}
+	for reason, n := range svc.rejected {
+		st.Rejected[reason] = n
+	}
+	for _, c := range svc.circuits {
+		if c.active {
+			st.Circuits++
+		} else {
+			st.Reservations++
+		}
+		st.SrcToDst += atomic.LoadInt64(&c.srcToDst)
+		st.DstToSrc += atomic.LoadInt64(&c.dstToSrc)
+	}
+	return st
+}
+
+// Kill 关闭一个 circuit，预留的 circuit 在握手完成时被关闭
+func (svc *Service) Kill(id uint64) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	c, ok := svc.circuits[id]
+	if !ok {
+		return ErrNoCircuit
+	}
+	c.kill(ErrKilled)
+	return nil
+}
+
+// Shutdown 停止接受新的请求，等待已有的 circuit 结束。ctx 结束时关闭剩余的 circuit
+func (svc *Service) Shutdown(ctx context.Context) error {
+	svc.mu.Lock()
+	if !svc.closed {
+		svc.closed = true
+		svc.host.RemoveStreamHandler(circuit.ProtoID)
+		if len(svc.circuits) == 0 {
+			close(svc.done)
+		}
+	}
+	svc.mu.Unlock()
+
+	select {
+	case <-svc.done:
+		svc.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	svc.cancel()
+	svc.mu.Lock()
+	for _, c := range svc.circuits {
+		c.kill(ErrClosed)
+	}
+	svc.mu.Unlock()
+	<-svc.done
+	return ctx.Err()
+}
+
+// Close 立即关闭所有的 circuit
+func (svc *Service) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.Shutdown(ctx)
+	return nil
+}
+
+// checkACL 检查源节点和目标节点是否被允许
+func (svc *Service) checkACL(src, dst peer.ID) error {
+	if svc.denySrc.has(src) || (len(svc.allowSrc) > 0 && !svc.allowSrc.has(src)) {
+		return ErrSrcDenied
+	}
+	if svc.denyDst.has(dst) || (len(svc.allowDst) > 0 && !svc.allowDst.has(dst)) {
+		return ErrDstDenied
+	}
+	return nil
+}
+
+// reserve 在限制之内为 src -> dst 预留一个 circuit，打开目标 stream 之前调用
+func (svc *Service) reserve(src, dst peer.ID) (*hop, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	lim := svc.cfg.Limits
+	switch {
+	case svc.closed:
+		return nil, ErrClosed
+	case lim.MaxCircuits > 0 && len(svc.circuits) >= lim.MaxCircuits:
+		return nil, ErrTooManyCircuits
+	case lim.MaxCircuitsPerPeer > 0 && (svc.perPeer[src] >= lim.MaxCircuitsPerPeer || svc.perPeer[dst] >= lim.MaxCircuitsPerPeer):
+		return nil, ErrTooManyForPeer
+	}
+
+	svc.nextID++
+	c := &hop{
+		id:    svc.nextID,
+		src:   src,
+		dst:   dst,
+		start: time.Now(),
+		reset: make(chan struct{}),
+	}
+	svc.circuits[c.id] = c
+	svc.perPeer[src]++
+	svc.perPeer[dst]++
+	return c, nil
+}
+
+func (svc *Service) release(c *hop) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	delete(svc.circuits, c.id)
+	svc.srcToDst += atomic.LoadInt64(&c.srcToDst)
+	svc.dstToSrc += atomic.LoadInt64(&c.dstToSrc)
+	for _, p := range []peer.ID{c.src, c.dst} {
+		if svc.perPeer[p]--; svc.perPeer[p] <= 0 {
+			delete(svc.perPeer, p)
+		}
+	}
+	if svc.closed && len(svc.circuits) == 0 {
+		close(svc.done)
+	}
+}
+
+func (svc *Service) handleStream(s inet.Stream) {
+	s.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	var msg pb.CircuitRelay
+	if err := readMsg(s, &msg); err != nil {
+		svc.refuse(s, pb.CircuitRelay_MALFORMED_MESSAGE, "")
+		return
+	}
+	s.SetReadDeadline(time.Time{})
+
+	switch msg.GetType() {
+	case pb.CircuitRelay_HOP:
+		svc.handleHop(s, &msg)
+	case pb.CircuitRelay_CAN_HOP:
+		if err := writeStatus(s, pb.CircuitRelay_SUCCESS); err != nil {
+			s.Reset()
+			return
+		}
+		inet.FullClose(s)
+	case pb.CircuitRelay_STOP:
+		// 只做中继，不接受以自己为终点的 circuit
+		svc.refuse(s, pb.CircuitRelay_STOP_RELAY_REFUSED, "")
+	default:
+		svc.refuse(s, pb.CircuitRelay_MALFORMED_MESSAGE, "")
+	}
+}
+
+func (svc *Service) handleHop(s inet.Stream, msg *pb.CircuitRelay) {
+	src, err := peerToPeerInfo(msg.GetSrcPeer())
+	if err != nil || src.ID != s.Conn().RemotePeer() {
+		svc.refuse(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID, "")
+		return
+	}
+	dst, err := peerToPeerInfo(msg.GetDstPeer())
+	if err != nil {
+		svc.refuse(s, pb.CircuitRelay_HOP_DST_MULTIADDR_INVALID, "")
+		return
+	}
+	if dst.ID == svc.host.ID() {
+		svc.refuse(s, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF, "")
+		return
+	}
+
+	// 协议中没有表示 "资源不足" 的状态码，被拒绝的请求都返回 HOP_CANT_SPEAK_RELAY
+	if err := svc.checkACL(src.ID, dst.ID); err != nil {
+		fmt.Printf("relay: rejected %s -> %s: %s \n", src.ID.Pretty(), dst.ID.Pretty(), err)
+		svc.refuse(s, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY, errReasons[err])
+		return
+	}
+	c, err := svc.reserve(src.ID, dst.ID)
+	if err != nil {
+		fmt.Printf("relay: rejected %s -> %s: %s \n", src.ID.Pretty(), dst.ID.Pretty(), err)
+		svc.refuse(s, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY, errReasons[err])
+		return
+	}
+
+	bs, code := svc.openDst(dst, msg)
+	if code != pb.CircuitRelay_SUCCESS {
+		svc.release(c)
+		svc.refuse(s, code, "")
+		return
+	}
+
+	// 握手期间 Shutdown 或 Kill 可能已经关闭了这个 circuit
+	svc.mu.Lock()
+	c.s, c.bs = s, bs
+	killed := c.killed()
+	if !killed {
+		c.active = true
+		c.start = time.Now()
+		svc.accepted++
+	}
+	svc.mu.Unlock()
+	if killed {
+		svc.release(c)
+		bs.Reset()
+		s.Reset()
+		return
+	}
+
+	if err := writeStatus(s, pb.CircuitRelay_SUCCESS); err != nil {
+		svc.release(c)
+		bs.Reset()
+		s.Reset()
+		return
+	}
+	go svc.relay(c)
+}
+
+// openDst 打开到目标节点的 stream，并完成 STOP 握手
+func (svc *Service) openDst(dst pstore.PeerInfo, msg *pb.CircuitRelay) (inet.Stream, pb.CircuitRelay_Status) {
+	ctx, cancel := context.WithTimeout(svc.ctx, svc.cfg.ConnectTimeout)
+	defer cancel()
+
+	if !svc.cfg.Active {
+		ctx = inet.WithNoDial(ctx, "relay hop")
+	} else if len(dst.Addrs) > 0 {
+		svc.host.Peerstore().AddAddrs(dst.ID, dst.Addrs, pstore.TempAddrTTL)
+	}
+
+	bs, err := svc.host.NewStream(ctx, dst.ID, circuit.ProtoID)
+	if err != nil {
+		if err == inet.ErrNoConn {
+			return nil, pb.CircuitRelay_HOP_NO_CONN_TO_DST
+		}
+		return nil, pb.CircuitRelay_HOP_CANT_DIAL_DST
+	}
+
+	stop := *msg
+	stop.Type = pb.CircuitRelay_STOP.Enum()
+	if err := ggio.NewDelimitedWriter(bs).WriteMsg(&stop); err != nil {
+		bs.Reset()
+		return nil, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM
+	}
+
+	var resp pb.CircuitRelay
+	bs.SetReadDeadline(time.Now().Add(svc.cfg.ConnectTimeout))
+	if err := readMsg(bs, &resp); err != nil || resp.GetType() != pb.CircuitRelay_STATUS {
+		bs.Reset()
+		return nil, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM
+	}
+	bs.SetReadDeadline(time.Time{})
+	if resp.GetCode() != pb.CircuitRelay_SUCCESS {
+		bs.Reset()
+		return nil, resp.GetCode()
+	}
+	return bs, pb.CircuitRelay_SUCCESS
+}
+
+// relay 在两个 stream 之间双向转发，直到两个方向都结束
+func (svc *Service) relay(c *hop) {
+	defer svc.release(c)
+
+	if d := svc.cfg.Limits.MaxDuration; d > 0 {
+		t := time.AfterFunc(d, func() { c.kill(ErrDurationLimit) })
+		defer t.Stop()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		svc.pump(c, c.bs, c.s, &c.srcToDst)
+	}()
+	go func() {
+		defer wg.Done()
+		svc.pump(c, c.s, c.bs, &c.dstToSrc)
+	}()
+	wg.Wait()
+
+	if err := c.finish(); err != nil {
+		fmt.Printf("relay: closed %s -> %s: %s \n", c.src.Pretty(), c.dst.Pretty(), err)
+	}
+}
+
+// pump 从 r 向 w 转发数据，受字节数和速率的限制，转发的字节数累加到 count。
+// 正常结束时关闭 w 的写方向，出错时重置整个 circuit
+func (svc *Service) pump(c *hop, w, r inet.Stream, count *int64) {
+	lim := svc.cfg.Limits
+	buf := make([]byte, maxMessageSize)
+	var n int64
+	for {
+		k, err := r.Read(buf)
+		if k > 0 {
+			if lim.MaxBytes > 0 && n+int64(k) > lim.MaxBytes {
+				c.kill(ErrByteLimit)
+				return
+			}
+			if _, werr := w.Write(buf[:k]); werr != nil {
+				c.kill(werr)
+				return
+			}
+			n += int64(k)
+			atomic.AddInt64(count, int64(k))
+			if !svc.throttle(c, n, lim.MaxRate) {
+				return
+			}
+		}
+		if err == io.EOF {
+			w.Close()
+			return
+		}
+		if err != nil {
+			c.kill(err)
+			return
+		}
+	}
+}
+
+// throttle 在转发了 n 字节之后等待，使平均速率不超过 rate。circuit 被关闭时返回 false
+func (svc *Service) throttle(c *hop, n, rate int64) bool {
+	if rate <= 0 {
+		return true
+	}
+	wait := time.Duration(n*int64(time.Second)/rate) - time.Since(c.start)
+	if wait <= 0 {
+		return true
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.reset:
+		return false
+	}
+}
+
+// refuse 记录一次被拒绝的请求并返回错误状态，reason 为空时使用状态码的名字
+func (svc *Service) refuse(s inet.Stream, code pb.CircuitRelay_Status, reason string) {
+	if reason == "" {
+		reason = statusReason(code)
+	}
+	svc.mu.Lock()
+	svc.rejected[reason]++
+	svc.mu.Unlock()
+	svc.handleError(s, code)
+}
+
+func (svc *Service) handleError(s inet.Stream, code pb.CircuitRelay_Status) {
+	if err := writeStatus(s, code); err != nil {
+		s.Reset()
+		return
+	}
+	inet.FullClose(s)
+}
+
+func writeStatus(s inet.Stream, code pb.CircuitRelay_Status) error {
+	var msg pb.CircuitRelay
+	msg.Type = pb.CircuitRelay_STATUS.Enum()
+	msg.Code = code.Enum()
+	return ggio.NewDelimitedWriter(s).WriteMsg(&msg)
+}
+
+// byteReader 每次只读一个字节，避免读走握手之后的数据
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.buf[:])
+	return br.buf[0], err
+}
+
+// readMsg 读取一个以 uvarint 长度为前缀的消息
+func readMsg(r io.Reader, msg proto.Message) error {
+	size, err := binary.ReadUvarint(&byteReader{r: r})
+	if err != nil {
+		return err
+	}
+	if size > maxMessageSize {
+		return errors.New("relay: message too large")
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, msg)
+}
+
+func peerToPeerInfo(p *pb.CircuitRelay_Peer) (pstore.PeerInfo, error) {
+	if p == nil {
+		return pstore.PeerInfo{}, errors.New("nil peer")
+	}
+	id, err := peer.IDFromBytes(p.Id)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	addrs := make([]ma.Multiaddr, 0, len(p.Addrs))
+	for _, b := range p.Addrs {
+		if a, err := ma.NewMultiaddrBytes(b); err == nil {
+			addrs = append(addrs, a)
+		}
+	}
+	return pstore.PeerInfo{ID: id, Addrs: addrs}, nil
+}
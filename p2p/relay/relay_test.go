@@ -0,0 +1,400 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	pb "github.com/libp2p/go-libp2p-circuit/pb"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+type testNet struct {
+	relay, src, dst host.Host
+	svc             *Service
+	srcRelay        *circuit.Relay
+}
+
+func connect(t *testing.T, ctx context.Context, a, b host.Host) {
+	if err := a.Connect(ctx, pstore.PeerInfo{ID: b.ID(), Addrs: b.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+ * src ---- relay ---- dst
+ * src 和 dst 都只连接 relay，dst 上运行一个 echo 服务
+ */
+func makeNet(t *testing.T, ctx context.Context, cfg Config) *testNet {
+	n := &testNet{
+		relay: tu.GenHost(t, ctx),
+		src:   tu.GenHost(t, ctx),
+		dst:   tu.GenHost(t, ctx),
+	}
+	n.svc = New(n.relay, cfg)
+	connect(t, ctx, n.src, n.relay)
+	connect(t, ctx, n.dst, n.relay)
+
+	var err error
+	if n.srcRelay, err = circuit.NewRelay(ctx, n.src, nil); err != nil {
+		t.Fatal(err)
+	}
+	dstRelay, err := circuit.NewRelay(ctx, n.dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		l := dstRelay.Listener()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return n
+}
+
+func (n *testNet) close() {
+	n.svc.Close()
+	for _, h := range []host.Host{n.relay, n.src, n.dst} {
+		h.Close()
+	}
+}
+
+func (n *testNet) dial(ctx context.Context) (*circuit.Conn, error) {
+	return n.srcRelay.DialPeer(ctx, pstore.PeerInfo{ID: n.relay.ID()}, pstore.PeerInfo{ID: n.dst.ID()})
+}
+
+func (n *testNet) dialOrFatal(t *testing.T, ctx context.Context) *circuit.Conn {
+	c, err := n.dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func expectRefused(t *testing.T, err error, code pb.CircuitRelay_Status) {
+	rerr, ok := err.(circuit.RelayError)
+	if !ok || rerr.Code != code {
+		t.Fatalf("expected relay error %s, got %v", code, err)
+	}
+}
+
+func echo(c io.ReadWriter, size int) error {
+	data := bytes.Repeat([]byte{'x'}, size)
+	if _, err := c.Write(data); err != nil {
+		return err
+	}
+	reply := make([]byte, size)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		return err
+	}
+	if !bytes.Equal(reply, data) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func waitCircuits(t *testing.T, svc *Service, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.NumCircuits() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d circuits, got %d", n, svc.NumCircuits())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	if err := echo(c, 100); err != nil {
+		t.Fatal(err)
+	}
+	waitCircuits(t, n.svc, 1)
+	c.Close()
+	waitCircuits(t, n.svc, 0)
+
+	// 中继不作为 circuit 的终点
+	_, err := n.srcRelay.DialPeer(ctx, pstore.PeerInfo{ID: n.relay.ID()}, pstore.PeerInfo{ID: n.relay.ID()})
+	expectRefused(t, err, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF)
+}
+
+func TestCircuitLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{Limits: Limits{MaxCircuitsPerPeer: 1}})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	_, err := n.dial(ctx)
+	expectRefused(t, err, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+
+	// 总数的限制，不经过网络直接检查 reserve
+	ids := make([]peer.ID, 4)
+	for i := range ids {
+		ids[i] = tu.RandIdentityOrFatal(t).ID()
+	}
+	svc := New(n.relay, Config{Limits: Limits{MaxCircuits: 2, MaxCircuitsPerPeer: 2}})
+	for _, pair := range [][2]int{{0, 1}, {0, 2}} {
+		h, err := svc.reserve(ids[pair[0]], ids[pair[1]])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer svc.release(h)
+	}
+	if _, err := svc.reserve(ids[2], ids[3]); err != ErrTooManyCircuits {
+		t.Fatalf("expected %v, got %v", ErrTooManyCircuits, err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	for _, acl := range []ACL{
+		{DenySrc: []peer.ID{n.src.ID()}},
+		{AllowSrc: []peer.ID{n.dst.ID()}},
+		{DenyDst: []peer.ID{n.dst.ID()}},
+		{AllowDst: []peer.ID{n.src.ID()}},
+	} {
+		n.svc.Close()
+		n.svc = New(n.relay, Config{ACL: acl})
+		_, err := n.dial(ctx)
+		expectRefused(t, err, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+	}
+
+	n.svc.Close()
+	n.svc = New(n.relay, Config{ACL: ACL{AllowSrc: []peer.ID{n.src.ID()}, AllowDst: []peer.ID{n.dst.ID()}}})
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	if err := echo(c, 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestByteLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{Limits: Limits{MaxBytes: 1000}})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	if err := echo(c, 600); err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := echo(c, 600); err == nil {
+		t.Fatal("expected the circuit to be closed after 1000 bytes")
+	}
+	waitCircuits(t, n.svc, 0)
+}
+
+func TestDurationLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{Limits: Limits{MaxDuration: 200 * time.Millisecond}})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	if err := echo(c, 10); err != nil {
+		t.Fatal(err)
+	}
+	waitCircuits(t, n.svc, 0)
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := echo(c, 10); err == nil {
+		t.Fatal("expected the circuit to be closed after MaxDuration")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{Limits: Limits{MaxRate: 64 << 10}})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	start := time.Now()
+	if err := echo(c, 32<<10); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("expected 32KiB at 64KiB/s to take about 500ms, took %s", d)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	waitCircuits(t, n.svc, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- n.svc.Shutdown(ctx)
+	}()
+
+	// 关闭期间不再接受新的 circuit，已有的 circuit 继续工作
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := n.dial(ctx); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected new circuits to be refused during shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := echo(c, 10); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown returned %v before the circuit closed", err)
+	default:
+	}
+
+	c.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not return after the last circuit closed")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	waitCircuits(t, n.svc, 1)
+
+	sctx, scancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer scancel()
+	if err := n.svc.Shutdown(sctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if n.svc.NumCircuits() != 0 {
+		t.Fatal("expected remaining circuits to be killed")
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := echo(c, 10); err == nil {
+		t.Fatal("expected the killed circuit to fail")
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	if err := echo(c, 100); err != nil {
+		t.Fatal(err)
+	}
+	infos := n.svc.Circuits()
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 circuit, got %d", len(infos))
+	}
+	ci := infos[0]
+	if ci.Src != n.src.ID() || ci.Dst != n.dst.ID() || ci.Reservation {
+		t.Fatalf("unexpected circuit %+v", ci)
+	}
+	if ci.SrcToDst != 100 || ci.DstToSrc != 100 {
+		t.Fatalf("expected 100 bytes each way, got %d/%d", ci.SrcToDst, ci.DstToSrc)
+	}
+
+	_, err := n.srcRelay.DialPeer(ctx, pstore.PeerInfo{ID: n.relay.ID()}, pstore.PeerInfo{ID: n.relay.ID()})
+	expectRefused(t, err, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF)
+
+	c.Close()
+	waitCircuits(t, n.svc, 0)
+	st := n.svc.Stats()
+	if st.Accepted != 1 || st.Circuits != 0 || st.Reservations != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if st.SrcToDst != 100 || st.DstToSrc != 100 {
+		t.Fatalf("expected the closed circuit's bytes in the totals, got %d/%d", st.SrcToDst, st.DstToSrc)
+	}
+	if st.Rejected["hop_cant_relay_to_self"] != 1 {
+		t.Fatalf("expected one hop_cant_relay_to_self rejection, got %v", st.Rejected)
+	}
+}
+
+func TestRejectReasons(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{Limits: Limits{MaxCircuitsPerPeer: 1}})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	_, err := n.dial(ctx)
+	expectRefused(t, err, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+	if r := n.svc.Stats().Rejected; r["max_circuits_per_peer"] != 1 {
+		t.Fatalf("expected one max_circuits_per_peer rejection, got %v", r)
+	}
+
+	n.svc.Close()
+	n.svc = New(n.relay, Config{ACL: ACL{DenySrc: []peer.ID{n.src.ID()}}})
+	_, err = n.dial(ctx)
+	expectRefused(t, err, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+	if r := n.svc.Stats().Rejected; r["src_denied"] != 1 {
+		t.Fatalf("expected one src_denied rejection, got %v", r)
+	}
+}
+
+func TestKill(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := makeNet(t, ctx, Config{})
+	defer n.close()
+
+	c := n.dialOrFatal(t, ctx)
+	defer c.Close()
+	waitCircuits(t, n.svc, 1)
+
+	id := n.svc.Circuits()[0].ID
+	if err := n.svc.Kill(id + 1); err != ErrNoCircuit {
+		t.Fatalf("expected %v, got %v", ErrNoCircuit, err)
+	}
+	if err := n.svc.Kill(id); err != nil {
+		t.Fatal(err)
+	}
+	waitCircuits(t, n.svc, 0)
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := echo(c, 10); err == nil {
+		t.Fatal("expected the killed circuit to fail")
+	}
+}
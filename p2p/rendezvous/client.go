@@ -0,0 +1,229 @@
+package rendezvous
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/czh0526/libp2p/p2p/rendezvous/pb"
+	ggio "github.com/gogo/protobuf/io"
+	disc "github.com/libp2p/go-libp2p-discovery"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+// Error 是服务器拒绝请求时返回的错误
+type Error struct {
+	Status pb.Message_ResponseStatus
+	Text   string
+}
+
+func (e *Error) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("rendezvous: %s", e.Status)
+	}
+	return fmt.Sprintf("rendezvous: %s: %s", e.Status, e.Text)
+}
+
+// Registration 是 DISCOVER 返回的一个注册，记录的签名已经验证过
+type Registration struct {
+	Namespace string
+	Peer      pstore.PeerInfo
+	// 注册剩余的有效时间
+	TTL time.Duration
+}
+
+// Client 在一个 rendezvous 服务器上注册和发现节点
+type Client struct {
+	host   host.Host
+	server peer.ID
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+var _ disc.Discovery = (*Client)(nil)
+
+// NewClient 创建使用 server 的 Client，server 的地址需要在 peerstore 中
+func NewClient(h host.Host, server peer.ID) *Client {
+	return &Client{host: h, server: server}
+}
+
+// nextSeq 返回递增的记录序号，使用时间保证重启之后的记录仍然更新
+func (c *Client) nextSeq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq := uint64(time.Now().UnixNano())
+	if seq <= c.seq {
+		seq = c.seq + 1
+	}
+	c.seq = seq
+	return seq
+}
+
+// roundTrip 在新的 stream 上发送 req，resp 为 nil 时不等待回应
+func (c *Client) roundTrip(ctx context.Context, req, resp *pb.Message) error {
+	s, err := c.host.NewStream(ctx, c.server, Proto)
+	if err != nil {
+		return err
+	}
+	defer inet.FullClose(s)
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(req); err != nil {
+		s.Reset()
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	if err := ggio.NewDelimitedReader(s, maxMessageSize).ReadMsg(resp); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
+
+// Register 用本节点当前的地址在 ns 中注册，ttl 为 0 时使用服务器的默认值，返回服务器接受的 TTL
+func (c *Client) Register(ctx context.Context, ns string, ttl time.Duration) (time.Duration, error) {
+	sk := c.host.Peerstore().PrivKey(c.host.ID())
+	if sk == nil {
+		return 0, fmt.Errorf("rendezvous: no private key for %s", c.host.ID().Pretty())
+	}
+	rec, err := signRecord(sk, c.host.ID(), c.host.Addrs(), c.nextSeq())
+	if err != nil {
+		return 0, err
+	}
+
+	req := &pb.Message{
+		Type: pb.Message_REGISTER,
+		Register: &pb.Message_Register{
+			Ns:   ns,
+			Peer: rec,
+			Ttl:  int64(ttl / time.Second),
+		},
+	}
+	var resp pb.Message
+	if err := c.roundTrip(ctx, req, &resp); err != nil {
+		return 0, err
+	}
+	r := resp.GetRegisterResponse()
+	if r == nil {
+		return 0, fmt.Errorf("rendezvous: unexpected response %s", resp.GetType())
+	}
+	if r.Status != pb.Message_OK {
+		return 0, &Error{r.Status, r.StatusText}
+	}
+	return time.Duration(r.Ttl) * time.Second, nil
+}
+
+// Unregister 取消本节点在 ns 中的注册
+func (c *Client) Unregister(ctx context.Context, ns string) error {
+	return c.roundTrip(ctx, &pb.Message{
+		Type: pb.Message_UNREGISTER,
+		Unregister: &pb.Message_Unregister{
+			Ns: ns,
+			Id: []byte(c.host.ID()),
+		},
+	}, nil)
+}
+
+// Discover 返回 ns 中 cookie 之后最多 limit 个注册，以及下一次使用的 cookie。
+// ns 为空时返回所有的 namespace，limit 为 0 时使用服务器的上限。
+// 签名不对的记录和其它 namespace 的注册被丢弃
+func (c *Client) Discover(ctx context.Context, ns string, limit int, cookie []byte) ([]Registration, []byte, error) {
+	req := &pb.Message{
+		Type: pb.Message_DISCOVER,
+		Discover: &pb.Message_Discover{
+			Ns:     ns,
+			Limit:  int64(limit),
+			Cookie: cookie,
+		},
+	}
+	var resp pb.Message
+	if err := c.roundTrip(ctx, req, &resp); err != nil {
+		return nil, nil, err
+	}
+	r := resp.GetDiscoverResponse()
+	if r == nil {
+		return nil, nil, fmt.Errorf("rendezvous: unexpected response %s", resp.GetType())
+	}
+	if r.Status != pb.Message_OK {
+		return nil, nil, &Error{r.Status, r.StatusText}
+	}
+
+	var regs []Registration
+	for _, reg := range r.Registrations {
+		if ns != "" && reg.GetNs() != ns {
+			continue
+		}
+		pi, err := verifyRecord(reg.GetPeer())
+		if err != nil {
+			continue
+		}
+		regs = append(regs, Registration{
+			Namespace: reg.Ns,
+			Peer:      pi,
+			TTL:       time.Duration(reg.Ttl) * time.Second,
+		})
+	}
+	return regs, r.Cookie, nil
+}
+
+// Advertise 实现 disc.Advertiser，disc.TTL 指定注册的时间
+func (c *Client) Advertise(ctx context.Context, ns string, opts ...disc.Option) (time.Duration, error) {
+	var options disc.Options
+	if err := options.Apply(opts...); err != nil {
+		return 0, err
+	}
+	return c.Register(ctx, ns, options.Ttl)
+}
+
+// FindPeers 实现 disc.Discoverer，分页取出 ns 中所有的注册，disc.Limit 限制总数
+func (c *Client) FindPeers(ctx context.Context, ns string, opts ...disc.Option) (<-chan pstore.PeerInfo, error) {
+	var options disc.Options
+	if err := options.Apply(opts...); err != nil {
+		return nil, err
+	}
+
+	// 先取第一页，服务器的错误直接返回
+	regs, cookie, err := c.Discover(ctx, ns, options.Limit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(ch)
+		sent := 0
+		for {
+			for _, reg := range regs {
+				select {
+				case ch <- reg.Peer:
+				case <-ctx.Done():
+					return
+				}
+				if sent++; options.Limit > 0 && sent >= options.Limit {
+					return
+				}
+			}
+
+			// cookie 不再变化时已经取完
+			limit := 0
+			if options.Limit > 0 {
+				limit = options.Limit - sent
+			}
+			prev := cookie
+			if regs, cookie, err = c.Discover(ctx, ns, limit, cookie); err != nil || bytes.Equal(cookie, prev) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,574 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: rendezvous.proto
+
+package rendezvous_pb
+
+import (
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
+
+type Message_MessageType int32
+
+const (
+	Message_REGISTER          Message_MessageType = 0
+	Message_REGISTER_RESPONSE Message_MessageType = 1
+	Message_UNREGISTER        Message_MessageType = 2
+	Message_DISCOVER          Message_MessageType = 3
+	Message_DISCOVER_RESPONSE Message_MessageType = 4
+)
+
+var Message_MessageType_name = map[int32]string{
+	0: "REGISTER",
+	1: "REGISTER_RESPONSE",
+	2: "UNREGISTER",
+	3: "DISCOVER",
+	4: "DISCOVER_RESPONSE",
+}
+
+var Message_MessageType_value = map[string]int32{
+	"REGISTER":          0,
+	"REGISTER_RESPONSE": 1,
+	"UNREGISTER":        2,
+	"DISCOVER":          3,
+	"DISCOVER_RESPONSE": 4,
+}
+
+func (x Message_MessageType) String() string {
+	return proto.EnumName(Message_MessageType_name, int32(x))
+}
+
+func (Message_MessageType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 0}
+}
+
+type Message_ResponseStatus int32
+
+const (
+	Message_OK                  Message_ResponseStatus = 0
+	Message_E_INVALID_NAMESPACE Message_ResponseStatus = 100
+	Message_E_INVALID_PEER_INFO Message_ResponseStatus = 101
+	Message_E_INVALID_TTL       Message_ResponseStatus = 102
+	Message_E_INVALID_COOKIE    Message_ResponseStatus = 103
+	Message_E_NOT_AUTHORIZED    Message_ResponseStatus = 200
+	Message_E_INTERNAL_ERROR    Message_ResponseStatus = 300
+	Message_E_UNAVAILABLE       Message_ResponseStatus = 400
+)
+
+var Message_ResponseStatus_name = map[int32]string{
+	0:   "OK",
+	100: "E_INVALID_NAMESPACE",
+	101: "E_INVALID_PEER_INFO",
+	102: "E_INVALID_TTL",
+	103: "E_INVALID_COOKIE",
+	200: "E_NOT_AUTHORIZED",
+	300: "E_INTERNAL_ERROR",
+	400: "E_UNAVAILABLE",
+}
+
+var Message_ResponseStatus_value = map[string]int32{
+	"OK":                  0,
+	"E_INVALID_NAMESPACE": 100,
+	"E_INVALID_PEER_INFO": 101,
+	"E_INVALID_TTL":       102,
+	"E_INVALID_COOKIE":    103,
+	"E_NOT_AUTHORIZED":    200,
+	"E_INTERNAL_ERROR":    300,
+	"E_UNAVAILABLE":       400,
+}
+
+func (x Message_ResponseStatus) String() string {
+	return proto.EnumName(Message_ResponseStatus_name, int32(x))
+}
+
+func (Message_ResponseStatus) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 1}
+}
+
+type Message struct {
+	Type                 Message_MessageType       `protobuf:"varint,1,opt,name=type,proto3,enum=rendezvous.pb.Message_MessageType" json:"type,omitempty"`
+	Register             *Message_Register         `protobuf:"bytes,2,opt,name=register,proto3" json:"register,omitempty"`
+	RegisterResponse     *Message_RegisterResponse `protobuf:"bytes,3,opt,name=registerResponse,proto3" json:"registerResponse,omitempty"`
+	Unregister           *Message_Unregister       `protobuf:"bytes,4,opt,name=unregister,proto3" json:"unregister,omitempty"`
+	Discover             *Message_Discover         `protobuf:"bytes,5,opt,name=discover,proto3" json:"discover,omitempty"`
+	DiscoverResponse     *Message_DiscoverResponse `protobuf:"bytes,6,opt,name=discoverResponse,proto3" json:"discoverResponse,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+func (*Message) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0}
+}
+func (m *Message) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message.Unmarshal(m, b)
+}
+func (m *Message) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message.Marshal(b, m, deterministic)
+}
+func (m *Message) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message.Merge(m, src)
+}
+func (m *Message) XXX_Size() int {
+	return xxx_messageInfo_Message.Size(m)
+}
+func (m *Message) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message proto.InternalMessageInfo
+
+func (m *Message) GetType() Message_MessageType {
+	if m != nil {
+		return m.Type
+	}
+	return Message_REGISTER
+}
+
+func (m *Message) GetRegister() *Message_Register {
+	if m != nil {
+		return m.Register
+	}
+	return nil
+}
+
+func (m *Message) GetRegisterResponse() *Message_RegisterResponse {
+	if m != nil {
+		return m.RegisterResponse
+	}
+	return nil
+}
+
+func (m *Message) GetUnregister() *Message_Unregister {
+	if m != nil {
+		return m.Unregister
+	}
+	return nil
+}
+
+func (m *Message) GetDiscover() *Message_Discover {
+	if m != nil {
+		return m.Discover
+	}
+	return nil
+}
+
+func (m *Message) GetDiscoverResponse() *Message_DiscoverResponse {
+	if m != nil {
+		return m.DiscoverResponse
+	}
+	return nil
+}
+
+type Message_PeerRecord struct {
+	Id                   []byte   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Addrs                [][]byte `protobuf:"bytes,2,rep,name=addrs,proto3" json:"addrs,omitempty"`
+	Seq                  uint64   `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	PubKey               []byte   `protobuf:"bytes,4,opt,name=pubKey,proto3" json:"pubKey,omitempty"`
+	Signature            []byte   `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message_PeerRecord) Reset()         { *m = Message_PeerRecord{} }
+func (m *Message_PeerRecord) String() string { return proto.CompactTextString(m) }
+func (*Message_PeerRecord) ProtoMessage()    {}
+func (*Message_PeerRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 0}
+}
+func (m *Message_PeerRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_PeerRecord.Unmarshal(m, b)
+}
+func (m *Message_PeerRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_PeerRecord.Marshal(b, m, deterministic)
+}
+func (m *Message_PeerRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_PeerRecord.Merge(m, src)
+}
+func (m *Message_PeerRecord) XXX_Size() int {
+	return xxx_messageInfo_Message_PeerRecord.Size(m)
+}
+func (m *Message_PeerRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_PeerRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_PeerRecord proto.InternalMessageInfo
+
+func (m *Message_PeerRecord) GetId() []byte {
+	if m != nil {
+		return m.Id
+	}
+	return nil
+}
+
+func (m *Message_PeerRecord) GetAddrs() [][]byte {
+	if m != nil {
+		return m.Addrs
+	}
+	return nil
+}
+
+func (m *Message_PeerRecord) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *Message_PeerRecord) GetPubKey() []byte {
+	if m != nil {
+		return m.PubKey
+	}
+	return nil
+}
+
+func (m *Message_PeerRecord) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+type Message_Register struct {
+	Ns                   string              `protobuf:"bytes,1,opt,name=ns,proto3" json:"ns,omitempty"`
+	Peer                 *Message_PeerRecord `protobuf:"bytes,2,opt,name=peer,proto3" json:"peer,omitempty"`
+	Ttl                  int64               `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *Message_Register) Reset()         { *m = Message_Register{} }
+func (m *Message_Register) String() string { return proto.CompactTextString(m) }
+func (*Message_Register) ProtoMessage()    {}
+func (*Message_Register) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 1}
+}
+func (m *Message_Register) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_Register.Unmarshal(m, b)
+}
+func (m *Message_Register) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_Register.Marshal(b, m, deterministic)
+}
+func (m *Message_Register) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_Register.Merge(m, src)
+}
+func (m *Message_Register) XXX_Size() int {
+	return xxx_messageInfo_Message_Register.Size(m)
+}
+func (m *Message_Register) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_Register.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_Register proto.InternalMessageInfo
+
+func (m *Message_Register) GetNs() string {
+	if m != nil {
+		return m.Ns
+	}
+	return ""
+}
+
+func (m *Message_Register) GetPeer() *Message_PeerRecord {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *Message_Register) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+type Message_RegisterResponse struct {
+	Status               Message_ResponseStatus `protobuf:"varint,1,opt,name=status,proto3,enum=rendezvous.pb.Message_ResponseStatus" json:"status,omitempty"`
+	StatusText           string                 `protobuf:"bytes,2,opt,name=statusText,proto3" json:"statusText,omitempty"`
+	Ttl                  int64                  `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *Message_RegisterResponse) Reset()         { *m = Message_RegisterResponse{} }
+func (m *Message_RegisterResponse) String() string { return proto.CompactTextString(m) }
+func (*Message_RegisterResponse) ProtoMessage()    {}
+func (*Message_RegisterResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 2}
+}
+func (m *Message_RegisterResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_RegisterResponse.Unmarshal(m, b)
+}
+func (m *Message_RegisterResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_RegisterResponse.Marshal(b, m, deterministic)
+}
+func (m *Message_RegisterResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_RegisterResponse.Merge(m, src)
+}
+func (m *Message_RegisterResponse) XXX_Size() int {
+	return xxx_messageInfo_Message_RegisterResponse.Size(m)
+}
+func (m *Message_RegisterResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_RegisterResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_RegisterResponse proto.InternalMessageInfo
+
+func (m *Message_RegisterResponse) GetStatus() Message_ResponseStatus {
+	if m != nil {
+		return m.Status
+	}
+	return Message_OK
+}
+
+func (m *Message_RegisterResponse) GetStatusText() string {
+	if m != nil {
+		return m.StatusText
+	}
+	return ""
+}
+
+func (m *Message_RegisterResponse) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+type Message_Unregister struct {
+	Ns                   string   `protobuf:"bytes,1,opt,name=ns,proto3" json:"ns,omitempty"`
+	Id                   []byte   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message_Unregister) Reset()         { *m = Message_Unregister{} }
+func (m *Message_Unregister) String() string { return proto.CompactTextString(m) }
+func (*Message_Unregister) ProtoMessage()    {}
+func (*Message_Unregister) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 3}
+}
+func (m *Message_Unregister) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_Unregister.Unmarshal(m, b)
+}
+func (m *Message_Unregister) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_Unregister.Marshal(b, m, deterministic)
+}
+func (m *Message_Unregister) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_Unregister.Merge(m, src)
+}
+func (m *Message_Unregister) XXX_Size() int {
+	return xxx_messageInfo_Message_Unregister.Size(m)
+}
+func (m *Message_Unregister) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_Unregister.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_Unregister proto.InternalMessageInfo
+
+func (m *Message_Unregister) GetNs() string {
+	if m != nil {
+		return m.Ns
+	}
+	return ""
+}
+
+func (m *Message_Unregister) GetId() []byte {
+	if m != nil {
+		return m.Id
+	}
+	return nil
+}
+
+type Message_Discover struct {
+	Ns                   string   `protobuf:"bytes,1,opt,name=ns,proto3" json:"ns,omitempty"`
+	Limit                int64    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cookie               []byte   `protobuf:"bytes,3,opt,name=cookie,proto3" json:"cookie,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message_Discover) Reset()         { *m = Message_Discover{} }
+func (m *Message_Discover) String() string { return proto.CompactTextString(m) }
+func (*Message_Discover) ProtoMessage()    {}
+func (*Message_Discover) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 4}
+}
+func (m *Message_Discover) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_Discover.Unmarshal(m, b)
+}
+func (m *Message_Discover) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_Discover.Marshal(b, m, deterministic)
+}
+func (m *Message_Discover) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_Discover.Merge(m, src)
+}
+func (m *Message_Discover) XXX_Size() int {
+	return xxx_messageInfo_Message_Discover.Size(m)
+}
+func (m *Message_Discover) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_Discover.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_Discover proto.InternalMessageInfo
+
+func (m *Message_Discover) GetNs() string {
+	if m != nil {
+		return m.Ns
+	}
+	return ""
+}
+
+func (m *Message_Discover) GetLimit() int64 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *Message_Discover) GetCookie() []byte {
+	if m != nil {
+		return m.Cookie
+	}
+	return nil
+}
+
+type Message_DiscoverResponse struct {
+	Registrations        []*Message_Register    `protobuf:"bytes,1,rep,name=registrations,proto3" json:"registrations,omitempty"`
+	Cookie               []byte                 `protobuf:"bytes,2,opt,name=cookie,proto3" json:"cookie,omitempty"`
+	Status               Message_ResponseStatus `protobuf:"varint,3,opt,name=status,proto3,enum=rendezvous.pb.Message_ResponseStatus" json:"status,omitempty"`
+	StatusText           string                 `protobuf:"bytes,4,opt,name=statusText,proto3" json:"statusText,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *Message_DiscoverResponse) Reset()         { *m = Message_DiscoverResponse{} }
+func (m *Message_DiscoverResponse) String() string { return proto.CompactTextString(m) }
+func (*Message_DiscoverResponse) ProtoMessage()    {}
+func (*Message_DiscoverResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ef0a1d5737df1c36, []int{0, 5}
+}
+func (m *Message_DiscoverResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message_DiscoverResponse.Unmarshal(m, b)
+}
+func (m *Message_DiscoverResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message_DiscoverResponse.Marshal(b, m, deterministic)
+}
+func (m *Message_DiscoverResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message_DiscoverResponse.Merge(m, src)
+}
+func (m *Message_DiscoverResponse) XXX_Size() int {
+	return xxx_messageInfo_Message_DiscoverResponse.Size(m)
+}
+func (m *Message_DiscoverResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message_DiscoverResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message_DiscoverResponse proto.InternalMessageInfo
+
+func (m *Message_DiscoverResponse) GetRegistrations() []*Message_Register {
+	if m != nil {
+		return m.Registrations
+	}
+	return nil
+}
+
+func (m *Message_DiscoverResponse) GetCookie() []byte {
+	if m != nil {
+		return m.Cookie
+	}
+	return nil
+}
+
+func (m *Message_DiscoverResponse) GetStatus() Message_ResponseStatus {
+	if m != nil {
+		return m.Status
+	}
+	return Message_OK
+}
+
+func (m *Message_DiscoverResponse) GetStatusText() string {
+	if m != nil {
+		return m.StatusText
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("rendezvous.pb.Message_MessageType", Message_MessageType_name, Message_MessageType_value)
+	proto.RegisterEnum("rendezvous.pb.Message_ResponseStatus", Message_ResponseStatus_name, Message_ResponseStatus_value)
+	proto.RegisterType((*Message)(nil), "rendezvous.pb.Message")
+	proto.RegisterType((*Message_PeerRecord)(nil), "rendezvous.pb.Message.PeerRecord")
+	proto.RegisterType((*Message_Register)(nil), "rendezvous.pb.Message.Register")
+	proto.RegisterType((*Message_RegisterResponse)(nil), "rendezvous.pb.Message.RegisterResponse")
+	proto.RegisterType((*Message_Unregister)(nil), "rendezvous.pb.Message.Unregister")
+	proto.RegisterType((*Message_Discover)(nil), "rendezvous.pb.Message.Discover")
+	proto.RegisterType((*Message_DiscoverResponse)(nil), "rendezvous.pb.Message.DiscoverResponse")
+}
+
+func init() { proto.RegisterFile("rendezvous.proto", fileDescriptor_ef0a1d5737df1c36) }
+
+var fileDescriptor_ef0a1d5737df1c36 = []byte{
+	// 630 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x54, 0xcf, 0x6e, 0xd3, 0x4e,
+	0x10, 0xae, 0xed, 0x34, 0xbf, 0x74, 0x9a, 0x46, 0xdb, 0xfd, 0xb5, 0x10, 0x45, 0x08, 0x4a, 0x24,
+	0x44, 0x0f, 0xa8, 0x87, 0x22, 0xb8, 0x20, 0x0e, 0xa6, 0x59, 0xa8, 0xd5, 0xd4, 0x8e, 0xc6, 0x4e,
+	0x0f, 0x5c, 0xa2, 0x34, 0x5e, 0x22, 0x8b, 0x12, 0x07, 0xaf, 0x53, 0x91, 0x5e, 0x79, 0x01, 0x1e,
+	0x84, 0x2b, 0xef, 0xc0, 0x91, 0xf7, 0xe1, 0x82, 0x76, 0xfd, 0x37, 0x09, 0x29, 0x48, 0x9c, 0x32,
+	0x33, 0xfe, 0xbe, 0xf9, 0xf3, 0xcd, 0x64, 0x81, 0x44, 0x7c, 0xe2, 0xf3, 0x9b, 0xeb, 0x70, 0x26,
+	0x8e, 0xa6, 0x51, 0x18, 0x87, 0x74, 0xa7, 0x1c, 0xb9, 0x6c, 0xff, 0x04, 0xf8, 0xef, 0x9c, 0x0b,
+	0x31, 0x1c, 0x73, 0xfa, 0x1c, 0x2a, 0xf1, 0x7c, 0xca, 0x9b, 0xda, 0x81, 0x76, 0xd8, 0x38, 0x6e,
+	0x1f, 0x2d, 0x20, 0x8f, 0x52, 0x54, 0xf6, 0xeb, 0xcd, 0xa7, 0x1c, 0x15, 0x9e, 0xbe, 0x80, 0x5a,
+	0xc4, 0xc7, 0x81, 0x88, 0x79, 0xd4, 0xd4, 0x0f, 0xb4, 0xc3, 0xed, 0xe3, 0x07, 0x6b, 0xb8, 0x98,
+	0xc2, 0x30, 0x27, 0x50, 0x17, 0x48, 0x66, 0x23, 0x17, 0xd3, 0x70, 0x22, 0x78, 0xd3, 0x50, 0x49,
+	0x1e, 0xff, 0x29, 0x49, 0x0a, 0xc7, 0x95, 0x04, 0xd4, 0x04, 0x98, 0x4d, 0xf2, 0x9e, 0x2a, 0x2a,
+	0xdd, 0xc3, 0x35, 0xe9, 0xfa, 0x39, 0x10, 0x4b, 0x24, 0x39, 0x94, 0x1f, 0x88, 0x51, 0x78, 0xcd,
+	0xa3, 0xe6, 0xe6, 0xad, 0x43, 0x75, 0x52, 0x18, 0xe6, 0x04, 0x39, 0x54, 0x66, 0xe7, 0x43, 0x55,
+	0x6f, 0x1d, 0xaa, 0xb3, 0x04, 0xc7, 0x95, 0x04, 0xad, 0x1b, 0x80, 0x1e, 0x97, 0xfe, 0x28, 0x8c,
+	0x7c, 0xda, 0x00, 0x3d, 0xf0, 0xd5, 0xaa, 0xea, 0xa8, 0x07, 0x3e, 0xdd, 0x83, 0xcd, 0xa1, 0xef,
+	0x47, 0xa2, 0xa9, 0x1f, 0x18, 0x87, 0x75, 0x4c, 0x1c, 0x4a, 0xc0, 0x10, 0xfc, 0xa3, 0x12, 0xb4,
+	0x82, 0xd2, 0xa4, 0x77, 0xa0, 0x3a, 0x9d, 0x5d, 0x9e, 0xf1, 0xb9, 0x92, 0xa5, 0x8e, 0xa9, 0x47,
+	0xef, 0xc1, 0x96, 0x08, 0xc6, 0x93, 0x61, 0x3c, 0x8b, 0xb8, 0x1a, 0xb8, 0x8e, 0x45, 0xa0, 0x35,
+	0x82, 0x5a, 0x26, 0xbb, 0xac, 0x3c, 0x11, 0xaa, 0xf2, 0x16, 0xea, 0x13, 0x41, 0x9f, 0x41, 0x65,
+	0xca, 0xf3, 0xd5, 0xaf, 0x93, 0xb9, 0x68, 0x1d, 0x15, 0x5c, 0xb6, 0x16, 0xc7, 0x57, 0xaa, 0x35,
+	0x03, 0xa5, 0xd9, 0xfa, 0xac, 0x01, 0x59, 0x5e, 0x2e, 0x7d, 0x09, 0x55, 0x11, 0x0f, 0xe3, 0x99,
+	0x48, 0xcf, 0xf2, 0xd1, 0xda, 0xab, 0x48, 0x08, 0xae, 0x02, 0x63, 0x4a, 0xa2, 0xf7, 0x01, 0x12,
+	0xcb, 0xe3, 0x9f, 0x62, 0xd5, 0xe2, 0x16, 0x96, 0x22, 0xbf, 0xe9, 0xe2, 0x09, 0x40, 0x71, 0x12,
+	0x2b, 0xc3, 0x26, 0xb2, 0xeb, 0x99, 0xec, 0xad, 0x53, 0xa8, 0x65, 0xab, 0x5b, 0xc1, 0xee, 0xc1,
+	0xe6, 0x55, 0xf0, 0x21, 0x48, 0xca, 0x1a, 0x98, 0x38, 0x72, 0x01, 0xa3, 0x30, 0x7c, 0x1f, 0x24,
+	0x67, 0x5e, 0xc7, 0xd4, 0x6b, 0xfd, 0xd0, 0x80, 0x2c, 0x5f, 0x01, 0x65, 0xb0, 0x93, 0xb4, 0x12,
+	0x0d, 0xe3, 0x20, 0x54, 0xd9, 0x8d, 0xbf, 0xf9, 0x7f, 0x2d, 0xb2, 0x4a, 0x35, 0xf5, 0x72, 0xcd,
+	0x92, 0xb8, 0xc6, 0xbf, 0x8b, 0x5b, 0x59, 0x16, 0xb7, 0x3d, 0x86, 0xed, 0xd2, 0x6b, 0x41, 0xeb,
+	0x50, 0x43, 0xf6, 0xc6, 0x72, 0x3d, 0x86, 0x64, 0x83, 0xee, 0xc3, 0x6e, 0xe6, 0x0d, 0x90, 0xb9,
+	0x3d, 0xc7, 0x76, 0x19, 0xd1, 0x68, 0x03, 0xa0, 0x6f, 0xe7, 0x30, 0x5d, 0x92, 0x3a, 0x96, 0x7b,
+	0xe2, 0x5c, 0x30, 0x24, 0x86, 0x24, 0x65, 0x5e, 0x41, 0xaa, 0xb4, 0xbf, 0x69, 0xd0, 0x58, 0xec,
+	0x91, 0x56, 0x41, 0x77, 0xce, 0xc8, 0x06, 0xbd, 0x0b, 0xff, 0xb3, 0x81, 0x65, 0x5f, 0x98, 0x5d,
+	0xab, 0x33, 0xb0, 0xcd, 0x73, 0xe6, 0xf6, 0xcc, 0x13, 0x46, 0xfc, 0xc5, 0x0f, 0x3d, 0xc6, 0x70,
+	0x60, 0xd9, 0xaf, 0x1d, 0xc2, 0xe9, 0x2e, 0xec, 0x14, 0x1f, 0x3c, 0xaf, 0x4b, 0xde, 0xd1, 0x3d,
+	0x20, 0x45, 0xe8, 0xc4, 0x71, 0xce, 0x2c, 0x46, 0xc6, 0x74, 0x5f, 0x46, 0x6d, 0xc7, 0x1b, 0x98,
+	0x7d, 0xef, 0xd4, 0x41, 0xeb, 0x2d, 0xeb, 0x90, 0xef, 0x5a, 0x12, 0xb6, 0x6c, 0x8f, 0xa1, 0x6d,
+	0x76, 0x07, 0x0c, 0xd1, 0x41, 0xf2, 0x55, 0xa7, 0x54, 0xa6, 0xed, 0xdb, 0xe6, 0x85, 0x69, 0x75,
+	0xcd, 0x57, 0x5d, 0x46, 0xbe, 0x18, 0x97, 0x55, 0xf5, 0x26, 0x3f, 0xfd, 0x35, 0x00, 0x22, 0xdc,
+	0x0d, 0x7f, 0xa7, 0x05, 0x00, 0x00,
+}
@@ -0,0 +1,92 @@
+package rendezvous
+
+import (
+	"errors"
+
+	pb "github.com/czh0526/libp2p/p2p/rendezvous/pb"
+	signed "github.com/czh0526/libp2p/security/signed"
+	proto "github.com/gogo/protobuf/proto"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// 地址记录签名的域，与其它协议的签名互不通用
+const recordDomain = "/rendezvous/peer-record"
+
+var ErrPeerMismatch = errors.New("rendezvous: peer id and public key mismatch")
+
+// recordPayload 返回被签名的数据: 不带 pubKey 和 signature 的记录
+func recordPayload(rec *pb.Message_PeerRecord) ([]byte, error) {
+	return proto.Marshal(&pb.Message_PeerRecord{
+		Id:    rec.Id,
+		Addrs: rec.Addrs,
+		Seq:   rec.Seq,
+	})
+}
+
+// signRecord 用 sk 对 id 的地址签名，seq 越大的记录越新
+func signRecord(sk ci.PrivKey, id peer.ID, addrs []ma.Multiaddr, seq uint64) (*pb.Message_PeerRecord, error) {
+	pub, err := sk.GetPublic().Bytes()
+	if err != nil {
+		return nil, err
+	}
+	rec := &pb.Message_PeerRecord{
+		Id:     []byte(id),
+		Seq:    seq,
+		PubKey: pub,
+	}
+	for _, a := range addrs {
+		rec.Addrs = append(rec.Addrs, a.Bytes())
+	}
+
+	data, err := recordPayload(rec)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Signature, err = signed.Sign(sk, recordDomain, data); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// verifyRecord 检查公钥与 peer ID 是否匹配以及签名，返回记录中的节点和地址
+func verifyRecord(rec *pb.Message_PeerRecord) (pstore.PeerInfo, error) {
+	if rec == nil {
+		return pstore.PeerInfo{}, errors.New("rendezvous: missing peer record")
+	}
+	id, err := peer.IDFromBytes(rec.Id)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	key, err := ci.UnmarshalPublicKey(rec.PubKey)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	if !id.MatchesPublicKey(key) {
+		return pstore.PeerInfo{}, ErrPeerMismatch
+	}
+
+	data, err := recordPayload(rec)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	ok, err := signed.VerifySignature(key, recordDomain, data, rec.Signature)
+	if err != nil {
+		return pstore.PeerInfo{}, err
+	}
+	if !ok {
+		return pstore.PeerInfo{}, errors.New("rendezvous: bad record signature")
+	}
+
+	pi := pstore.PeerInfo{ID: id}
+	for _, b := range rec.Addrs {
+		a, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			return pstore.PeerInfo{}, err
+		}
+		pi.Addrs = append(pi.Addrs, a)
+	}
+	return pi, nil
+}
@@ -0,0 +1,395 @@
+package rendezvous
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	mocknet "github.com/czh0526/libp2p/p2p/net/mock"
+	pb "github.com/czh0526/libp2p/p2p/rendezvous/pb"
+	tu "github.com/czh0526/libp2p/testutil"
+	ggio "github.com/gogo/protobuf/io"
+	disc "github.com/libp2p/go-libp2p-discovery"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// makeNet 构建一个服务器 hosts[0] 和 n 个客户端，所有节点之间都建立了 link
+func makeNet(t *testing.T, ctx context.Context, n int, cfg Config) (*Service, []host.Host, []*Client) {
+	mn := mocknet.New(ctx)
+	hosts := make([]host.Host, n+1)
+	for i := range hosts {
+		// 地址记录需要真实的密钥，不能用 GenPeer 生成的测试密钥
+		sk, _, err := tu.RandTestKeyPair(512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, tu.RandLocalTCPAddress())
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[i] = h
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := New(hosts[0], cfg)
+	clients := make([]*Client, n)
+	for i, h := range hosts[1:] {
+		h.Peerstore().AddAddrs(hosts[0].ID(), hosts[0].Addrs(), time.Hour)
+		clients[i] = NewClient(h, hosts[0].ID())
+	}
+	return svc, hosts[1:], clients
+}
+
+func statusOf(err error) pb.Message_ResponseStatus {
+	if e, ok := err.(*Error); ok {
+		return e.Status
+	}
+	return -1
+}
+
+func TestRegisterDiscover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, hosts, clients := makeNet(t, ctx, 3, Config{})
+
+	for _, c := range clients[:2] {
+		ttl, err := c.Register(ctx, "ns", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != DefaultTTL {
+			t.Fatalf("expected %s, got %s", DefaultTTL, ttl)
+		}
+	}
+	if _, err := clients[2].Register(ctx, "other", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if st := svc.Stats(); st.Namespaces != 2 || st.Registrations != 3 || st.Peers != 3 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// 分页
+	regs, cookie, err := clients[2].Discover(ctx, "ns", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].Peer.ID != hosts[0].ID() || regs[0].Namespace != "ns" || len(regs[0].Peer.Addrs) == 0 {
+		t.Fatalf("unexpected registrations %+v", regs)
+	}
+	regs, cookie, err = clients[2].Discover(ctx, "ns", 1, cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].Peer.ID != hosts[1].ID() {
+		t.Fatalf("unexpected registrations %+v", regs)
+	}
+	if regs, _, err = clients[2].Discover(ctx, "ns", 1, cookie); err != nil || len(regs) != 0 {
+		t.Fatalf("expected no new registrations, got %+v, %v", regs, err)
+	}
+
+	// cookie 之后只返回新的注册
+	if _, err := clients[2].Register(ctx, "ns", 0); err != nil {
+		t.Fatal(err)
+	}
+	regs, _, err = clients[2].Discover(ctx, "ns", 0, cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].Peer.ID != hosts[2].ID() {
+		t.Fatalf("unexpected registrations %+v", regs)
+	}
+
+	// 空的 namespace 返回所有的注册
+	if regs, _, err = clients[0].Discover(ctx, "", 0, nil); err != nil || len(regs) != 4 {
+		t.Fatalf("expected 4 registrations, got %d, %v", len(regs), err)
+	}
+	if _, _, err = clients[0].Discover(ctx, "other", 0, cookie); statusOf(err) != pb.Message_E_INVALID_COOKIE {
+		t.Fatalf("expected E_INVALID_COOKIE, got %v", err)
+	}
+
+	if err := clients[0].Unregister(ctx, "ns"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.Stats().Registrations != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unregister not applied: %+v", svc.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, clients := makeNet(t, ctx, 4, Config{MaxDiscoverLimit: 2})
+
+	for _, c := range clients {
+		if _, err := c.Advertise(ctx, "ns", disc.TTL(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 服务器每次最多返回 2 个，FindPeers 取完所有的页
+	find := func(opts ...disc.Option) map[peer.ID]bool {
+		ch, err := clients[0].FindPeers(ctx, "ns", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[peer.ID]bool)
+		for pi := range ch {
+			found[pi.ID] = true
+		}
+		return found
+	}
+	if found := find(); len(found) != 4 {
+		t.Fatalf("expected 4 peers, got %d", len(found))
+	}
+	if found := find(disc.Limit(3)); len(found) != 3 {
+		t.Fatalf("expected 3 peers, got %d", len(found))
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, hosts, clients := makeNet(t, ctx, 2, Config{MaxTTL: time.Hour, MaxRegistrations: 2})
+	c := clients[0]
+
+	if _, err := c.Register(ctx, "", 0); statusOf(err) != pb.Message_E_INVALID_NAMESPACE {
+		t.Fatalf("expected E_INVALID_NAMESPACE, got %v", err)
+	}
+	if _, err := c.Register(ctx, "ns", 2*time.Hour); statusOf(err) != pb.Message_E_INVALID_TTL {
+		t.Fatalf("expected E_INVALID_TTL, got %v", err)
+	}
+	for _, ns := range []string{"a", "b"} {
+		if _, err := c.Register(ctx, ns, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Register(ctx, "c", 0); statusOf(err) != pb.Message_E_NOT_AUTHORIZED {
+		t.Fatalf("expected E_NOT_AUTHORIZED, got %v", err)
+	}
+	// 更新已有的注册不占用新的名额
+	if _, err := c.Register(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 为其它节点注册
+	sk := hosts[1].Peerstore().PrivKey(hosts[1].ID())
+	rec, err := signRecord(sk, hosts[1].ID(), hosts[1].Addrs(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := svc.register(hosts[0].ID(), "127.0.0.1", &pb.Message_Register{Ns: "ns", Peer: rec})
+	if resp.Status != pb.Message_E_NOT_AUTHORIZED {
+		t.Fatalf("expected E_NOT_AUTHORIZED, got %s", resp.Status)
+	}
+
+	// 旧的记录不能覆盖新的记录
+	if resp := svc.register(hosts[1].ID(), "127.0.0.1", &pb.Message_Register{Ns: "ns", Peer: rec}); resp.Status != pb.Message_OK {
+		t.Fatalf("expected OK, got %s", resp.Status)
+	}
+	if _, err := clients[1].Register(ctx, "ns", 0); err != nil {
+		t.Fatal(err)
+	}
+	if resp := svc.register(hosts[1].ID(), "127.0.0.1", &pb.Message_Register{Ns: "ns", Peer: rec}); resp.Status != pb.Message_E_INVALID_PEER_INFO {
+		t.Fatalf("expected E_INVALID_PEER_INFO, got %s", resp.Status)
+	}
+
+	// 地址太多或者记录太大
+	var addrs []ma.Multiaddr
+	for i := 0; i <= MaxAddrs; i++ {
+		addrs = append(addrs, ma.StringCast(fmt.Sprintf("/ip4/10.0.0.1/tcp/%d", 1000+i)))
+	}
+	if rec, err = signRecord(sk, hosts[1].ID(), addrs, uint64(time.Now().UnixNano())); err != nil {
+		t.Fatal(err)
+	}
+	if resp := svc.register(hosts[1].ID(), "127.0.0.1", &pb.Message_Register{Ns: "big", Peer: rec}); resp.Status != pb.Message_E_INVALID_PEER_INFO {
+		t.Fatalf("expected E_INVALID_PEER_INFO, got %s", resp.Status)
+	}
+	rec.Addrs = [][]byte{make([]byte, MaxRecordSize)}
+	if resp := svc.register(hosts[1].ID(), "127.0.0.1", &pb.Message_Register{Ns: "big", Peer: rec}); resp.Status != pb.Message_E_INVALID_PEER_INFO {
+		t.Fatalf("expected E_INVALID_PEER_INFO, got %s", resp.Status)
+	}
+}
+
+func TestMaxTotalRegistrations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, _, clients := makeNet(t, ctx, 3, Config{MaxTotalRegistrations: 3})
+
+	for _, ns := range []string{"a", "b"} {
+		if _, err := clients[0].Register(ctx, ns, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := clients[1].Register(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clients[2].Register(ctx, "a", 0); statusOf(err) != pb.Message_E_UNAVAILABLE {
+		t.Fatalf("expected E_UNAVAILABLE, got %v", err)
+	}
+	// 更新已有的注册不受限制
+	if _, err := clients[1].Register(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clients[0].Unregister(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.Stats().Registrations != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unregister not applied: %+v", svc.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := clients[2].Register(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxRegistrationsPerIP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, hosts, _ := makeNet(t, ctx, 3, Config{MaxRegistrationsPerIP: 2})
+
+	var recs []*pb.Message_PeerRecord
+	for _, h := range hosts {
+		rec, err := signRecord(h.Peerstore().PrivKey(h.ID()), h.ID(), h.Addrs(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	for i := 0; i < 2; i++ {
+		if resp := svc.register(hosts[i].ID(), "10.0.0.1", &pb.Message_Register{Ns: "ns", Peer: recs[i]}); resp.Status != pb.Message_OK {
+			t.Fatalf("expected OK, got %s", resp.Status)
+		}
+	}
+	if resp := svc.register(hosts[2].ID(), "10.0.0.1", &pb.Message_Register{Ns: "ns", Peer: recs[2]}); resp.Status != pb.Message_E_NOT_AUTHORIZED {
+		t.Fatalf("expected E_NOT_AUTHORIZED, got %s", resp.Status)
+	}
+	// 其它 IP 不受影响
+	if resp := svc.register(hosts[2].ID(), "10.0.0.2", &pb.Message_Register{Ns: "ns", Peer: recs[2]}); resp.Status != pb.Message_OK {
+		t.Fatalf("expected OK, got %s", resp.Status)
+	}
+}
+
+func TestPressureTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, clients := makeNet(t, ctx, 2, Config{MaxTotalRegistrations: 4, PressureTTL: time.Minute})
+
+	for _, ns := range []string{"a", "b"} {
+		ttl, err := clients[0].Register(ctx, ns, 3*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != 3*time.Hour {
+			t.Fatalf("expected 3h, got %s", ttl)
+		}
+	}
+	// 已经用了一半的名额，新的注册只保留 PressureTTL
+	ttl, err := clients[1].Register(ctx, "a", 3*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("expected 1m, got %s", ttl)
+	}
+}
+
+func TestDiscoverNamespaceMismatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, hosts, clients := makeNet(t, ctx, 2, Config{})
+
+	if _, err := clients[0].Register(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clients[1].Register(ctx, "b", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务器不管请求的 namespace，返回所有的注册
+	server := svc.host
+	server.SetStreamHandler(Proto, func(s inet.Stream) {
+		defer inet.FullClose(s)
+		var req pb.Message
+		if err := ggio.NewDelimitedReader(s, maxRequestSize).ReadMsg(&req); err != nil {
+			return
+		}
+		ggio.NewDelimitedWriter(s).WriteMsg(&pb.Message{
+			Type:             pb.Message_DISCOVER_RESPONSE,
+			DiscoverResponse: svc.discover(&pb.Message_Discover{}),
+		})
+	})
+
+	regs, _, err := clients[0].Discover(ctx, "a", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regs) != 1 || regs[0].Namespace != "a" || regs[0].Peer.ID != hosts[0].ID() {
+		t.Fatalf("unexpected registrations %+v", regs)
+	}
+}
+
+func TestRecordSignature(t *testing.T) {
+	id := tu.RandIdentityOrFatal(t)
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/4001")
+	rec, err := signRecord(id.PrivateKey(), id.ID(), []ma.Multiaddr{addr}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi, err := verifyRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ID != id.ID() || len(pi.Addrs) != 1 || !pi.Addrs[0].Equal(addr) {
+		t.Fatalf("unexpected peer %+v", pi)
+	}
+
+	// 修改地址之后签名失效
+	rec.Addrs[0] = ma.StringCast("/ip4/10.0.0.1/tcp/4001").Bytes()
+	if _, err := verifyRecord(rec); err == nil {
+		t.Fatal("expected a tampered record to be rejected")
+	}
+
+	// 公钥与 peer ID 不匹配
+	other := tu.RandIdentityOrFatal(t)
+	rec, err = signRecord(other.PrivateKey(), id.ID(), []ma.Multiaddr{addr}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyRecord(rec); err != ErrPeerMismatch {
+		t.Fatalf("expected %v, got %v", ErrPeerMismatch, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, _, clients := makeNet(t, ctx, 1, Config{})
+
+	if _, err := clients[0].Register(ctx, "ns", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if st := svc.Stats(); st.Registrations != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if regs, _, err := clients[0].Discover(ctx, "ns", 0, nil); err != nil || len(regs) != 0 {
+		t.Fatalf("expected the registration to expire, got %+v, %v", regs, err)
+	}
+	if st := svc.Stats(); st.Registrations != 0 || st.Peers != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
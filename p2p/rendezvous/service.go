@@ -0,0 +1,447 @@
+// rendezvous 实现一个轻量的 rendezvous 协议，不需要 DHT:
+//
+//   - 节点在一个已知的服务器上 REGISTER(ns, ttl) 自己签名的地址记录，UNREGISTER 取消注册
+//   - DISCOVER(ns, limit, cookie) 分页返回 ns 中的注册，cookie 之后只返回新的注册
+//   - 服务器只接受节点为自己注册，客户端也会验证返回的记录，服务器不能伪造地址
+//   - Client 实现 go-libp2p-discovery 的 Discovery，可以替代 RoutingDiscovery
+package rendezvous
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/czh0526/libp2p/p2p/rendezvous/pb"
+	ggio "github.com/gogo/protobuf/io"
+	proto "github.com/gogo/protobuf/proto"
+	host "github.com/libp2p/go-libp2p-host"
+	inet "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	protocol "github.com/libp2p/go-libp2p-protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const Proto = protocol.ID("/rendezvous/1.0.0")
+
+const (
+	DefaultTTL                   = 2 * time.Hour
+	DefaultMaxTTL                = 72 * time.Hour
+	DefaultMaxRegistrations      = 1000
+	DefaultMaxTotalRegistrations = 100000
+	DefaultMaxRegistrationsPerIP = 10000
+	DefaultPressureTTL           = 2 * time.Hour
+	DefaultDiscoverLimit         = 1000
+
+	MaxNamespaceLength = 255
+	// 签名的地址记录的最大长度和最多的地址数
+	MaxRecordSize = 8 << 10
+	MaxAddrs      = 64
+)
+
+// 请求只包含一个记录，回应最多 maxMessageSize，DISCOVER 的注册超过时分页返回
+const (
+	maxRequestSize = MaxRecordSize + 1<<10
+	maxMessageSize = 1 << 20
+)
+
+// 等待下一个请求的超时时间
+const streamTimeout = time.Minute
+
+// Config 是 Service 的配置，为 0 的字段使用默认值
+type Config struct {
+	// 注册的最长时间
+	MaxTTL time.Duration
+	// 一个节点最多同时注册的 namespace 数
+	MaxRegistrations int
+	// 所有节点在所有 namespace 中一共最多的注册数，peer ID 没有成本，不能只按节点限制
+	MaxTotalRegistrations int
+	// 来自同一个 IP 的节点一共最多的注册数，经过 relay 或者没有 IP 的连接算作同一个来源
+	MaxRegistrationsPerIP int
+	// 注册数超过 MaxTotalRegistrations 的一半时，新的注册最长只保留 PressureTTL
+	PressureTTL time.Duration
+	// 一次 DISCOVER 最多返回的注册数
+	MaxDiscoverLimit int
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.MaxTTL <= 0 {
+		cfg.MaxTTL = DefaultMaxTTL
+	}
+	if cfg.MaxRegistrations <= 0 {
+		cfg.MaxRegistrations = DefaultMaxRegistrations
+	}
+	if cfg.MaxTotalRegistrations <= 0 {
+		cfg.MaxTotalRegistrations = DefaultMaxTotalRegistrations
+	}
+	if cfg.MaxRegistrationsPerIP <= 0 {
+		cfg.MaxRegistrationsPerIP = DefaultMaxRegistrationsPerIP
+	}
+	if cfg.PressureTTL <= 0 {
+		cfg.PressureTTL = DefaultPressureTTL
+	}
+	if cfg.MaxDiscoverLimit <= 0 {
+		cfg.MaxDiscoverLimit = DefaultDiscoverLimit
+	}
+}
+
+type registration struct {
+	ns      string
+	id      peer.ID
+	ip      string
+	rec     *pb.Message_PeerRecord
+	expires time.Time
+	// 注册的顺序，cookie 记录已经返回过的最大值
+	order uint64
+	// 在 expiryHeap 中的位置
+	index int
+}
+
+// expiryHeap 按过期时间排列注册，过期的注册可以从堆顶依次删除
+type expiryHeap []*registration
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	reg := x.(*registration)
+	reg.index = len(*h)
+	*h = append(*h, reg)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	reg := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return reg
+}
+
+// Service 在 host 上处理 rendezvous 协议
+type Service struct {
+	host host.Host
+	cfg  Config
+
+	mu            sync.Mutex
+	registrations map[string]map[peer.ID]*registration
+	perPeer       map[peer.ID]int
+	perIP         map[string]int
+	expiry        expiryHeap
+	order         uint64
+}
+
+// Stats 是 Service 当前的注册数
+type Stats struct {
+	Namespaces    int
+	Registrations int
+	Peers         int
+}
+
+// New 创建 Service 并在 host 上处理 rendezvous 协议
+func New(h host.Host, cfg Config) *Service {
+	cfg.setDefaults()
+	svc := &Service{
+		host:          h,
+		cfg:           cfg,
+		registrations: make(map[string]map[peer.ID]*registration),
+		perPeer:       make(map[peer.ID]int),
+		perIP:         make(map[string]int),
+	}
+	h.SetStreamHandler(Proto, svc.handleStream)
+	return svc
+}
+
+func (svc *Service) Close() error {
+	svc.host.RemoveStreamHandler(Proto)
+	return nil
+}
+
+// Stats 返回没有过期的注册的统计
+func (svc *Service) Stats() Stats {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.expire(time.Now())
+
+	return Stats{
+		Namespaces:    len(svc.registrations),
+		Registrations: len(svc.expiry),
+		Peers:         len(svc.perPeer),
+	}
+}
+
+// 一个 stream 上可以依次发送多个请求
+func (svc *Service) handleStream(s inet.Stream) {
+	defer inet.FullClose(s)
+	r := ggio.NewDelimitedReader(s, maxRequestSize)
+	w := ggio.NewDelimitedWriter(s)
+	remote := s.Conn().RemotePeer()
+	ip := remoteIP(s.Conn().RemoteMultiaddr())
+
+	for {
+		s.SetReadDeadline(time.Now().Add(streamTimeout))
+		var req pb.Message
+		if err := r.ReadMsg(&req); err != nil {
+			return
+		}
+
+		var resp *pb.Message
+		switch req.GetType() {
+		case pb.Message_REGISTER:
+			resp = &pb.Message{
+				Type:             pb.Message_REGISTER_RESPONSE,
+				RegisterResponse: svc.register(remote, ip, req.GetRegister()),
+			}
+		case pb.Message_UNREGISTER:
+			// UNREGISTER 没有回应
+			svc.unregister(remote, req.GetUnregister())
+			continue
+		case pb.Message_DISCOVER:
+			resp = &pb.Message{
+				Type:             pb.Message_DISCOVER_RESPONSE,
+				DiscoverResponse: svc.discover(req.GetDiscover()),
+			}
+		default:
+			s.Reset()
+			return
+		}
+		if err := w.WriteMsg(resp); err != nil {
+			s.Reset()
+			return
+		}
+	}
+}
+
+func registerError(status pb.Message_ResponseStatus, text string) *pb.Message_RegisterResponse {
+	return &pb.Message_RegisterResponse{Status: status, StatusText: text}
+}
+
+// remoteIP 返回连接的对方 IP，经过 relay 的连接地址中没有 IP，返回空字符串
+func remoteIP(addr ma.Multiaddr) string {
+	for _, code := range []int{ma.P_IP4, ma.P_IP6} {
+		if v, err := addr.ValueForProtocol(code); err == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// register 处理来自 ip 的节点 remote 的注册
+func (svc *Service) register(remote peer.ID, ip string, req *pb.Message_Register) *pb.Message_RegisterResponse {
+	if req == nil {
+		return registerError(pb.Message_E_INVALID_PEER_INFO, "missing registration")
+	}
+	ns := req.GetNs()
+	if ns == "" || len(ns) > MaxNamespaceLength {
+		return registerError(pb.Message_E_INVALID_NAMESPACE, "bad namespace")
+	}
+	if rec := req.GetPeer(); rec != nil && (proto.Size(rec) > MaxRecordSize || len(rec.Addrs) > MaxAddrs) {
+		return registerError(pb.Message_E_INVALID_PEER_INFO, "peer record too large")
+	}
+	pi, err := verifyRecord(req.GetPeer())
+	if err != nil {
+		return registerError(pb.Message_E_INVALID_PEER_INFO, err.Error())
+	}
+	if pi.ID != remote {
+		return registerError(pb.Message_E_NOT_AUTHORIZED, "can only register yourself")
+	}
+	if len(pi.Addrs) == 0 {
+		return registerError(pb.Message_E_INVALID_PEER_INFO, "no addresses")
+	}
+	ttl := time.Duration(req.GetTtl()) * time.Second
+	if ttl == 0 {
+		ttl = DefaultTTL
+		if ttl > svc.cfg.MaxTTL {
+			ttl = svc.cfg.MaxTTL
+		}
+	}
+	if ttl < 0 || ttl > svc.cfg.MaxTTL {
+		return registerError(pb.Message_E_INVALID_TTL, fmt.Sprintf("ttl must be at most %s", svc.cfg.MaxTTL))
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	now := time.Now()
+	svc.expire(now)
+
+	// 注册数较多时缩短注册的时间，占满名额的注册更快过期
+	if len(svc.expiry) >= svc.cfg.MaxTotalRegistrations/2 && ttl > svc.cfg.PressureTTL {
+		ttl = svc.cfg.PressureTTL
+	}
+
+	svc.order++
+	if old, ok := svc.registrations[ns][remote]; ok {
+		// 更新已有的注册不受数量限制，仍然计入原来的 IP
+		if req.Peer.Seq < old.rec.Seq {
+			return registerError(pb.Message_E_INVALID_PEER_INFO, "stale peer record")
+		}
+		old.rec = req.Peer
+		old.expires = now.Add(ttl)
+		old.order = svc.order
+		heap.Fix(&svc.expiry, old.index)
+		return &pb.Message_RegisterResponse{Status: pb.Message_OK, Ttl: int64(ttl / time.Second)}
+	}
+
+	if svc.perPeer[remote] >= svc.cfg.MaxRegistrations {
+		return registerError(pb.Message_E_NOT_AUTHORIZED, "too many registrations")
+	}
+	if svc.perIP[ip] >= svc.cfg.MaxRegistrationsPerIP {
+		return registerError(pb.Message_E_NOT_AUTHORIZED, "too many registrations from this address")
+	}
+	if len(svc.expiry) >= svc.cfg.MaxTotalRegistrations {
+		return registerError(pb.Message_E_UNAVAILABLE, "too many registrations on the server")
+	}
+
+	regs, ok := svc.registrations[ns]
+	if !ok {
+		regs = make(map[peer.ID]*registration)
+		svc.registrations[ns] = regs
+	}
+	reg := &registration{
+		ns:      ns,
+		id:      remote,
+		ip:      ip,
+		rec:     req.Peer,
+		expires: now.Add(ttl),
+		order:   svc.order,
+	}
+	regs[remote] = reg
+	heap.Push(&svc.expiry, reg)
+	svc.perPeer[remote]++
+	svc.perIP[ip]++
+	return &pb.Message_RegisterResponse{Status: pb.Message_OK, Ttl: int64(ttl / time.Second)}
+}
+
+func (svc *Service) unregister(remote peer.ID, req *pb.Message_Unregister) {
+	if req == nil {
+		return
+	}
+	// 只能取消自己的注册
+	if len(req.Id) > 0 && peer.ID(req.Id) != remote {
+		return
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if reg, ok := svc.registrations[req.GetNs()][remote]; ok {
+		svc.remove(reg)
+	}
+}
+
+func discoverError(status pb.Message_ResponseStatus, text string) *pb.Message_DiscoverResponse {
+	return &pb.Message_DiscoverResponse{Status: status, StatusText: text}
+}
+
+// discover 按注册的顺序返回 cookie 之后的注册，ns 为空时返回所有的 namespace
+func (svc *Service) discover(req *pb.Message_Discover) *pb.Message_DiscoverResponse {
+	if req == nil {
+		return discoverError(pb.Message_E_INVALID_NAMESPACE, "missing request")
+	}
+	ns := req.GetNs()
+	if len(ns) > MaxNamespaceLength {
+		return discoverError(pb.Message_E_INVALID_NAMESPACE, "bad namespace")
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 || limit > svc.cfg.MaxDiscoverLimit {
+		limit = svc.cfg.MaxDiscoverLimit
+	}
+	var after uint64
+	if len(req.Cookie) > 0 {
+		var err error
+		if after, err = parseCookie(req.Cookie, ns); err != nil {
+			return discoverError(pb.Message_E_INVALID_COOKIE, err.Error())
+		}
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	now := time.Now()
+
+	var found []*registration
+	collect := func(regs map[peer.ID]*registration) {
+		for _, reg := range regs {
+			if now.After(reg.expires) {
+				svc.remove(reg)
+				continue
+			}
+			if reg.order > after {
+				found = append(found, reg)
+			}
+		}
+	}
+	if ns == "" {
+		for _, regs := range svc.registrations {
+			collect(regs)
+		}
+	} else {
+		collect(svc.registrations[ns])
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].order < found[j].order })
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	// 回应超过 maxMessageSize 时剩下的注册留给下一页
+	resp := &pb.Message_DiscoverResponse{Status: pb.Message_OK}
+	size := 0
+	for _, reg := range found {
+		r := &pb.Message_Register{
+			Ns:   reg.ns,
+			Peer: reg.rec,
+			Ttl:  int64(reg.expires.Sub(now) / time.Second),
+		}
+		if size += proto.Size(r) + 8; size > maxMessageSize-maxRequestSize {
+			break
+		}
+		resp.Registrations = append(resp.Registrations, r)
+		after = reg.order
+	}
+	resp.Cookie = makeCookie(after, ns)
+	return resp
+}
+
+// remove 删除一个注册，调用者持有 mu
+func (svc *Service) remove(reg *registration) {
+	regs := svc.registrations[reg.ns]
+	if regs[reg.id] != reg {
+		return
+	}
+	delete(regs, reg.id)
+	heap.Remove(&svc.expiry, reg.index)
+	if len(regs) == 0 {
+		delete(svc.registrations, reg.ns)
+	}
+	if svc.perPeer[reg.id]--; svc.perPeer[reg.id] <= 0 {
+		delete(svc.perPeer, reg.id)
+	}
+	if svc.perIP[reg.ip]--; svc.perIP[reg.ip] <= 0 {
+		delete(svc.perIP, reg.ip)
+	}
+}
+
+// expire 从堆顶删除过期的注册，调用者持有 mu
+func (svc *Service) expire(now time.Time) {
+	for len(svc.expiry) > 0 && now.After(svc.expiry[0].expires) {
+		svc.remove(svc.expiry[0])
+	}
+}
+
+// cookie = 8 字节的注册顺序 | namespace，只能用于同一个 namespace
+func makeCookie(order uint64, ns string) []byte {
+	cookie := make([]byte, 8, 8+len(ns))
+	binary.BigEndian.PutUint64(cookie, order)
+	return append(cookie, ns...)
+}
+
+func parseCookie(cookie []byte, ns string) (uint64, error) {
+	if len(cookie) < 8 || string(cookie[8:]) != ns {
+		return 0, errors.New("cookie does not match the namespace")
+	}
+	return binary.BigEndian.Uint64(cookie), nil
+}
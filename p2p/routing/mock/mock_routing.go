@@ -0,0 +1,254 @@
+// mockrouting 是测试用的内存路由，所有节点共用一个 Server:
+//
+//   - Client 实现 routing.IpfsRouting（ContentRouting、PeerRouting 和 ValueStore）
+//   - 可以设置每次请求的延迟，给某种请求注入错误
+//   - provider 记录在 ProviderTTL 之后过期
+//   - 按请求的类型计数，测试可以检查查询了多少次
+package test_mockrouting
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-host"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	routing "github.com/libp2p/go-libp2p-routing"
+	ropts "github.com/libp2p/go-libp2p-routing/options"
+)
+
+// Op 是请求的类型，用于注入错误和计数
+type Op string
+
+const (
+	OpProvide       Op = "provide"
+	OpFindProviders Op = "find_providers"
+	OpFindPeer      Op = "find_peer"
+	OpPutValue      Op = "put_value"
+	OpGetValue      Op = "get_value"
+	OpSearchValue   Op = "search_value"
+)
+
+// 与 DHT 的 provider 记录的有效时间相同
+const DefaultProviderTTL = 24 * time.Hour
+
+type provider struct {
+	pstore.PeerInfo
+	expires time.Time
+}
+
+// Server 是共用的路由表
+type Server struct {
+	mu          sync.Mutex
+	latency     time.Duration
+	providerTTL time.Duration
+	errs        map[Op]error
+	queries     map[Op]int
+
+	providers map[string]map[peer.ID]provider
+	hosts     map[peer.ID]host.Host
+	values    map[string][]byte
+}
+
+func NewServer() *Server {
+	return &Server{
+		providerTTL: DefaultProviderTTL,
+		errs:        make(map[Op]error),
+		queries:     make(map[Op]int),
+		providers:   make(map[string]map[peer.ID]provider),
+		hosts:       make(map[peer.ID]host.Host),
+		values:      make(map[string][]byte),
+	}
+}
+
+// SetLatency 设置每个请求在返回之前等待的时间
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetProviderTTL 设置之后的 Provide 产生的记录的有效时间
+func (s *Server) SetProviderTTL(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providerTTL = d
+}
+
+// Fail 让 op 类型的请求返回 err，err 为 nil 时恢复正常。
+// FindProvidersAsync 不能返回错误，失败时返回已经关闭的 channel
+func (s *Server) Fail(op Op, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, op)
+		return
+	}
+	s.errs[op] = err
+}
+
+// Queries 返回 op 类型的请求的次数，失败的请求也计算在内
+func (s *Server) Queries(op Op) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[op]
+}
+
+// ResetQueries 清零所有的计数
+func (s *Server) ResetQueries() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = make(map[Op]int)
+}
+
+// Client 返回 h 使用的路由，h 同时加入 FindPeer 可以找到的节点
+func (s *Server) Client(h host.Host) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[h.ID()] = h
+	return &Client{s: s, h: h}
+}
+
+// begin 记录一次请求，等待延迟之后返回注入的错误
+func (s *Server) begin(ctx context.Context, op Op) error {
+	s.mu.Lock()
+	s.queries[op]++
+	latency, err := s.latency, s.errs[op]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// Client 是一个节点的路由
+type Client struct {
+	s *Server
+	h host.Host
+}
+
+var _ routing.IpfsRouting = (*Client)(nil)
+
+// Provide 记录本节点是 key 的 provider，bcast 为 false 时也会记录
+func (c *Client) Provide(ctx context.Context, key cid.Cid, bcast bool) error {
+	if err := c.s.begin(ctx, OpProvide); err != nil {
+		return err
+	}
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	pmap, ok := c.s.providers[key.String()]
+	if !ok {
+		pmap = make(map[peer.ID]provider)
+		c.s.providers[key.String()] = pmap
+	}
+	pmap[c.h.ID()] = provider{
+		PeerInfo: pstore.PeerInfo{ID: c.h.ID(), Addrs: c.h.Addrs()},
+		expires:  time.Now().Add(c.s.providerTTL),
+	}
+	return nil
+}
+
+// FindProvidersAsync 返回没有过期的 provider，limit 为 0 时不限制数量
+func (c *Client) FindProvidersAsync(ctx context.Context, key cid.Cid, limit int) <-chan pstore.PeerInfo {
+	ch := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(ch)
+		if err := c.s.begin(ctx, OpFindProviders); err != nil {
+			return
+		}
+
+		c.s.mu.Lock()
+		now := time.Now()
+		var found []pstore.PeerInfo
+		for id, p := range c.s.providers[key.String()] {
+			if now.After(p.expires) {
+				delete(c.s.providers[key.String()], id)
+				continue
+			}
+			found = append(found, p.PeerInfo)
+		}
+		c.s.mu.Unlock()
+
+		for i, pi := range found {
+			if limit > 0 && i >= limit {
+				return
+			}
+			select {
+			case ch <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// FindPeer 返回通过 Server.Client 加入的节点当前的地址
+func (c *Client) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	if err := c.s.begin(ctx, OpFindPeer); err != nil {
+		return pstore.PeerInfo{}, err
+	}
+
+	c.s.mu.Lock()
+	h, ok := c.s.hosts[id]
+	c.s.mu.Unlock()
+	if !ok {
+		return pstore.PeerInfo{}, routing.ErrNotFound
+	}
+	return pstore.PeerInfo{ID: id, Addrs: h.Addrs()}, nil
+}
+
+func (c *Client) PutValue(ctx context.Context, key string, value []byte, opts ...ropts.Option) error {
+	if err := c.s.begin(ctx, OpPutValue); err != nil {
+		return err
+	}
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	c.s.values[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (c *Client) GetValue(ctx context.Context, key string, opts ...ropts.Option) ([]byte, error) {
+	if err := c.s.begin(ctx, OpGetValue); err != nil {
+		return nil, err
+	}
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	value, ok := c.s.values[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// SearchValue 找到时返回只有一个值的 channel，找不到时返回已经关闭的 channel
+func (c *Client) SearchValue(ctx context.Context, key string, opts ...ropts.Option) (<-chan []byte, error) {
+	if err := c.s.begin(ctx, OpSearchValue); err != nil {
+		return nil, err
+	}
+	ch := make(chan []byte, 1)
+	defer close(ch)
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if value, ok := c.s.values[key]; ok {
+		ch <- append([]byte{}, value...)
+	}
+	return ch, nil
+}
+
+func (c *Client) Bootstrap(context.Context) error {
+	return nil
+}
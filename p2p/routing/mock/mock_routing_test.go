@@ -0,0 +1,176 @@
+package test_mockrouting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mocknet "github.com/czh0526/libp2p/p2p/net/mock"
+	cid "github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-host"
+	routing "github.com/libp2p/go-libp2p-routing"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func makeHosts(t *testing.T, ctx context.Context, n int) []host.Host {
+	mn := mocknet.New(ctx)
+	hosts := make([]host.Host, n)
+	for i := range hosts {
+		h, err := mn.GenPeer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[i] = h
+	}
+	return hosts
+}
+
+func makeCid(t *testing.T, s string) cid.Cid {
+	h, err := mh.Sum([]byte(s), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func countProviders(ctx context.Context, c *Client, key cid.Cid, limit int) int {
+	n := 0
+	for range c.FindProvidersAsync(ctx, key, limit) {
+		n++
+	}
+	return n
+}
+
+func TestProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hosts := makeHosts(t, ctx, 3)
+	s := NewServer()
+	clients := []*Client{s.Client(hosts[0]), s.Client(hosts[1]), s.Client(hosts[2])}
+	key := makeCid(t, "key")
+
+	for _, c := range clients[:2] {
+		if err := c.Provide(ctx, key, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countProviders(ctx, clients[2], key, 0); n != 2 {
+		t.Fatalf("expected 2 providers, got %d", n)
+	}
+	if n := countProviders(ctx, clients[2], key, 1); n != 1 {
+		t.Fatalf("expected 1 provider, got %d", n)
+	}
+	if n := countProviders(ctx, clients[2], makeCid(t, "other"), 0); n != 0 {
+		t.Fatalf("expected no providers, got %d", n)
+	}
+	if s.Queries(OpProvide) != 2 || s.Queries(OpFindProviders) != 3 {
+		t.Fatalf("unexpected queries %d, %d", s.Queries(OpProvide), s.Queries(OpFindProviders))
+	}
+	s.ResetQueries()
+	if s.Queries(OpProvide) != 0 {
+		t.Fatal("expected the counters to be reset")
+	}
+}
+
+func TestProviderExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hosts := makeHosts(t, ctx, 2)
+	s := NewServer()
+	a, b := s.Client(hosts[0]), s.Client(hosts[1])
+	key := makeCid(t, "key")
+
+	s.SetProviderTTL(50 * time.Millisecond)
+	if err := a.Provide(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := countProviders(ctx, b, key, 0); n != 1 {
+		t.Fatalf("expected 1 provider, got %d", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := countProviders(ctx, b, key, 0); n != 0 {
+		t.Fatalf("expected the provider to expire, got %d", n)
+	}
+}
+
+func TestFailAndLatency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hosts := makeHosts(t, ctx, 2)
+	s := NewServer()
+	a, b := s.Client(hosts[0]), s.Client(hosts[1])
+	key := makeCid(t, "key")
+	if err := a.Provide(ctx, key, true); err != nil {
+		t.Fatal(err)
+	}
+
+	errFail := errors.New("injected")
+	s.Fail(OpFindPeer, errFail)
+	s.Fail(OpFindProviders, errFail)
+	if _, err := b.FindPeer(ctx, hosts[0].ID()); err != errFail {
+		t.Fatalf("expected %v, got %v", errFail, err)
+	}
+	if n := countProviders(ctx, b, key, 0); n != 0 {
+		t.Fatalf("expected no providers, got %d", n)
+	}
+	s.Fail(OpFindPeer, nil)
+	pi, err := b.FindPeer(ctx, hosts[0].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.ID != hosts[0].ID() || len(pi.Addrs) == 0 {
+		t.Fatalf("unexpected peer %+v", pi)
+	}
+	if s.Queries(OpFindPeer) != 2 {
+		t.Fatalf("expected 2 queries, got %d", s.Queries(OpFindPeer))
+	}
+
+	// 延迟超过 ctx 的超时时间
+	s.SetLatency(time.Second)
+	tctx, tcancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer tcancel()
+	start := time.Now()
+	if _, err := b.FindPeer(tctx, hosts[0].ID()); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("request did not stop at the deadline")
+	}
+}
+
+func TestValueStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hosts := makeHosts(t, ctx, 2)
+	s := NewServer()
+	a, b := s.Client(hosts[0]), s.Client(hosts[1])
+
+	if _, err := b.GetValue(ctx, "/v/key"); err != routing.ErrNotFound {
+		t.Fatalf("expected %v, got %v", routing.ErrNotFound, err)
+	}
+	if err := a.PutValue(ctx, "/v/key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	value, err := b.GetValue(ctx, "/v/key")
+	if err != nil || string(value) != "value" {
+		t.Fatalf("unexpected value %q, %v", value, err)
+	}
+
+	ch, err := b.SearchValue(ctx, "/v/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for v := range ch {
+		found = append(found, string(v))
+	}
+	if len(found) != 1 || found[0] != "value" {
+		t.Fatalf("unexpected values %q", found)
+	}
+
+	s.Fail(OpSearchValue, routing.ErrNotFound)
+	if _, err := b.SearchValue(ctx, "/v/key"); err != routing.ErrNotFound {
+		t.Fatalf("expected %v, got %v", routing.ErrNotFound, err)
+	}
+}
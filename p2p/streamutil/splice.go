@@ -0,0 +1,50 @@
+// streamutil 是在 libp2p stream 和普通网络连接之间转发数据的工具，供 forward、http_proxy 等示例共用
+package streamutil
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	inet "github.com/libp2p/go-libp2p-net"
+)
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Splice 在 conn 和 stream 之间双向复制数据，一个方向结束时半关闭对端，两个方向都结束后关闭。
+// connReader 和 streamReader 通常就是 conn 和 stream，已经用 bufio 读过握手时传入带缓冲的 Reader
+func Splice(conn net.Conn, connReader io.Reader, stream inet.Stream, streamReader io.Reader) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// conn ==> stream
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(stream, connReader); err != nil {
+			stream.Reset()
+			conn.Close()
+			return
+		}
+		stream.Close()
+	}()
+
+	// stream ==> conn
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(conn, streamReader); err != nil {
+			stream.Reset()
+			conn.Close()
+			return
+		}
+		if cw, ok := conn.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+
+	wg.Wait()
+	conn.Close()
+}
@@ -0,0 +1,87 @@
+package streamutil
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	mocknet "github.com/czh0526/libp2p/p2p/net/mock"
+	inet "github.com/libp2p/go-libp2p-net"
+)
+
+func TestSplice(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	a, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// b 端把 stream 上收到的数据原样写回，读完之后关闭
+	b.SetStreamHandler("/splice/test", func(s inet.Stream) {
+		data, err := ioutil.ReadAll(s)
+		if err != nil {
+			s.Reset()
+			return
+		}
+		s.Write(data)
+		s.Close()
+	})
+
+	s, err := a.NewStream(ctx, b.ID(), "/splice/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 用 TCP 连接，这样 Splice 可以半关闭 conn
+	list, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := list.Accept()
+		if err != nil {
+			return
+		}
+		Splice(conn, conn, s, s)
+	}()
+
+	client, err := net.Dial("tcp", list.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	client.(*net.TCPConn).CloseWrite()
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("unexpected reply %q", data)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Splice did not return after both directions finished")
+	}
+}
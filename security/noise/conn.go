@@ -0,0 +1,131 @@
+package noise
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// 每一帧前面是 2 字节的大端长度
+const maxFrameLen = 65535
+
+const maxPlaintextLen = maxFrameLen - tagLen
+
+var errFrameTooLarge = errors.New("noise: frame too large")
+
+type secureConn struct {
+	net.Conn
+
+	localPeer  peer.ID
+	localKey   ci.PrivKey
+	remotePeer peer.ID
+	remoteKey  ci.PubKey
+
+	readLock sync.Mutex
+	recv     *cipherState
+	frame    []byte
+	plain    []byte
+	pending  []byte
+
+	writeLock sync.Mutex
+	send      *cipherState
+	out       []byte
+}
+
+func (c *secureConn) Read(buf []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.pending) == 0 {
+		ciphertext, err := readFrame(c.Conn, c.frame[:0])
+		if err != nil {
+			return 0, err
+		}
+		c.frame = ciphertext
+
+		plaintext, err := c.recv.decrypt(c.plain[:0], nil, ciphertext)
+		if err != nil {
+			return 0, err
+		}
+		c.plain = plaintext
+		c.pending = plaintext
+	}
+
+	n := copy(buf, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *secureConn) Write(data []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	written := 0
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxPlaintextLen {
+			chunk = chunk[:maxPlaintextLen]
+		}
+
+		c.out = c.send.encrypt(c.out[:0], nil, chunk)
+		if err := writeFrame(c.Conn, c.out); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		data = data[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *secureConn) LocalPeer() peer.ID {
+	return c.localPeer
+}
+
+func (c *secureConn) LocalPrivateKey() ci.PrivKey {
+	return c.localKey
+}
+
+func (c *secureConn) RemotePeer() peer.ID {
+	return c.remotePeer
+}
+
+func (c *secureConn) RemotePublicKey() ci.PubKey {
+	return c.remoteKey
+}
+
+func readFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > maxFrameLen {
+		return errFrameTooLarge
+	}
+
+	frame := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	copy(frame[2:], data)
+	_, err := w.Write(frame)
+	return err
+}
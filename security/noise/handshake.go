@@ -0,0 +1,273 @@
+package noise
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Noise_XX_25519_ChaChaPoly_SHA256，名字正好 32 字节，直接作为初始的 h
+const protocolName = "Noise_XX_25519_ChaChaPoly_SHA256"
+
+const (
+	dhLen   = 32
+	hashLen = sha256.Size
+	tagLen  = 16 // Poly1305 认证标签
+)
+
+var errDecrypt = errors.New("noise: message authentication failed")
+
+type keypair struct {
+	pub  [dhLen]byte
+	priv [dhLen]byte
+}
+
+func generateKeypair(r io.Reader) (*keypair, error) {
+	var kp keypair
+	if _, err := io.ReadFull(r, kp.priv[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&kp.pub, &kp.priv)
+	return &kp, nil
+}
+
+func dh(priv, pub *[dhLen]byte) []byte {
+	var out [dhLen]byte
+	curve25519.ScalarMult(&out, priv, pub)
+	return out[:]
+}
+
+// cipherState 对应 Noise 规范中的 CipherState
+type cipherState struct {
+	key    [32]byte
+	hasKey bool
+	n      uint64
+}
+
+func (cs *cipherState) initializeKey(k []byte) {
+	copy(cs.key[:], k)
+	cs.hasKey = true
+	cs.n = 0
+}
+
+func (cs *cipherState) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], cs.n)
+	return nonce[:]
+}
+
+func (cs *cipherState) encrypt(out, ad, plaintext []byte) []byte {
+	if !cs.hasKey {
+		return append(out, plaintext...)
+	}
+	aead, _ := chacha20poly1305.New(cs.key[:])
+	out = aead.Seal(out, cs.nonce(), plaintext, ad)
+	cs.n++
+	return out
+}
+
+func (cs *cipherState) decrypt(out, ad, ciphertext []byte) ([]byte, error) {
+	if !cs.hasKey {
+		return append(out, ciphertext...), nil
+	}
+	aead, _ := chacha20poly1305.New(cs.key[:])
+	out, err := aead.Open(out, cs.nonce(), ciphertext, ad)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	cs.n++
+	return out, nil
+}
+
+// symmetricState 对应 Noise 规范中的 SymmetricState
+type symmetricState struct {
+	cs cipherState
+	ck [hashLen]byte
+	h  [hashLen]byte
+}
+
+func newSymmetricState() *symmetricState {
+	var ss symmetricState
+	copy(ss.h[:], protocolName)
+	ss.ck = ss.h
+	// prologue 为空
+	ss.mixHash(nil)
+	return &ss
+}
+
+func (ss *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(ss.h[:])
+	h.Write(data)
+	h.Sum(ss.h[:0])
+}
+
+func (ss *symmetricState) mixKey(ikm []byte) {
+	ck, k := hkdf(ss.ck[:], ikm)
+	copy(ss.ck[:], ck)
+	ss.cs.initializeKey(k)
+}
+
+func (ss *symmetricState) encryptAndHash(out, plaintext []byte) []byte {
+	start := len(out)
+	out = ss.cs.encrypt(out, ss.h[:], plaintext)
+	ss.mixHash(out[start:])
+	return out
+}
+
+func (ss *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := ss.cs.decrypt(nil, ss.h[:], ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	ss.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split 生成两个方向的 CipherState：c1 用于 initiator -> responder，c2 反之
+func (ss *symmetricState) split() (c1, c2 *cipherState) {
+	k1, k2 := hkdf(ss.ck[:], nil)
+	c1, c2 = new(cipherState), new(cipherState)
+	c1.initializeKey(k1)
+	c2.initializeKey(k2)
+	return c1, c2
+}
+
+func (ss *symmetricState) overhead() int {
+	if ss.cs.hasKey {
+		return tagLen
+	}
+	return 0
+}
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// hkdf 按照 Noise 规范派生两个输出
+func hkdf(chainingKey, ikm []byte) ([]byte, []byte) {
+	tempKey := hmacSHA256(chainingKey, ikm)
+	out1 := hmacSHA256(tempKey, []byte{0x01})
+	out2 := hmacSHA256(tempKey, out1, []byte{0x02})
+	return out1, out2
+}
+
+// handshakeState 执行 XX 握手:
+//
+//	-> e
+//	<- e, ee, s, es
+//	-> s, se
+type handshakeState struct {
+	ss        *symmetricState
+	initiator bool
+	s         *keypair
+	e         *keypair
+	rs        [dhLen]byte
+	re        [dhLen]byte
+}
+
+func newHandshakeState(initiator bool, s *keypair) *handshakeState {
+	return &handshakeState{
+		ss:        newSymmetricState(),
+		initiator: initiator,
+		s:         s,
+	}
+}
+
+// writeMessageA: -> e
+func (hs *handshakeState) writeMessageA(payload []byte) ([]byte, error) {
+	e, err := generateKeypair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hs.e = e
+
+	out := append([]byte{}, e.pub[:]...)
+	hs.ss.mixHash(e.pub[:])
+	return hs.ss.encryptAndHash(out, payload), nil
+}
+
+func (hs *handshakeState) readMessageA(msg []byte) ([]byte, error) {
+	if len(msg) < dhLen {
+		return nil, errors.New("noise: message A too short")
+	}
+	copy(hs.re[:], msg[:dhLen])
+	hs.ss.mixHash(hs.re[:])
+	return hs.ss.decryptAndHash(msg[dhLen:])
+}
+
+// writeMessageB: <- e, ee, s, es
+func (hs *handshakeState) writeMessageB(payload []byte) ([]byte, error) {
+	e, err := generateKeypair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hs.e = e
+
+	out := append([]byte{}, e.pub[:]...)
+	hs.ss.mixHash(e.pub[:])
+	hs.ss.mixKey(dh(&hs.e.priv, &hs.re))
+	out = hs.ss.encryptAndHash(out, hs.s.pub[:])
+	hs.ss.mixKey(dh(&hs.s.priv, &hs.re))
+	return hs.ss.encryptAndHash(out, payload), nil
+}
+
+func (hs *handshakeState) readMessageB(msg []byte) ([]byte, error) {
+	if len(msg) < dhLen+dhLen+tagLen {
+		return nil, errors.New("noise: message B too short")
+	}
+	copy(hs.re[:], msg[:dhLen])
+	msg = msg[dhLen:]
+	hs.ss.mixHash(hs.re[:])
+	hs.ss.mixKey(dh(&hs.e.priv, &hs.re))
+
+	rs, err := hs.ss.decryptAndHash(msg[:dhLen+tagLen])
+	if err != nil {
+		return nil, err
+	}
+	copy(hs.rs[:], rs)
+	msg = msg[dhLen+tagLen:]
+	hs.ss.mixKey(dh(&hs.e.priv, &hs.rs))
+
+	return hs.ss.decryptAndHash(msg)
+}
+
+// writeMessageC: -> s, se
+func (hs *handshakeState) writeMessageC(payload []byte) ([]byte, error) {
+	out := hs.ss.encryptAndHash(nil, hs.s.pub[:])
+	hs.ss.mixKey(dh(&hs.s.priv, &hs.re))
+	return hs.ss.encryptAndHash(out, payload), nil
+}
+
+func (hs *handshakeState) readMessageC(msg []byte) ([]byte, error) {
+	if len(msg) < dhLen+tagLen {
+		return nil, errors.New("noise: message C too short")
+	}
+	rs, err := hs.ss.decryptAndHash(msg[:dhLen+tagLen])
+	if err != nil {
+		return nil, err
+	}
+	copy(hs.rs[:], rs)
+	hs.ss.mixKey(dh(&hs.e.priv, &hs.rs))
+
+	return hs.ss.decryptAndHash(msg[dhLen+tagLen:])
+}
+
+// ciphers 返回 (发送, 接收) 两个方向的 CipherState
+func (hs *handshakeState) ciphers() (send, recv *cipherState) {
+	c1, c2 := hs.ss.split()
+	if hs.initiator {
+		return c1, c2
+	}
+	return c2, c1
+}
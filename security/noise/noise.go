@@ -0,0 +1,230 @@
+// noise 实现了基于 Noise_XX_25519_ChaChaPoly_SHA256 握手的 security.Transport。
+//
+// 每个 Transport 生成一个临时的 Noise 静态密钥，并用 libp2p 身份私钥对其签名，
+// 签名和身份公钥放在握手消息的 payload 里交给对方验证。
+package noise
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	pb "github.com/czh0526/libp2p/security/noise/pb"
+	proto "github.com/gogo/protobuf/proto"
+	cs "github.com/libp2p/go-conn-security"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+const ID = "/noise"
+
+// 对 Noise 静态公钥签名时使用的前缀
+const payloadSigPrefix = "noise-libp2p-static-key:"
+
+type Transport struct {
+	LocalID    peer.ID
+	PrivateKey ci.PrivKey
+
+	static *keypair
+}
+
+var _ cs.Transport = (*Transport)(nil)
+
+func New(sk ci.PrivKey) (*Transport, error) {
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	static, err := generateKeypair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transport{
+		LocalID:    id,
+		PrivateKey: sk,
+		static:     static,
+	}, nil
+}
+
+func (t *Transport) SecureInbound(ctx context.Context, insecure net.Conn) (cs.Conn, error) {
+	return t.handshake(ctx, insecure, false, "")
+}
+
+func (t *Transport) SecureOutbound(ctx context.Context, insecure net.Conn, p peer.ID) (cs.Conn, error) {
+	return t.handshake(ctx, insecure, true, p)
+}
+
+func (t *Transport) handshake(ctx context.Context, insecure net.Conn, initiator bool, remote peer.ID) (cs.Conn, error) {
+	if t.static == nil {
+		return nil, fmt.Errorf("noise: transport not initialized, use noise.New")
+	}
+
+	// context 取消时关闭底层连接，让阻塞中的读写返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			insecure.Close()
+		case <-done:
+		}
+	}()
+
+	conn, err := t.runHandshake(insecure, initiator, remote)
+	if ctx.Err() != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		insecure.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *Transport) runHandshake(insecure net.Conn, initiator bool, remote peer.ID) (*secureConn, error) {
+	payload, err := t.makePayload()
+	if err != nil {
+		return nil, err
+	}
+
+	hs := newHandshakeState(initiator, t.static)
+	var remoteKey ci.PubKey
+	var remoteID peer.ID
+
+	if initiator {
+		// -> e
+		msg, err := hs.writeMessageA(nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(insecure, msg); err != nil {
+			return nil, err
+		}
+
+		// <- e, ee, s, es
+		msg, err = readFrame(insecure, nil)
+		if err != nil {
+			return nil, err
+		}
+		remotePayload, err := hs.readMessageB(msg)
+		if err != nil {
+			return nil, err
+		}
+		// 先确认对方身份再发送自己的身份，对方不对时直接断开
+		if remoteKey, remoteID, err = checkRemote(remotePayload, hs.rs[:], remote); err != nil {
+			return nil, err
+		}
+
+		// -> s, se
+		msg, err = hs.writeMessageC(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(insecure, msg); err != nil {
+			return nil, err
+		}
+	} else {
+		// -> e
+		msg, err := readFrame(insecure, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := hs.readMessageA(msg); err != nil {
+			return nil, err
+		}
+
+		// <- e, ee, s, es
+		msg, err = hs.writeMessageB(payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFrame(insecure, msg); err != nil {
+			return nil, err
+		}
+
+		// -> s, se
+		msg, err = readFrame(insecure, nil)
+		if err != nil {
+			return nil, err
+		}
+		remotePayload, err := hs.readMessageC(msg)
+		if err != nil {
+			return nil, err
+		}
+		if remoteKey, remoteID, err = checkRemote(remotePayload, hs.rs[:], remote); err != nil {
+			return nil, err
+		}
+	}
+
+	send, recv := hs.ciphers()
+	return &secureConn{
+		Conn:       insecure,
+		localPeer:  t.LocalID,
+		localKey:   t.PrivateKey,
+		remotePeer: remoteID,
+		remoteKey:  remoteKey,
+		send:       send,
+		recv:       recv,
+	}, nil
+}
+
+// checkRemote 验证对方的 payload，并在指定了 remote 时检查 peer ID
+func checkRemote(payload []byte, remoteStatic []byte, remote peer.ID) (ci.PubKey, peer.ID, error) {
+	remoteKey, err := verifyPayload(payload, remoteStatic)
+	if err != nil {
+		return nil, "", err
+	}
+	remoteID, err := peer.IDFromPublicKey(remoteKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if remote != "" && remoteID != remote {
+		return nil, "", fmt.Errorf("noise: expected to connect to %s, got %s", remote, remoteID)
+	}
+	return remoteKey, remoteID, nil
+}
+
+// makePayload 用身份私钥对 Noise 静态公钥签名
+func (t *Transport) makePayload() ([]byte, error) {
+	keyBytes, err := ci.MarshalPublicKey(t.PrivateKey.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := t.PrivateKey.Sign(append([]byte(payloadSigPrefix), t.static.pub[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&pb.NoiseHandshakePayload{
+		IdentityKey: keyBytes,
+		IdentitySig: sig,
+	})
+}
+
+// verifyPayload 检查对方的身份公钥确实签署了握手中使用的 Noise 静态公钥
+func verifyPayload(data []byte, remoteStatic []byte) (ci.PubKey, error) {
+	var payload pb.NoiseHandshakePayload
+	if err := proto.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("noise: bad handshake payload: %s", err)
+	}
+
+	key, err := ci.UnmarshalPublicKey(payload.IdentityKey)
+	if err != nil {
+		return nil, fmt.Errorf("noise: bad identity key: %s", err)
+	}
+
+	ok, err := key.Verify(append([]byte(payloadSigPrefix), remoteStatic...), payload.IdentitySig)
+	if err != nil {
+		return nil, fmt.Errorf("noise: verify static key signature: %s", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("noise: invalid static key signature")
+	}
+	return key, nil
+}
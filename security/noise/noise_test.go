@@ -0,0 +1,28 @@
+package noise
+
+import (
+	"testing"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	sst "github.com/libp2p/go-conn-security/test"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+func newTestTransport(t *testing.T) (*Transport, peer.ID) {
+	sk, _, err := tu.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpt, err := New(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpt, tpt.LocalID
+}
+
+func TestNoise(t *testing.T) {
+	at, ap := newTestTransport(t)
+	bt, bp := newTestTransport(t)
+
+	sst.SubtestAll(t, at, bt, ap, bp)
+}
@@ -0,0 +1,93 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: payload.proto
+
+package noise_pb
+
+import (
+	fmt "fmt"
+	proto "github.com/gogo/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
+
+type NoiseHandshakePayload struct {
+	IdentityKey          []byte   `protobuf:"bytes,1,opt,name=identityKey,proto3" json:"identityKey,omitempty"`
+	IdentitySig          []byte   `protobuf:"bytes,2,opt,name=identitySig,proto3" json:"identitySig,omitempty"`
+	Data                 []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NoiseHandshakePayload) Reset()         { *m = NoiseHandshakePayload{} }
+func (m *NoiseHandshakePayload) String() string { return proto.CompactTextString(m) }
+func (*NoiseHandshakePayload) ProtoMessage()    {}
+func (*NoiseHandshakePayload) Descriptor() ([]byte, []int) {
+	return fileDescriptor_678c914f1bee6d56, []int{0}
+}
+func (m *NoiseHandshakePayload) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NoiseHandshakePayload.Unmarshal(m, b)
+}
+func (m *NoiseHandshakePayload) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NoiseHandshakePayload.Marshal(b, m, deterministic)
+}
+func (m *NoiseHandshakePayload) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NoiseHandshakePayload.Merge(m, src)
+}
+func (m *NoiseHandshakePayload) XXX_Size() int {
+	return xxx_messageInfo_NoiseHandshakePayload.Size(m)
+}
+func (m *NoiseHandshakePayload) XXX_DiscardUnknown() {
+	xxx_messageInfo_NoiseHandshakePayload.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NoiseHandshakePayload proto.InternalMessageInfo
+
+func (m *NoiseHandshakePayload) GetIdentityKey() []byte {
+	if m != nil {
+		return m.IdentityKey
+	}
+	return nil
+}
+
+func (m *NoiseHandshakePayload) GetIdentitySig() []byte {
+	if m != nil {
+		return m.IdentitySig
+	}
+	return nil
+}
+
+func (m *NoiseHandshakePayload) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*NoiseHandshakePayload)(nil), "noise.pb.NoiseHandshakePayload")
+}
+
+func init() { proto.RegisterFile("payload.proto", fileDescriptor_678c914f1bee6d56) }
+
+var fileDescriptor_678c914f1bee6d56 = []byte{
+	// 120 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2d, 0x48, 0xac, 0xcc,
+	0xc9, 0x4f, 0x4c, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0xc8, 0xcb, 0xcf, 0x2c, 0x4e,
+	0xd5, 0x2b, 0x48, 0x52, 0xca, 0xe7, 0x12, 0xf5, 0x03, 0xb1, 0x3d, 0x12, 0xf3, 0x52, 0x8a, 0x33,
+	0x12, 0xb3, 0x53, 0x03, 0x20, 0x0a, 0x85, 0x14, 0xb8, 0xb8, 0x33, 0x53, 0x52, 0xf3, 0x4a, 0x32,
+	0x4b, 0x2a, 0xbd, 0x53, 0x2b, 0x25, 0x18, 0x15, 0x18, 0x35, 0x78, 0x82, 0x90, 0x85, 0x90, 0x55,
+	0x04, 0x67, 0xa6, 0x4b, 0x30, 0xa1, 0xaa, 0x08, 0xce, 0x4c, 0x17, 0x12, 0xe2, 0x62, 0x49, 0x49,
+	0x2c, 0x49, 0x94, 0x60, 0x06, 0x4b, 0x81, 0xd9, 0x49, 0x6c, 0x60, 0x17, 0x18, 0x03, 0x06, 0x00,
+	0xdc, 0x00, 0xc0, 0xdc, 0x92, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,214 @@
+package signed
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+const (
+	DefaultMaxClockSkew   = 30 * time.Second
+	DefaultMaxSeen        = 10000
+	DefaultMaxSeenPerPeer = 1000
+)
+
+// Policy 是签名消息的验证策略，可以被多个协议共用。零值可以直接使用，为 0 的字段使用默认值
+type Policy struct {
+	// 时间戳与本地时间允许的最大偏差
+	MaxClockSkew time.Duration
+	// 最多记录多少个已经见过的消息 ID，记录满时拒绝新的消息。
+	// 淘汰时间窗口内的记录会让被淘汰的消息可以重放
+	MaxSeen int
+	// 每个签名者最多占用的记录数，一个签名者的记录满时只拒绝它的消息
+	MaxSeenPerPeer int
+	// 取当前时间，测试时可以替换，为 nil 时使用 time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	seen    map[string]*list.Element
+	order   *list.List
+	perPeer map[string]int
+}
+
+type seenEntry struct {
+	key     string
+	peer    string
+	expires time.Time
+}
+
+// NewPolicy 构造验证策略，maxSeen <= 0 时使用 DefaultMaxSeen
+func NewPolicy(maxClockSkew time.Duration, maxSeen int) *Policy {
+	if maxSeen <= 0 {
+		maxSeen = DefaultMaxSeen
+	}
+	return &Policy{
+		MaxClockSkew: maxClockSkew,
+		MaxSeen:      maxSeen,
+		Now:          time.Now,
+	}
+}
+
+func DefaultPolicy() *Policy {
+	return NewPolicy(DefaultMaxClockSkew, DefaultMaxSeen)
+}
+
+// Verify 按顺序检查: 消息 ID、公钥与 peer ID、签名、时间戳、重放。
+// 全部通过之后才记录消息 ID，返回签名者的公钥
+func (p *Policy) Verify(env *Envelope) (ci.PubKey, error) {
+	fail := func(code Code, err error) error {
+		return &VerifyError{Code: code, Domain: env.Domain, ID: env.ID, Peer: env.PeerID, Err: err}
+	}
+
+	if env.ID == "" {
+		return nil, fail(ErrMissingID, nil)
+	}
+
+	id, err := peer.IDB58Decode(env.PeerID)
+	if err != nil {
+		return nil, fail(ErrBadPeerID, err)
+	}
+	key, err := ci.UnmarshalPublicKey(env.PubKey)
+	if err != nil {
+		return nil, fail(ErrBadKey, err)
+	}
+	if !id.MatchesPublicKey(key) {
+		return nil, fail(ErrPeerMismatch, nil)
+	}
+
+	ok, err := VerifySignature(key, env.Domain, env.Data, env.Signature)
+	if err != nil {
+		return nil, fail(ErrBadSignature, err)
+	}
+	if !ok {
+		return nil, fail(ErrBadSignature, nil)
+	}
+
+	now, maxSkew := p.now(), p.maxClockSkew()
+	skew := now.Sub(env.Timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return nil, fail(ErrClockSkew, nil)
+	}
+
+	// 超出时间窗口的消息在上面已经被拒绝，所以记录只需要保留到窗口结束
+	if code := p.markSeen(seenKey(env), env.PeerID, env.Timestamp.Add(maxSkew), now); code != 0 {
+		return nil, fail(code, nil)
+	}
+	return key, nil
+}
+
+func (p *Policy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+func (p *Policy) maxClockSkew() time.Duration {
+	if p.MaxClockSkew <= 0 {
+		return DefaultMaxClockSkew
+	}
+	return p.MaxClockSkew
+}
+
+func (p *Policy) maxSeen() int {
+	if p.MaxSeen <= 0 {
+		return DefaultMaxSeen
+	}
+	return p.MaxSeen
+}
+
+func (p *Policy) maxSeenPerPeer() int {
+	if p.MaxSeenPerPeer <= 0 {
+		return DefaultMaxSeenPerPeer
+	}
+	return p.MaxSeenPerPeer
+}
+
+// 同一个 ID 在不同协议、不同签名者之间互不影响
+func seenKey(env *Envelope) string {
+	return env.Domain + "\x00" + env.PeerID + "\x00" + env.ID
+}
+
+// markSeen 记录 signer 的 key，已经存在并且没有过期时返回 ErrReplay，
+// signer 的记录或者全部的记录满时返回 ErrSeenFull
+func (p *Policy) markSeen(key, signer string, expires, now time.Time) Code {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.seen == nil {
+		p.seen = make(map[string]*list.Element)
+		p.order = list.New()
+		p.perPeer = make(map[string]int)
+	}
+	p.expire(now)
+
+	if _, ok := p.seen[key]; ok {
+		return ErrReplay
+	}
+
+	// 一个签名者不能占满所有的记录，影响其它签名者
+	if p.perPeer[signer] >= p.maxSeenPerPeer() {
+		return ErrSeenFull
+	}
+	if p.order.Len() >= p.maxSeen() {
+		// 记录只是大致按过期时间排列，满的时候检查所有的记录
+		p.expireAll(now)
+		if p.order.Len() >= p.maxSeen() {
+			return ErrSeenFull
+		}
+	}
+	p.seen[key] = p.order.PushBack(&seenEntry{key: key, peer: signer, expires: expires})
+	p.perPeer[signer]++
+	return 0
+}
+
+// expire 删除已经过期的记录。记录大致按过期时间排列，遇到没过期的就停止
+func (p *Policy) expire(now time.Time) {
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		if e.Value.(*seenEntry).expires.After(now) {
+			return
+		}
+		p.remove(e)
+	}
+}
+
+// expireAll 删除所有已经过期的记录
+func (p *Policy) expireAll(now time.Time) {
+	for e := p.order.Front(); e != nil; {
+		next := e.Next()
+		if !e.Value.(*seenEntry).expires.After(now) {
+			p.remove(e)
+		}
+		e = next
+	}
+}
+
+func (p *Policy) remove(e *list.Element) {
+	entry := e.Value.(*seenEntry)
+	delete(p.seen, entry.key)
+	if p.perPeer[entry.peer]--; p.perPeer[entry.peer] <= 0 {
+		delete(p.perPeer, entry.peer)
+	}
+	p.order.Remove(e)
+}
+
+// HasSeen 检查消息是否已经通过过验证，可以在验证签名之前用来丢弃重复的消息
+func (p *Policy) HasSeen(env *Envelope) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.seen[seenKey(env)]
+	return ok
+}
+
+// Seen 返回当前记录的消息 ID 数量
+func (p *Policy) Seen() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.seen)
+}
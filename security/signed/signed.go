@@ -0,0 +1,116 @@
+// signed 提供带签名消息的签名与验证:
+//
+//   - 签名按协议做域分离，为一个协议签的消息不能被拿到另一个协议中使用
+//   - 验证时检查公钥和 peer ID 是否匹配、签名、时间戳偏差，并用一个有上限、会过期的缓存拒绝重放，
+//     缓存满时拒绝新的消息，不淘汰仍在时间窗口内的记录
+//   - 验证失败返回 *VerifyError，Code 说明失败原因
+package signed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+)
+
+// 所有签名数据的公共前缀
+const signaturePrefix = "libp2p-signed-message:"
+
+// Code 表示验证失败的原因
+type Code int
+
+const (
+	ErrMissingID Code = iota + 1
+	ErrBadPeerID
+	ErrBadKey
+	ErrPeerMismatch
+	ErrBadSignature
+	ErrClockSkew
+	ErrReplay
+	ErrSeenFull
+)
+
+func (c Code) String() string {
+	switch c {
+	case ErrMissingID:
+		return "missing message id"
+	case ErrBadPeerID:
+		return "bad peer id"
+	case ErrBadKey:
+		return "bad public key"
+	case ErrPeerMismatch:
+		return "peer id and public key mismatch"
+	case ErrBadSignature:
+		return "bad signature"
+	case ErrClockSkew:
+		return "timestamp outside allowed clock skew"
+	case ErrReplay:
+		return "replayed message"
+	case ErrSeenFull:
+		return "too many recent messages"
+	default:
+		return fmt.Sprintf("unknown error %d", int(c))
+	}
+}
+
+// VerifyError 是验证失败时返回的错误
+type VerifyError struct {
+	Code   Code
+	Domain string
+	ID     string
+	Peer   string
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("verify %s message %q from %s: %s", e.Domain, e.ID, e.Peer, e.Code)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// IsCode 判断 err 是否是指定原因的 VerifyError
+func IsCode(err error, code Code) bool {
+	ve, ok := err.(*VerifyError)
+	return ok && ve.Code == code
+}
+
+// Envelope 描述一条待验证的签名消息
+type Envelope struct {
+	// 协议标识，签名时使用同样的 domain
+	Domain string
+	// 消息 ID，用于拒绝重放
+	ID        string
+	Timestamp time.Time
+	// 签名者的 peer ID（base58）和序列化的公钥
+	PeerID string
+	PubKey []byte
+	// 被签名的数据以及签名
+	Data      []byte
+	Signature []byte
+}
+
+// Sign 使用 domain 做域分离后对 data 签名
+func Sign(sk ci.PrivKey, domain string, data []byte) ([]byte, error) {
+	return sk.Sign(signingBytes(domain, data))
+}
+
+// VerifySignature 只检查签名，不做时间和重放检查
+func VerifySignature(pk ci.PubKey, domain string, data, sig []byte) (bool, error) {
+	return pk.Verify(signingBytes(domain, data), sig)
+}
+
+// signingBytes = 前缀 | uvarint(len(domain)) | domain | data，
+// domain 带长度，避免 domain 和 data 的边界被移动
+func signingBytes(domain string, data []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(l[:], uint64(len(domain)))
+
+	buf := make([]byte, 0, len(signaturePrefix)+n+len(domain)+len(data))
+	buf = append(buf, signaturePrefix...)
+	buf = append(buf, l[:n]...)
+	buf = append(buf, domain...)
+	return append(buf, data...)
+}
@@ -0,0 +1,246 @@
+package signed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+type testSigner struct {
+	sk     ci.PrivKey
+	id     string
+	pubKey []byte
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	sk, pk, err := tu.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkb, err := pk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{sk: sk, id: peer.IDB58Encode(id), pubKey: pkb}
+}
+
+func (s *testSigner) envelope(t *testing.T, domain, id string, ts time.Time) *Envelope {
+	data := []byte(fmt.Sprintf("message %s", id))
+	sig, err := Sign(s.sk, domain, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Envelope{
+		Domain:    domain,
+		ID:        id,
+		Timestamp: ts,
+		PeerID:    s.id,
+		PubKey:    s.pubKey,
+		Data:      data,
+		Signature: sig,
+	}
+}
+
+// 可以手动调整的时钟
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestPolicy(maxSeen int) (*Policy, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	p := NewPolicy(10*time.Second, maxSeen)
+	p.Now = clock.Now
+	return p, clock
+}
+
+func expectCode(t *testing.T, err error, code Code) {
+	t.Helper()
+	if !IsCode(err, code) {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s := newTestSigner(t)
+	p, clock := newTestPolicy(0)
+
+	if _, err := p.Verify(s.envelope(t, "/ping", "1", clock.now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 篡改数据
+	env := s.envelope(t, "/ping", "2", clock.now)
+	env.Data = []byte("tampered")
+	_, err := p.Verify(env)
+	expectCode(t, err, ErrBadSignature)
+
+	// 缺少 ID
+	_, err = p.Verify(s.envelope(t, "/ping", "", clock.now))
+	expectCode(t, err, ErrMissingID)
+
+	// peer ID 与公钥不匹配
+	env = s.envelope(t, "/ping", "3", clock.now)
+	env.PeerID = newTestSigner(t).id
+	_, err = p.Verify(env)
+	expectCode(t, err, ErrPeerMismatch)
+}
+
+func TestDomainSeparation(t *testing.T) {
+	s := newTestSigner(t)
+	p, clock := newTestPolicy(0)
+
+	env := s.envelope(t, "/ping", "1", clock.now)
+	env.Domain = "/echo"
+	_, err := p.Verify(env)
+	expectCode(t, err, ErrBadSignature)
+
+	// domain 和 data 的边界不能移动
+	env = s.envelope(t, "/ping", "2", clock.now)
+	env.Domain = "/pin"
+	env.Data = append([]byte("g"), env.Data...)
+	_, err = p.Verify(env)
+	expectCode(t, err, ErrBadSignature)
+}
+
+func TestClockSkew(t *testing.T) {
+	s := newTestSigner(t)
+	p, clock := newTestPolicy(0)
+
+	_, err := p.Verify(s.envelope(t, "/ping", "old", clock.now.Add(-11*time.Second)))
+	expectCode(t, err, ErrClockSkew)
+
+	_, err = p.Verify(s.envelope(t, "/ping", "future", clock.now.Add(11*time.Second)))
+	expectCode(t, err, ErrClockSkew)
+
+	if _, err := p.Verify(s.envelope(t, "/ping", "ok", clock.now.Add(-9*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := newTestSigner(t)
+	p, clock := newTestPolicy(0)
+
+	env := s.envelope(t, "/ping", "1", clock.now)
+	if _, err := p.Verify(env); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Verify(env)
+	expectCode(t, err, ErrReplay)
+
+	// 同一个 ID 用在其它协议上不算重放
+	if _, err := p.Verify(s.envelope(t, "/echo", "1", clock.now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 验证失败的消息不占用 ID
+	bad := s.envelope(t, "/ping", "2", clock.now)
+	bad.Data = []byte("tampered")
+	p.Verify(bad)
+	if _, err := p.Verify(s.envelope(t, "/ping", "2", clock.now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 时间窗口过去之后，记录被清理，旧消息由时间戳检查拒绝
+	clock.now = clock.now.Add(11 * time.Second)
+	_, err = p.Verify(env)
+	expectCode(t, err, ErrClockSkew)
+	p.Verify(s.envelope(t, "/ping", "3", clock.now))
+	if p.Seen() != 1 {
+		t.Fatalf("expected expired ids to be removed, %d left", p.Seen())
+	}
+}
+
+func TestSeenBound(t *testing.T) {
+	s := newTestSigner(t)
+	p, clock := newTestPolicy(5)
+	start := clock.now
+
+	// 第一条消息的时间戳最晚，它的记录最后过期
+	if _, err := p.Verify(s.envelope(t, "/ping", "0", start.Add(5*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 5; i++ {
+		if _, err := p.Verify(s.envelope(t, "/ping", fmt.Sprint(i), start)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 记录满时拒绝新的消息，不淘汰时间窗口内的记录
+	for i := 5; i < 20; i++ {
+		_, err := p.Verify(s.envelope(t, "/ping", fmt.Sprint(i), start))
+		expectCode(t, err, ErrSeenFull)
+	}
+	if p.Seen() != 5 {
+		t.Fatalf("expected 5 seen ids, got %d", p.Seen())
+	}
+
+	// 被大量新消息冲击之后，时间窗口内的消息仍然不能重放
+	clock.now = start.Add(9 * time.Second)
+	_, err := p.Verify(s.envelope(t, "/ping", "1", start))
+	expectCode(t, err, ErrReplay)
+
+	// 后面的记录过期之后腾出位置，即使队列前面的记录还没有过期
+	clock.now = start.Add(11 * time.Second)
+	if _, err := p.Verify(s.envelope(t, "/ping", "new", clock.now)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Seen() != 2 {
+		t.Fatalf("expected 2 seen ids, got %d", p.Seen())
+	}
+	_, err = p.Verify(s.envelope(t, "/ping", "0", start.Add(5*time.Second)))
+	expectCode(t, err, ErrReplay)
+}
+
+func TestSeenPerPeer(t *testing.T) {
+	a, b := newTestSigner(t), newTestSigner(t)
+	p, clock := newTestPolicy(10)
+	p.MaxSeenPerPeer = 3
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.Verify(a.envelope(t, "/ping", fmt.Sprint(i), clock.now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a 的记录满了只拒绝 a 的消息
+	_, err := p.Verify(a.envelope(t, "/ping", "3", clock.now))
+	expectCode(t, err, ErrSeenFull)
+	for i := 0; i < 3; i++ {
+		if _, err := p.Verify(b.envelope(t, "/ping", fmt.Sprint(i), clock.now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a 的记录过期之后可以继续发送
+	clock.now = clock.now.Add(11 * time.Second)
+	if _, err := p.Verify(a.envelope(t, "/ping", "4", clock.now)); err != nil {
+		t.Fatal(err)
+	}
+	if p.Seen() != 1 {
+		t.Fatalf("expected 1 seen id, got %d", p.Seen())
+	}
+}
+
+func TestZeroPolicy(t *testing.T) {
+	s := newTestSigner(t)
+	var p Policy
+
+	env := s.envelope(t, "/ping", "1", time.Now())
+	if _, err := p.Verify(env); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Verify(env)
+	expectCode(t, err, ErrReplay)
+	_, err = p.Verify(s.envelope(t, "/ping", "2", time.Now().Add(-2*DefaultMaxClockSkew)))
+	expectCode(t, err, ErrClockSkew)
+}
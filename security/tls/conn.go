@@ -0,0 +1,33 @@
+package libp2ptls
+
+import (
+	"crypto/tls"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+type conn struct {
+	*tls.Conn
+
+	localPeer  peer.ID
+	localKey   ci.PrivKey
+	remotePeer peer.ID
+	remoteKey  ci.PubKey
+}
+
+func (c *conn) LocalPeer() peer.ID {
+	return c.localPeer
+}
+
+func (c *conn) LocalPrivateKey() ci.PrivKey {
+	return c.localKey
+}
+
+func (c *conn) RemotePeer() peer.ID {
+	return c.remotePeer
+}
+
+func (c *conn) RemotePublicKey() ci.PubKey {
+	return c.remoteKey
+}
@@ -0,0 +1,125 @@
+package libp2ptls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+)
+
+// 证书扩展: 携带 libp2p 身份公钥以及它对证书公钥的签名
+var extensionID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53594, 1, 1}
+
+const certificatePrefix = "libp2p-tls-handshake:"
+
+const certValidityPeriod = 100 * 365 * 24 * time.Hour
+
+type signedKey struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// keyToCertificate 生成一个自签名证书，证书密钥是临时的 ECDSA 密钥，
+// 身份私钥只用来签署证书公钥
+func keyToCertificate(sk ci.PrivKey) (*tls.Certificate, error) {
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := ci.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	spki, err := x509.MarshalPKIXPublicKey(&certKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sk.Sign(append([]byte(certificatePrefix), spki...))
+	if err != nil {
+		return nil, err
+	}
+	ext, err := asn1.Marshal(signedKey{PubKey: keyBytes, Signature: sig})
+	if err != nil {
+		return nil, err
+	}
+
+	sn, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:    sn,
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(certValidityPeriod),
+		ExtraExtensions: []pkix.Extension{{Id: extensionID, Value: ext}},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, certKey.Public(), certKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  certKey,
+	}, nil
+}
+
+// pubKeyFromCertChain 校验对方的证书链（只能有一个自签名证书），返回其中的 libp2p 身份公钥
+func pubKeyFromCertChain(chain []*x509.Certificate) (ci.PubKey, error) {
+	if len(chain) != 1 {
+		return nil, errors.New("expected one certificate in the chain")
+	}
+	cert := chain[0]
+
+	// 自签名证书，不要求 CA 标记
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return nil, fmt.Errorf("certificate not self-signed: %s", err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errors.New("certificate expired or not yet valid")
+	}
+
+	var found bool
+	var sk signedKey
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(extensionID) {
+			continue
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &sk); err != nil {
+			return nil, fmt.Errorf("unmarshalling signed certificate failed: %s", err)
+		}
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("expected certificate to contain the key extension")
+	}
+
+	pubKey, err := ci.UnmarshalPublicKey(sk.PubKey)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling public key failed: %s", err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := pubKey.Verify(append([]byte(certificatePrefix), spki...), sk.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed: %s", err)
+	}
+	if !ok {
+		return nil, errors.New("signature invalid")
+	}
+	return pubKey, nil
+}
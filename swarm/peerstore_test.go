@@ -0,0 +1,57 @@
+package test_swarm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	pstorefs "github.com/czh0526/libp2p/p2p/pstorefs"
+	inet "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+)
+
+func TestPersistentPeerstore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "swarm-peerstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := GenSwarm(t, ctx)
+	defer remote.Close()
+
+	// 第一次运行: 连接 remote，记住它的地址
+	ps, err := pstorefs.NewPeerstore(ctx, dir, pstorefs.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := GenSwarm(t, ctx, OptPeerstore(ps), OptDialOnly)
+	s.Peerstore().AddAddrs(remote.LocalPeer(), remote.ListenAddresses(), pstore.PermanentAddrTTL)
+	if _, err := s.DialPeer(ctx, remote.LocalPeer()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	ps.Close()
+
+	// 重启之后，不需要再告诉它 remote 的地址
+	ps, err = pstorefs.NewPeerstore(ctx, dir, pstorefs.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if ps.PubKey(remote.LocalPeer()) == nil {
+		t.Fatal("expected the remote public key to be persisted")
+	}
+	s = GenSwarm(t, ctx, OptPeerstore(ps), OptDialOnly)
+	defer s.Close()
+	if _, err := s.DialPeer(ctx, remote.LocalPeer()); err != nil {
+		t.Fatal(err)
+	}
+	if s.Connectedness(remote.LocalPeer()) != inet.Connected {
+		t.Fatal("expected to be connected to remote")
+	}
+}
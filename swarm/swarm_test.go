@@ -82,9 +82,9 @@ func connectSwarms(t *testing.T, ctx context.Context, swarms []*swarm.Swarm) {
 	}
 }
 
-func SubtestSwarm(t *testing.T, SwarmNum int, MsgNum int) {
+func SubtestSwarm(t *testing.T, SwarmNum int, MsgNum int, opts ...Option) {
 	ctx := context.Background()
-	swarms := makeSwarms(ctx, t, SwarmNum, OptDisableReuseport)
+	swarms := makeSwarms(ctx, t, SwarmNum, append([]Option{OptDisableReuseport}, opts...)...)
 	fmt.Println("\n------ finish making swarm -------")
 
 	connectSwarms(t, ctx, swarms)
@@ -207,3 +207,10 @@ func TestSwarm(t *testing.T) {
 	swarms := 5
 	SubtestSwarm(t, swarms, msgs)
 }
+
+// 在每一种 加密 x 多路复用 组合上运行 SubtestSwarm
+func TestSwarmMatrix(t *testing.T) {
+	Matrix(t, func(t *testing.T, opts ...Option) {
+		SubtestSwarm(t, 3, 2, opts...)
+	})
+}
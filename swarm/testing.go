@@ -2,27 +2,51 @@ package test_swarm
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	secio "github.com/libp2p/go-libp2p-secio"
 
+	cs "github.com/libp2p/go-conn-security"
 	csms "github.com/libp2p/go-conn-security-multistream"
+	insecure "github.com/libp2p/go-conn-security/insecure"
 
 	tcp "github.com/libp2p/go-tcp-transport"
 
+	noise "github.com/czh0526/libp2p/security/noise"
+	libp2ptls "github.com/czh0526/libp2p/security/tls"
 	tu "github.com/czh0526/libp2p/testutil"
 	inet "github.com/libp2p/go-libp2p-net"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	pstoremem "github.com/libp2p/go-libp2p-peerstore/pstoremem"
 	swarm "github.com/libp2p/go-libp2p-swarm"
 	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	smux "github.com/libp2p/go-stream-muxer"
+	mplex "github.com/whyrusleeping/go-smux-multiplex"
 	msmux "github.com/whyrusleeping/go-smux-multistream"
 	yamux "github.com/whyrusleeping/go-smux-yamux"
 )
 
+const (
+	YamuxID = "/yamux/1.0.0"
+	MplexID = "/mplex/6.7.0"
+)
+
+// 测试矩阵遍历的协议组合。
+// insecure 也可以通过 OptSecurity 选择，但它不交换身份，入站连接拿不到对方的 peer ID，
+// 无法在 swarm 中正常使用，所以不在矩阵中
+var (
+	SecurityIDs = []string{secio.ID, noise.ID, libp2ptls.ID}
+	MuxerIDs    = []string{YamuxID, MplexID}
+)
+
 type config struct {
 	disableReuseport bool
 	dialOnly         bool
+	security         string
+	muxer            string
+	peerstore        pstore.Peerstore
 }
 
 type Option func(*testing.T, *config)
@@ -35,22 +59,97 @@ var OptDialOnly Option = func(_ *testing.T, c *config) {
 	c.dialOnly = true
 }
 
+// OptSecurity 选择加密协议，取值见 SecurityIDs 以及 insecure.ID，默认为 secio
+func OptSecurity(id string) Option {
+	return func(_ *testing.T, c *config) {
+		c.security = id
+	}
+}
+
+// OptMuxer 选择多路复用协议，取值见 MuxerIDs，默认为 yamux
+func OptMuxer(id string) Option {
+	return func(_ *testing.T, c *config) {
+		c.muxer = id
+	}
+}
+
+// OptPeerstore 使用给定的 peerstore（例如 pstorefs 保存在磁盘上的），默认为内存中的 peerstore
+func OptPeerstore(ps pstore.Peerstore) Option {
+	return func(_ *testing.T, c *config) {
+		c.peerstore = ps
+	}
+}
+
+// GenUpgrader 构造使用 secio + yamux 的 Upgrader
 func GenUpgrader(n *swarm.Swarm) *tptu.Upgrader {
+	up, err := genUpgrader(n, secio.ID, YamuxID)
+	if err != nil {
+		panic(err)
+	}
+	return up
+}
+
+func genUpgrader(n *swarm.Swarm, security, muxer string) (*tptu.Upgrader, error) {
 	id := n.LocalPeer()
 	pk := n.Peerstore().PrivKey(id)
-	secMuxer := new(csms.SSMuxer)
-	secMuxer.AddTransport(secio.ID, &secio.Transport{
-		LocalID:    id,
-		PrivateKey: pk,
-	})
 
+	var secTpt cs.Transport
+	switch security {
+	case "", secio.ID:
+		security = secio.ID
+		secTpt = &secio.Transport{
+			LocalID:    id,
+			PrivateKey: pk,
+		}
+	case insecure.ID:
+		secTpt = insecure.New(id)
+	case noise.ID:
+		tpt, err := noise.New(pk)
+		if err != nil {
+			return nil, err
+		}
+		secTpt = tpt
+	case libp2ptls.ID:
+		tpt, err := libp2ptls.New(pk)
+		if err != nil {
+			return nil, err
+		}
+		secTpt = tpt
+	default:
+		return nil, fmt.Errorf("unknown security protocol: %s", security)
+	}
+	secMuxer := new(csms.SSMuxer)
+	secMuxer.AddTransport(security, secTpt)
+
+	var muxTpt smux.Transport
+	switch muxer {
+	case "", YamuxID:
+		muxer = YamuxID
+		muxTpt = yamux.DefaultTransport
+	case MplexID:
+		muxTpt = mplex.DefaultTransport
+	default:
+		return nil, fmt.Errorf("unknown stream muxer: %s", muxer)
+	}
 	stMuxer := msmux.NewBlankTransport()
-	stMuxer.AddTransport("/yamux/1.0.0", yamux.DefaultTransport)
+	stMuxer.AddTransport(muxer, muxTpt)
 
 	return &tptu.Upgrader{
 		Secure:  secMuxer,
 		Muxer:   stMuxer,
 		Filters: n.Filters,
+	}, nil
+}
+
+// Matrix 对每一种 加密 x 多路复用 组合运行一次 f，f 收到的 Option 用于 GenSwarm
+func Matrix(t *testing.T, f func(t *testing.T, opts ...Option)) {
+	for _, sec := range SecurityIDs {
+		for _, mux := range MuxerIDs {
+			sec, mux := sec, mux
+			t.Run(protoName(sec)+"-"+protoName(mux), func(t *testing.T) {
+				f(t, OptSecurity(sec), OptMuxer(mux))
+			})
+		}
 	}
 }
 
@@ -63,14 +162,21 @@ func GenSwarm(t *testing.T, ctx context.Context, opts ...Option) *swarm.Swarm {
 	// 构造节点的身份 priv/pub key, ID, multiaddr
 	p := tu.RandPeerNetParamsOrFatal(t)
 	// 构建 Peerstore
-	ps := pstoremem.NewPeerstore()
+	ps := cfg.peerstore
+	if ps == nil {
+		ps = pstoremem.NewPeerstore()
+	}
 	ps.AddPubKey(p.ID, p.PubKey)
 	ps.AddPrivKey(p.ID, p.PrivKey)
 	// 构建 swarm 网络
 	s := swarm.NewSwarm(ctx, p.ID, ps, nil)
 
 	// 构建 libp2p 的 Transport 对象
-	tcpTransport := tcp.NewTCPTransport(GenUpgrader(s))
+	upgrader, err := genUpgrader(s, cfg.security, cfg.muxer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpTransport := tcp.NewTCPTransport(upgrader)
 	tcpTransport.DisableReuseport = cfg.disableReuseport
 
 	// 关联 Swarm 和 Transport 对象
@@ -79,6 +185,10 @@ func GenSwarm(t *testing.T, ctx context.Context, opts ...Option) *swarm.Swarm {
 	}
 
 	if !cfg.dialOnly {
+		// 使用预先保留的端口，避免并行的测试进程之间端口冲突，swarm 关闭时释放
+		addr, release := tu.LocalAddressOrFatal(t, "tcp")
+		tu.ReleaseOnClose(s.Process(), release)
+		p.Addr = addr
 		if err := s.Listen(p.Addr); err != nil {
 			t.Fatal(err)
 		}
@@ -88,6 +198,11 @@ func GenSwarm(t *testing.T, ctx context.Context, opts ...Option) *swarm.Swarm {
 	return s
 }
 
+// protoName 取协议 ID 的第一段，例如 "/secio/1.0.0" -> "secio"
+func protoName(id string) string {
+	return strings.SplitN(strings.TrimPrefix(id, "/"), "/", 2)[0]
+}
+
 func DivulgeAddresses(a, b inet.Network) {
 	id := a.LocalPeer()
 	addrs := a.Peerstore().Addrs(id)
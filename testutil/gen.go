@@ -4,19 +4,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"math/rand"
 	"sync"
-	"sync/atomic"
 	"testing"
-	"time"
 
 	ci "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-var generatedPairs int64 = 0
-
 var ZeroLocalTCPAddress ma.Multiaddr
 
 func init() {
@@ -44,12 +39,9 @@ func RandPeerNetParamsOrFatal(t *testing.T) PeerNetParams {
 	return *p
 }
 
+// RandTestKeyPair 从 DefaultKeyPool 中取一个 DefaultKeyType 类型的新密钥，bits 只对 RSA 有效
 func RandTestKeyPair(bits int) (ci.PrivKey, ci.PubKey, error) {
-	seed := time.Now().UnixNano()
-
-	seed += atomic.AddInt64(&generatedPairs, 1) << 32
-	r := rand.New(rand.NewSource(seed))
-	return ci.GenerateKeyPairWithReader(ci.ECDSA, bits, r)
+	return RandTestKeyPairOfType(DefaultKeyType, bits)
 }
 
 var lastPort = struct {
@@ -57,6 +49,8 @@ var lastPort = struct {
 	sync.Mutex
 }{}
 
+// RandLocalTCPAddress 返回一个本进程内不重复的本地 TCP 地址，不保留端口，
+// 只用于不真正监听的地址（例如 mocknet）。需要监听时使用 LocalAddressOrFatal
 func RandLocalTCPAddress() ma.Multiaddr {
 	lastPort.Lock()
 	if lastPort.port == 0 {
@@ -72,13 +66,18 @@ func RandLocalTCPAddress() ma.Multiaddr {
 }
 
 func RandPeerNetParams() (*PeerNetParams, error) {
-	var p PeerNetParams
-	var err error
-	p.Addr = ZeroLocalTCPAddress
-	p.PrivKey, p.PubKey, err = RandTestKeyPair(1024)
+	sk, pk, err := RandTestKeyPair(1024)
 	if err != nil {
 		return nil, err
 	}
+	return newPeerNetParams(sk, pk)
+}
+
+func newPeerNetParams(sk ci.PrivKey, pk ci.PubKey) (*PeerNetParams, error) {
+	var p PeerNetParams
+	var err error
+	p.Addr = ZeroLocalTCPAddress
+	p.PrivKey, p.PubKey = sk, pk
 
 	p.ID, err = peer.IDFromPublicKey(p.PubKey)
 	if err != nil {
@@ -0,0 +1,19 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-host"
+)
+
+// GenHost 构建一个监听在 127.0.0.1 上、端口由系统分配的 host，opts 追加在监听地址之后
+func GenHost(t testing.TB, ctx context.Context, opts ...libp2p.Option) host.Host {
+	opts = append([]libp2p.Option{libp2p.ListenAddrs(ZeroLocalTCPAddress)}, opts...)
+	h, err := libp2p.New(ctx, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
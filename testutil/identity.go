@@ -35,6 +35,32 @@ func RandIdentityOrFatal(t *testing.T) Identity {
 	return &identity{*p}
 }
 
+// RandIdentityOfType 从 DefaultKeyPool 中取一个指定密钥类型的新身份
+func RandIdentityOfType(typ int) (Identity, error) {
+	sk, pk, err := RandTestKeyPairOfType(typ, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPeerNetParams(sk, pk)
+	if err != nil {
+		return nil, err
+	}
+	return &identity{*p}, nil
+}
+
+// IdentityFromSeed 由 (seed, index) 确定性地生成身份，同样的参数总是得到同样的 peer.ID
+func IdentityFromSeed(seed int64, index int, typ int) (Identity, error) {
+	sk, pk, err := KeyPairFromSeed(typ, 2048, seed, index)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPeerNetParams(sk, pk)
+	if err != nil {
+		return nil, err
+	}
+	return &identity{*p}, nil
+}
+
 func (p *identity) ID() peer.ID {
 	return p.PeerNetParams.ID
 }
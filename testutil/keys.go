@@ -0,0 +1,134 @@
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+)
+
+// 测试中默认使用的密钥类型，Ed25519 生成最快，而且可以由种子完全确定
+var DefaultKeyType = ci.Ed25519
+
+// keyReader 由 (seed, index) 派生一个确定性的随机数流
+func keyReader(seed int64, index int) io.Reader {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(seed))
+	binary.BigEndian.PutUint64(buf[8:], uint64(index))
+	sum := sha256.Sum256(buf[:])
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+}
+
+// KeyPairFromSeed 由 (seed, index) 生成一对密钥，bits 只对 RSA 有效。
+//
+// Ed25519 和 secp256k1 的结果完全由 (seed, index) 决定；
+// crypto/rsa 和 crypto/ecdsa 不保证相同的随机数流生成相同的密钥，RSA / ECDSA 只在同一个 KeyPool 内可复现
+func KeyPairFromSeed(typ, bits int, seed int64, index int) (ci.PrivKey, ci.PubKey, error) {
+	r := keyReader(seed, index)
+
+	switch typ {
+	case ci.Ed25519:
+		return ci.GenerateEd25519Key(r)
+	case ci.Secp256k1:
+		// btcec 生成密钥时不使用传入的随机数流，这里直接用派生的 32 字节作为私钥
+		var b [32]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, nil, err
+		}
+		sk, err := ci.UnmarshalSecp256k1PrivateKey(b[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return sk, sk.GetPublic(), nil
+	case ci.RSA, ci.ECDSA:
+		return ci.GenerateKeyPairWithReader(typ, bits, r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type: %d", typ)
+	}
+}
+
+type poolKey struct {
+	typ   int
+	bits  int
+	index int
+}
+
+// KeyPool 缓存由同一个种子生成的密钥，相同的 (类型, 长度, 序号) 只生成一次
+type KeyPool struct {
+	seed int64
+	next int64
+
+	mu   sync.Mutex
+	keys map[poolKey]ci.PrivKey
+}
+
+func NewKeyPool(seed int64) *KeyPool {
+	return &KeyPool{
+		seed: seed,
+		keys: make(map[poolKey]ci.PrivKey),
+	}
+}
+
+// DefaultKeyPool 使用 TestSeed，被 RandTestKeyPair 等函数使用
+var DefaultKeyPool = NewKeyPool(TestSeed)
+
+// Get 返回第 index 个密钥
+func (p *KeyPool) Get(typ, bits, index int) (ci.PrivKey, ci.PubKey, error) {
+	k := poolKey{typ, bits, index}
+
+	p.mu.Lock()
+	sk, ok := p.keys[k]
+	p.mu.Unlock()
+	if ok {
+		return sk, sk.GetPublic(), nil
+	}
+
+	sk, pk, err := KeyPairFromSeed(typ, bits, p.seed, index)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	// 并发生成时以先放进去的为准
+	if cached, ok := p.keys[k]; ok {
+		sk, pk = cached, cached.GetPublic()
+	} else {
+		p.keys[k] = sk
+	}
+	p.mu.Unlock()
+	return sk, pk, nil
+}
+
+// Next 返回一个本进程中还没有分配过的密钥
+func (p *KeyPool) Next(typ, bits int) (ci.PrivKey, ci.PubKey, error) {
+	index := int(atomic.AddInt64(&p.next, 1) - 1)
+	return p.Get(typ, bits, index)
+}
+
+// Warm 预先生成 n 个密钥，适合在 TestMain 中对 RSA 这类生成很慢的密钥使用
+func (p *KeyPool) Warm(typ, bits, n int) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := p.Get(typ, bits, i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// RandTestKeyPairOfType 从 DefaultKeyPool 中取一个新的指定类型的密钥
+func RandTestKeyPairOfType(typ, bits int) (ci.PrivKey, ci.PubKey, error) {
+	return DefaultKeyPool.Next(typ, bits)
+}
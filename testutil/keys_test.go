@@ -0,0 +1,66 @@
+package testutil
+
+import (
+	"testing"
+
+	ci "github.com/libp2p/go-libp2p-crypto"
+)
+
+func TestIdentityFromSeed(t *testing.T) {
+	defer ReportSeed(t)
+
+	for _, typ := range []int{ci.Ed25519, ci.Secp256k1} {
+		a, err := IdentityFromSeed(42, 3, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := IdentityFromSeed(42, 3, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := IdentityFromSeed(42, 4, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a.ID() != b.ID() {
+			t.Errorf("key type %d: same (seed, index) gave %s and %s", typ, a.ID(), b.ID())
+		}
+		if a.ID() == c.ID() {
+			t.Errorf("key type %d: different index gave the same id %s", typ, a.ID())
+		}
+	}
+}
+
+func TestKeyPool(t *testing.T) {
+	defer ReportSeed(t)
+
+	pool := NewKeyPool(TestSeed)
+	if err := pool.Warm(ci.RSA, 1024, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _, err := pool.Get(ci.RSA, 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := pool.Get(ci.RSA, 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Equals(b) {
+		t.Error("pool returned different keys for the same index")
+	}
+
+	x, _, err := pool.Next(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, _, err := pool.Next(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Equals(y) {
+		t.Error("Next returned the same key twice")
+	}
+}
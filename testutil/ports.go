@@ -0,0 +1,212 @@
+package testutil
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	goprocess "github.com/jbenet/goprocess"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// 端口锁文件所在的目录，同一台机器上并行的测试进程通过它避免拿到同一个端口
+var PortLockDir = filepath.Join(os.TempDir(), "libp2p-test-ports")
+
+const maxReserveAttempts = 50
+
+// ReservedPort 是一个已经确认可用、并且加了锁的端口
+type ReservedPort struct {
+	Network string
+	IP      net.IP
+	Port    int
+
+	lockFile string
+	lock     *os.File
+	once     sync.Once
+}
+
+// Multiaddr 返回端口对应的 multiaddr，例如 /ip4/127.0.0.1/tcp/4001
+func (r *ReservedPort) Multiaddr() ma.Multiaddr {
+	ipProto := "ip4"
+	if r.IP.To4() == nil {
+		ipProto = "ip6"
+	}
+	proto := "tcp"
+	if r.Network == "udp" || r.Network == "udp4" || r.Network == "udp6" {
+		proto = "udp"
+	}
+
+	maddr, err := ma.NewMultiaddr(fmt.Sprintf("/%s/%s/%s/%d", ipProto, r.IP, proto, r.Port))
+	if err != nil {
+		panic(err)
+	}
+	return maddr
+}
+
+// release 删除锁文件并释放锁，端口可以再次被分配。
+// 先删除再解锁，之后拿到这把锁的进程会发现文件已经不在目录中
+func (r *ReservedPort) release() {
+	r.once.Do(func() {
+		os.Remove(r.lockFile)
+		r.lock.Close()
+
+		reserved.Lock()
+		delete(reserved.ports, r)
+		reserved.Unlock()
+	})
+}
+
+// 本进程持有的端口，进程退出前由 ReleasePorts 统一释放
+var reserved = struct {
+	sync.Mutex
+	ports map[*ReservedPort]struct{}
+}{ports: make(map[*ReservedPort]struct{})}
+
+// ReservePort 在 ip 上找一个空闲端口并加锁。network 取 tcp/udp（以及 tcp6、udp6 等）。
+//
+// 端口先由系统分配（绑定 0 端口），确认可以绑定之后关闭 socket，再用锁文件防止其他测试进程拿到同一个端口。
+// 不再使用端口时调用返回的 release 删除锁文件，例如 defer release() 或者 ReleaseOnClose
+func ReservePort(network string, ip net.IP) (*ReservedPort, func(), error) {
+	if err := os.MkdirAll(PortLockDir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	for i := 0; i < maxReserveAttempts; i++ {
+		port, err := freePort(network, ip)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lockFile := filepath.Join(PortLockDir, fmt.Sprintf("%s-%d.lock", protoFamily(network), port))
+		lock, ok := tryLock(lockFile)
+		if !ok {
+			continue
+		}
+
+		r := &ReservedPort{
+			Network:  network,
+			IP:       ip,
+			Port:     port,
+			lockFile: lockFile,
+			lock:     lock,
+		}
+		reserved.Lock()
+		reserved.ports[r] = struct{}{}
+		reserved.Unlock()
+		return r, r.release, nil
+	}
+	return nil, nil, fmt.Errorf("failed to reserve a %s port after %d attempts", network, maxReserveAttempts)
+}
+
+// ReleaseOnClose 在 proc 关闭时调用 release，proc 通常是 swarm 或 host.Network() 的 Process
+func ReleaseOnClose(proc goprocess.Process, release func()) {
+	proc.AddChild(goprocess.WithTeardown(func() error {
+		release()
+		return nil
+	}))
+}
+
+// ReleasePorts 释放本进程还持有的所有端口，RunMain 会自动调用
+func ReleasePorts() {
+	reserved.Lock()
+	ports := make([]*ReservedPort, 0, len(reserved.ports))
+	for r := range reserved.ports {
+		ports = append(ports, r)
+	}
+	reserved.Unlock()
+
+	for _, r := range ports {
+		r.release()
+	}
+}
+
+func freePort(network string, ip net.IP) (int, error) {
+	switch protoFamily(network) {
+	case "udp":
+		c, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+		return c.LocalAddr().(*net.UDPAddr).Port, nil
+	default:
+		l, err := net.ListenTCP(network, &net.TCPAddr{IP: ip})
+		if err != nil {
+			return 0, err
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port, nil
+	}
+}
+
+func protoFamily(network string) string {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return "udp"
+	default:
+		return "tcp"
+	}
+}
+
+// tryLock 打开锁文件并加上非阻塞的 flock 排它锁，成功时返回持有锁的文件。
+// 锁随文件描述符存在，持有者退出（包括测试进程崩溃）时由内核释放，不需要判断锁文件是否过期。
+// 加锁之后检查目录中的文件还是同一个：持有者释放时先删除文件再解锁，
+// 这期间打开旧文件的进程会拿到一把已经没有意义的锁
+func tryLock(lockFile string) (*os.File, bool) {
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, false
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			return nil, false
+		}
+
+		if sameFile(f, lockFile) {
+			return f, true
+		}
+		f.Close()
+	}
+	return nil, false
+}
+
+// sameFile 判断打开的 f 是否仍然是目录中的 path
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
+
+// LocalAddress 在本地回环地址上保留一个端口，network 取 tcp、udp、tcp6、udp6。
+// 不再使用端口时调用返回的 release
+func LocalAddress(network string) (ma.Multiaddr, func(), error) {
+	ip := net.IPv4(127, 0, 0, 1)
+	if network == "tcp6" || network == "udp6" {
+		ip = net.IPv6loopback
+	}
+
+	r, release, err := ReservePort(network, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Multiaddr(), release, nil
+}
+
+func LocalAddressOrFatal(t testing.TB, network string) (ma.Multiaddr, func()) {
+	maddr, release, err := LocalAddress(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return maddr, release
+}
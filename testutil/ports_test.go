@@ -0,0 +1,133 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestReservePort(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		seen := make(map[int]bool)
+		for i := 0; i < 10; i++ {
+			r, release, err := ReservePort(network, net.IPv4(127, 0, 0, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			if seen[r.Port] {
+				t.Fatalf("port %d reserved twice", r.Port)
+			}
+			seen[r.Port] = true
+
+			if _, err := os.Stat(r.lockFile); err != nil {
+				t.Fatalf("lock file missing: %s", err)
+			}
+		}
+	}
+}
+
+func TestReservePortLocked(t *testing.T) {
+	r, release, err := ReservePort("tcp", net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// 锁还被持有时不能再拿这个端口
+	if _, ok := tryLock(r.lockFile); ok {
+		t.Fatal("locked port was handed out again")
+	}
+
+	release()
+	if _, err := os.Stat(r.lockFile); !os.IsNotExist(err) {
+		t.Fatal("lock file not removed on release")
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	if err := os.MkdirAll(PortLockDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lockFile := filepath.Join(PortLockDir, "test-stale.lock")
+	defer os.Remove(lockFile)
+
+	// 崩溃的进程留下的锁文件，没有人持有锁，不管内容是什么都可以拿走
+	if err := ioutil.WriteFile(lockFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := tryLock(lockFile)
+	if !ok {
+		t.Fatal("left-over lock file was not taken over")
+	}
+
+	// 持有期间其它进程拿不到
+	helper := func() ([]byte, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperLock$")
+		cmd.Env = append(os.Environ(), "TESTUTIL_LOCK_FILE="+lockFile)
+		return cmd.CombinedOutput()
+	}
+	if out, err := helper(); err == nil {
+		t.Fatalf("another process took a held lock: %s", out)
+	}
+
+	// 持有者退出后锁自动释放
+	f.Close()
+	if out, err := helper(); err != nil {
+		t.Fatalf("lock of a closed file was not released: %s", out)
+	}
+}
+
+// TestHelperLock 在子进程中运行，拿不到锁时失败
+func TestHelperLock(t *testing.T) {
+	lockFile := os.Getenv("TESTUTIL_LOCK_FILE")
+	if lockFile == "" {
+		t.Skip("only run as a helper process")
+	}
+	f, ok := tryLock(lockFile)
+	if !ok {
+		t.Fatal("lock not acquired")
+	}
+	f.Close()
+}
+
+func TestReleasedLockReplaced(t *testing.T) {
+	r, release, err := ReservePort("tcp", net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 在释放之前打开了锁文件的进程，解锁后拿到的是已经删除的文件，不能算持有锁
+	stale, err := os.Open(r.lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stale.Close()
+	release()
+
+	if err := syscall.Flock(int(stale.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatal(err)
+	}
+	if sameFile(stale, r.lockFile) {
+		t.Fatal("removed lock file still considered current")
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	for _, network := range []string{"tcp", "udp", "tcp6", "udp6"} {
+		maddr, _, err := LocalAddress(network)
+		if err != nil {
+			if network == "tcp6" || network == "udp6" {
+				t.Logf("skipping %s: %s", network, err)
+				continue
+			}
+			t.Fatal(err)
+		}
+		t.Log(maddr)
+	}
+	ReleasePorts()
+}
@@ -1,17 +1,55 @@
 package testutil
 
 import (
+	"fmt"
 	"math/rand"
+	"os"
+	"strconv"
+	"testing"
 	"time"
 )
 
+// 设置该环境变量可以用固定的种子重跑测试，例如 LIBP2P_TEST_SEED=1234 go test ./...
+const SeedEnv = "LIBP2P_TEST_SEED"
+
+// TestSeed 是本次测试进程使用的全局种子，SeededRand 和确定性身份都由它派生
+var TestSeed = loadSeed()
+
 var SeededRand *rand.Rand
 
 func init() {
-	SeededRand = NewSeededRand(time.Now().UTC().UnixNano())
+	SeededRand = NewSeededRand(TestSeed)
+}
+
+func loadSeed() int64 {
+	if s := os.Getenv(SeedEnv); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %s: %s", SeedEnv, err))
+		}
+		return seed
+	}
+	return time.Now().UTC().UnixNano()
 }
 
 func NewSeededRand(seed int64) *rand.Rand {
 	src := rand.NewSource(seed)
 	return rand.New(src)
 }
+
+// ReportSeed 在测试失败时输出种子，一般这样使用: defer tu.ReportSeed(t)
+func ReportSeed(t testing.TB) {
+	if t.Failed() {
+		t.Logf("test seed: %d, rerun with %s=%d", TestSeed, SeedEnv, TestSeed)
+	}
+}
+
+// RunMain 用于 TestMain，测试失败时输出种子，退出前释放保留的端口
+func RunMain(m *testing.M) {
+	code := m.Run()
+	ReleasePorts()
+	if code != 0 {
+		fmt.Printf("test seed: %d, rerun with %s=%d \n", TestSeed, SeedEnv, TestSeed)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,98 @@
+package p2ptransport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	tpt "github.com/libp2p/go-libp2p-transport"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const benchChunk = 64 << 10
+
+// BenchmarkStreamThroughput 测量单个 Stream 的单向吞吐量，每次迭代写入 64KiB
+func BenchmarkStreamThroughput(b *testing.B, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer list.Close()
+
+	go func() {
+		c, err := list.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		s, err := c.AcceptStream()
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, s)
+		s.Write([]byte{0})
+		s.Close()
+	}()
+
+	c, err := tb.Dial(context.Background(), list.Multiaddr(), peerA)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	s, err := c.OpenStream()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	chunk := make([]byte, benchChunk)
+	b.SetBytes(benchChunk)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// 等待对端确认收完所有数据
+	if _, err := io.ReadFull(s, make([]byte, 1)); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkDial 测量建立一个完成升级（加密 + 多路复用）的连接所需的时间
+func BenchmarkDial(b *testing.B, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer list.Close()
+
+	go func() {
+		for {
+			c, err := list.Accept()
+			if err != nil {
+				return
+			}
+			// 等拨号方关闭之后再关闭，避免在握手过程中 reset
+			go func() {
+				c.AcceptStream()
+				c.Close()
+			}()
+		}
+	}()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := tb.Dial(ctx, list.Multiaddr(), peerA)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.Close()
+	}
+}
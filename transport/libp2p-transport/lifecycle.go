@@ -0,0 +1,319 @@
+package p2ptransport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	tpt "github.com/libp2p/go-libp2p-transport"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// 等待 Accept/Read 等阻塞操作返回的最长时间
+var blockTimeout = 5 * time.Second
+
+// connPair 在 ta 上监听，由 tb 拨号，返回两端的 Conn
+func connPair(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) (list tpt.Listener, connA, connB tpt.Conn) {
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan tpt.Conn, 1)
+	go func() {
+		c, err := list.Accept()
+		if err != nil {
+			t.Error(err)
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+
+	connA, err = tb.Dial(context.Background(), list.Multiaddr(), peerA)
+	if err != nil {
+		list.Close()
+		t.Fatal(err)
+	}
+
+	select {
+	case connB = <-accepted:
+		if connB == nil {
+			connA.Close()
+			list.Close()
+			t.FailNow()
+		}
+	case <-time.After(blockTimeout):
+		connA.Close()
+		list.Close()
+		t.Fatal("listener never accepted the dialed conn")
+	}
+	return list, connA, connB
+}
+
+func SubtestListenerCloseUnblocksAccept(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		c, err := list.Accept()
+		if err == nil {
+			c.Close()
+		}
+		errCh <- err
+	}()
+
+	// 确保 Accept 已经阻塞
+	time.Sleep(50 * time.Millisecond)
+	if err := list.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("Accept should fail after the listener is closed")
+		}
+		fmt.Printf("Accept returned after Close: %s \n", err)
+	case <-time.After(blockTimeout):
+		t.Fatal("closing the listener did not unblock Accept")
+	}
+}
+
+func SubtestConnCloseResetsStreams(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, connA, connB := connPair(t, ta, tb, maddr, peerA)
+	defer list.Close()
+	defer connB.Close()
+
+	sA, err := connA.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先写一点数据，保证对端能 Accept 到这个 Stream
+	if _, err := sA.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+
+	sB, err := connB.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(sB, make([]byte, len(testData))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 关闭 Conn，两端的 Stream 都必须失效
+	if err := connA.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !connA.IsClosed() {
+		t.Error("conn should report closed after Close")
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(sB)
+		readErr <- err
+	}()
+	select {
+	case <-readErr:
+		// 读到错误或者 EOF 都可以，只要不再阻塞
+	case <-time.After(blockTimeout):
+		t.Fatal("remote stream still blocked after the conn was closed")
+	}
+
+	if _, err := sA.Write(testData); err == nil {
+		t.Error("writing to a stream of a closed conn should fail")
+	}
+	if _, err := connA.OpenStream(); err == nil {
+		t.Error("opening a stream on a closed conn should fail")
+	}
+}
+
+func SubtestConcurrentDials(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	dials := 20
+
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	var serverWg sync.WaitGroup
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		for i := 0; i < dials; i++ {
+			c, err := list.Accept()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			serverWg.Add(1)
+			go func(c tpt.Conn) {
+				defer serverWg.Done()
+				defer c.Close()
+
+				s, err := c.AcceptStream()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer s.Close()
+				io.Copy(s, s)
+			}(c)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < dials; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			c, err := tb.Dial(ctx, list.Multiaddr(), peerA)
+			if err != nil {
+				t.Errorf("dial %d: %s", i, err)
+				return
+			}
+			defer c.Close()
+
+			s, err := c.OpenStream()
+			if err != nil {
+				t.Errorf("dial %d: %s", i, err)
+				return
+			}
+
+			data := []byte(fmt.Sprintf("%s - dial %d", testData, i))
+			if _, err := s.Write(data); err != nil {
+				t.Errorf("dial %d: %s", i, err)
+				return
+			}
+			s.Close()
+
+			ret, err := ioutil.ReadAll(s)
+			if err != nil {
+				t.Errorf("dial %d: %s", i, err)
+				return
+			}
+			if !bytes.Equal(data, ret) {
+				t.Errorf("dial %d: expected %q, got %q", i, data, ret)
+			}
+		}(i)
+	}
+	wg.Wait()
+	serverWg.Wait()
+}
+
+func SubtestDialClosedListener(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, err := ta.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := list.Multiaddr()
+	if err := list.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), blockTimeout)
+	defer cancel()
+
+	c, err := tb.Dial(ctx, addr, peerA)
+	if err == nil {
+		c.Close()
+		t.Fatalf("dialing closed listener %s should fail", addr)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("dial to closed listener hung until the timeout: %s", err)
+	}
+	fmt.Printf("dial closed listener: %s \n", err)
+}
+
+func SubtestMultiaddrs(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, connA, connB := connPair(t, ta, tb, maddr, peerA)
+	defer list.Close()
+	defer connA.Close()
+	defer connB.Close()
+
+	fmt.Printf("A: %s -> %s \n", connA.LocalMultiaddr(), connA.RemoteMultiaddr())
+	fmt.Printf("B: %s -> %s \n", connB.LocalMultiaddr(), connB.RemoteMultiaddr())
+
+	if !connA.RemoteMultiaddr().Equal(list.Multiaddr()) {
+		t.Errorf("dialer's remote addr %s != listener addr %s", connA.RemoteMultiaddr(), list.Multiaddr())
+	}
+	if !connB.LocalMultiaddr().Equal(list.Multiaddr()) {
+		t.Errorf("listener conn's local addr %s != listener addr %s", connB.LocalMultiaddr(), list.Multiaddr())
+	}
+	if !connA.LocalMultiaddr().Equal(connB.RemoteMultiaddr()) {
+		t.Errorf("dialer's local addr %s != listener conn's remote addr %s", connA.LocalMultiaddr(), connB.RemoteMultiaddr())
+	}
+
+	// 对端地址必须能被同一个 Transport 拨号
+	if !tb.CanDial(connA.RemoteMultiaddr()) {
+		t.Errorf("transport cannot dial its own remote addr %s", connA.RemoteMultiaddr())
+	}
+	if !ta.CanDial(connB.RemoteMultiaddr()) {
+		t.Errorf("transport cannot dial its own remote addr %s", connB.RemoteMultiaddr())
+	}
+
+	if connA.Transport() != tb {
+		t.Error("dialed conn should report the dialing transport")
+	}
+	if connB.Transport() != ta {
+		t.Error("accepted conn should report the listening transport")
+	}
+}
+
+func SubtestRemotePeer(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID) {
+	list, connA, connB := connPair(t, ta, tb, maddr, peerA)
+	defer list.Close()
+	defer connA.Close()
+	defer connB.Close()
+
+	if connA.RemotePeer() != peerA {
+		t.Errorf("dialer's remote peer %s != %s", connA.RemotePeer(), peerA)
+	}
+	if connB.LocalPeer() != peerA {
+		t.Errorf("listener's local peer %s != %s", connB.LocalPeer(), peerA)
+	}
+
+	// 不加密的连接（insecure）没有公钥，以下检查只针对加密的连接
+	pkA := connA.RemotePublicKey()
+	if pkA == nil {
+		fmt.Println("insecure conn, skipping public key checks")
+		return
+	}
+	if !peerA.MatchesPublicKey(pkA) {
+		t.Errorf("remote public key does not match %s", peerA)
+	}
+	if connB.RemotePeer() != connA.LocalPeer() {
+		t.Errorf("listener's remote peer %s != dialer %s", connB.RemotePeer(), connA.LocalPeer())
+	}
+
+	pkB := connB.RemotePublicKey()
+	if pkB == nil {
+		t.Fatal("secured conn has no remote public key on the listener side")
+	}
+	if !connA.LocalPeer().MatchesPublicKey(pkB) {
+		t.Errorf("listener saw a public key that does not match %s", connA.LocalPeer())
+	}
+	if !pkB.Equals(connA.LocalPrivateKey().GetPublic()) {
+		t.Error("listener's remote public key != dialer's local key")
+	}
+	if !pkA.Equals(connB.LocalPrivateKey().GetPublic()) {
+		t.Error("dialer's remote public key != listener's local key")
+	}
+}
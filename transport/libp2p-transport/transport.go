@@ -189,6 +189,9 @@ func SubtestPingPong(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pee
 	}
 	defer list.Close()
 
+	// 对方读完所有回复之前不能关闭连接，关闭连接会 reset 还没有读完的 stream
+	clientDone := make(chan struct{})
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -242,6 +245,10 @@ func SubtestPingPong(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pee
 			}()
 		}
 		sWg.Wait()
+		select {
+		case <-clientDone:
+		case <-ctx.Done():
+		}
 	}()
 
 	if !tb.CanDial(list.Multiaddr()) {
@@ -254,6 +261,7 @@ func SubtestPingPong(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pee
 	}
 	defer c.Close()
 
+	var cWg sync.WaitGroup
 	for i := 0; i < streams; i++ {
 		s, err := c.OpenStream()
 		if err != nil {
@@ -261,9 +269,9 @@ func SubtestPingPong(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pee
 			continue
 		}
 
-		wg.Add(1)
+		cWg.Add(1)
 		go func(i int) {
-			defer wg.Done()
+			defer cWg.Done()
 			data := []byte(fmt.Sprintf("%s - %d", testData, i))
 			n, err := s.Write(data)
 			if err != nil {
@@ -292,6 +300,8 @@ func SubtestPingPong(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pee
 			}
 		}(i)
 	}
+	cWg.Wait()
+	close(clientDone)
 	wg.Wait()
 }
 
@@ -15,6 +15,17 @@ var Subtests = []func(t *testing.T, ta, tb tpt.Transport, maddr ma.Multiaddr, pe
 	SubtestBasic,
 	SubtestPingPong,
 	SubtestCancel,
+	SubtestListenerCloseUnblocksAccept,
+	SubtestConnCloseResetsStreams,
+	SubtestConcurrentDials,
+	SubtestDialClosedListener,
+	SubtestMultiaddrs,
+	SubtestRemotePeer,
+}
+
+var Benchmarks = []func(b *testing.B, ta, tb tpt.Transport, maddr ma.Multiaddr, peerA peer.ID){
+	BenchmarkStreamThroughput,
+	BenchmarkDial,
 }
 
 func getFunctionName(i interface{}) string {
@@ -32,3 +43,15 @@ func SubtestTransport(t *testing.T, ta, tb tpt.Transport, addr string, peerA pee
 		})
 	}
 }
+
+func BenchmarkTransport(b *testing.B, ta, tb tpt.Transport, addr string, peerA peer.ID) {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, f := range Benchmarks {
+		b.Run(getFunctionName(f), func(b *testing.B) {
+			f(b, ta, tb, maddr, peerA)
+		})
+	}
+}
@@ -3,14 +3,25 @@ package tcp_transport
 import (
 	"testing"
 
+	noise "github.com/czh0526/libp2p/security/noise"
+	libp2ptls "github.com/czh0526/libp2p/security/tls"
+	tu "github.com/czh0526/libp2p/testutil"
 	p2pt "github.com/czh0526/libp2p/transport/libp2p-transport"
 
+	cs "github.com/libp2p/go-conn-security"
 	insecure "github.com/libp2p/go-conn-security/insecure"
+	ci "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	secio "github.com/libp2p/go-libp2p-secio"
 	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	smux "github.com/libp2p/go-stream-muxer"
 	tcpt "github.com/libp2p/go-tcp-transport"
 	smux_mplex "github.com/whyrusleeping/go-smux-multiplex"
+	smux_yamux "github.com/whyrusleeping/go-smux-yamux"
 )
 
+const zero = "/ip4/127.0.0.1/tcp/0"
+
 func TestTcpTransport(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		ta := tcpt.NewTCPTransport(&tptu.Upgrader{
@@ -22,7 +33,86 @@ func TestTcpTransport(t *testing.T) {
 			Muxer:  new(smux_mplex.Transport),
 		})
 
-		zero := "/ip4/127.0.0.1/tcp/0"
 		p2pt.SubtestTransport(t, ta, tb, zero, "peerA")
 	}
 }
+
+// 使用 secio 加密，检查连接上的 peer ID / 公钥
+func TestTcpTransportSecio(t *testing.T) {
+	ta, idA := makeSecioTransport(t)
+	tb, _ := makeSecioTransport(t)
+
+	p2pt.SubtestTransport(t, ta, tb, zero, idA)
+}
+
+var securities = map[string]func(ci.PrivKey, peer.ID) (cs.Transport, error){
+	"insecure": func(_ ci.PrivKey, id peer.ID) (cs.Transport, error) {
+		return insecure.New(id), nil
+	},
+	"secio": func(sk ci.PrivKey, id peer.ID) (cs.Transport, error) {
+		return &secio.Transport{LocalID: id, PrivateKey: sk}, nil
+	},
+	"noise": func(sk ci.PrivKey, _ peer.ID) (cs.Transport, error) {
+		return noise.New(sk)
+	},
+	"tls": func(sk ci.PrivKey, _ peer.ID) (cs.Transport, error) {
+		return libp2ptls.New(sk)
+	},
+}
+
+var muxers = map[string]smux.Transport{
+	"yamux": smux_yamux.DefaultTransport,
+	"mplex": smux_mplex.DefaultTransport,
+}
+
+// 在每一种 加密 x 多路复用 组合上运行 transport subtests
+func TestTcpTransportMatrix(t *testing.T) {
+	for secName, sec := range securities {
+		for muxName, mux := range muxers {
+			sec, mux := sec, mux
+			t.Run(secName+"-"+muxName, func(t *testing.T) {
+				ta, idA := makeTransport(t, sec, mux)
+				tb, _ := makeTransport(t, sec, mux)
+
+				p2pt.SubtestTransport(t, ta, tb, zero, idA)
+			})
+		}
+	}
+}
+
+func BenchmarkTcpTransport(b *testing.B) {
+	ta := tcpt.NewTCPTransport(&tptu.Upgrader{
+		Secure: insecure.New("peerA"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+	tb := tcpt.NewTCPTransport(&tptu.Upgrader{
+		Secure: insecure.New("peerB"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+
+	p2pt.BenchmarkTransport(b, ta, tb, zero, "peerA")
+}
+
+func makeSecioTransport(t *testing.T) (*tcpt.TcpTransport, peer.ID) {
+	return makeTransport(t, securities["secio"], new(smux_mplex.Transport))
+}
+
+func makeTransport(t *testing.T, newSecurity func(ci.PrivKey, peer.ID) (cs.Transport, error), mux smux.Transport) (*tcpt.TcpTransport, peer.ID) {
+	sk, _, err := tu.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := newSecurity(sk, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tcpt.NewTCPTransport(&tptu.Upgrader{
+		Secure: sec,
+		Muxer:  mux,
+	}), id
+}
@@ -0,0 +1,67 @@
+package ws_transport
+
+import (
+	"testing"
+
+	tu "github.com/czh0526/libp2p/testutil"
+	p2pt "github.com/czh0526/libp2p/transport/libp2p-transport"
+
+	insecure "github.com/libp2p/go-conn-security/insecure"
+	peer "github.com/libp2p/go-libp2p-peer"
+	secio "github.com/libp2p/go-libp2p-secio"
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	ws "github.com/libp2p/go-ws-transport"
+	smux_mplex "github.com/whyrusleeping/go-smux-multiplex"
+)
+
+const zero = "/ip4/127.0.0.1/tcp/0/ws"
+
+func TestWebsocketTransport(t *testing.T) {
+	ta := ws.New(&tptu.Upgrader{
+		Secure: insecure.New("peerA"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+	tb := ws.New(&tptu.Upgrader{
+		Secure: insecure.New("peerB"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+
+	p2pt.SubtestTransport(t, ta, tb, zero, "peerA")
+}
+
+// 使用 secio 加密，检查连接上的 peer ID / 公钥
+func TestWebsocketTransportSecio(t *testing.T) {
+	ta, idA := makeSecioTransport(t)
+	tb, _ := makeSecioTransport(t)
+
+	p2pt.SubtestTransport(t, ta, tb, zero, idA)
+}
+
+func BenchmarkWebsocketTransport(b *testing.B) {
+	ta := ws.New(&tptu.Upgrader{
+		Secure: insecure.New("peerA"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+	tb := ws.New(&tptu.Upgrader{
+		Secure: insecure.New("peerB"),
+		Muxer:  new(smux_mplex.Transport),
+	})
+
+	p2pt.BenchmarkTransport(b, ta, tb, zero, "peerA")
+}
+
+func makeSecioTransport(t *testing.T) (*ws.WebsocketTransport, peer.ID) {
+	sk, _, err := tu.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ws.New(&tptu.Upgrader{
+		Secure: &secio.Transport{LocalID: id, PrivateKey: sk},
+		Muxer:  new(smux_mplex.Transport),
+	}), id
+}